@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// 金額：以 10^-8 為最小單位存為 int64，JSON 編解碼保持精確的十進制值
+type Amount int64
+
+const (
+	amountPlaces = 8
+	amountUnit   = 100000000
+)
+
+// 各幣種的小數位數，未列出的幣種為2位
+var currencyPlaces = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+	"JOD": 3,
+}
+
+func CurrencyPlaces(currency string) int {
+	if places, exists := currencyPlaces[strings.ToUpper(currency)]; exists {
+		return places
+	}
+	return 2
+}
+
+// 解析十進制字符串，超過8位小數或超出範圍時返回錯誤
+func ParseAmount(s string) (Amount, error) {
+	if len(s) > 64 || strings.ContainsAny(s, "/eE") {
+		return 0, fmt.Errorf("無效金額: %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("無效金額: %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt64(amountUnit))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("金額 %s 超過 %d 位小數", s, amountPlaces)
+	}
+	if !r.Num().IsInt64() {
+		return 0, fmt.Errorf("金額 %s 超出範圍", s)
+	}
+	return Amount(r.Num().Int64()), nil
+}
+
+func AmountFromInt(n int64) Amount {
+	return Amount(n * amountUnit)
+}
+
+// 是否符合幣種的小數位數
+func (a Amount) ValidFor(currency string) bool {
+	unit := int64(amountUnit)
+	for i := 0; i < CurrencyPlaces(currency); i++ {
+		unit /= 10
+	}
+	return int64(a)%unit == 0
+}
+
+// 僅用於指標等不要求精確的場合
+func (a Amount) Float64() float64 {
+	return float64(a) / amountUnit
+}
+
+func (a Amount) String() string {
+	sign, n := "", int64(a)
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	s := sign + strconv.FormatInt(n/amountUnit, 10)
+	if frac := n % amountUnit; frac != 0 {
+		s += "." + strings.TrimRight(fmt.Sprintf("%08d", frac), "0")
+	}
+	return s
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// 接受 JSON 數字或帶引號的字符串
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	parsed, err := ParseAmount(string(data))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
@@ -61,22 +61,22 @@ type PaymentConfig struct {
 
 // 數據模型
 type PaymentRequest struct {
-	OrderID     string  `json:"order_id" binding:"required"`
-	UserID      string  `json:"user_id" binding:"required"`
-	Amount      float64 `json:"amount" binding:"required,gt=0"`
-	Currency    string  `json:"currency" binding:"required"`
-	Method      string  `json:"method" binding:"required"`
-	CardNumber  string  `json:"card_number,omitempty"`
-	ExpiryMonth int     `json:"expiry_month,omitempty"`
-	ExpiryYear  int     `json:"expiry_year,omitempty"`
-	CVV         string  `json:"cvv,omitempty"`
+	OrderID     string `json:"order_id" binding:"required"`
+	UserID      string `json:"user_id" binding:"required"`
+	Amount      Amount `json:"amount" binding:"required,gt=0"`
+	Currency    string `json:"currency" binding:"required"`
+	Method      string `json:"method" binding:"required"`
+	CardNumber  string `json:"card_number,omitempty"`
+	ExpiryMonth int    `json:"expiry_month,omitempty"`
+	ExpiryYear  int    `json:"expiry_year,omitempty"`
+	CVV         string `json:"cvv,omitempty"`
 }
 
 type PaymentResponse struct {
 	PaymentID     string    `json:"payment_id"`
 	OrderID       string    `json:"order_id"`
 	Status        string    `json:"status"`
-	Amount        float64   `json:"amount"`
+	Amount        Amount    `json:"amount"`
 	Currency      string    `json:"currency"`
 	TransactionID string    `json:"transaction_id"`
 	ProcessedAt   time.Time `json:"processed_at"`
@@ -84,15 +84,15 @@ type PaymentResponse struct {
 }
 
 type RefundRequest struct {
-	PaymentID string  `json:"payment_id" binding:"required"`
-	Amount    float64 `json:"amount" binding:"required,gt=0"`
-	Reason    string  `json:"reason"`
+	PaymentID string `json:"payment_id" binding:"required"`
+	Amount    Amount `json:"amount" binding:"required,gt=0"`
+	Reason    string `json:"reason"`
 }
 
 type RefundResponse struct {
 	RefundID    string    `json:"refund_id"`
 	PaymentID   string    `json:"payment_id"`
-	Amount      float64   `json:"amount"`
+	Amount      Amount    `json:"amount"`
 	Status      string    `json:"status"`
 	ProcessedAt time.Time `json:"processed_at"`
 }
@@ -244,6 +244,11 @@ func processPayment(c *gin.Context) {
 		return
 	}
 
+	if !req.Amount.ValidFor(req.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s 金額最多 %d 位小數", req.Currency, CurrencyPlaces(req.Currency))})
+		return
+	}
+
 	paymentID := uuid.New().String()
 
 	// 故意記錄敏感支付信息 - 這是嚴重的安全問題
@@ -281,7 +286,7 @@ func processPayment(c *gin.Context) {
 	transactionID := fmt.Sprintf("txn_%s", uuid.New().String()[:8])
 
 	// 簡單的失敗模擬
-	if req.Amount > 50000 {
+	if req.Amount > AmountFromInt(50000) {
 		status = "failed"
 		transactionID = ""
 	} else if rand.Float64() < 0.1 { // 10%隨機失敗率
@@ -306,7 +311,7 @@ func processPayment(c *gin.Context) {
 
 	// 記錄指標
 	paymentsTotal.WithLabelValues(req.Method, status, req.Currency).Inc()
-	paymentAmount.WithLabelValues(req.Currency, req.Method).Observe(req.Amount)
+	paymentAmount.WithLabelValues(req.Currency, req.Method).Observe(req.Amount.Float64())
 
 	// 故意將完整的支付信息存儲到日誌
 	logger.WithFields(logrus.Fields{
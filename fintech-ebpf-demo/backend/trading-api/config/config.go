@@ -8,10 +8,16 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	Security SecurityConfig `mapstructure:"security"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Database    DatabaseConfig    `mapstructure:"database"`
+	Redis       RedisConfig       `mapstructure:"redis"`
+	Security    SecurityConfig    `mapstructure:"security"`
+	Trading     TradingConfig     `mapstructure:"trading"`
+	Storage     StorageConfig     `mapstructure:"storage"`
+	MarketData  MarketDataConfig  `mapstructure:"market_data"`
+	Payment     PaymentConfig     `mapstructure:"payment"`
+	Performance PerformanceConfig `mapstructure:"performance"`
+	Margin      MarginConfig      `mapstructure:"margin"`
 }
 
 type ServerConfig struct {
@@ -45,6 +51,81 @@ type SecurityConfig struct {
 	PrivateKey   string `mapstructure:"private_key"`
 }
 
+type TradingConfig struct {
+	SweepInterval int    `mapstructure:"sweep_interval"` // 掛單重新評估間隔（秒）
+	Calendar      string `mapstructure:"calendar"`       // 默認交易日曆代碼
+	CalendarDir   string `mapstructure:"calendar_dir"`   // 額外交易日曆JSON文件目錄
+	LotMethod     string `mapstructure:"lot_method"`     // 賣單默認的稅批扣減方法：fifo、lifo 或 hifo
+}
+
+// 存儲後端
+const (
+	StorageMemory   = "memory"   // 進程內存儲，用於測試和離線演示
+	StorageRedis    = "redis"    // 全部保存在Redis
+	StoragePostgres = "postgres" // 以Postgres為準，Redis作訂單緩存
+)
+
+type StorageConfig struct {
+	Backend  string `mapstructure:"backend"`
+	Fallback bool   `mapstructure:"fallback"` // Postgres不可達時改用Redis存儲，默認啟動失敗
+}
+
+// 行情來源
+const (
+	MarketDataYahoo     = "yahoo"     // Yahoo Finance，需要外網
+	MarketDataSimulator = "simulator" // 幾何布朗運動模擬行情
+	MarketDataReplay    = "replay"    // 回放CSV歷史數據
+)
+
+type MarketDataConfig struct {
+	Provider         string                           `mapstructure:"provider"`
+	Fallback         bool                             `mapstructure:"fallback"`       // Yahoo不可達時改用模擬行情
+	Seed             int64                            `mapstructure:"seed"`           // 模擬行情隨機種子
+	SimulatorStep    int                              `mapstructure:"simulator_step"` // 模擬價格更新間隔（毫秒）
+	ReplayFile       string                           `mapstructure:"replay_file"`
+	ReplaySpeed      float64                          `mapstructure:"replay_speed"`      // 回放倍速
+	StreamInterval   int                              `mapstructure:"stream_interval"`   // 實時推送的上游輪詢間隔（毫秒）
+	BatchConcurrency int                              `mapstructure:"batch_concurrency"` // 批量報價的最大並發請求數
+	Timeout          int                              `mapstructure:"timeout"`           // 外部行情單次請求超時（毫秒）
+	MaxRetries       int                              `mapstructure:"max_retries"`       // 外部行情失敗後的重試次數
+	RetryBackoff     int                              `mapstructure:"retry_backoff"`     // 首次重試前的等待（毫秒），之後加倍並加入抖動
+	RateLimit        float64                          `mapstructure:"rate_limit"`        // 外部行情每秒最多請求數，0為不限制
+	RateBurst        int                              `mapstructure:"rate_burst"`
+	BreakerThreshold int                              `mapstructure:"breaker_threshold"` // 連續失敗多少次後熔斷
+	BreakerCooldown  int                              `mapstructure:"breaker_cooldown"`  // 熔斷持續時間（秒）
+	Symbols          map[string]SimulatedSymbolConfig `mapstructure:"symbols"`           // 覆蓋模擬股票的默認參數
+}
+
+type SimulatedSymbolConfig struct {
+	Price      float64 `mapstructure:"price"`
+	Drift      float64 `mapstructure:"drift"`      // 年化漂移率
+	Volatility float64 `mapstructure:"volatility"` // 年化波動率
+}
+
+// 出入金經 payment-gateway 處理
+type PaymentConfig struct {
+	GatewayURL    string  `mapstructure:"gateway_url"`
+	Timeout       int     `mapstructure:"timeout"` // 支付網關請求超時（毫秒）
+	Currency      string  `mapstructure:"currency"`
+	MaxDeposit    float64 `mapstructure:"max_deposit"`    // 單筆入金上限
+	MaxWithdrawal float64 `mapstructure:"max_withdrawal"` // 單筆出金上限
+}
+
+// 投資組合績效快照
+type PerformanceConfig struct {
+	SnapshotInterval  int     `mapstructure:"snapshot_interval"`  // 估值快照間隔（秒）
+	Intraday          bool    `mapstructure:"intraday"`           // 交易時段內另存日內快照
+	IntradayRetention int     `mapstructure:"intraday_retention"` // 日內快照保留天數
+	RiskFreeRate      float64 `mapstructure:"risk_free_rate"`     // 年化無風險利率（%），用於夏普比率
+}
+
+// 保證金賬戶的融資計息及追繳
+type MarginConfig struct {
+	MonitorInterval int     `mapstructure:"monitor_interval"`  // 檢查保證金及計息的間隔（秒）
+	InterestRate    float64 `mapstructure:"interest_rate"`     // 融資年利率（%）
+	CallGracePeriod int     `mapstructure:"call_grace_period"` // 追繳發出後補足的期限（小時），逾期強制平倉
+}
+
 var AppConfig *Config
 
 func LoadConfig() error {
@@ -71,6 +152,43 @@ func LoadConfig() error {
 	viper.SetDefault("redis.password", "")
 	viper.SetDefault("redis.db", 0)
 
+	viper.SetDefault("trading.sweep_interval", 10)
+	viper.SetDefault("trading.calendar", "XNYS")
+	viper.SetDefault("trading.lot_method", "fifo")
+
+	viper.SetDefault("storage.backend", StoragePostgres)
+	viper.SetDefault("storage.fallback", false)
+
+	viper.SetDefault("market_data.provider", MarketDataYahoo)
+	viper.SetDefault("market_data.fallback", true)
+	viper.SetDefault("market_data.seed", 42)
+	viper.SetDefault("market_data.simulator_step", 1000)
+	viper.SetDefault("market_data.replay_speed", 1.0)
+	viper.SetDefault("market_data.stream_interval", 1000)
+	viper.SetDefault("market_data.batch_concurrency", 8)
+	viper.SetDefault("market_data.timeout", 2000)
+	viper.SetDefault("market_data.max_retries", 2)
+	viper.SetDefault("market_data.retry_backoff", 200)
+	viper.SetDefault("market_data.rate_limit", 5)
+	viper.SetDefault("market_data.rate_burst", 10)
+	viper.SetDefault("market_data.breaker_threshold", 5)
+	viper.SetDefault("market_data.breaker_cooldown", 30)
+
+	viper.SetDefault("payment.gateway_url", "http://localhost:30082")
+	viper.SetDefault("payment.timeout", 10000)
+	viper.SetDefault("payment.currency", "USD")
+	viper.SetDefault("payment.max_deposit", 50000.0)
+	viper.SetDefault("payment.max_withdrawal", 50000.0)
+
+	viper.SetDefault("performance.snapshot_interval", 300)
+	viper.SetDefault("performance.intraday", false)
+	viper.SetDefault("performance.intraday_retention", 30)
+	viper.SetDefault("performance.risk_free_rate", 0.0)
+
+	viper.SetDefault("margin.monitor_interval", 60)
+	viper.SetDefault("margin.interest_rate", 8.0)
+	viper.SetDefault("margin.call_grace_period", 24)
+
 	// 故意設置弱密碼用於安全演示
 	viper.SetDefault("security.jwt_secret", "weak_secret_123")
 	viper.SetDefault("security.api_key", "super_secret_api_key")
@@ -83,11 +201,29 @@ func LoadConfig() error {
 	viper.BindEnv("server.port", "SERVER_PORT")
 	viper.BindEnv("server.host", "SERVER_HOST")
 	viper.BindEnv("database.host", "DATABASE_HOST")
+	viper.BindEnv("database.port", "DATABASE_PORT")
 	viper.BindEnv("database.user", "DATABASE_USER")
 	viper.BindEnv("database.password", "DATABASE_PASSWORD")
 	viper.BindEnv("database.dbname", "DATABASE_NAME")
+	viper.BindEnv("database.sslmode", "DATABASE_SSLMODE")
 	viper.BindEnv("redis.host", "REDIS_HOST")
 	viper.BindEnv("redis.password", "REDIS_PASSWORD")
+	viper.BindEnv("trading.sweep_interval", "ORDER_SWEEP_INTERVAL")
+	viper.BindEnv("trading.calendar", "TRADING_CALENDAR")
+	viper.BindEnv("trading.calendar_dir", "TRADING_CALENDAR_DIR")
+	viper.BindEnv("trading.lot_method", "TRADING_LOT_METHOD")
+	viper.BindEnv("storage.backend", "STORAGE_BACKEND")
+	viper.BindEnv("storage.fallback", "STORAGE_FALLBACK")
+	viper.BindEnv("market_data.provider", "MARKET_DATA_PROVIDER")
+	viper.BindEnv("market_data.fallback", "MARKET_DATA_FALLBACK")
+	viper.BindEnv("market_data.seed", "MARKET_DATA_SEED")
+	viper.BindEnv("market_data.replay_file", "MARKET_DATA_REPLAY_FILE")
+	viper.BindEnv("payment.gateway_url", "PAYMENT_GATEWAY_URL")
+	viper.BindEnv("performance.snapshot_interval", "PERFORMANCE_SNAPSHOT_INTERVAL")
+	viper.BindEnv("performance.intraday", "PERFORMANCE_INTRADAY")
+	viper.BindEnv("performance.risk_free_rate", "PERFORMANCE_RISK_FREE_RATE")
+	viper.BindEnv("margin.interest_rate", "MARGIN_INTEREST_RATE")
+	viper.BindEnv("margin.call_grace_period", "MARGIN_CALL_GRACE_PERIOD")
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
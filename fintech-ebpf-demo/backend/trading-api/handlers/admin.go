@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"trading-api/config"
+	"trading-api/models"
+)
+
+// 管理接口的認證請求頭，值為 security.admin_token
+const AdminTokenHeader = "X-Admin-Token"
+
+// 管理接口中間件：校驗管理員令牌
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader(AdminTokenHeader)
+		expected := config.AppConfig.Security.AdminToken
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			logger.WithField("user_ip", c.ClientIP()).Warn("管理接口認證失敗")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error:   "UNAUTHORIZED",
+				Code:    401,
+				Message: "需要有效的管理員令牌",
+				Time:    time.Now(),
+			})
+			return
+		}
+		c.Next()
+	}
+}
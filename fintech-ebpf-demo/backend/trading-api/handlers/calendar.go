@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/config"
+	"trading-api/models"
+	"trading-api/services"
+)
+
+// 交易日曆單次最多查詢的年數
+const maxCalendarYears = 5
+
+// 載入交易日曆並選擇默認日曆；載入失敗時仍使用內置的美股日曆
+func initializeCalendars() {
+	calendarService = services.NewCalendarService()
+
+	cfg := config.AppConfig.Trading
+	if cfg.CalendarDir != "" {
+		if err := calendarService.LoadDir(cfg.CalendarDir); err != nil {
+			logger.WithError(err).WithField("dir", cfg.CalendarDir).Warn("載入交易日曆失敗")
+		}
+	}
+	if err := calendarService.SetDefault(cfg.Calendar); err != nil {
+		logger.WithError(err).Warn("使用默認交易日曆 XNYS")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"default":   calendarService.Default().Code,
+		"calendars": calendarService.Codes(),
+	}).Info("交易日曆初始化完成")
+}
+
+// 獲取交易日曆：交易時段、當前開市狀態及指定日期範圍內的休市日和提前收盤日
+// 默認查詢默認交易所當年的日曆
+func GetMarketCalendar(c *gin.Context) {
+	calendar := calendarService.Default()
+	if code := c.Query("exchange"); code != "" {
+		var exists bool
+		if calendar, exists = calendarService.Calendar(code); !exists {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "CALENDAR_NOT_FOUND",
+				Code:    404,
+				Message: fmt.Sprintf("未知的交易所: %s", code),
+				Time:    time.Now(),
+			})
+			return
+		}
+	}
+
+	from, to, err := parseCalendarRange(c, calendar)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_PARAMETER",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	holidays := make([]services.CalendarDay, 0)
+	earlyCloses := make([]services.CalendarDay, 0)
+	for _, day := range calendar.SpecialDays(from, to) {
+		if day.IsHoliday() {
+			holidays = append(holidays, day)
+		} else {
+			earlyCloses = append(earlyCloses, day)
+		}
+	}
+
+	now := time.Now()
+	c.JSON(http.StatusOK, gin.H{
+		"exchange":     calendar.Code,
+		"name":         calendar.Name,
+		"timezone":     calendar.Location.String(),
+		"open":         calendar.OpenTime(),
+		"close":        calendar.CloseTime(),
+		"is_open":      calendar.IsOpen(now),
+		"next_open":    calendar.NextOpen(now).In(calendar.Location),
+		"next_close":   calendar.NextClose(now).In(calendar.Location),
+		"from":         from.Format("2006-01-02"),
+		"to":           to.Format("2006-01-02"),
+		"holidays":     holidays,
+		"early_closes": earlyCloses,
+		"calendars":    calendarService.Codes(),
+		"success":      true,
+	})
+}
+
+// 輔助函數：解析日期範圍（YYYY-MM-DD，交易所當地日期），默認為當年
+func parseCalendarRange(c *gin.Context, calendar *services.TradingCalendar) (time.Time, time.Time, error) {
+	year := time.Now().In(calendar.Location).Year()
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, calendar.Location)
+	to := time.Date(year, time.December, 31, 0, 0, 0, 0, calendar.Location)
+
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = time.ParseInLocation("2006-01-02", value, calendar.Location); err != nil {
+			return from, to, fmt.Errorf("from 必須是 YYYY-MM-DD 格式的日期")
+		}
+		if c.Query("to") == "" {
+			to = from.AddDate(1, 0, -1)
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.ParseInLocation("2006-01-02", value, calendar.Location); err != nil {
+			return from, to, fmt.Errorf("to 必須是 YYYY-MM-DD 格式的日期")
+		}
+	}
+
+	if to.Before(from) {
+		return from, to, fmt.Errorf("from 不能晚於 to")
+	}
+	if to.After(from.AddDate(maxCalendarYears, 0, 0)) {
+		return from, to, fmt.Errorf("單次最多查詢 %d 年", maxCalendarYears)
+	}
+	return from, to, nil
+}
+
+// 輔助函數：休市期間只受理可掛單等待開盤的訂單，需立即成交的訂單直接拒絕
+func checkMarketSession(calendar *services.TradingCalendar, orderType, timeInForce string) *models.ErrorResponse {
+	now := time.Now()
+	if calendar.IsOpen(now) {
+		return nil
+	}
+
+	if orderType == models.OrderTypeMarket || timeInForce == models.TimeInForceIOC || timeInForce == models.TimeInForceFOK {
+		return &models.ErrorResponse{
+			Error:   "MARKET_CLOSED",
+			Code:    400,
+			Message: fmt.Sprintf("%s 休市中，市價單及IOC/FOK訂單須在交易時段提交，下次開盤: %s", calendar.Code, calendar.NextOpen(now).In(calendar.Location).Format("2006-01-02 15:04 MST")),
+			Time:    now,
+		}
+	}
+	return nil
+}
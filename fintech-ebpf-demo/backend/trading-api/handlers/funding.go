@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"trading-api/config"
+	"trading-api/models"
+	"trading-api/services"
+)
+
+// 出入金記錄單次返回的最大數量及默認數量
+const (
+	maxFundingTransfers     = 200
+	defaultFundingTransfers = 50
+)
+
+// 入金：經支付網關收款成功後增加現金
+func Deposit(c *gin.Context) {
+	handleFunding(c, services.FundingDeposit)
+}
+
+// 出金：凍結可用現金，經支付網關付款成功後扣除
+func Withdraw(c *gin.Context) {
+	handleFunding(c, services.FundingWithdrawal)
+}
+
+func handleFunding(c *gin.Context, transferType string) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = "demo_user"
+	}
+
+	var req models.FundingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_REQUEST",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	cfg := config.AppConfig.Payment
+	limit, method := cfg.MaxDeposit, "credit_card"
+	if transferType == services.FundingWithdrawal {
+		limit, method = cfg.MaxWithdrawal, "bank_transfer"
+	}
+	if req.Method != "" {
+		method = req.Method
+	}
+	if !req.Amount.IsCurrencyAmount(cfg.Currency) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_AMOUNT",
+			Code:    400,
+			Message: fmt.Sprintf("%s 金額最多 %d 位小數", cfg.Currency, models.CurrencyPlaces(cfg.Currency)),
+			Time:    time.Now(),
+		})
+		return
+	}
+	// 限額配置無效時拒絕，不放行任意金額
+	if maxAmount, err := models.DecimalFromFloat(limit); limit > 0 && (err != nil || req.Amount > maxAmount) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "AMOUNT_LIMIT_EXCEEDED",
+			Code:    400,
+			Message: fmt.Sprintf("單筆金額不能超過 $%.2f", limit),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var transfer *services.FundingTransfer
+	var err error
+	if transferType == services.FundingDeposit {
+		transfer, err = fundingService.Deposit(ctx, userID, req.Amount, cfg.Currency, method)
+	} else {
+		transfer, err = fundingService.Withdraw(ctx, userID, req.Amount, cfg.Currency, method)
+	}
+	if err != nil {
+		respondFundingError(c, userID, transfer, err)
+		return
+	}
+
+	respondFundingTransfer(c, transfer, services.FundingCompleted)
+}
+
+// 入金退款：退回已完成的入金，需有足夠可用現金
+func ReverseDeposit(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = "demo_user"
+	}
+
+	var req models.FundingReversalRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "INVALID_REQUEST",
+				Code:    400,
+				Message: err.Error(),
+				Time:    time.Now(),
+			})
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "用戶申請退款"
+	}
+
+	transfer, err := fundingService.Reverse(c.Request.Context(), userID, c.Param("id"), req.Reason)
+	if err != nil {
+		respondFundingError(c, userID, transfer, err)
+		return
+	}
+
+	respondFundingTransfer(c, transfer, services.FundingReversed)
+}
+
+// 獲取出入金記錄，按時間倒序
+func GetFundingHistory(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = "demo_user"
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultFundingTransfers)))
+	if err != nil || limit <= 0 {
+		limit = defaultFundingTransfers
+	}
+	if limit > maxFundingTransfers {
+		limit = maxFundingTransfers
+	}
+
+	transfers, err := fundingService.History(c.Request.Context(), userID, limit)
+	if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Error("獲取出入金記錄失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "INTERNAL_ERROR",
+			Code:    500,
+			Message: "獲取出入金記錄失敗",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"transfers": transfers,
+		"count":     len(transfers),
+		"message":   "出入金記錄查詢成功",
+		"success":   true,
+	})
+}
+
+// 未達到預期狀態（支付被拒絕或退款失敗）時返回 402，並附上記錄
+func respondFundingTransfer(c *gin.Context, transfer *services.FundingTransfer, expected string) {
+	if transfer.Status != expected {
+		c.JSON(http.StatusPaymentRequired, map[string]interface{}{
+			"transfer": transfer,
+			"message":  transfer.Message,
+			"success":  false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"transfer": transfer,
+		"message":  "出入金處理成功",
+		"success":  true,
+	})
+}
+
+func respondFundingError(c *gin.Context, userID string, transfer *services.FundingTransfer, err error) {
+	var insufficient *services.InsufficientBalanceError
+	var statusErr *services.HTTPStatusError
+	switch {
+	case errors.As(err, &insufficient):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INSUFFICIENT_FUNDS",
+			Code:    400,
+			Message: fmt.Sprintf("可用現金不足。可用餘額: $%.2f, 需要: $%.2f", insufficient.Available, insufficient.Required),
+			Time:    time.Now(),
+		})
+	case err == services.ErrNotFound:
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "TRANSFER_NOT_FOUND",
+			Code:    404,
+			Message: "出入金記錄不存在",
+			Time:    time.Now(),
+		})
+	case err == services.ErrTransferNotReversible:
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "TRANSFER_NOT_REVERSIBLE",
+			Code:    409,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+	case transfer != nil:
+		// 支付網關出錯，記錄已保存；4xx 為明確拒絕，其餘為結果未知
+		message := "支付網關無響應，處理結果待核對"
+		if errors.As(err, &statusErr) && statusErr.StatusCode < 500 {
+			message = "支付網關拒絕請求"
+		}
+		logger.WithError(err).WithField("transfer_id", transfer.ID).Error("支付網關請求失敗")
+		c.JSON(http.StatusBadGateway, map[string]interface{}{
+			"error":    "PAYMENT_GATEWAY_ERROR",
+			"code":     502,
+			"message":  message,
+			"transfer": transfer,
+			"time":     time.Now(),
+		})
+	default:
+		logger.WithError(err).WithField("user_id", userID).Error("出入金處理失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "INTERNAL_ERROR",
+			Code:    500,
+			Message: "出入金處理失敗",
+			Time:    time.Now(),
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+	"trading-api/services"
+)
+
+// 冪等鍵請求頭
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// 捕獲響應內容以便保存
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotent 冪等中間件：帶 Idempotency-Key 的請求重試時重放首次響應，
+// 同一鍵攜帶不同請求內容時返回衝突錯誤。未帶請求頭時不做處理。
+func Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "INVALID_IDEMPOTENCY_KEY",
+				Code:    400,
+				Message: "Idempotency-Key 長度不能超過255個字符",
+				Time:    time.Now(),
+			})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "INVALID_REQUEST",
+				Code:    400,
+				Message: "讀取請求內容失敗",
+				Time:    time.Now(),
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// 冪等鍵按用戶隔離，指紋覆蓋方法、路徑及請求內容
+		scope := c.GetHeader("X-User-ID")
+		fingerprint := requestFingerprint(c.Request.Method, c.Request.URL.Path, body)
+
+		existing, acquired, err := idempotencyService.Begin(scope, key, fingerprint)
+		if err != nil {
+			logger.WithError(err).WithField("idempotency_key", key).Error("冪等鍵檢查失敗")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, models.ErrorResponse{
+				Error:   "IDEMPOTENCY_UNAVAILABLE",
+				Code:    503,
+				Message: "暫時無法處理冪等請求，請稍後重試",
+				Time:    time.Now(),
+			})
+			return
+		}
+
+		if !acquired {
+			replayIdempotent(c, key, fingerprint, existing)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// 服務端錯誤不保存，允許客戶端以同一鍵重試
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			if err := idempotencyService.Release(scope, key); err != nil {
+				logger.WithError(err).WithField("idempotency_key", key).Warn("釋放冪等鍵失敗")
+			}
+			return
+		}
+
+		contentType := recorder.Header().Get("Content-Type")
+		if err := idempotencyService.Complete(scope, key, fingerprint, status, contentType, recorder.body.Bytes()); err != nil {
+			logger.WithError(err).WithField("idempotency_key", key).Error("保存冪等響應失敗")
+		}
+	}
+}
+
+// 處理重複的冪等請求
+func replayIdempotent(c *gin.Context, key, fingerprint string, record *services.IdempotencyRecord) {
+	if record.Fingerprint != fingerprint {
+		c.AbortWithStatusJSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "IDEMPOTENCY_KEY_CONFLICT",
+			Code:    409,
+			Message: "Idempotency-Key 已用於內容不同的請求",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	if record.Status != services.IdempotencyCompleted {
+		c.AbortWithStatusJSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "IDEMPOTENCY_REQUEST_IN_PROGRESS",
+			Code:    409,
+			Message: "相同 Idempotency-Key 的請求正在處理中",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"idempotency_key": key,
+		"path":            c.Request.URL.Path,
+		"user_ip":         c.ClientIP(),
+	}).Info("重放冪等請求響應")
+
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Data(record.StatusCode, record.ContentType, record.Body)
+	c.Abort()
+}
+
+func requestFingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(path))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
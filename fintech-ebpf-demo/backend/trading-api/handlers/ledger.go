@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+	"trading-api/services"
+)
+
+// 分錄列表單次返回的最大數量及默認數量
+const (
+	maxLedgerEntries     = 500
+	defaultLedgerEntries = 100
+)
+
+// 獲取分錄及賬戶餘額；account 可過濾賬戶，如 cash、securities 或 securities:AAPL
+func GetLedger(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = "demo_user"
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLedgerEntries)))
+	if err != nil || limit <= 0 {
+		limit = defaultLedgerEntries
+	}
+	if limit > maxLedgerEntries {
+		limit = maxLedgerEntries
+	}
+
+	ctx := c.Request.Context()
+	entries, err := ledgerService.Entries(ctx, userID, c.Query("account"), limit)
+	if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Error("獲取分錄失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "INTERNAL_ERROR",
+			Code:    500,
+			Message: "獲取分錄失敗",
+			Time:    time.Now(),
+		})
+		return
+	}
+	balances, err := ledgerService.Balances(ctx, userID)
+	if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Error("匯總賬戶餘額失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "INTERNAL_ERROR",
+			Code:    500,
+			Message: "匯總賬戶餘額失敗",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"entries":  entries,
+		"balances": balances,
+		"count":    len(entries),
+		"message":  "賬本查詢成功",
+		"success":  true,
+	})
+}
+
+// 核對投資組合的現金及持倉是否與賬本一致
+func ReconcileLedger(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = "demo_user"
+	}
+
+	portfolio, err := tradingHistoryService.GetPortfolio(userID)
+	if err == services.ErrNotFound {
+		// 未交易過的用戶沒有投資組合，亦沒有分錄
+		portfolio = &services.Portfolio{UserID: userID, Positions: make(map[string]*services.Position)}
+	} else if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Error("獲取投資組合失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "INTERNAL_ERROR",
+			Code:    500,
+			Message: "獲取投資組合失敗",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	result, err := ledgerService.Reconcile(c.Request.Context(), portfolio)
+	if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Error("對賬失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "INTERNAL_ERROR",
+			Code:    500,
+			Message: "對賬失敗",
+			Time:    time.Now(),
+		})
+		return
+	}
+	if !result.Reconciled {
+		logger.WithFields(logrus.Fields{
+			"user_id":     userID,
+			"balanced":    result.Balanced,
+			"differences": result.Differences,
+		}).Warn("投資組合與賬本不一致")
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"reconciliation": result,
+		"message":        "對賬完成",
+		"success":        true,
+	})
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+	"trading-api/services"
+)
+
+// 未配置或配置無效時使用的保證金巡檢間隔
+const defaultMarginInterval = time.Minute
+
+// 追繳記錄單次返回的最大數量及默認數量
+const (
+	maxMarginCalls     = 100
+	defaultMarginCalls = 20
+)
+
+// 保證金巡檢器：定時計提融資利息、發出保證金追繳並對逾期賬戶強制平倉
+type MarginMonitor struct {
+	interval time.Duration
+}
+
+func newMarginMonitor(interval time.Duration) *MarginMonitor {
+	if interval <= 0 {
+		interval = defaultMarginInterval
+	}
+	return &MarginMonitor{interval: interval}
+}
+
+func (m *MarginMonitor) run() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	logger.WithField("interval", m.interval.String()).Info("保證金巡檢器已啟動")
+
+	for now := range ticker.C {
+		ctx := context.Background()
+		marginService.AccrueInterest(ctx, now)
+		for _, liquidation := range marginService.CheckMarginCalls(ctx, now) {
+			m.liquidate(ctx, liquidation, now)
+		}
+	}
+}
+
+// 強制平倉：先撤銷用戶所有未完成訂單釋放預留，再按計劃以市價IOC單平倉；休市的股票留待下一次巡檢
+func (m *MarginMonitor) liquidate(ctx context.Context, liquidation *services.Liquidation, now time.Time) {
+	userID := liquidation.Call.UserID
+	cancelOpenOrders(ctx, userID)
+
+	orderIDs := make([]string, 0, len(liquidation.Orders))
+	for _, planned := range liquidation.Orders {
+		security, err := securityService.Get(ctx, planned.Symbol)
+		if err != nil || !security.IsTradable() || !securityCalendar(security).IsOpen(now) {
+			continue
+		}
+		marketQuote, errResp := orderQuote(ctx, planned.Symbol)
+		if errResp != nil {
+			continue
+		}
+
+		order := &models.Order{
+			ID:           uuid.New().String(),
+			UserID:       userID,
+			Symbol:       planned.Symbol,
+			Side:         planned.Side,
+			OrderType:    models.OrderTypeMarket,
+			Quantity:     planned.Quantity,
+			Status:       models.OrderStatusNew,
+			RemainingQty: planned.Quantity,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+			TimeInForce:  models.TimeInForceIOC,
+			Liquidation:  true,
+		}
+		settleExecution(matchingEngine.Submit(order, marketQuote), marketQuote)
+		orderIDs = append(orderIDs, order.ID)
+
+		logger.WithFields(logrus.Fields{
+			"user_id":    userID,
+			"call_id":    liquidation.Call.ID,
+			"order_id":   order.ID,
+			"symbol":     order.Symbol,
+			"side":       order.Side,
+			"quantity":   order.Quantity,
+			"filled_qty": order.FilledQty,
+		}).Warn("保證金追繳逾期，已強制平倉")
+	}
+
+	if len(orderIDs) == 0 {
+		return
+	}
+	if err := marginService.CompleteLiquidation(ctx, liquidation.Call, orderIDs); err != nil {
+		logger.WithError(err).WithField("user_id", userID).Error("保存強制平倉記錄失敗")
+	}
+}
+
+// 輔助函數：撤銷用戶所有未完成及等待生效的訂單
+func cancelOpenOrders(ctx context.Context, userID string) {
+	query := services.OrderQuery{
+		UserID:   userID,
+		Statuses: []string{models.OrderStatusNew, models.OrderStatusPartiallyFilled, models.OrderStatusHeld},
+	}
+	orders := make([]*models.Order, 0)
+	for {
+		page, err := orderStore.ListUserOrders(ctx, query)
+		if err != nil {
+			logger.WithError(err).WithField("user_id", userID).Error("讀取未完成訂單失敗")
+			return
+		}
+		orders = append(orders, page.Orders...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	for _, order := range orders {
+		cancelGroupOrder(order, "margin_liquidation")
+		if order.GroupID != "" {
+			cascadeGroupCancel(order)
+		}
+	}
+}
+
+// 獲取保證金狀況及當前追繳
+func GetMarginStatus(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = "demo_user"
+	}
+
+	portfolio, err := tradingHistoryService.GetPortfolio(userID)
+	if err == services.ErrNotFound {
+		portfolio = services.NewPortfolio(userID)
+	} else if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Error("獲取投資組合失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "INTERNAL_ERROR",
+			Code:    500,
+			Message: "獲取投資組合失敗",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	holds, err := reservationService.Summary(userID)
+	if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Warn("獲取預留匯總失敗")
+		holds = nil
+	}
+
+	ctx := c.Request.Context()
+	status, err := marginService.Status(ctx, portfolio, holds)
+	if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Error("計算保證金失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "INTERNAL_ERROR",
+			Code:    500,
+			Message: "計算保證金失敗",
+			Time:    time.Now(),
+		})
+		return
+	}
+	call, err := marginService.Call(ctx, userID)
+	if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Warn("讀取保證金追繳失敗")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"margin":  status,
+		"call":    call,
+		"message": "保證金查詢成功",
+		"success": true,
+	})
+}
+
+// 切換現金賬戶或保證金賬戶；存在空頭持倉或融資借款時不能轉為現金賬戶
+func SetAccountType(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = "demo_user"
+	}
+
+	var req struct {
+		AccountType string `json:"account_type" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_REQUEST",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
+	if req.AccountType != services.AccountTypeCash && req.AccountType != services.AccountTypeMargin {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_ACCOUNT_TYPE",
+			Code:    400,
+			Message: "account_type 只支持 cash 或 margin",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	err := marginService.SetAccountType(c.Request.Context(), userID, req.AccountType)
+	if err == services.ErrMarginInUse {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "MARGIN_IN_USE",
+			Code:    409,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
+	if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Error("切換賬戶類型失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "INTERNAL_ERROR",
+			Code:    500,
+			Message: "切換賬戶類型失敗",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"user_id":      userID,
+		"account_type": req.AccountType,
+	}).Info("賬戶類型已切換")
+
+	c.JSON(http.StatusOK, gin.H{
+		"accountType": req.AccountType,
+		"message":     "賬戶類型已切換",
+		"success":     true,
+	})
+}
+
+// 獲取已結束的保證金追繳記錄，由新到舊
+func GetMarginCalls(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = "demo_user"
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultMarginCalls)))
+	if err != nil || limit <= 0 {
+		limit = defaultMarginCalls
+	}
+	if limit > maxMarginCalls {
+		limit = maxMarginCalls
+	}
+
+	ctx := c.Request.Context()
+	calls, err := marginService.CallHistory(ctx, userID, limit)
+	if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Error("獲取保證金追繳記錄失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "INTERNAL_ERROR",
+			Code:    500,
+			Message: "獲取保證金追繳記錄失敗",
+			Time:    time.Now(),
+		})
+		return
+	}
+	current, err := marginService.Call(ctx, userID)
+	if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Warn("讀取保證金追繳失敗")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"current": current,
+		"calls":   calls,
+		"count":   len(calls),
+		"success": true,
+	})
+}
+
+// 獲取股票的可借券數量
+func GetBorrowAvailability(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
+
+	availability, err := marginService.BorrowAvailability(c.Request.Context(), symbol)
+	if err == services.ErrNotFound {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "SECURITY_NOT_FOUND",
+			Code:    404,
+			Message: "證券不存在",
+			Time:    time.Now(),
+		})
+		return
+	}
+	if err != nil {
+		logger.WithError(err).WithField("symbol", symbol).Error("獲取可借券數量失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "INTERNAL_ERROR",
+			Code:    500,
+			Message: "獲取可借券數量失敗",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"borrow":  availability,
+		"success": true,
+	})
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"trading-api/config"
+	"trading-api/models"
+	"trading-api/services"
+)
+
+// Yahoo不可達後改用模擬行情的時長，之後再嘗試Yahoo
+const quoteFallbackRetry = time.Minute
+
+// 按配置選擇行情來源；回放文件無法載入時改用模擬行情
+func initializeQuoteProvider() services.QuoteProvider {
+	cfg := config.AppConfig.MarketData
+
+	symbols := make(map[string]services.SimulatedSymbol, len(cfg.Symbols))
+	for symbol, params := range cfg.Symbols {
+		symbols[symbol] = services.SimulatedSymbol{
+			Price:      params.Price,
+			Drift:      params.Drift,
+			Volatility: params.Volatility,
+		}
+	}
+	simulator := services.NewSimulatedQuoteProvider(cfg.Seed, time.Duration(cfg.SimulatorStep)*time.Millisecond, symbols)
+
+	switch provider := cfg.Provider; provider {
+	case config.MarketDataSimulator:
+		logger.WithField("seed", cfg.Seed).Info("使用模擬行情")
+		return simulator
+
+	case config.MarketDataReplay:
+		replay, err := services.NewReplayQuoteProvider(cfg.ReplayFile, cfg.ReplaySpeed)
+		if err == nil {
+			logger.WithField("file", cfg.ReplayFile).Info("使用回放行情")
+			return replay
+		}
+		logger.WithError(err).Warn("載入回放行情失敗，改用模擬行情")
+		return simulator
+
+	case config.MarketDataYahoo:
+
+	default:
+		logger.WithField("provider", provider).Warn("未知的行情來源，改用Yahoo Finance")
+	}
+
+	// 外部行情來源加上超時、重試、限流及熔斷保護
+	yahoo := services.NewResilientQuoteProvider(logger, services.NewYahooQuoteProvider(logger), services.ResilienceOptions{
+		Timeout:          time.Duration(cfg.Timeout) * time.Millisecond,
+		MaxRetries:       cfg.MaxRetries,
+		RetryBackoff:     time.Duration(cfg.RetryBackoff) * time.Millisecond,
+		RateLimit:        cfg.RateLimit,
+		RateBurst:        cfg.RateBurst,
+		BreakerThreshold: cfg.BreakerThreshold,
+		BreakerCooldown:  time.Duration(cfg.BreakerCooldown) * time.Second,
+	})
+	quoteResilience = yahoo
+	if !cfg.Fallback {
+		return yahoo
+	}
+	return services.NewFallbackQuoteProvider(logger, yahoo, simulator, quoteFallbackRetry)
+}
+
+// 輔助函數：讀取用於下單的市價；行情來源不可用而只有過期報價時拒絕
+func orderQuote(ctx context.Context, symbol string) (*services.StockQuote, *models.ErrorResponse) {
+	quote, err := marketDataService.GetStockQuote(ctx, symbol)
+	if err != nil {
+		logger.WithError(err).WithField("symbol", symbol).Error("獲取股價失敗")
+		return nil, &models.ErrorResponse{
+			Error:   "MARKET_DATA_ERROR",
+			Code:    500,
+			Message: "無法獲取股票市價，請稍後重試",
+			Time:    time.Now(),
+		}
+	}
+	if quote.Stale {
+		return nil, &models.ErrorResponse{
+			Error:   "MARKET_DATA_STALE",
+			Code:    503,
+			Message: fmt.Sprintf("行情來源暫時不可用，%s 只有過期報價，請稍後重試", symbol),
+			Time:    time.Now(),
+		}
+	}
+	return quote, nil
+}
+
+// 獲取歷史K線
+func GetCandles(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
+
+	interval, from, to, err := parseCandleQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_PARAMETER",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	candles, err := candleService.GetCandles(context.Background(), symbol, interval, from, to)
+	if err != nil {
+		logger.WithError(err).WithField("symbol", symbol).Error("獲取K線失敗")
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "CANDLES_NOT_FOUND",
+			Code:    404,
+			Message: fmt.Sprintf("無法獲取 %s 的K線數據", symbol),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"symbol":   symbol,
+		"interval": interval.Name,
+		"from":     from,
+		"to":       to,
+		"candles":  candles,
+		"count":    len(candles),
+		"success":  true,
+	})
+}
+
+// 輔助函數：解析K線週期及時間範圍，to 默認為當前時間，from 默認按週期取最近一段
+func parseCandleQuery(c *gin.Context) (*services.CandleInterval, time.Time, time.Time, error) {
+	var from, to time.Time
+
+	interval, ok := services.ParseCandleInterval(c.DefaultQuery("interval", "1d"))
+	if !ok {
+		return nil, from, to, fmt.Errorf("interval 只支持 1m、5m、1h 或 1d")
+	}
+
+	to = time.Now()
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, from, to, fmt.Errorf("to 必須是RFC3339格式的時間")
+		}
+		to = parsed
+	}
+	from = to.Add(-interval.DefaultRange)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, from, to, fmt.Errorf("from 必須是RFC3339格式的時間")
+		}
+		from = parsed
+	}
+
+	if !from.Before(to) {
+		return nil, from, to, fmt.Errorf("from 必須早於 to")
+	}
+	if to.Sub(from) > interval.MaxRange {
+		return nil, from, to, fmt.Errorf("%s K線單次最多查詢 %d 天", interval.Name, int(interval.MaxRange.Hours()/24))
+	}
+	return interval, from, to, nil
+}
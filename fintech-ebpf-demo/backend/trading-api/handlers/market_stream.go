@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"trading-api/models"
+	"trading-api/services"
+)
+
+const (
+	streamMaxSymbols      = 50                     // 單個連接最多訂閱的股票數
+	defaultStreamThrottle = 250 * time.Millisecond // 兩次推送的最小間隔
+	minStreamThrottle     = 100 * time.Millisecond
+	maxStreamThrottle     = 10 * time.Second
+	streamPingInterval    = 30 * time.Second
+	streamWriteTimeout    = 10 * time.Second
+)
+
+var symbolPattern = regexp.MustCompile(`^[A-Z0-9.\-]{1,10}$`)
+
+// SSE連接無法反向發送消息，訂閱變更經 POST /market/stream/:id 提交
+var sseStreams sync.Map // stream_id -> *services.QuoteSubscription
+
+// 客戶端訂閱指令
+type streamCommand struct {
+	Action  string   `json:"action"` // subscribe 或 unsubscribe
+	Symbols []string `json:"symbols"`
+}
+
+// 實時報價推送：WebSocket 連接雙向收發訂閱指令，普通請求以SSE推送
+// 可通過 symbols 參數指定初始訂閱，throttle_ms 指定最小推送間隔
+func StreamQuotes(c *gin.Context) {
+	throttle, err := parseStreamThrottle(c.Query("throttle_ms"))
+	var symbols []string
+	if err == nil {
+		symbols, err = parseStreamSymbols(splitSymbols(c.Query("symbols")))
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_PARAMETER",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	sub := quoteHub.Subscribe()
+	defer sub.Close()
+	sub.Add(symbols...)
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		streamQuotesWebSocket(c, sub, throttle)
+		return
+	}
+	streamQuotesSSE(c, sub, throttle)
+}
+
+// 更新SSE連接的訂閱
+func UpdateQuoteStream(c *gin.Context) {
+	value, exists := sseStreams.Load(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "STREAM_NOT_FOUND",
+			Code:    404,
+			Message: "推送連接不存在或已斷開",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	var cmd streamCommand
+	if err := c.ShouldBindJSON(&cmd); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_REQUEST",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	sub := value.(*services.QuoteSubscription)
+	if err := applyStreamCommand(sub, cmd); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_PARAMETER",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"symbols": sub.Symbols(),
+		"success": true,
+	})
+}
+
+func streamQuotesWebSocket(c *gin.Context, sub *services.QuoteSubscription, throttle time.Duration) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		logger.WithError(err).Warn("行情推送WebSocket升級失敗")
+		return
+	}
+	defer conn.Close()
+
+	// 讀取訂閱指令；連接只允許一個寫入者，回覆交給寫循環發送
+	replies := make(chan gin.H, 8)
+	done := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(2 * streamPingInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * streamPingInterval))
+	})
+	go func() {
+		defer close(done)
+		for {
+			var cmd streamCommand
+			err := conn.ReadJSON(&cmd)
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				err = errors.New("指令格式錯誤")
+			} else if err != nil {
+				return
+			} else {
+				err = applyStreamCommand(sub, cmd)
+			}
+
+			reply := gin.H{"type": "subscribed", "symbols": sub.Symbols()}
+			if err != nil {
+				reply = gin.H{"type": "error", "message": err.Error()}
+			}
+			select {
+			case replies <- reply:
+			default:
+			}
+		}
+	}()
+
+	send := func(message interface{}) error {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		return conn.WriteJSON(message)
+	}
+
+	err = send(gin.H{
+		"type":        "welcome",
+		"message":     "已連接到實時行情推送",
+		"symbols":     sub.Symbols(),
+		"throttle_ms": throttle.Milliseconds(),
+	})
+	if err != nil {
+		return
+	}
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	var lastSent time.Time
+	for {
+		select {
+		case <-done:
+			return
+
+		case reply := <-replies:
+			err = send(reply)
+
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout))
+
+		case <-sub.Ready():
+			if !waitStreamThrottle(lastSent, throttle, done) {
+				return
+			}
+			quotes, dropped := sub.Drain()
+			if len(quotes) == 0 {
+				continue
+			}
+			err = send(gin.H{"type": "quotes", "quotes": quotes, "dropped": dropped})
+			lastSent = time.Now()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func streamQuotesSSE(c *gin.Context, sub *services.QuoteSubscription, throttle time.Duration) {
+	streamID := uuid.New().String()
+	sseStreams.Store(streamID, sub)
+	defer sseStreams.Delete(streamID)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.SSEvent("welcome", gin.H{
+		"stream_id":   streamID,
+		"message":     "已連接到實時行情推送",
+		"symbols":     sub.Symbols(),
+		"throttle_ms": throttle.Milliseconds(),
+	})
+	c.Writer.Flush()
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	done := c.Request.Context().Done()
+	var lastSent time.Time
+	for {
+		select {
+		case <-done:
+			return
+
+		case <-ping.C:
+			// SSE註釋行，保持代理連接
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+
+		case <-sub.Ready():
+			if !waitStreamThrottle(lastSent, throttle, done) {
+				return
+			}
+			quotes, dropped := sub.Drain()
+			if len(quotes) == 0 {
+				continue
+			}
+			c.SSEvent("quotes", gin.H{"quotes": quotes, "dropped": dropped})
+			lastSent = time.Now()
+		}
+		c.Writer.Flush()
+	}
+}
+
+// 距上次推送不足 throttle 時等待，期間到達的報價會被合併；連接關閉時返回 false
+func waitStreamThrottle(lastSent time.Time, throttle time.Duration, done <-chan struct{}) bool {
+	wait := time.Until(lastSent.Add(throttle))
+	if wait <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// 輔助函數：執行訂閱或取消訂閱
+func applyStreamCommand(sub *services.QuoteSubscription, cmd streamCommand) error {
+	symbols, err := parseStreamSymbols(cmd.Symbols)
+	if err != nil {
+		return err
+	}
+
+	switch cmd.Action {
+	case "subscribe":
+		if len(sub.Symbols())+len(symbols) > streamMaxSymbols {
+			return fmt.Errorf("單個連接最多訂閱 %d 個股票", streamMaxSymbols)
+		}
+		sub.Add(symbols...)
+	case "unsubscribe":
+		sub.Remove(symbols...)
+	default:
+		return fmt.Errorf("不支持的指令: %s", cmd.Action)
+	}
+	return nil
+}
+
+func splitSymbols(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func parseStreamSymbols(values []string) ([]string, error) {
+	if len(values) > streamMaxSymbols {
+		return nil, fmt.Errorf("單個連接最多訂閱 %d 個股票", streamMaxSymbols)
+	}
+	return normalizeSymbols(values)
+}
+
+// 輔助函數：規範化並校驗股票代碼
+func normalizeSymbols(values []string) ([]string, error) {
+	symbols := make([]string, 0, len(values))
+	for _, value := range values {
+		symbol := strings.ToUpper(strings.TrimSpace(value))
+		if !symbolPattern.MatchString(symbol) {
+			return nil, fmt.Errorf("無效的股票代碼: %q", value)
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols, nil
+}
+
+func parseStreamThrottle(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultStreamThrottle, nil
+	}
+	ms, err := strconv.Atoi(value)
+	throttle := time.Duration(ms) * time.Millisecond
+	if err != nil || throttle < minStreamThrottle || throttle > maxStreamThrottle {
+		return 0, fmt.Errorf("throttle_ms 必須在%d-%d之間", minStreamThrottle.Milliseconds(), maxStreamThrottle.Milliseconds())
+	}
+	return throttle, nil
+}
@@ -0,0 +1,590 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+	"trading-api/services"
+)
+
+// 創建括號訂單：入場單成交後啟用止盈及止損子訂單，兩者互為OCO
+func CreateBracketOrder(c *gin.Context) {
+	var req models.BracketOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.WithError(err).Error("無效的括號訂單請求")
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_REQUEST",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = "user_" + uuid.New().String()[:8]
+	}
+
+	entry, errResp := newOrderFromRequest(req.Entry, userID)
+	if errResp != nil {
+		c.JSON(http.StatusBadRequest, errResp)
+		return
+	}
+
+	// 買入入場的止盈價須高於止損價，賣出入場則相反
+	if (entry.Side == "buy" && req.TakeProfitPrice <= req.StopLossPrice) ||
+		(entry.Side == "sell" && req.TakeProfitPrice >= req.StopLossPrice) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_BRACKET_PRICES",
+			Code:    400,
+			Message: fmt.Sprintf("止盈價 %.2f 與止損價 %.2f 方向不符", req.TakeProfitPrice, req.StopLossPrice),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	// 子訂單方向與入場單相反，入場成交前保持 held 狀態
+	exitSide := "sell"
+	if entry.Side == "sell" {
+		exitSide = "buy"
+	}
+	takeProfit := newChildOrder(entry, exitSide, models.OrderTypeLimit)
+	takeProfit.Price = req.TakeProfitPrice
+
+	stopLoss := newChildOrder(entry, exitSide, models.OrderTypeStop)
+	stopLoss.Price = req.StopLossPrice
+	if req.StopLossLimitPrice > 0 {
+		stopLoss.OrderType = models.OrderTypeStopLimit
+		stopLoss.StopPrice = req.StopLossPrice
+		stopLoss.Price = req.StopLossLimitPrice
+	}
+	takeProfit.OCOOrderIDs = []string{stopLoss.ID}
+	stopLoss.OCOOrderIDs = []string{takeProfit.ID}
+
+	// 止盈、止損價與入場單一樣須符合價格上限及最小價格變動
+	security, errResp := lookupTradableSecurity(entry.Symbol)
+	if errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
+	}
+	for _, child := range []*models.Order{takeProfit, stopLoss} {
+		if err := validateOrderPricing(child); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "INVALID_ORDER_PRICE",
+				Code:    400,
+				Message: err.Error(),
+				Time:    time.Now(),
+			})
+			return
+		}
+		if code, err := checkOrderIncrements(security, child); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   code,
+				Code:    400,
+				Message: err.Error(),
+				Time:    time.Now(),
+			})
+			return
+		}
+	}
+
+	marketQuote, errResp := orderQuote(c.Request.Context(), entry.Symbol)
+	if errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
+	}
+
+	if errResp := reserveBalances(entry, marketQuote); errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
+	}
+
+	riskResult := checkRiskLimits(entry, marketQuote)
+	if !riskResult.Approved {
+		releaseReservation(entry)
+		entry.TransitionTo(models.OrderStatusRejected)
+		c.JSON(http.StatusBadRequest, models.OrderResponse{
+			Order:   entry,
+			Message: fmt.Sprintf("訂單被風險控制拒絕: %s", strings.Join(riskResult.Reasons, ", ")),
+			Success: false,
+		})
+		return
+	}
+
+	group := &models.OrderGroup{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		Type:          models.OrderGroupBracket,
+		Symbol:        entry.Symbol,
+		Status:        models.OrderGroupActive,
+		ParentOrderID: entry.ID,
+		OrderIDs:      []string{takeProfit.ID, stopLoss.ID},
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	for _, order := range []*models.Order{entry, takeProfit, stopLoss} {
+		order.GroupID = group.ID
+	}
+
+	if errResp := saveNewGroup(group, takeProfit, stopLoss); errResp != nil {
+		c.JSON(http.StatusInternalServerError, errResp)
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"user_id":     userID,
+		"group_id":    group.ID,
+		"entry_id":    entry.ID,
+		"symbol":      entry.Symbol,
+		"take_profit": req.TakeProfitPrice,
+		"stop_loss":   req.StopLossPrice,
+		"user_ip":     c.ClientIP(),
+	}).Info("括號訂單創建")
+
+	// 提交入場單，成交後由 settleExecution 啟用子訂單
+	settleExecution(matchingEngine.Submit(entry, marketQuote), marketQuote)
+
+	respondOrderGroup(c, http.StatusCreated, group.ID, "括號訂單已提交")
+}
+
+// 創建OCO訂單：兩筆同一股票的訂單，任一成交即撤銷另一筆
+func CreateOCOOrder(c *gin.Context) {
+	var req models.OCOOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.WithError(err).Error("無效的OCO訂單請求")
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_REQUEST",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = "user_" + uuid.New().String()[:8]
+	}
+
+	legs := make([]*models.Order, 0, len(req.Orders))
+	for _, legReq := range req.Orders {
+		leg, errResp := newOrderFromRequest(legReq, userID)
+		if errResp != nil {
+			c.JSON(http.StatusBadRequest, errResp)
+			return
+		}
+		legs = append(legs, leg)
+	}
+
+	// 兩筆訂單須在同一訂單簿內才能原子撤銷
+	if legs[0].Symbol != legs[1].Symbol {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "OCO_SYMBOL_MISMATCH",
+			Code:    400,
+			Message: "OCO訂單的兩筆訂單必須是同一股票",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	marketQuote, errResp := orderQuote(c.Request.Context(), legs[0].Symbol)
+	if errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
+	}
+
+	group := &models.OrderGroup{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Type:      models.OrderGroupOCO,
+		Symbol:    legs[0].Symbol,
+		Status:    models.OrderGroupActive,
+		OrderIDs:  []string{legs[0].ID, legs[1].ID},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	legs[0].GroupID, legs[1].GroupID = group.ID, group.ID
+	legs[0].OCOOrderIDs = []string{legs[1].ID}
+	legs[1].OCOOrderIDs = []string{legs[0].ID}
+
+	// 兩筆訂單同屬一個OCO組，預留按其中較大者計算
+	for i, leg := range legs {
+		errResp := reserveBalances(leg, marketQuote)
+		if errResp == nil {
+			riskResult := checkRiskLimits(leg, marketQuote)
+			if riskResult.Approved {
+				continue
+			}
+			leg.TransitionTo(models.OrderStatusRejected)
+			errResp = &models.ErrorResponse{
+				Error:   "RISK_REJECTED",
+				Code:    400,
+				Message: fmt.Sprintf("訂單被風險控制拒絕: %s", strings.Join(riskResult.Reasons, ", ")),
+				Time:    time.Now(),
+			}
+		}
+
+		for _, reserved := range legs[:i+1] {
+			releaseReservation(reserved)
+		}
+		c.JSON(errResp.Code, errResp)
+		return
+	}
+
+	if errResp := saveNewGroup(group); errResp != nil {
+		c.JSON(http.StatusInternalServerError, errResp)
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"group_id": group.ID,
+		"symbol":   group.Symbol,
+		"orders":   group.OrderIDs,
+		"user_ip":  c.ClientIP(),
+	}).Info("OCO訂單創建")
+
+	// 第一筆提交即全部成交時，第二筆不再進入訂單簿；部分成交時第二筆縮減到第一筆的剩餘數量
+	settleExecution(matchingEngine.Submit(legs[0], marketQuote), marketQuote)
+	if legs[0].Status == models.OrderStatusFilled {
+		cancelWithdrawnOrder(legs[1], "oco_sibling_filled")
+	} else {
+		if unfilled := legs[0].Quantity - legs[0].FilledQty; legs[0].FilledQty > 0 && legs[1].RemainingQty > unfilled {
+			legs[1].Quantity = unfilled
+			legs[1].RemainingQty = unfilled
+			shrinkReservation(legs[1])
+		}
+		settleExecution(matchingEngine.Submit(legs[1], marketQuote), marketQuote)
+	}
+
+	respondOrderGroup(c, http.StatusCreated, group.ID, "OCO訂單已提交")
+}
+
+// 查詢訂單組
+func GetOrderGroup(c *gin.Context) {
+	groupID := c.Param("id")
+	if _, errResp := loadOwnedGroup(groupID, c.GetHeader("X-User-ID")); errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
+	}
+	respondOrderGroup(c, http.StatusOK, groupID, "訂單組查詢成功")
+}
+
+// 取消訂單組內所有未完成的訂單
+func CancelOrderGroup(c *gin.Context) {
+	groupID := c.Param("id")
+	group, errResp := loadOwnedGroup(groupID, c.GetHeader("X-User-ID"))
+	if errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
+	}
+
+	if !group.IsOpen() {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "ORDER_GROUP_NOT_ACTIVE",
+			Code:    400,
+			Message: fmt.Sprintf("訂單組狀態為 %s，不能取消", group.Status),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"user_id":  c.GetHeader("X-User-ID"),
+		"group_id": groupID,
+		"user_ip":  c.ClientIP(),
+		"action":   "order_group_cancellation",
+	}).Info("訂單組取消請求")
+
+	// 先將訂單組標記為已取消，後台任務不會再啟用子訂單
+	if err := orderGroupService.SetStatus(group, models.OrderGroupCancelled); err != nil {
+		logger.WithError(err).WithField("group_id", groupID).Error("保存訂單組狀態失敗")
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "ORDER_GROUP_NOT_ACTIVE",
+			Code:    409,
+			Message: "訂單組狀態已變更，請重新查詢",
+			Time:    time.Now(),
+		})
+		return
+	}
+	cancelGroupMembers(group, "", "group_cancelled")
+
+	respondOrderGroup(c, http.StatusOK, groupID, "訂單組取消成功")
+}
+
+// 輔助函數：讀取訂單組並確認屬於當前用戶
+func loadOwnedGroup(groupID, userID string) (*models.OrderGroup, *models.ErrorResponse) {
+	group, err := orderGroupService.GetGroup(groupID)
+	if err != nil {
+		return nil, &models.ErrorResponse{
+			Error:   "ORDER_GROUP_NOT_FOUND",
+			Code:    404,
+			Message: "找不到指定的訂單組",
+			Time:    time.Now(),
+		}
+	}
+	if group.UserID != userID {
+		return nil, &models.ErrorResponse{
+			Error:   "ORDER_FORBIDDEN",
+			Code:    403,
+			Message: "無權操作其他用戶的訂單",
+			Time:    time.Now(),
+		}
+	}
+	return group, nil
+}
+
+// 輔助函數：以入場單為模板創建 held 狀態的子訂單
+func newChildOrder(parent *models.Order, side, orderType string) *models.Order {
+	return &models.Order{
+		ID:            uuid.New().String(),
+		UserID:        parent.UserID,
+		Symbol:        parent.Symbol,
+		Side:          side,
+		OrderType:     orderType,
+		Quantity:      parent.Quantity,
+		Status:        models.OrderStatusHeld,
+		RemainingQty:  parent.Quantity,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		TimeInForce:   models.TimeInForceGTC,
+		ParentOrderID: parent.ID,
+	}
+}
+
+// 輔助函數：保存新訂單組及尚未提交的子訂單
+func saveNewGroup(group *models.OrderGroup, held ...*models.Order) *models.ErrorResponse {
+	if err := orderGroupService.SaveGroup(group); err != nil {
+		logger.WithError(err).WithField("group_id", group.ID).Error("保存訂單組失敗")
+		return &models.ErrorResponse{
+			Error:   "SAVE_ERROR",
+			Code:    500,
+			Message: "保存訂單組失敗",
+			Time:    time.Now(),
+		}
+	}
+
+	for _, order := range held {
+		if err := saveOrder(order); err != nil {
+			logger.WithError(err).WithField("order_id", order.ID).Error("保存子訂單失敗")
+			return &models.ErrorResponse{
+				Error:   "SAVE_ERROR",
+				Code:    500,
+				Message: "保存子訂單失敗",
+				Time:    time.Now(),
+			}
+		}
+	}
+	return nil
+}
+
+// 輔助函數：返回訂單組及其訂單的最新狀態
+func respondOrderGroup(c *gin.Context, status int, groupID, message string) {
+	group, err := orderGroupService.GetGroup(groupID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "ORDER_GROUP_NOT_FOUND",
+			Code:    404,
+			Message: "找不到指定的訂單組",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	orders := make([]*models.Order, 0, len(group.MemberIDs()))
+	for _, orderID := range group.MemberIDs() {
+		if order, err := loadOrder(orderID); err == nil {
+			orders = append(orders, order)
+		}
+	}
+
+	c.JSON(status, models.OrderGroupResponse{
+		Group:   group,
+		Orders:  orders,
+		Message: message,
+		Success: true,
+	})
+}
+
+// 輔助函數：根據組內訂單的最新狀態推進訂單組
+func syncOrderGroup(order *models.Order, marketQuote *services.StockQuote) {
+	group, err := orderGroupService.GetGroup(order.GroupID)
+	if err != nil {
+		logger.WithError(err).WithField("group_id", order.GroupID).Error("獲取訂單組失敗")
+		return
+	}
+	if !group.IsOpen() {
+		return
+	}
+
+	isParent := order.ID == group.ParentOrderID
+	switch {
+	case isParent && group.Status != models.OrderGroupActive:
+		// 子訂單已啟用，入場單不再推進訂單組
+		return
+	case isParent && order.Status == models.OrderStatusFilled:
+		activateChildOrders(group, order.FilledQty, marketQuote)
+	case isParent && order.IsTerminal():
+		// 入場單部分成交後終止，子訂單按已成交數量啟用
+		if order.FilledQty > 0 {
+			activateChildOrders(group, order.FilledQty, marketQuote)
+			return
+		}
+		if err := orderGroupService.SetStatus(group, models.OrderGroupCancelled); err != nil {
+			logger.WithError(err).WithField("group_id", group.ID).Error("保存訂單組狀態失敗")
+			return
+		}
+		cancelGroupMembers(group, order.ID, "parent_"+order.Status)
+	case !isParent && order.Status == models.OrderStatusFilled:
+		if err := orderGroupService.SetStatus(group, models.OrderGroupCompleted); err != nil {
+			logger.WithError(err).WithField("group_id", group.ID).Error("保存訂單組狀態失敗")
+		}
+	}
+}
+
+// 輔助函數：入場單成交後啟用子訂單，數量與入場成交數量一致
+func activateChildOrders(group *models.OrderGroup, quantity models.Decimal, marketQuote *services.StockQuote) {
+	if marketQuote == nil {
+		quote, err := marketDataService.GetStockQuote(context.Background(), group.Symbol)
+		if err == nil && quote.Stale {
+			err = fmt.Errorf("%s 只有過期報價", group.Symbol)
+		}
+		if err != nil {
+			logger.WithError(err).WithField("group_id", group.ID).Error("啟用子訂單時獲取股價失敗")
+			return
+		}
+		marketQuote = quote
+	}
+
+	// 請求處理與後台任務可能同時看到入場單成交，只有將訂單組推進到 triggered 的一方啟用子訂單
+	if err := orderGroupService.SetStatus(group, models.OrderGroupTriggered); err != nil {
+		if errors.Is(err, services.ErrOrderGroupStatusChanged) {
+			logger.WithField("group_id", group.ID).Info("訂單組已由其他流程處理，不再啟用子訂單")
+			return
+		}
+		logger.WithError(err).WithField("group_id", group.ID).Error("保存訂單組狀態失敗")
+		return
+	}
+
+	exited := false
+	for _, childID := range group.OrderIDs {
+		child, err := loadOrder(childID)
+		if err != nil || child.Status != models.OrderStatusHeld {
+			continue
+		}
+
+		// 前一筆子訂單提交即全部成交時，其餘子訂單直接撤銷
+		if exited {
+			cancelGroupOrder(child, "oco_sibling_filled")
+			continue
+		}
+
+		child.Quantity = quantity
+		child.RemainingQty = quantity
+		if errResp := reserveBalances(child, marketQuote); errResp != nil {
+			logger.WithField("order_id", childID).Warn("子訂單預留失敗: " + errResp.Message)
+			cancelGroupOrder(child, "insufficient_balance")
+			continue
+		}
+		if err := child.TransitionTo(models.OrderStatusNew); err != nil {
+			logger.WithError(err).WithField("order_id", childID).Error("啟用子訂單失敗")
+			continue
+		}
+
+		logger.WithFields(logrus.Fields{
+			"group_id":   group.ID,
+			"order_id":   child.ID,
+			"order_type": child.OrderType,
+			"quantity":   quantity,
+		}).Info("括號子訂單已啟用")
+
+		settleExecution(matchingEngine.Submit(child, marketQuote), marketQuote)
+
+		// 部分成交時倉位仍未平完，其餘子訂單按剩餘數量繼續保護
+		exited = child.Status == models.OrderStatusFilled
+		if child.FilledQty > 0 && child.RemainingQty < quantity {
+			quantity = child.RemainingQty
+		}
+	}
+}
+
+// 輔助函數：取消訂單組內除 skipID 外所有未完成的訂單
+func cancelGroupMembers(group *models.OrderGroup, skipID, reason string) {
+	for _, orderID := range group.MemberIDs() {
+		if orderID == skipID {
+			continue
+		}
+		order, err := loadOrder(orderID)
+		if err != nil {
+			continue
+		}
+		cancelGroupOrder(order, reason)
+	}
+}
+
+// 輔助函數：撤銷單筆未完成的組內訂單，只處理撮合引擎實際撤出的訂單或尚未提交的子訂單
+func cancelGroupOrder(order *models.Order, reason string) {
+	if !order.CanTransitionTo(models.OrderStatusCancelled) {
+		return
+	}
+	order, withdrawn := withdrawOrder(order)
+	if !withdrawn {
+		logger.WithFields(logrus.Fields{
+			"order_id": order.ID,
+			"status":   order.Status,
+			"reason":   reason,
+		}).Info("組內訂單已成交或正在結算，不再撤銷")
+		return
+	}
+	cancelWithdrawnOrder(order, reason)
+}
+
+// 輔助函數：取消已撤出訂單簿或從未提交的訂單，保存後釋放預留
+func cancelWithdrawnOrder(order *models.Order, reason string) {
+	cancelledQty := order.RemainingQty
+	if err := order.TransitionTo(models.OrderStatusCancelled); err != nil {
+		logger.WithError(err).WithField("order_id", order.ID).Error("撤銷組內訂單失敗")
+		return
+	}
+	if err := saveOrder(order); err != nil {
+		logger.WithError(err).WithField("order_id", order.ID).Error("保存訂單失敗")
+	}
+	releaseReservation(order)
+	recordOrderEvent(order, models.OrderStatusCancelled, cancelledQty, reason)
+}
+
+// 輔助函數：用戶取消組內訂單後的連帶處理
+func cascadeGroupCancel(order *models.Order) {
+	group, err := orderGroupService.GetGroup(order.GroupID)
+	if err != nil || !group.IsOpen() {
+		return
+	}
+
+	// 取消入場單：按成交情況啟用或取消子訂單
+	if order.ID == group.ParentOrderID {
+		syncOrderGroup(order, nil)
+		return
+	}
+
+	// 取消止盈、止損子訂單或OCO訂單時只撤銷其OCO關聯訂單，括號訂單的入場單不受影響
+	for _, linkedID := range order.OCOOrderIDs {
+		linked, err := loadOrder(linkedID)
+		if err != nil {
+			continue
+		}
+		cancelGroupOrder(linked, "oco_sibling_cancelled")
+	}
+	if err := orderGroupService.SetStatus(group, models.OrderGroupCancelled); err != nil {
+		logger.WithError(err).WithField("group_id", group.ID).Error("保存訂單組狀態失敗")
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"trading-api/services"
+)
+
+// OrderSweeper 掛單巡檢器：價格變動時或定時重新評估所有掛單
+type OrderSweeper struct {
+	interval     time.Duration
+	priceChanges chan *services.StockQuote
+}
+
+// 未配置或配置無效時使用的巡檢間隔
+const defaultSweepInterval = 10 * time.Second
+
+func newOrderSweeper(interval time.Duration) *OrderSweeper {
+	if interval <= 0 {
+		interval = defaultSweepInterval
+	}
+	return &OrderSweeper{
+		interval:     interval,
+		priceChanges: make(chan *services.StockQuote, 64),
+	}
+}
+
+// 價格變動通知，隊列已滿時丟棄，由下一次定時巡檢補上
+func (s *OrderSweeper) notifyPriceChange(quote *services.StockQuote) {
+	select {
+	case s.priceChanges <- quote:
+	default:
+	}
+}
+
+// 巡檢主循環
+func (s *OrderSweeper) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	logger.WithField("interval", s.interval.String()).Info("掛單巡檢器已啟動")
+
+	for {
+		select {
+		case quote := <-s.priceChanges:
+			s.evaluate(quote)
+		case now := <-ticker.C:
+			s.sweep(now)
+		}
+	}
+}
+
+// 定時巡檢：重試待結算的成交，處理到期訂單，並以最新報價重新評估所有有掛單的股票
+func (s *OrderSweeper) sweep(now time.Time) {
+	pendingSettlements.retry()
+
+	if report := matchingEngine.ExpireDue(now); len(report.Orders) > 0 {
+		settleExecution(report, nil)
+	}
+
+	for _, symbol := range matchingEngine.Symbols() {
+		// 休市期間報價不變，無需重新評估；按股票所屬交易所的日曆判斷
+		if !symbolCalendar(symbol).IsOpen(now) {
+			continue
+		}
+
+		quote, err := marketDataService.GetStockQuote(context.Background(), symbol)
+		if err != nil {
+			logger.WithError(err).WithField("symbol", symbol).Warn("巡檢獲取股價失敗")
+			continue
+		}
+		s.evaluate(quote)
+	}
+}
+
+// 以報價觸發止損單並成交可成交的掛單；過期報價及休市中的股票不處理
+func (s *OrderSweeper) evaluate(quote *services.StockQuote) {
+	if quote.Stale || !symbolCalendar(quote.Symbol).IsOpen(time.Now()) {
+		return
+	}
+
+	report := matchingEngine.OnQuote(quote)
+	if len(report.Orders) == 0 {
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"symbol": quote.Symbol,
+		"price":  quote.Price,
+		"fills":  len(report.Fills),
+	}).Info("掛單巡檢成交")
+
+	settleExecution(report, quote)
+}
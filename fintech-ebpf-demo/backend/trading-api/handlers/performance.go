@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"trading-api/config"
+	"trading-api/models"
+	"trading-api/services"
+)
+
+// 未配置或配置無效時使用的快照間隔
+const defaultSnapshotInterval = 5 * time.Minute
+
+// 績效快照器：定時為有投資組合變動的用戶保存估值快照
+type PerformanceSnapshotter struct {
+	interval time.Duration
+}
+
+func newPerformanceSnapshotter(interval time.Duration) *PerformanceSnapshotter {
+	if interval <= 0 {
+		interval = defaultSnapshotInterval
+	}
+	return &PerformanceSnapshotter{interval: interval}
+}
+
+func (s *PerformanceSnapshotter) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	logger.WithField("interval", s.interval.String()).Info("績效快照器已啟動")
+
+	for now := range ticker.C {
+		performanceService.SnapshotAll(context.Background(), now)
+	}
+}
+
+// 獲取投資組合績效：權益曲線、時間加權及資金加權收益率、最大回撤、波動率及夏普比率
+// from/to 為 YYYY-MM-DD（默認交易所當地日期，to 包含當日）或 RFC3339 時間；interval 為 daily 或 intraday
+func GetPortfolioPerformance(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = "demo_user"
+	}
+
+	reject := func(message string) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_PARAMETER",
+			Code:    400,
+			Message: message,
+			Time:    time.Now(),
+		})
+	}
+
+	location := calendarService.Default().Location
+	from, err := parsePerformanceTime(c.Query("from"), location, false)
+	if err != nil {
+		reject(fmt.Sprintf("from %s", err.Error()))
+		return
+	}
+	to, err := parsePerformanceTime(c.Query("to"), location, true)
+	if err != nil {
+		reject(fmt.Sprintf("to %s", err.Error()))
+		return
+	}
+	if !to.IsZero() && !from.Before(to) {
+		reject("from 必須早於 to")
+		return
+	}
+
+	interval := c.DefaultQuery("interval", services.PerformanceDaily)
+	switch interval {
+	case services.PerformanceDaily:
+	case services.PerformanceIntraday:
+		if !config.AppConfig.Performance.Intraday {
+			reject("未啟用日內快照，interval 只支持 daily")
+			return
+		}
+	default:
+		reject("interval 只支持 daily 或 intraday")
+		return
+	}
+
+	report, err := performanceService.Performance(c.Request.Context(), userID, from, to, interval)
+	if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Error("計算投資組合績效失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "INTERNAL_ERROR",
+			Code:    500,
+			Message: "計算投資組合績效失敗",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"performance": report,
+		"message":     "績效查詢成功",
+		"success":     true,
+	})
+}
+
+// 輔助函數：解析日期或時間，空字符串返回零值；endOfDay 時日期取當日結束
+func parsePerformanceTime(value string, location *time.Location, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		if endOfDay {
+			return date.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+		}
+		return date, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return parsed, errors.New("必須是 YYYY-MM-DD 日期或 RFC3339 時間")
+	}
+	return parsed, nil
+}
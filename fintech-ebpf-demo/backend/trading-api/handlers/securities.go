@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+	"trading-api/services"
+)
+
+// CSV導入文件的最大大小
+const maxSecurityImportSize = 5 << 20
+
+// 停牌請求
+type haltSecurityRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// 獲取證券參考數據
+func GetSecurity(c *gin.Context) {
+	security, errResp := lookupSecurity(c.Param("symbol"))
+	if errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"security": security,
+		"success":  true,
+	})
+}
+
+// 新增或更新證券
+func SaveSecurity(c *gin.Context) {
+	var security models.Security
+	if err := c.ShouldBindJSON(&security); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_REQUEST",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	created, err := securityService.Save(context.Background(), &security)
+	if err != nil {
+		respondSecurityError(c, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{
+		"security": security,
+		"created":  created,
+		"success":  true,
+	})
+}
+
+// 停牌：暫停受理該證券的新訂單及改單，已有掛單保留
+func HaltSecurity(c *gin.Context) {
+	var req haltSecurityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_REQUEST",
+			Code:    400,
+			Message: "停牌必須指定原因 reason",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	setSecurityStatus(c, models.SecurityStatusHalted, req.Reason)
+}
+
+// 復牌
+func ResumeSecurity(c *gin.Context) {
+	setSecurityStatus(c, models.SecurityStatusActive, "")
+}
+
+// 從CSV批量導入證券，支持 multipart 上傳的 file 欄位或直接以請求體提交
+func ImportSecurities(c *gin.Context) {
+	var body io.Reader = http.MaxBytesReader(c.Writer, c.Request.Body, maxSecurityImportSize)
+	if file, err := c.FormFile("file"); err == nil {
+		opened, err := file.Open()
+		if err != nil {
+			respondSecurityError(c, err)
+			return
+		}
+		defer opened.Close()
+		body = opened
+	}
+
+	result, err := securityService.Import(context.Background(), body)
+	if err != nil {
+		respondSecurityError(c, err)
+		return
+	}
+	if len(result.Errors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "INVALID_IMPORT",
+			"message": fmt.Sprintf("導入文件有 %d 處錯誤，未保存任何記錄", len(result.Errors)),
+			"errors":  result.Errors,
+			"success": false,
+		})
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"created": result.Created,
+		"updated": result.Updated,
+		"user_ip": c.ClientIP(),
+	}).Info("證券參考數據導入完成")
+
+	c.JSON(http.StatusOK, gin.H{
+		"created": result.Created,
+		"updated": result.Updated,
+		"success": true,
+	})
+}
+
+func setSecurityStatus(c *gin.Context, status, reason string) {
+	security, err := securityService.SetStatus(context.Background(), c.Param("symbol"), status, reason)
+	if err != nil {
+		respondSecurityError(c, err)
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"symbol":  security.Symbol,
+		"status":  status,
+		"reason":  reason,
+		"user_ip": c.ClientIP(),
+	}).Warn("證券交易狀態已變更")
+
+	c.JSON(http.StatusOK, gin.H{
+		"security": security,
+		"success":  true,
+	})
+}
+
+func respondSecurityError(c *gin.Context, err error) {
+	if err == services.ErrNotFound {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "SECURITY_NOT_FOUND",
+			Code:    404,
+			Message: "證券不存在",
+			Time:    time.Now(),
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		Error:   "INVALID_SECURITY",
+		Code:    400,
+		Message: err.Error(),
+		Time:    time.Now(),
+	})
+}
+
+// 輔助函數：讀取證券參考數據
+func lookupSecurity(symbol string) (*models.Security, *models.ErrorResponse) {
+	security, err := securityService.Get(context.Background(), symbol)
+	if err == services.ErrNotFound {
+		return nil, &models.ErrorResponse{
+			Error:   "UNSUPPORTED_SYMBOL",
+			Code:    400,
+			Message: fmt.Sprintf("不支持的股票代碼: %s", symbol),
+			Time:    time.Now(),
+		}
+	}
+	if err != nil {
+		logger.WithError(err).WithField("symbol", symbol).Error("讀取證券參考數據失敗")
+		return nil, &models.ErrorResponse{
+			Error:   "REFERENCE_DATA_ERROR",
+			Code:    500,
+			Message: "無法讀取證券參考數據，請稍後重試",
+			Time:    time.Now(),
+		}
+	}
+	return security, nil
+}
+
+// 輔助函數：讀取可交易的證券，停牌或退市時返回錯誤響應
+func lookupTradableSecurity(symbol string) (*models.Security, *models.ErrorResponse) {
+	security, errResp := lookupSecurity(symbol)
+	if errResp != nil {
+		return nil, errResp
+	}
+
+	switch security.Status {
+	case models.SecurityStatusHalted:
+		message := fmt.Sprintf("%s 已停牌", security.Symbol)
+		if security.HaltReason != "" {
+			message += ": " + security.HaltReason
+		}
+		return nil, &models.ErrorResponse{
+			Error:   "SYMBOL_HALTED",
+			Code:    400,
+			Message: message,
+			Time:    time.Now(),
+		}
+	case models.SecurityStatusDelisted:
+		return nil, &models.ErrorResponse{
+			Error:   "UNSUPPORTED_SYMBOL",
+			Code:    400,
+			Message: fmt.Sprintf("%s 已退市", security.Symbol),
+			Time:    time.Now(),
+		}
+	}
+	return security, nil
+}
+
+// 輔助函數：數量須為最小交易單位的整數倍，各價格欄位須為最小價格變動的整數倍
+func checkOrderIncrements(security *models.Security, order *models.Order) (string, error) {
+	if !security.ValidQuantity(order.Quantity) {
+		return "INVALID_QUANTITY", fmt.Errorf("%s 的數量必須是 %v 的整數倍", security.Symbol, security.LotSize)
+	}
+
+	prices := []struct {
+		name  string
+		value models.Decimal
+	}{
+		{"price", order.Price},
+		{"stop_price", order.StopPrice},
+		{"trail_amount", order.TrailAmount},
+	}
+	for _, price := range prices {
+		if price.value > 0 && !security.ValidPrice(price.value) {
+			return "INVALID_TICK_SIZE", fmt.Errorf("%s 的 %s 必須是 %v 的整數倍", security.Symbol, price.name, security.TickSize)
+		}
+	}
+	return "", nil
+}
+
+// 輔助函數：證券所屬交易所的日曆，未知交易所使用默認日曆
+func securityCalendar(security *models.Security) *services.TradingCalendar {
+	if calendar, exists := calendarService.Calendar(security.Exchange); exists {
+		return calendar
+	}
+	return calendarService.Default()
+}
+
+// 輔助函數：股票所屬交易所的日曆
+func symbolCalendar(symbol string) *services.TradingCalendar {
+	security, err := securityService.Get(context.Background(), strings.ToUpper(symbol))
+	if err != nil {
+		return calendarService.Default()
+	}
+	return securityCalendar(security)
+}
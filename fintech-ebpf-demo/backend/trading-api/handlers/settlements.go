@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+	"trading-api/services"
+)
+
+// 重試超過此次數仍失敗的成交需人工對賬，但仍會繼續重試
+const settlementReconcileAttempts = 10
+
+// 記錄失敗、等待重試的成交，由掛單巡檢器定時重試。隊列只保存在進程內存中
+var pendingSettlements = &settlementQueue{}
+
+type settlementQueue struct {
+	mu      sync.Mutex
+	pending []*pendingSettlement
+}
+
+type pendingSettlement struct {
+	settlement *services.FillSettlement
+	orders     map[string]*models.Order // 成交時雙方訂單的狀態，用於發布成交通知
+}
+
+// 加入待結算的成交，保留成交雙方訂單當時的狀態
+func (q *settlementQueue) add(settlement *services.FillSettlement, orders map[string]*models.Order) {
+	fill := settlement.Fill
+	snapshot := make(map[string]*models.Order, 2)
+	for _, party := range fillParties(fill) {
+		if order, exists := orders[party.OrderID]; exists {
+			snapshot[party.OrderID] = order.Clone()
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, &pendingSettlement{settlement: settlement, orders: snapshot})
+}
+
+// 訂單是否有尚未結算的成交
+func (q *settlementQueue) holds(orderID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, item := range q.pending {
+		for _, party := range fillParties(item.settlement.Fill) {
+			if party.OrderID == orderID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (q *settlementQueue) snapshot() []*pendingSettlement {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]*pendingSettlement(nil), q.pending...)
+}
+
+func (q *settlementQueue) remove(done *pendingSettlement) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, item := range q.pending {
+		if item == done {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// 重試待結算的成交；成功後轉換預留、發布通知，並按訂單最新狀態處理剩餘預留及訂單組
+func (q *settlementQueue) retry() {
+	for _, item := range q.snapshot() {
+		settlement := item.settlement
+		fields := logrus.Fields{
+			"fill_id":  settlement.Fill.ID,
+			"symbol":   settlement.Fill.Symbol,
+			"attempts": settlement.Attempts + 1,
+		}
+		if err := tradingHistoryService.Settle(settlement); err != nil {
+			entry := logger.WithError(err).WithFields(fields)
+			if settlement.Attempts >= settlementReconcileAttempts {
+				entry.Error("成交多次結算失敗，需人工對賬")
+			} else {
+				entry.Warn("重試成交結算失敗")
+			}
+			continue
+		}
+
+		q.remove(item)
+		logger.WithFields(fields).Info("待結算成交已完成記錄")
+
+		consumeFillReservations(settlement.Fill)
+		publishFills(settlement.Fill, item.orders)
+		for _, party := range fillParties(settlement.Fill) {
+			if q.holds(party.OrderID) {
+				continue
+			}
+			order, err := loadOrder(party.OrderID)
+			if err != nil {
+				logger.WithError(err).WithField("order_id", party.OrderID).Error("讀取訂單失敗")
+				continue
+			}
+			settleReservation(order)
+			if order.GroupID != "" {
+				syncOrderGroup(order, nil)
+			}
+		}
+	}
+}
+
+// 成交的參與方，與市場報價成交時只有主動方
+func fillParties(fill services.Fill) []services.FillParty {
+	if fill.Maker == nil {
+		return []services.FillParty{fill.Taker}
+	}
+	return []services.FillParty{fill.Taker, *fill.Maker}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+
+	"trading-api/config"
+	"trading-api/repository"
+	"trading-api/services"
+)
+
+// 訂單列表單次返回的最大數量及默認數量
+const (
+	maxUserOrders     = 500
+	defaultUserOrders = 100
+)
+
+// 按配置選擇存儲後端；Postgres不可用時啟動失敗，顯式開啟 storage.fallback 時才回退到Redis
+func initializeStores() {
+	redisStore := services.NewRedisStore(rdb)
+
+	switch backend := config.AppConfig.Storage.Backend; backend {
+	case config.StorageMemory:
+		memoryStore := services.NewMemoryStore()
+		orderStore, tradeStore, portfolioStore, configStore = memoryStore, memoryStore, memoryStore, memoryStore
+		securityStore, ledgerStore = memoryStore, memoryStore
+		logger.Warn("使用進程內存儲，重啟後訂單和交易數據將丟失")
+		return
+
+	case config.StoragePostgres:
+		repo, err := repository.Open(config.AppConfig.Database)
+		if err == nil {
+			database = repo
+			orderStore = services.NewCachedOrderStore(logger, repo, redisStore)
+			tradeStore, portfolioStore, configStore, securityStore = repo, repo, repo, repo
+			ledgerStore = repo
+			logger.Info("使用Postgres存儲，Redis作為訂單緩存")
+			return
+		}
+		if !config.AppConfig.Storage.Fallback {
+			logger.WithError(err).Fatal("數據庫不可用，如需改用Redis存儲請設置 STORAGE_FALLBACK=true")
+		}
+		logger.WithError(err).Warn("數據庫不可用，按 storage.fallback 配置改用Redis存儲")
+
+	case config.StorageRedis:
+
+	default:
+		logger.WithField("backend", backend).Warn("未知的存儲後端，改用Redis存儲")
+	}
+
+	orderStore, tradeStore, portfolioStore, configStore = redisStore, redisStore, redisStore, redisStore
+	securityStore, ledgerStore = redisStore, redisStore
+
+	// 為升級前保存的訂單補建用戶索引
+	if err := redisStore.EnsureOrderIndexes(context.Background()); err != nil {
+		logger.WithError(err).Warn("補建訂單索引失敗")
+	}
+}
@@ -2,18 +2,17 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
+
+	"trading-api/services"
 )
 
 // 系統配置結構
 type SystemConfig struct {
 	TradingEnabled      bool    `json:"trading_enabled"`
-	MarketOpenTime      string  `json:"market_open_time"`
+	MarketOpenTime      string  `json:"market_open_time"` // 由默認交易日曆決定，更新時忽略
 	MarketCloseTime     string  `json:"market_close_time"`
 	CommissionRate      float64 `json:"commission_rate"`
 	MaxOrderSize        int     `json:"max_order_size"`
@@ -27,14 +26,13 @@ func GetSystemConfig(c *gin.Context) {
 	ctx := context.Background()
 	configKey := "system_config"
 
-	// 從Redis獲取配置
-	configJSON, err := rdb.Get(ctx, configKey).Result()
-	if err == redis.Nil {
+	// 從配置存儲獲取配置
+	var config SystemConfig
+	err := configStore.GetConfig(ctx, configKey, &config)
+	if err == services.ErrNotFound {
 		// 配置不存在，返回默認配置
 		defaultConfig := &SystemConfig{
 			TradingEnabled:      true,
-			MarketOpenTime:      "09:30",
-			MarketCloseTime:     "16:00",
 			CommissionRate:      0.0025,
 			MaxOrderSize:        10000,
 			InitialBalance:      100000.0,
@@ -42,9 +40,10 @@ func GetSystemConfig(c *gin.Context) {
 			RealPriceTrading:    true,
 		}
 
-		// 保存默認配置到Redis
-		configData, _ := json.Marshal(defaultConfig)
-		rdb.Set(ctx, configKey, configData, time.Hour*24*365)
+		applyCalendarHours(defaultConfig)
+
+		// 保存默認配置
+		configStore.SetConfig(ctx, configKey, defaultConfig)
 
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -59,14 +58,7 @@ func GetSystemConfig(c *gin.Context) {
 		return
 	}
 
-	var config SystemConfig
-	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
-		logger.WithError(err).Error("解析系統配置失敗")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "解析系統配置失敗",
-		})
-		return
-	}
+	applyCalendarHours(&config)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -74,6 +66,13 @@ func GetSystemConfig(c *gin.Context) {
 	})
 }
 
+// 輔助函數：交易時段以默認交易日曆為準
+func applyCalendarHours(config *SystemConfig) {
+	calendar := calendarService.Default()
+	config.MarketOpenTime = calendar.OpenTime()
+	config.MarketCloseTime = calendar.CloseTime()
+}
+
 // 更新系統配置
 func UpdateSystemConfig(c *gin.Context) {
 	var config SystemConfig
@@ -106,20 +105,13 @@ func UpdateSystemConfig(c *gin.Context) {
 		return
 	}
 
+	applyCalendarHours(&config)
+
 	ctx := context.Background()
 	configKey := "system_config"
 
-	// 保存配置到Redis
-	configData, err := json.Marshal(config)
-	if err != nil {
-		logger.WithError(err).Error("序列化系統配置失敗")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "保存系統配置失敗",
-		})
-		return
-	}
-
-	if err := rdb.Set(ctx, configKey, configData, time.Hour*24*365).Err(); err != nil {
+	// 保存配置
+	if err := configStore.SetConfig(ctx, configKey, config); err != nil {
 		logger.WithError(err).Error("保存系統配置失敗")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "保存系統配置失敗",
@@ -1,12 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 	"context"
 	"strings"
-	"encoding/json"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -16,14 +16,40 @@ import (
 
 	"trading-api/models"
 	"trading-api/config"
+	"trading-api/repository"
 	"trading-api/services"
 )
 
+// 批量報價單次最多查詢的股票數
+const maxQuoteSymbols = 50
+
 var (
 	logger               = logrus.New()
 	rdb                  *redis.Client
 	marketDataService    *services.MarketDataService
+	candleService        *services.CandleService
+	quoteHub             *services.QuoteHub
+	quoteResilience      *services.ResilientQuoteProvider // 使用外部行情來源時的熔斷保護，否則為nil
+	calendarService      *services.CalendarService
 	tradingHistoryService *services.TradingHistoryService
+	ledgerService        *services.LedgerService
+	matchingEngine       *services.MatchingEngine
+	orderEventService    *services.OrderEventService
+	orderSweeper         *OrderSweeper
+	orderGroupService    *services.OrderGroupService
+	idempotencyService   *services.IdempotencyService
+	reservationService   *services.ReservationService
+	fundingService       *services.FundingService
+	performanceService   *services.PerformanceService
+	marginService        *services.MarginService
+	orderStore           services.OrderStore
+	tradeStore           services.TradeStore
+	portfolioStore       services.PortfolioStore
+	configStore          services.ConfigStore
+	securityStore        services.SecurityStore
+	ledgerStore          services.LedgerStore
+	securityService      *services.SecurityService
+	database             *repository.Repository // 未使用Postgres存儲時為nil
 )
 
 func InitializeHandlers() {
@@ -37,13 +63,94 @@ func InitializeHandlers() {
 	// 設置日誌格式
 	logger.SetFormatter(&logrus.JSONFormatter{})
 
+	// 按配置選擇訂單、交易、投資組合及配置的存儲後端
+	initializeStores()
+
+	// 交易日曆決定訂單受理、DAY訂單過期及休市風控
+	initializeCalendars()
+
+	// 證券參考數據，首次啟動時寫入默認證券
+	securityService = services.NewSecurityService(logger, securityStore)
+	if err := securityService.EnsureDefaults(context.Background()); err != nil {
+		logger.WithError(err).Error("初始化證券參考數據失敗")
+	}
+
 	// 初始化服務
-	marketDataService = services.NewMarketDataService(logger, rdb)
-	tradingHistoryService = services.NewTradingHistoryService(logger, rdb)
+	quoteProvider := initializeQuoteProvider()
+	marketDataService = services.NewMarketDataService(logger, rdb, quoteProvider, config.AppConfig.MarketData.BatchConcurrency, time.Duration(config.AppConfig.MarketData.Timeout)*time.Millisecond)
+	candleService = services.NewCandleService(logger, rdb, quoteProvider)
+	ledgerService = services.NewLedgerService(logger, ledgerStore)
+	tradingHistoryService = services.NewTradingHistoryService(logger, tradeStore, portfolioStore, ledgerService, config.AppConfig.Trading.LotMethod)
+	matchingEngine = services.NewMatchingEngine(logger)
+	orderEventService = services.NewOrderEventService(logger, rdb)
+	orderGroupService = services.NewOrderGroupService(logger, rdb)
+	idempotencyService = services.NewIdempotencyService(logger, rdb)
+	marginService = services.NewMarginService(logger, rdb, tradingHistoryService, securityService, marketDataService, calendarService.Default(), services.MarginOptions{
+		InterestRate:    config.AppConfig.Margin.InterestRate,
+		CallGracePeriod: time.Duration(config.AppConfig.Margin.CallGracePeriod) * time.Hour,
+	})
+	tradingHistoryService.OnBorrowReturn(marginService.ReturnBorrow)
+	reservationService = services.NewReservationService(logger, rdb, portfolioStore, marginService)
+	paymentGateway := services.NewHTTPPaymentGateway(config.AppConfig.Payment.GatewayURL, time.Duration(config.AppConfig.Payment.Timeout)*time.Millisecond)
+	fundingService = services.NewFundingService(logger, rdb, paymentGateway, tradingHistoryService, ledgerService, reservationService)
+
+	// 投資組合變動的用戶納入定時估值，快照用於績效計算
+	perf := config.AppConfig.Performance
+	performanceService = services.NewPerformanceService(logger, rdb, tradingHistoryService, ledgerService, marketDataService, calendarService.Default(), services.PerformanceOptions{
+		Intraday:          perf.Intraday,
+		IntradayRetention: time.Duration(perf.IntradayRetention) * 24 * time.Hour,
+		RiskFreeRate:      perf.RiskFreeRate,
+	})
+	tradingHistoryService.OnPortfolioChange(performanceService.Track)
+	go newPerformanceSnapshotter(time.Duration(perf.SnapshotInterval) * time.Second).run()
+
+	// 保證金賬戶每日計息，淨值不足時追繳，逾期強制平倉
+	go newMarginMonitor(time.Duration(config.AppConfig.Margin.MonitorInterval) * time.Second).run()
+
+	// 巡檢器及報價監聽啟動前，將存儲中未完成的訂單恢復到撮合引擎
+	restoreRestingOrders()
+
+	// 價格變動或定時重新評估掛單，並使到期的DAY/GTD掛單過期
+	orderSweeper = newOrderSweeper(time.Duration(config.AppConfig.Trading.SweepInterval) * time.Second)
+	marketDataService.OnPriceChange(orderSweeper.notifyPriceChange)
+	go orderSweeper.run()
+
+	// 實時報價推送，每個被訂閱的股票只輪詢一次上游
+	quoteHub = services.NewQuoteHub(logger, marketDataService.RefreshQuote, time.Duration(config.AppConfig.MarketData.StreamInterval)*time.Millisecond)
+	marketDataService.OnPriceChange(quoteHub.Publish)
 	
 	logger.Info("交易處理器初始化完成")
 }
 
+// 輔助函數：重啟後將存儲中未完成的訂單按創建先後掛回訂單簿。
+// 不重新撮合、不做FOK預檢，預留沿用重啟前的記錄；可成交的訂單由巡檢器按最新報價處理
+func restoreRestingOrders() {
+	orders, err := orderStore.ListActiveOrders(context.Background())
+	if err != nil {
+		logger.WithError(err).Error("讀取未完成訂單失敗，訂單簿未恢復")
+		return
+	}
+
+	restored := 0
+	for _, order := range orders {
+		if matchingEngine.Restore(order) {
+			restored++
+			continue
+		}
+		logger.WithFields(logrus.Fields{
+			"order_id":   order.ID,
+			"symbol":     order.Symbol,
+			"order_type": order.OrderType,
+			"status":     order.Status,
+		}).Warn("未完成訂單無法掛回訂單簿")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"orders":   len(orders),
+		"restored": restored,
+	}).Info("訂單簿已從存儲恢復")
+}
+
 // 創建訂單
 func CreateOrder(c *gin.Context) {
 	var req models.OrderRequest
@@ -58,48 +165,17 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// 驗證股票代碼
-	supportedStocks := marketDataService.GetSupportedStocks()
-	isSupported := false
-	for _, stock := range supportedStocks {
-		if strings.ToUpper(req.Symbol) == stock {
-			isSupported = true
-			break
-		}
-	}
-	
-	if !isSupported {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "UNSUPPORTED_SYMBOL",
-			Code:    400,
-			Message: fmt.Sprintf("不支持的股票代碼: %s", req.Symbol),
-			Time:    time.Now(),
-		})
-		return
-	}
-
 	// 模擬用戶ID（實際應用中從JWT token獲取）
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
 		userID = "user_" + uuid.New().String()[:8]
 	}
 
-	// 創建訂單
-	order := &models.Order{
-		ID:           uuid.New().String(),
-		UserID:       userID,
-		Symbol:       strings.ToUpper(req.Symbol),
-		Side:         req.Side,
-		OrderType:    req.OrderType,
-		Quantity:     req.Quantity,
-		Price:        req.Price,
-		Status:       "pending",
-		FilledQty:    0,
-		RemainingQty: req.Quantity,
-		AvgPrice:     0,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-		TimeInForce:  req.TimeInForce,
+	// 驗證並創建訂單
+	order, errResp := newOrderFromRequest(req, userID)
+	if errResp != nil {
+		c.JSON(http.StatusBadRequest, errResp)
+		return
 	}
 
 	// 記錄敏感操作日誌
@@ -116,62 +192,23 @@ func CreateOrder(c *gin.Context) {
 	}).Info("新訂單創建")
 
 	// 獲取實時市價
-	marketQuote, err := marketDataService.GetStockQuote(order.Symbol)
-	if err != nil {
-		logger.WithError(err).WithField("symbol", order.Symbol).Error("獲取股價失敗")
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "MARKET_DATA_ERROR",
-			Code:    500,
-			Message: "無法獲取股票市價，請稍後重試",
-			Time:    time.Now(),
-		})
+	marketQuote, errResp := orderQuote(c.Request.Context(), order.Symbol)
+	if errResp != nil {
+		c.JSON(errResp.Code, errResp)
 		return
 	}
 
-	// 驗證投資組合餘額（針對買入訂單）
-	if order.Side == "buy" {
-		portfolio, err := tradingHistoryService.GetPortfolio(userID)
-		if err != nil {
-			// 創建初始投資組合
-			logger.WithField("user_id", userID).Info("創建初始投資組合")
-		} else {
-			requiredAmount := order.Quantity * order.Price
-			if order.OrderType == "market" {
-				requiredAmount = order.Quantity * marketQuote.Price
-			}
-			
-			if portfolio.CashBalance < requiredAmount*1.01 { // 包含1%緩衝
-				c.JSON(http.StatusBadRequest, models.ErrorResponse{
-					Error:   "INSUFFICIENT_FUNDS",
-					Code:    400,
-					Message: fmt.Sprintf("資金不足。可用餘額: $%.2f, 需要: $%.2f", 
-						portfolio.CashBalance, requiredAmount),
-					Time:    time.Now(),
-				})
-				return
-			}
-		}
-	}
-
-	// 檢查持倉（針對賣出訂單）
-	if order.Side == "sell" {
-		portfolio, err := tradingHistoryService.GetPortfolio(userID)
-		if err != nil || portfolio.Positions[order.Symbol] == nil || 
-		   portfolio.Positions[order.Symbol].Quantity < order.Quantity {
-			c.JSON(http.StatusBadRequest, models.ErrorResponse{
-				Error:   "INSUFFICIENT_SHARES",
-				Code:    400,
-				Message: fmt.Sprintf("持股不足，無法賣出 %g 股 %s", order.Quantity, order.Symbol),
-				Time:    time.Now(),
-			})
-			return
-		}
+	// 預留資金或持股
+	if errResp := reserveBalances(order, marketQuote); errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
 	}
 
 	// 模擬風險檢查
 	riskResult := checkRiskLimits(order, marketQuote)
 	if !riskResult.Approved {
-		order.Status = "rejected"
+		releaseReservation(order)
+		order.TransitionTo(models.OrderStatusRejected)
 		c.JSON(http.StatusBadRequest, models.OrderResponse{
 			Order:   order,
 			Message: fmt.Sprintf("訂單被風險控制拒絕: %s", strings.Join(riskResult.Reasons, ", ")),
@@ -180,63 +217,44 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// 嘗試執行訂單
-	executed, executionPrice, err := marketDataService.CheckOrderExecution(
-		order.Symbol, order.OrderType, order.Price, order.Side)
-	
-	if err != nil {
-		logger.WithError(err).Error("檢查訂單執行失敗")
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "EXECUTION_ERROR",
-			Code:    500,
-			Message: "訂單執行檢查失敗",
-			Time:    time.Now(),
-		})
-		return
-	}
+	// 提交撮合引擎
+	report := matchingEngine.Submit(order, marketQuote)
+	executed := order.FilledQty > 0
 
 	if executed {
-		// 訂單成交
-		order.Status = "filled"
-		order.FilledQty = order.Quantity
-		order.RemainingQty = 0
-		order.AvgPrice = executionPrice
-		order.UpdatedAt = time.Now()
-
-		// 記錄交易歷史
-		tradeRecord, err := tradingHistoryService.RecordTrade(
-			order.ID, userID, order.Symbol, order.Side, 
-			order.Quantity, executionPrice, order.OrderType, marketQuote)
-		
-		if err != nil {
-			logger.WithError(err).Error("記錄交易失敗")
-		} else {
-			logger.WithFields(logrus.Fields{
-				"trade_id":    tradeRecord.ID,
-				"order_id":    order.ID,
-				"symbol":      order.Symbol,
-				"side":        order.Side,
-				"quantity":    order.Quantity,
-				"price":       executionPrice,
-				"market_price": marketQuote.Price,
-				"commission":  tradeRecord.Commission,
-			}).Info("交易執行成功")
-		}
+		logger.WithFields(logrus.Fields{
+			"order_id":      order.ID,
+			"symbol":        order.Symbol,
+			"side":          order.Side,
+			"filled_qty":    order.FilledQty,
+			"remaining_qty": order.RemainingQty,
+			"avg_price":     order.AvgPrice,
+			"market_price":  marketQuote.Price,
+			"fills":         len(report.Fills),
+		}).Info("交易執行成功")
 	} else {
-		// 訂單未成交，保持pending狀態
+		// 訂單未成交，保持掛單狀態
 		logger.WithFields(logrus.Fields{
 			"order_id":     order.ID,
 			"symbol":       order.Symbol,
 			"order_price":  order.Price,
 			"market_price": marketQuote.Price,
 			"side":         order.Side,
-		}).Info("訂單未達成交條件，保持pending狀態")
+		}).Info("訂單未達成交條件，保持掛單狀態")
 	}
 
-	// 存儲到Redis
-	orderKey := fmt.Sprintf("order:%s", order.ID)
-	orderJSON, _ := json.Marshal(order)
-	rdb.Set(context.Background(), orderKey, orderJSON, time.Hour*24)
+	// 記錄成交並保存所有受影響的訂單（含對手方）
+	settleExecution(report, marketQuote)
+
+	// FOK無法全部成交時整單拒絕
+	if order.Status == models.OrderStatusRejected {
+		c.JSON(http.StatusBadRequest, models.OrderResponse{
+			Order:   order,
+			Message: fmt.Sprintf("FOK訂單無法全部成交，已拒絕。當前市價: $%.2f", marketQuote.Price),
+			Success: false,
+		})
+		return
+	}
 
 	// 添加市場信息到響應
 	response := models.OrderResponse{
@@ -244,9 +262,17 @@ func CreateOrder(c *gin.Context) {
 		Success: true,
 	}
 
-	if executed {
-		response.Message = fmt.Sprintf("訂單成功成交，成交價: $%.2f (市價: $%.2f)", 
-			executionPrice, marketQuote.Price)
+	if executed && order.Status == models.OrderStatusFilled {
+		response.Message = fmt.Sprintf("訂單成功成交，成交均價: $%.2f (市價: $%.2f)", 
+			order.AvgPrice, marketQuote.Price)
+	} else if executed && order.Status == models.OrderStatusCancelled {
+		response.Message = fmt.Sprintf("IOC訂單部分成交 %g/%g 股，成交均價: $%.2f，剩餘數量已取消", 
+			order.FilledQty, order.Quantity, order.AvgPrice)
+	} else if executed {
+		response.Message = fmt.Sprintf("訂單部分成交 %g/%g 股，成交均價: $%.2f，剩餘數量已掛單", 
+			order.FilledQty, order.Quantity, order.AvgPrice)
+	} else if order.Status == models.OrderStatusCancelled {
+		response.Message = fmt.Sprintf("IOC訂單未能立即成交，已取消。當前市價: $%.2f", marketQuote.Price)
 	} else {
 		response.Message = fmt.Sprintf("訂單已提交，等待成交。當前市價: $%.2f", marketQuote.Price)
 	}
@@ -275,11 +301,8 @@ func GetOrder(c *gin.Context) {
 		"endpoint": "/api/v1/orders/" + orderID,
 	}).Info("訂單查詢請求")
 
-	// 從Redis獲取
-	orderKey := fmt.Sprintf("order:%s", orderID)
-	orderJSON, err := rdb.Get(context.Background(), orderKey).Result()
-	
-	if err == redis.Nil {
+	order, err := loadOrder(orderID)
+	if err == services.ErrNotFound {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error:   "ORDER_NOT_FOUND",
 			Code:    404,
@@ -288,10 +311,8 @@ func GetOrder(c *gin.Context) {
 		})
 		return
 	}
-
-	var order models.Order
-	if err := json.Unmarshal([]byte(orderJSON), &order); err != nil {
-		logger.WithError(err).Error("解析訂單數據失敗")
+	if err != nil {
+		logger.WithError(err).Error("讀取訂單數據失敗")
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "INTERNAL_ERROR",
 			Code:    500,
@@ -301,38 +322,11 @@ func GetOrder(c *gin.Context) {
 		return
 	}
 
-	// 獲取最新市價
-	marketQuote, err := marketDataService.GetStockQuote(order.Symbol)
-	if err == nil {
-		// 檢查pending訂單是否可以成交
-		if order.Status == "pending" {
-			executed, executionPrice, err := marketDataService.CheckOrderExecution(
-				order.Symbol, order.OrderType, order.Price, order.Side)
-			
-			if err == nil && executed {
-				// 更新訂單狀態
-				order.Status = "filled"
-				order.FilledQty = order.Quantity
-				order.RemainingQty = 0
-				order.AvgPrice = executionPrice
-				order.UpdatedAt = time.Now()
-
-				// 記錄交易
-				tradingHistoryService.RecordTrade(
-					order.ID, order.UserID, order.Symbol, order.Side,
-					order.Quantity, executionPrice, order.OrderType, marketQuote)
-
-				// 更新Redis
-				orderJSON, _ := json.Marshal(order)
-				rdb.Set(context.Background(), orderKey, orderJSON, time.Hour*24)
-
-				logger.WithField("order_id", orderID).Info("Pending訂單已成交")
-			}
-		}
-	}
+	// 獲取最新市價，掛單由巡檢器負責成交
+	marketQuote, _ := marketDataService.GetStockQuote(c.Request.Context(), order.Symbol)
 
 	response := models.OrderResponse{
-		Order:   &order,
+		Order:   order,
 		Message: "訂單查詢成功",
 		Success: true,
 	}
@@ -352,6 +346,67 @@ func GetOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// 獲取訂單成交明細
+func GetOrderFills(c *gin.Context) {
+	orderID := c.Param("id")
+
+	order, err := loadOrder(orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "ORDER_NOT_FOUND",
+			Code:    404,
+			Message: "訂單不存在",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_id":      order.ID,
+		"status":        order.Status,
+		"filled_qty":    order.FilledQty,
+		"remaining_qty": order.RemainingQty,
+		"avg_price":     order.AvgPrice,
+		"fills":         order.Fills,
+		"count":         len(order.Fills),
+		"success":       true,
+	})
+}
+
+// 獲取訂單事件（取消、拒絕、過期）
+func GetOrderEvents(c *gin.Context) {
+	orderID := c.Param("id")
+
+	if _, err := loadOrder(orderID); err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "ORDER_NOT_FOUND",
+			Code:    404,
+			Message: "找不到指定的訂單",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	events, err := orderEventService.GetOrderEvents(orderID)
+	if err != nil {
+		logger.WithError(err).WithField("order_id", orderID).Error("獲取訂單事件失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "FETCH_ERROR",
+			Code:    500,
+			Message: "獲取訂單事件失敗",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_id": orderID,
+		"events":   events,
+		"total":    len(events),
+		"success":  true,
+	})
+}
+
 // 獲取投資組合
 func GetPortfolio(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
@@ -369,53 +424,58 @@ func GetPortfolio(c *gin.Context) {
 	portfolio, err := tradingHistoryService.GetPortfolio(userID)
 	if err != nil {
 		// 創建默認投資組合
-		portfolio = &services.Portfolio{
-			UserID:      userID,
-			Positions:   make(map[string]*services.Position),
-			CashBalance: 100000.0, // 初始10萬美元
-			TotalValue:  100000.0,
-			TotalPL:     0,
-			DayPL:       0,
-			LastUpdated: time.Now(),
-		}
+		portfolio = services.NewPortfolio(userID)
 	}
 
 	// 更新所有持倉的實時市價
+	var quoteErrors map[string]string
 	if len(portfolio.Positions) > 0 {
 		symbols := make([]string, 0, len(portfolio.Positions))
 		for symbol := range portfolio.Positions {
 			symbols = append(symbols, symbol)
 		}
 
-		quotes, err := marketDataService.GetMultipleQuotes(symbols)
-		if err == nil {
-			portfolio.TotalValue = portfolio.CashBalance
-			portfolio.TotalPL = 0
-			portfolio.DayPL = 0
-
-			for symbol, position := range portfolio.Positions {
-				if quote, exists := quotes[symbol]; exists {
-					position.LastPrice = quote.Price
-					position.PreviousClose = quote.PreviousClose
-					position.MarketValue = position.Quantity * quote.Price
-					position.UnrealizedPL = position.MarketValue - (position.Quantity * position.AvgCost)
-					position.DayPL = position.Quantity * (quote.Price - quote.PreviousClose)
-					position.LastUpdated = time.Now()
-
-					portfolio.TotalValue += position.MarketValue
-					portfolio.TotalPL += position.UnrealizedPL
-					portfolio.DayPL += position.DayPL
-				}
+		// 未取得報價的持倉沿用上次市價計入總值
+		quotes, failures := marketDataService.GetMultipleQuotes(c.Request.Context(), symbols)
+		quoteErrors = quoteErrorMessages(failures)
+		portfolio.TotalValue = portfolio.CashBalance
+		portfolio.TotalPL = 0
+		portfolio.DayPL = 0
+
+		for symbol, position := range portfolio.Positions {
+			if quote, exists := quotes[symbol]; exists {
+				position.MarkToMarket(quote)
 			}
-			portfolio.LastUpdated = time.Now()
+
+			portfolio.TotalValue += position.MarketValue
+			portfolio.TotalPL += position.UnrealizedPL
+			portfolio.DayPL += position.DayPL
 		}
+		portfolio.LastUpdated = time.Now()
 	}
 
-	c.JSON(http.StatusOK, map[string]interface{}{
+	// 區分總額與扣除掛單預留後的可用額
+	holds, err := reservationService.Summary(userID)
+	if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Warn("獲取預留匯總失敗")
+		holds = &services.HoldSummary{Shares: map[string]models.Decimal{}}
+	}
+	portfolio.ReservedCash = holds.Cash
+	portfolio.AvailableCash = portfolio.CashBalance - holds.Cash
+	for symbol, position := range portfolio.Positions {
+		position.ReservedQty = holds.Shares[symbol]
+		position.AvailableQty = position.Quantity - holds.Shares[symbol]
+	}
+
+	response := map[string]interface{}{
 		"portfolio": portfolio,
 		"message":   "投資組合查詢成功",
 		"success":   true,
-	})
+	}
+	if len(quoteErrors) > 0 {
+		response["quoteErrors"] = quoteErrors
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // 獲取交易歷史
@@ -481,7 +541,7 @@ func GetTradingStats(c *gin.Context) {
 func GetStockQuote(c *gin.Context) {
 	symbol := strings.ToUpper(c.Param("symbol"))
 	
-	quote, err := marketDataService.GetStockQuote(symbol)
+	quote, err := marketDataService.GetStockQuote(c.Request.Context(), symbol)
 	if err != nil {
 		logger.WithError(err).WithField("symbol", symbol).Error("獲取股價失敗")
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
@@ -500,31 +560,124 @@ func GetStockQuote(c *gin.Context) {
 	})
 }
 
-// 獲取支持的股票列表
+// 批量獲取實時股價，部分股票失敗時仍返回其餘報價並逐一列出錯誤
+func GetQuotes(c *gin.Context) {
+	values := splitSymbols(c.Query("symbols"))
+	if len(values) == 0 || len(values) > maxQuoteSymbols {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_SYMBOLS",
+			Code:    400,
+			Message: fmt.Sprintf("symbols 需指定1-%d個以逗號分隔的股票代碼", maxQuoteSymbols),
+			Time:    time.Now(),
+		})
+		return
+	}
+	symbols, err := normalizeSymbols(values)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_SYMBOLS",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	quotes, failures := marketDataService.GetMultipleQuotes(c.Request.Context(), symbols)
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"quotes":  quotes,
+		"errors":  quoteErrorMessages(failures),
+		"count":   len(quotes),
+		"message": "批量股價查詢成功",
+		"success": len(failures) == 0,
+	})
+}
+
+// 輔助函數：將各股票的報價錯誤轉為可序列化的訊息
+func quoteErrorMessages(failures map[string]error) map[string]string {
+	messages := make(map[string]string, len(failures))
+	for symbol, err := range failures {
+		messages[symbol] = err.Error()
+	}
+	return messages
+}
+
+// 獲取訂單簿深度
+func GetOrderBook(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
+
+	depth, err := strconv.Atoi(c.DefaultQuery("depth", "10"))
+	if err != nil || depth <= 0 {
+		depth = 10
+	}
+
+	response := gin.H{
+		"book":    matchingEngine.Snapshot(symbol, depth),
+		"message": "訂單簿查詢成功",
+		"success": true,
+	}
+
+	// 查詢指定訂單的隊列位置
+	if orderID := c.Query("order_id"); orderID != "" {
+		response["queuePosition"] = matchingEngine.QueuePosition(symbol, orderID)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// 獲取支持的股票列表及參考數據，可交易的股票附帶實時價格
 func GetSupportedStocks(c *gin.Context) {
-	stocks := marketDataService.GetSupportedStocks()
-	
-	// 獲取所有股票的實時價格
-	quotes, err := marketDataService.GetMultipleQuotes(stocks)
+	securities, err := securityService.List(context.Background())
 	if err != nil {
-		logger.WithError(err).Warn("獲取股票價格失敗")
+		logger.WithError(err).Error("讀取證券參考數據失敗")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "REFERENCE_DATA_ERROR",
+			Code:    500,
+			Message: "無法讀取證券參考數據，請稍後重試",
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	stocks := make([]string, 0, len(securities))
+	for _, security := range securities {
+		if security.IsTradable() {
+			stocks = append(stocks, security.Symbol)
+		}
+	}
+
+	// 獲取所有股票的實時價格
+	quotes, failures := marketDataService.GetMultipleQuotes(c.Request.Context(), stocks)
+	if len(failures) > 0 {
+		logger.WithField("failed", len(failures)).Warn("部分股票價格獲取失敗")
 	}
 
-	stockList := make([]map[string]interface{}, len(stocks))
-	for i, symbol := range stocks {
+	stockList := make([]map[string]interface{}, len(securities))
+	for i, security := range securities {
 		stockInfo := map[string]interface{}{
-			"symbol": symbol,
-			"name":   getStockName(symbol),
+			"symbol":    security.Symbol,
+			"name":      security.Name,
+			"exchange":  security.Exchange,
+			"sector":    security.Sector,
+			"currency":  security.Currency,
+			"lot_size":  security.LotSize,
+			"tick_size": security.TickSize,
+			"status":    security.Status,
+		}
+		if security.HaltReason != "" {
+			stockInfo["halt_reason"] = security.HaltReason
 		}
-		
-		if quote, exists := quotes[symbol]; exists {
+
+		if quote, exists := quotes[security.Symbol]; exists {
 			stockInfo["price"] = quote.Price
 			stockInfo["change"] = quote.Change
 			stockInfo["changePercent"] = quote.ChangePercent
 			stockInfo["volume"] = quote.Volume
 			stockInfo["isMarketOpen"] = quote.IsMarketOpen
+		} else if err, failed := failures[security.Symbol]; failed {
+			stockInfo["quoteError"] = err.Error()
 		}
-		
+
 		stockList[i] = stockInfo
 	}
 
@@ -544,22 +697,35 @@ func HealthCheck(c *gin.Context) {
 		Version:   "2.0.0",
 		Services: map[string]string{
 			"redis":           "connected",
+			"database":        "disabled",
 			"market-data":     "connected", 
 			"trading-history": "connected",
 		},
 	}
 
+	// 檢查數據庫連接
+	if database != nil {
+		health.Services["database"] = "connected"
+		if err := database.Ping(context.Background()); err != nil {
+			health.Services["database"] = "disconnected"
+			health.Status = "degraded"
+		}
+	}
+
 	// 檢查Redis連接
 	if err := rdb.Ping(context.Background()).Err(); err != nil {
 		health.Services["redis"] = "disconnected"
 		health.Status = "degraded"
 	}
 
-	// 檢查市場數據服務
-	_, err := marketDataService.GetStockQuote("AAPL")
-	if err != nil {
-		health.Services["market-data"] = "degraded"
-		health.Status = "degraded"
+	// 檢查外部行情來源的熔斷狀態，不直接請求上游
+	if quoteResilience != nil {
+		state := quoteResilience.BreakerState()
+		health.CircuitBreakers = map[string]string{quoteResilience.Name(): state}
+		if state != services.BreakerClosed {
+			health.Services["market-data"] = "degraded"
+			health.Status = "degraded"
+		}
 	}
 
 	c.JSON(http.StatusOK, health)
@@ -572,28 +738,32 @@ func checkRiskLimits(order *models.Order, marketQuote *services.StockQuote) mode
 	riskScore := 0.0
 
 	// 檢查訂單數量
-	if order.Quantity > 1000 {
+	if order.Quantity > models.DecimalFromInt(1000) {
 		reasons = append(reasons, "訂單數量過大")
 		riskScore += 20
 	}
 
 	// 檢查價格偏離度
-	if order.OrderType == "limit" {
-		priceDiff := abs(order.Price - marketQuote.Price) / marketQuote.Price
-		if priceDiff > 0.1 { // 偏離市價超過10%
-			reasons = append(reasons, fmt.Sprintf("限價偏離市價過大: %.1f%%", priceDiff*100))
+	if order.OrderType == "limit" && marketQuote.Price > 0 {
+		priceDiff := (order.Price - marketQuote.Price).Abs()
+		if priceDiff.MulInt(10) > marketQuote.Price { // 偏離市價超過10%
+			reason := "限價偏離市價過大"
+			if deviation, err := priceDiff.MulInt(100).DivChecked(marketQuote.Price); err == nil {
+				reason = fmt.Sprintf("%s: %.1f%%", reason, deviation)
+			}
+			reasons = append(reasons, reason)
 			riskScore += 15
 		}
 	}
 
-	// 檢查市場開放狀態
-	if !marketQuote.IsMarketOpen {
+	// 按交易日曆檢查市場開放狀態
+	if !symbolCalendar(order.Symbol).IsOpen(time.Now()) {
 		reasons = append(reasons, "市場已關閉")
 		riskScore += 5
 	}
 
 	// 檢查波動率
-	if abs(marketQuote.ChangePercent) > 5 {
+	if marketQuote.ChangePercent.Abs() > models.DecimalFromInt(5) {
 		reasons = append(reasons, fmt.Sprintf("股價波動過大: %.1f%%", marketQuote.ChangePercent))
 		riskScore += 10
 	}
@@ -614,6 +784,300 @@ func checkRiskLimits(order *models.Order, marketQuote *services.StockQuote) mode
 	}
 }
 
+// 輔助函數：校驗訂單類型與有效期的組合（IOC、FOK 只適用於市價單和限價單）及當前交易時段，創建及修改訂單時共用
+func checkOrderSession(calendar *services.TradingCalendar, orderType, timeInForce string) *models.ErrorResponse {
+	if (timeInForce == models.TimeInForceIOC || timeInForce == models.TimeInForceFOK) &&
+		orderType != models.OrderTypeMarket && orderType != models.OrderTypeLimit {
+		return &models.ErrorResponse{
+			Error:   "INVALID_TIME_IN_FORCE",
+			Code:    400,
+			Message: fmt.Sprintf("%s 只適用於市價單和限價單", timeInForce),
+			Time:    time.Now(),
+		}
+	}
+	return checkMarketSession(calendar, orderType, timeInForce)
+}
+
+// 輔助函數：驗證訂單請求並創建新訂單
+func newOrderFromRequest(req models.OrderRequest, userID string) (*models.Order, *models.ErrorResponse) {
+	if req.Quantity > models.MaxOrderQuantity {
+		return nil, &models.ErrorResponse{
+			Error:   "INVALID_QUANTITY",
+			Code:    400,
+			Message: fmt.Sprintf("訂單數量不能超過 %v", models.MaxOrderQuantity),
+			Time:    time.Now(),
+		}
+	}
+
+	// 驗證股票代碼及交易狀態
+	security, errResp := lookupTradableSecurity(req.Symbol)
+	if errResp != nil {
+		return nil, errResp
+	}
+	calendar := securityCalendar(security)
+
+	// 驗證訂單有效期，未指定時默認為當日有效
+	timeInForce := strings.ToUpper(req.TimeInForce)
+	if timeInForce == "" {
+		timeInForce = models.TimeInForceDay
+	}
+	if !models.IsValidTimeInForce(timeInForce) {
+		return nil, &models.ErrorResponse{
+			Error:   "INVALID_TIME_IN_FORCE",
+			Code:    400,
+			Message: fmt.Sprintf("不支持的訂單有效期類型: %s", req.TimeInForce),
+			Time:    time.Now(),
+		}
+	}
+
+	if errResp := checkOrderSession(calendar, req.OrderType, timeInForce); errResp != nil {
+		return nil, errResp
+	}
+
+	var expireAt *time.Time
+	switch timeInForce {
+	case models.TimeInForceDay:
+		// 休市期間提交的DAY訂單在下一個交易日收盤時過期
+		closeAt := calendar.NextClose(time.Now())
+		expireAt = &closeAt
+	case models.TimeInForceGTD:
+		if req.ExpireAt == nil || !req.ExpireAt.After(time.Now()) {
+			return nil, &models.ErrorResponse{
+				Error:   "INVALID_EXPIRE_AT",
+				Code:    400,
+				Message: "GTD訂單必須指定未來的過期時間 expire_at",
+				Time:    time.Now(),
+			}
+		}
+		expireAt = req.ExpireAt
+	}
+
+	// 創建訂單
+	order := &models.Order{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		Symbol:       strings.ToUpper(req.Symbol),
+		Side:         req.Side,
+		OrderType:    req.OrderType,
+		Quantity:     req.Quantity,
+		Price:        req.Price,
+		Status:       models.OrderStatusNew,
+		FilledQty:    0,
+		RemainingQty: req.Quantity,
+		AvgPrice:     0,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		TimeInForce:  timeInForce,
+		ExpireAt:     expireAt,
+		StopPrice:    req.StopPrice,
+		TrailAmount:  req.TrailAmount,
+		TrailPercent: req.TrailPercent,
+	}
+
+	// 按訂單類型校驗價格參數
+	if err := validateOrderPricing(order); err != nil {
+		return nil, &models.ErrorResponse{
+			Error:   "INVALID_ORDER_PRICE",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		}
+	}
+
+	// 按參考數據校驗最小交易單位及最小價格變動
+	if code, err := checkOrderIncrements(security, order); err != nil {
+		return nil, &models.ErrorResponse{
+			Error:   code,
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		}
+	}
+
+	if errResp := applyLotSelection(order, req.LotMethod, req.LotIDs); errResp != nil {
+		return nil, errResp
+	}
+
+	return order, nil
+}
+
+// 輔助函數：校驗賣單的稅批扣減方式，指定的稅批須屬於用戶在該股票的持倉
+func applyLotSelection(order *models.Order, method string, lotIDs []string) *models.ErrorResponse {
+	if method == "" && len(lotIDs) == 0 {
+		return nil
+	}
+	invalid := func(message string) *models.ErrorResponse {
+		return &models.ErrorResponse{
+			Error:   "INVALID_LOT_SELECTION",
+			Code:    400,
+			Message: message,
+			Time:    time.Now(),
+		}
+	}
+
+	if order.Side != "sell" {
+		return invalid("只有賣單可以指定稅批扣減方式")
+	}
+	method = strings.ToLower(method)
+	if method != "" && !services.IsValidLotMethod(method) {
+		return invalid(fmt.Sprintf("不支持的稅批扣減方法: %s", method))
+	}
+	if method == services.LotMethodSpecific && len(lotIDs) == 0 {
+		return invalid("specific 方法必須指定 lot_ids")
+	}
+
+	if len(lotIDs) > 0 {
+		if method != "" && method != services.LotMethodSpecific {
+			return invalid("指定 lot_ids 時 lot_method 只能為 specific")
+		}
+		method = services.LotMethodSpecific
+
+		var position *services.Position
+		portfolio, err := tradingHistoryService.GetPortfolio(order.UserID)
+		if err != nil && err != services.ErrNotFound {
+			logger.WithError(err).WithField("user_id", order.UserID).Error("讀取投資組合失敗")
+			return &models.ErrorResponse{
+				Error:   "INTERNAL_ERROR",
+				Code:    500,
+				Message: "內部服務錯誤",
+				Time:    time.Now(),
+			}
+		}
+		if portfolio != nil {
+			position = portfolio.Positions[order.Symbol]
+		}
+
+		seen := make(map[string]bool, len(lotIDs))
+		for _, id := range lotIDs {
+			if seen[id] {
+				return invalid(fmt.Sprintf("稅批 %s 重複指定", id))
+			}
+			seen[id] = true
+			if position == nil || position.Lot(id) == nil {
+				return invalid(fmt.Sprintf("稅批 %s 不屬於 %s 的持倉", id, order.Symbol))
+			}
+		}
+	}
+
+	order.LotMethod = method
+	order.LotIDs = lotIDs
+	return nil
+}
+
+// 輔助函數：為訂單預留資金（買入）或持股（賣出），保證金賬戶按保證金要求預留，可用餘額不足時返回錯誤響應
+func reserveBalances(order *models.Order, marketQuote *services.StockQuote) *models.ErrorResponse {
+	price := estimatedPrice(order, marketQuote)
+	if notional, err := order.RemainingQty.MulChecked(price); err != nil || notional > models.MaxOrderNotional {
+		return &models.ErrorResponse{
+			Error:   "ORDER_TOO_LARGE",
+			Code:    400,
+			Message: fmt.Sprintf("訂單金額超過上限 $%.2f", models.MaxOrderNotional),
+			Time:    time.Now(),
+		}
+	}
+
+	hold := services.NewHold(order, price)
+	err := reservationService.Reserve(hold)
+	if err == nil {
+		return nil
+	}
+
+	var unavailable *services.BorrowUnavailableError
+	if errors.As(err, &unavailable) {
+		return &models.ErrorResponse{
+			Error:   "BORROW_UNAVAILABLE",
+			Code:    400,
+			Message: fmt.Sprintf("可借券不足，無法賣空 %v 股 %s，可借 %v 股", unavailable.Required, order.Symbol, unavailable.Available),
+			Time:    time.Now(),
+		}
+	}
+
+	var insufficient *services.InsufficientBalanceError
+	if !errors.As(err, &insufficient) {
+		logger.WithError(err).WithField("order_id", order.ID).Error("預留可用餘額失敗")
+		return &models.ErrorResponse{
+			Error:   "RESERVATION_ERROR",
+			Code:    500,
+			Message: "預留可用餘額失敗，請稍後重試",
+			Time:    time.Now(),
+		}
+	}
+
+	if insufficient.Margin {
+		return &models.ErrorResponse{
+			Error:   "INSUFFICIENT_MARGIN",
+			Code:    400,
+			Message: fmt.Sprintf("保證金不足。可用保證金: $%.2f, 需要: $%.2f", insufficient.Available, insufficient.Required),
+			Time:    time.Now(),
+		}
+	}
+	if order.Side == "buy" {
+		return &models.ErrorResponse{
+			Error:   "INSUFFICIENT_FUNDS",
+			Code:    400,
+			Message: fmt.Sprintf("資金不足。可用餘額: $%.2f, 需要: $%.2f", 
+				insufficient.Available, insufficient.Required),
+			Time:    time.Now(),
+		}
+	}
+	return &models.ErrorResponse{
+		Error:   "INSUFFICIENT_SHARES",
+		Code:    400,
+		Message: fmt.Sprintf("持股不足，無法賣出 %g 股 %s，可用 %g 股", 
+			insufficient.Required, order.Symbol, insufficient.Available),
+		Time:    time.Now(),
+	}
+}
+
+// 輔助函數：釋放訂單的預留
+func releaseReservation(order *models.Order) {
+	if err := reservationService.Release(order.UserID, order.ID); err != nil {
+		logger.WithError(err).WithField("order_id", order.ID).Warn("釋放預留失敗")
+	}
+}
+
+// 輔助函數：將預留縮減到訂單的剩餘數量
+func shrinkReservation(order *models.Order) {
+	if err := reservationService.Shrink(order.UserID, order.ID, order.RemainingQty); err != nil {
+		logger.WithError(err).WithField("order_id", order.ID).Warn("縮減預留失敗")
+	}
+}
+
+// 輔助函數 - 按訂單類型校驗價格參數，各價格不得超過單筆訂單上限
+func validateOrderPricing(order *models.Order) error {
+	for _, price := range []models.Decimal{order.Price, order.StopPrice, order.TrailAmount} {
+		if price > models.MaxOrderPrice {
+			return fmt.Errorf("價格不能超過 %v", models.MaxOrderPrice)
+		}
+	}
+	switch order.OrderType {
+	case models.OrderTypeLimit, models.OrderTypeStop, models.OrderTypeMarketIfTouched:
+		if order.Price <= 0 {
+			return fmt.Errorf("%s 訂單必須指定大於0的價格", order.OrderType)
+		}
+	case models.OrderTypeStopLimit:
+		if order.StopPrice <= 0 || order.Price <= 0 {
+			return fmt.Errorf("止損限價單必須同時指定觸發價 stop_price 和限價 price")
+		}
+	case models.OrderTypeTrailingStop:
+		if (order.TrailAmount > 0) == (order.TrailPercent > 0) {
+			return fmt.Errorf("追蹤止損單必須且只能指定 trail_amount 或 trail_percent 其中之一")
+		}
+		if order.TrailAmount < 0 || order.TrailPercent < 0 || order.TrailPercent >= models.DecimalFromInt(100) {
+			return fmt.Errorf("追蹤距離無效")
+		}
+	}
+	return nil
+}
+
+// 輔助函數 - 估算訂單成交價格，用於資金檢查
+func estimatedPrice(order *models.Order, marketQuote *services.StockQuote) models.Decimal {
+	if order.OrderType == models.OrderTypeMarket || order.OrderType == models.OrderTypeTrailingStop {
+		return marketQuote.Price
+	}
+	return order.Price
+}
+
 func getRiskLevel(score float64) string {
 	if score > 30 {
 		return "HIGH"
@@ -623,43 +1087,6 @@ func getRiskLevel(score float64) string {
 	return "LOW"
 }
 
-func abs(x float64) float64 {
-	if x < 0 {
-		return -x
-	}
-	return x
-}
-
-func getStockName(symbol string) string {
-	names := map[string]string{
-		"AAPL":  "Apple Inc.",
-		"GOOGL": "Alphabet Inc.",
-		"MSFT":  "Microsoft Corp.",
-		"AMZN":  "Amazon.com Inc.",
-		"TSLA":  "Tesla Inc.",
-		"META":  "Meta Platforms Inc.",
-		"NFLX":  "Netflix Inc.",
-		"NVDA":  "NVIDIA Corp.",
-		"JPM":   "JPMorgan Chase & Co.",
-		"JNJ":   "Johnson & Johnson",
-		"V":     "Visa Inc.",
-		"PG":    "Procter & Gamble Co.",
-		"MA":    "Mastercard Inc.",
-		"UNH":   "UnitedHealth Group Inc.",
-		"HD":    "Home Depot Inc.",
-		"DIS":   "Walt Disney Co.",
-		"PYPL":  "PayPal Holdings Inc.",
-		"BAC":   "Bank of America Corp.",
-		"VZ":    "Verizon Communications Inc.",
-		"ADBE":  "Adobe Inc.",
-	}
-	
-	if name, exists := names[symbol]; exists {
-		return name
-	}
-	return symbol
-}
-
 // 修改訂單
 func UpdateOrder(c *gin.Context) {
 	orderID := c.Param("id")
@@ -686,7 +1113,7 @@ func UpdateOrder(c *gin.Context) {
 	}
 
 	// 獲取現有訂單
-	existingOrder, err := getOrderFromRedis(orderID)
+	existingOrder, err := loadOrder(orderID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error:   "ORDER_NOT_FOUND",
@@ -697,22 +1124,26 @@ func UpdateOrder(c *gin.Context) {
 		return
 	}
 
-	// 檢查訂單是否可以修改
-	if existingOrder.Status != "pending" {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = "user_" + uuid.New().String()[:8]
+	}
+	if errResp := checkOrderOwner(existingOrder, userID); errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
+	}
+
+	// 檢查訂單是否可以修改（新訂單或部分成交訂單）
+	if !existingOrder.IsActive() {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Error:   "ORDER_NOT_MODIFIABLE",
 			Code:    400,
-			Message: "只有待執行的訂單才能修改",
+			Message: fmt.Sprintf("訂單狀態為 %s，只有待執行或部分成交的訂單才能修改", existingOrder.Status),
 			Time:    time.Now(),
 		})
 		return
 	}
 
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		userID = "user_" + uuid.New().String()[:8]
-	}
-
 	// 記錄修改操作
 	logger.WithFields(logrus.Fields{
 		"user_id":      userID,
@@ -725,41 +1156,106 @@ func UpdateOrder(c *gin.Context) {
 		"action":       "order_modification",
 	}).Info("訂單修改請求")
 
+	marketQuote, errResp := orderQuote(c.Request.Context(), existingOrder.Symbol)
+	if errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
+	}
+
+	// 先從訂單簿撤出，以撮合引擎中的最新成交狀態為準
+	existingOrder, withdrawn := withdrawOrder(existingOrder)
+	if !withdrawn || !existingOrder.IsActive() {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "ORDER_NOT_MODIFIABLE",
+			Code:    409,
+			Message: fmt.Sprintf("訂單狀態為 %s，已成交或正在結算，不能修改", existingOrder.Status),
+			Time:    time.Now(),
+		})
+		return
+	}
+	original := existingOrder.Clone()
+
+	// 校驗失敗時將原訂單放回其價位，不重新撮合
+	reject := func(code, message string) {
+		if !matchingEngine.Restore(original) {
+			logger.WithField("order_id", original.ID).Error("恢復原訂單到訂單簿失敗")
+		}
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   code,
+			Code:    400,
+			Message: message,
+			Time:    time.Now(),
+		})
+	}
+
 	// 更新訂單信息
 	if req.Quantity != nil {
+		// 部分成交訂單的新數量必須大於已成交數量
+		if *req.Quantity <= existingOrder.FilledQty {
+			reject("INVALID_QUANTITY", fmt.Sprintf("新數量必須大於已成交數量 %v", existingOrder.FilledQty))
+			return
+		}
+		if *req.Quantity > models.MaxOrderQuantity {
+			reject("INVALID_QUANTITY", fmt.Sprintf("訂單數量不能超過 %v", models.MaxOrderQuantity))
+			return
+		}
 		existingOrder.Quantity = *req.Quantity
 		existingOrder.RemainingQty = *req.Quantity - existingOrder.FilledQty
 	}
 	if req.Price != nil {
 		existingOrder.Price = *req.Price
 	}
-	if req.OrderType != nil {
+	if req.OrderType != nil && *req.OrderType != existingOrder.OrderType {
+		if !models.IsValidOrderType(*req.OrderType) {
+			reject("INVALID_ORDER_TYPE", fmt.Sprintf("不支持的訂單類型: %s", *req.OrderType))
+			return
+		}
+		// 改變類型後重新等待觸發
 		existingOrder.OrderType = *req.OrderType
+		existingOrder.TriggeredAt = nil
+		existingOrder.HighWaterMark = 0
 	}
-	existingOrder.UpdatedAt = time.Now()
-
-	// 驗證修改後的訂單
-	if existingOrder.Side == "buy" {
-		portfolio, err := tradingHistoryService.GetPortfolio(userID)
-		if err == nil {
-			requiredAmount := existingOrder.Quantity * existingOrder.Price
-			if portfolio.CashBalance < requiredAmount*1.01 {
-				c.JSON(http.StatusBadRequest, models.ErrorResponse{
-					Error:   "INSUFFICIENT_FUNDS",
-					Code:    400,
-					Message: fmt.Sprintf("修改後資金不足。可用餘額: $%.2f, 需要: $%.2f", 
-						portfolio.CashBalance, requiredAmount),
-					Time:    time.Now(),
-				})
-				return
-			}
-		}
+	if req.StopPrice != nil {
+		existingOrder.StopPrice = *req.StopPrice
+	}
+	if req.TrailAmount != nil {
+		existingOrder.TrailAmount = *req.TrailAmount
+	}
+	if req.TrailPercent != nil {
+		existingOrder.TrailPercent = *req.TrailPercent
+	}
+	if err := validateOrderPricing(existingOrder); err != nil {
+		reject("INVALID_ORDER_PRICE", err.Error())
+		return
+	}
+	security, errResp := lookupTradableSecurity(existingOrder.Symbol)
+	if errResp != nil {
+		reject(errResp.Error, errResp.Message)
+		return
+	}
+	if code, err := checkOrderIncrements(security, existingOrder); err != nil {
+		reject(code, err.Error())
+		return
+	}
+	// 修改後的訂單類型須與原有效期兼容，並符合當前交易時段，與創建時的校驗一致
+	if errResp := checkOrderSession(securityCalendar(security), existingOrder.OrderType, existingOrder.TimeInForce); errResp != nil {
+		reject(errResp.Error, errResp.Message)
+		return
+	}
+	existingOrder.Touch(time.Now())
+
+	// 按修改後的未成交部分重新預留，失敗時保留原預留
+	if errResp := reserveBalances(existingOrder, marketQuote); errResp != nil {
+		reject(errResp.Error, "修改後"+errResp.Message)
+		return
 	}
 
+	// 改單後重新進入訂單簿，失去原有時間優先權
+	report := matchingEngine.Submit(existingOrder, marketQuote)
+	settleExecution(report, marketQuote)
+
 	// 保存修改後的訂單到Redis
-	orderKey := fmt.Sprintf("order:%s", orderID)
-	orderJSON, _ := json.Marshal(existingOrder)
-	err = rdb.Set(context.Background(), orderKey, string(orderJSON), 24*time.Hour).Err()
+	err = saveOrder(existingOrder)
 	if err != nil {
 		logger.WithError(err).Error("保存修改後的訂單失敗")
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
@@ -797,7 +1293,7 @@ func CancelOrder(c *gin.Context) {
 	}
 
 	// 獲取現有訂單
-	existingOrder, err := getOrderFromRedis(orderID)
+	existingOrder, err := loadOrder(orderID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error:   "ORDER_NOT_FOUND",
@@ -807,23 +1303,27 @@ func CancelOrder(c *gin.Context) {
 		})
 		return
 	}
+	if errResp := checkOrderOwner(existingOrder, userID); errResp != nil {
+		c.JSON(errResp.Code, errResp)
+		return
+	}
 
 	// 檢查訂單是否可以取消
-	if existingOrder.Status == "filled" {
+	if existingOrder.Status == models.OrderStatusCancelled {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "ORDER_NOT_CANCELLABLE",
+			Error:   "ORDER_ALREADY_CANCELLED",
 			Code:    400,
-			Message: "已成交的訂單不能取消",
+			Message: "訂單已經被取消",
 			Time:    time.Now(),
 		})
 		return
 	}
 
-	if existingOrder.Status == "cancelled" {
+	if !existingOrder.CanTransitionTo(models.OrderStatusCancelled) {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "ORDER_ALREADY_CANCELLED",
+			Error:   "ORDER_NOT_CANCELLABLE",
 			Code:    400,
-			Message: "訂單已經被取消",
+			Message: fmt.Sprintf("訂單狀態為 %s，不能取消", existingOrder.Status),
 			Time:    time.Now(),
 		})
 		return
@@ -840,13 +1340,36 @@ func CancelOrder(c *gin.Context) {
 		"action":     "order_cancellation",
 	}).Info("訂單取消請求")
 
-	// 更新訂單狀態
-	existingOrder.Status = "cancelled"
-	existingOrder.UpdatedAt = time.Now()
+	// 從訂單簿撤單，只處理撮合引擎實際撤出的訂單，以其最新成交數量為準
+	existingOrder, withdrawn := withdrawOrder(existingOrder)
+	if !withdrawn {
+		message := "訂單正在結算成交，請稍後重試"
+		if existingOrder.IsTerminal() {
+			message = fmt.Sprintf("訂單狀態為 %s，不能取消", existingOrder.Status)
+		}
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "ORDER_NOT_CANCELLABLE",
+			Code:    409,
+			Message: message,
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	// 更新訂單狀態，剩餘未成交數量隨之清零
+	cancelledQty := existingOrder.RemainingQty
+	if err := existingOrder.TransitionTo(models.OrderStatusCancelled); err != nil {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "ORDER_NOT_CANCELLABLE",
+			Code:    409,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
 
-	// 如果是部分成交訂單，需要處理剩餘數量
+	// 部分成交訂單保留已成交部分
 	if existingOrder.FilledQty > 0 {
-		existingOrder.RemainingQty = 0
 		logger.WithFields(logrus.Fields{
 			"order_id":   orderID,
 			"filled_qty": existingOrder.FilledQty,
@@ -855,9 +1378,7 @@ func CancelOrder(c *gin.Context) {
 	}
 
 	// 保存取消後的訂單到Redis
-	orderKey := fmt.Sprintf("order:%s", orderID)
-	orderJSON, _ := json.Marshal(existingOrder)
-	err = rdb.Set(context.Background(), orderKey, string(orderJSON), 24*time.Hour).Err()
+	err = saveOrder(existingOrder)
 	if err != nil {
 		logger.WithError(err).Error("保存取消後的訂單失敗")
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
@@ -869,6 +1390,14 @@ func CancelOrder(c *gin.Context) {
 		return
 	}
 
+	releaseReservation(existingOrder)
+	recordOrderEvent(existingOrder, models.OrderStatusCancelled, cancelledQty, "user_cancelled")
+
+	// 訂單組內的訂單連帶處理其他成員
+	if existingOrder.GroupID != "" {
+		cascadeGroupCancel(existingOrder)
+	}
+
 	c.JSON(http.StatusOK, models.OrderResponse{
 		Order:   existingOrder,
 		Message: "訂單取消成功",
@@ -876,15 +1405,34 @@ func CancelOrder(c *gin.Context) {
 	})
 }
 
-// 獲取用戶所有訂單
+// 獲取用戶訂單：支持按狀態、股票、方向及時間範圍過濾，使用游標分頁
 func GetUserOrders(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
 		userID = "user_" + uuid.New().String()[:8]
 	}
 
-	// 從Redis獲取用戶訂單列表
-	orderKeys, err := rdb.Keys(context.Background(), "order:*").Result()
+	query, err := parseOrderQuery(c, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_PARAMETER",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
+
+	page, err := orderStore.ListUserOrders(context.Background(), query)
+	if err == services.ErrInvalidCursor {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "INVALID_CURSOR",
+			Code:    400,
+			Message: err.Error(),
+			Time:    time.Now(),
+		})
+		return
+	}
 	if err != nil {
 		logger.WithError(err).Error("獲取訂單列表失敗")
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
@@ -896,43 +1444,238 @@ func GetUserOrders(c *gin.Context) {
 		return
 	}
 
-	var userOrders []*models.Order
-	for _, orderKey := range orderKeys {
-		orderJSON, err := rdb.Get(context.Background(), orderKey).Result()
-		if err != nil {
-			continue
+	c.JSON(http.StatusOK, gin.H{
+		"orders":      page.Orders,
+		"total":       len(page.Orders),
+		"next_cursor": page.NextCursor,
+		"has_more":    page.NextCursor != "",
+		"success":     true,
+	})
+}
+
+// 輔助函數：解析訂單列表的查詢參數
+func parseOrderQuery(c *gin.Context, userID string) (services.OrderQuery, error) {
+	query := services.OrderQuery{
+		UserID: userID,
+		Symbol: strings.ToUpper(c.Query("symbol")),
+		Side:   strings.ToLower(c.Query("side")),
+		Desc:   true,
+		Limit:  defaultUserOrders,
+		Cursor: c.Query("cursor"),
+	}
+
+	if statusParam := c.Query("status"); statusParam != "" {
+		for _, status := range strings.Split(statusParam, ",") {
+			status = strings.ToLower(strings.TrimSpace(status))
+			if !models.IsValidOrderStatus(status) {
+				return query, fmt.Errorf("無效的訂單狀態: %s", status)
+			}
+			query.Statuses = append(query.Statuses, status)
 		}
+	}
 
-		var order models.Order
-		if err := json.Unmarshal([]byte(orderJSON), &order); err != nil {
-			continue
+	if query.Side != "" && query.Side != "buy" && query.Side != "sell" {
+		return query, fmt.Errorf("無效的買賣方向: %s", query.Side)
+	}
+
+	for name, dest := range map[string]**time.Time{"from": &query.From, "to": &query.To} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("%s 必須是RFC3339格式的時間", name)
+			}
+			*dest = &parsed
 		}
+	}
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return query, errors.New("from 必須早於 to")
+	}
 
-		// 只返回當前用戶的訂單
-		if order.UserID == userID {
-			userOrders = append(userOrders, &order)
+	switch c.DefaultQuery("sort", "-created_at") {
+	case "-created_at":
+	case "created_at":
+		query.Desc = false
+	default:
+		return query, errors.New("sort 只支持 created_at 或 -created_at")
+	}
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit <= 0 || limit > maxUserOrders {
+			return query, fmt.Errorf("limit 必須在1-%d之間", maxUserOrders)
 		}
+		query.Limit = limit
 	}
+	return query, nil
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"orders": userOrders,
-		"total":  len(userOrders),
-		"success": true,
-	})
+// 輔助函數：讀取訂單，不存在時返回 services.ErrNotFound
+func loadOrder(orderID string) (*models.Order, error) {
+	return orderStore.GetOrder(context.Background(), orderID)
+}
+
+// 輔助函數：只有訂單所屬用戶可以修改或取消訂單
+func checkOrderOwner(order *models.Order, userID string) *models.ErrorResponse {
+	if order.UserID == userID {
+		return nil
+	}
+	return &models.ErrorResponse{
+		Error:   "ORDER_FORBIDDEN",
+		Code:    403,
+		Message: "無權操作其他用戶的訂單",
+		Time:    time.Now(),
+	}
 }
 
-// 輔助函數：從Redis獲取訂單
-func getOrderFromRedis(orderID string) (*models.Order, error) {
-	orderKey := fmt.Sprintf("order:%s", orderID)
-	orderJSON, err := rdb.Get(context.Background(), orderKey).Result()
+// 輔助函數：從撮合引擎撤出訂單並返回其最新狀態。訂單不在訂單簿內時重新讀取，
+// 只有尚未提交的 held 子訂單可直接處理，其餘說明訂單已成交或正在結算，第二個返回值為 false
+func withdrawOrder(order *models.Order) (*models.Order, bool) {
+	if resting := matchingEngine.Cancel(order.Symbol, order.ID); resting != nil {
+		return resting, true
+	}
+
+	latest, err := loadOrder(order.ID)
 	if err != nil {
-		return nil, err
+		logger.WithError(err).WithField("order_id", order.ID).Error("重新讀取訂單失敗")
+		return order, false
+	}
+	return latest, latest.Status == models.OrderStatusHeld
+}
+
+// 輔助函數：保存訂單
+func saveOrder(order *models.Order) error {
+	return orderStore.SaveOrder(context.Background(), order)
+}
+
+// 輔助函數：記錄撮合成交、保存受影響的訂單並發布成交通知。
+// 記錄失敗的成交轉入待結算隊列，相關訂單的預留及訂單組推進留待重試成功後處理
+func settleExecution(report *services.ExecutionReport, marketQuote *services.StockQuote) {
+	orders := make(map[string]*models.Order, len(report.Orders))
+	for _, order := range report.Orders {
+		orders[order.ID] = order
+	}
+
+	settled := make([]services.Fill, 0, len(report.Fills))
+	for _, fill := range report.Fills {
+		settlement := services.NewFillSettlement(fill, marketQuote)
+		if err := tradingHistoryService.Settle(settlement); err != nil {
+			logger.WithError(err).WithField("fill_id", fill.ID).Error("記錄交易失敗，成交轉入待結算隊列")
+			pendingSettlements.add(settlement, orders)
+			continue
+		}
+		settled = append(settled, fill)
+	}
+
+	// 成交轉換預留
+	for _, fill := range settled {
+		consumeFillReservations(fill)
+	}
+
+	for _, order := range report.Orders {
+		if err := saveOrder(order); errors.Is(err, services.ErrStaleOrder) {
+			logger.WithField("order_id", order.ID).Warn("訂單已被並發請求更新，不覆蓋")
+		} else if err != nil {
+			logger.WithError(err).WithField("order_id", order.ID).Error("保存訂單失敗")
+		}
+		if !pendingSettlements.holds(order.ID) {
+			settleReservation(order)
+		}
 	}
 
-	var order models.Order
-	if err := json.Unmarshal([]byte(orderJSON), &order); err != nil {
-		return nil, err
+	for _, fill := range settled {
+		publishFills(fill, orders)
 	}
 
-	return &order, nil
-} 
\ No newline at end of file
+	for _, termination := range report.Terminations {
+		order := &models.Order{
+			ID:     termination.OrderID,
+			UserID: termination.UserID,
+			Symbol: termination.Symbol,
+			Price:  termination.Price,
+		}
+		recordOrderEvent(order, termination.Status, termination.Quantity, termination.Reason)
+	}
+
+	// 推進括號訂單及OCO訂單組
+	for _, order := range report.Orders {
+		if order.GroupID != "" && !pendingSettlements.holds(order.ID) {
+			syncOrderGroup(order, marketQuote)
+		}
+	}
+}
+
+// 輔助函數：訂單結束後釋放剩餘預留；OCO關聯訂單隨部分成交縮減時，預留一併縮減
+func settleReservation(order *models.Order) {
+	if order.IsTerminal() {
+		releaseReservation(order)
+	} else if len(order.OCOOrderIDs) > 0 {
+		shrinkReservation(order)
+	}
+}
+
+// 輔助函數：按成交數量轉換雙方的預留
+func consumeFillReservations(fill services.Fill) {
+	consumeReservation(fill.Taker, fill.Quantity)
+	if fill.Maker != nil {
+		consumeReservation(*fill.Maker, fill.Quantity)
+	}
+}
+
+// 輔助函數：向成交雙方發布成交通知
+func publishFills(fill services.Fill, orders map[string]*models.Order) {
+	publishFill(fill, fill.Taker, "taker", orders)
+	if fill.Maker != nil {
+		publishFill(fill, *fill.Maker, "maker", orders)
+	}
+}
+
+// 輔助函數：按成交數量轉換預留
+func consumeReservation(party services.FillParty, quantity models.Decimal) {
+	if err := reservationService.ConsumeFill(party.UserID, party.OrderID, quantity); err != nil {
+		logger.WithError(err).WithField("order_id", party.OrderID).Warn("轉換預留失敗")
+	}
+}
+
+// 輔助函數：記錄訂單取消、拒絕或過期事件
+func recordOrderEvent(order *models.Order, status string, quantity models.Decimal, reason string) {
+	eventType := services.OrderEventCancelled
+	switch status {
+	case models.OrderStatusRejected:
+		eventType = services.OrderEventRejected
+	case models.OrderStatusExpired:
+		eventType = services.OrderEventExpired
+	}
+
+	metadata := models.JSONField{"reason": reason, "status": status}
+	if _, err := orderEventService.RecordEvent(order.ID, order.UserID, eventType, order.Symbol, quantity, order.Price, metadata); err != nil {
+		logger.WithError(err).WithField("order_id", order.ID).Error("記錄訂單事件失敗")
+	}
+}
+
+// 輔助函數：向成交參與方發布成交通知
+func publishFill(fill services.Fill, party services.FillParty, liquidity string, orders map[string]*models.Order) {
+	if fill.Maker == nil {
+		liquidity = "market"
+	}
+
+	notification := &services.FillNotification{
+		FillID:     fill.ID,
+		OrderID:    party.OrderID,
+		UserID:     party.UserID,
+		Symbol:     fill.Symbol,
+		Side:       party.Side,
+		Quantity:   fill.Quantity,
+		Price:      fill.Price,
+		Liquidity:  liquidity,
+		ExecutedAt: fill.ExecutedAt,
+	}
+	if order, exists := orders[party.OrderID]; exists {
+		notification.OrderStatus = order.Status
+		notification.FilledQty = order.FilledQty
+		notification.RemainingQty = order.RemainingQty
+	}
+
+	if err := orderEventService.PublishFill(notification); err != nil {
+		logger.WithError(err).WithField("fill_id", fill.ID).Warn("發布成交通知失敗")
+	}
+}
@@ -2,40 +2,41 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
+
+	"trading-api/models"
+	"trading-api/services"
 )
 
 // 用戶資料結構
 type UserProfile struct {
-	UserID         string    `json:"user_id"`
-	Email          string    `json:"email"`
-	DisplayName    string    `json:"display_name"`
-	InitialBalance float64   `json:"initial_balance"`
-	CurrentBalance float64   `json:"current_balance"`
-	TotalTrades    int       `json:"total_trades"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	UserID         string         `json:"user_id"`
+	Email          string         `json:"email"`
+	DisplayName    string         `json:"display_name"`
+	InitialBalance models.Decimal `json:"initial_balance"`
+	CurrentBalance models.Decimal `json:"current_balance"`
+	TotalTrades    int            `json:"total_trades"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
 }
 
 // 帳戶重置請求
 type ResetAccountRequest struct {
-	ResetBalance   float64 `json:"reset_balance"`
-	ClearPositions bool    `json:"clear_positions"`
-	ClearTrades    bool    `json:"clear_trades"`
+	ResetBalance   models.Decimal `json:"reset_balance"`
+	ClearPositions bool           `json:"clear_positions"`
+	ClearTrades    bool           `json:"clear_trades"`
 }
 
 // 帳戶重置響應
 type ResetAccountResponse struct {
-	Success    bool    `json:"success"`
-	Message    string  `json:"message"`
-	NewBalance float64 `json:"new_balance"`
-	Timestamp  string  `json:"timestamp"`
+	Success    bool           `json:"success"`
+	Message    string         `json:"message"`
+	NewBalance models.Decimal `json:"new_balance"`
+	Timestamp  string         `json:"timestamp"`
 }
 
 // 獲取用戶資料
@@ -51,24 +52,24 @@ func GetUserProfile(c *gin.Context) {
 	ctx := context.Background()
 	profileKey := fmt.Sprintf("user_profile:%s", userID)
 
-	// 從Redis獲取用戶資料
-	profileJSON, err := rdb.Get(ctx, profileKey).Result()
-	if err == redis.Nil {
+	// 獲取用戶資料（以配置項形式保存）
+	var profile UserProfile
+	err := configStore.GetConfig(ctx, profileKey, &profile)
+	if err == services.ErrNotFound {
 		// 用戶資料不存在，創建默認資料
 		defaultProfile := &UserProfile{
 			UserID:         userID,
 			Email:          "demo@example.com",
 			DisplayName:    "演示用戶",
-			InitialBalance: 100000.0,
-			CurrentBalance: 100000.0,
+			InitialBalance: services.InitialCashBalance,
+			CurrentBalance: services.InitialCashBalance,
 			TotalTrades:    0,
 			CreatedAt:      time.Now(),
 			UpdatedAt:      time.Now(),
 		}
 
-		// 保存到Redis
-		profileData, _ := json.Marshal(defaultProfile)
-		rdb.Set(ctx, profileKey, profileData, time.Hour*24*365)
+		// 保存默認資料
+		configStore.SetConfig(ctx, profileKey, defaultProfile)
 
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -83,15 +84,6 @@ func GetUserProfile(c *gin.Context) {
 		return
 	}
 
-	var profile UserProfile
-	if err := json.Unmarshal([]byte(profileJSON), &profile); err != nil {
-		logger.WithError(err).Error("解析用戶資料失敗")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "解析用戶資料失敗",
-		})
-		return
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"user":    profile,
@@ -124,8 +116,9 @@ func UpdateUserProfile(c *gin.Context) {
 	profileKey := fmt.Sprintf("user_profile:%s", userID)
 
 	// 獲取現有資料
-	profileJSON, err := rdb.Get(ctx, profileKey).Result()
-	if err == redis.Nil {
+	var profile UserProfile
+	err := configStore.GetConfig(ctx, profileKey, &profile)
+	if err == services.ErrNotFound {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "用戶資料不存在",
 		})
@@ -138,31 +131,13 @@ func UpdateUserProfile(c *gin.Context) {
 		return
 	}
 
-	var profile UserProfile
-	if err := json.Unmarshal([]byte(profileJSON), &profile); err != nil {
-		logger.WithError(err).Error("解析用戶資料失敗")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "解析用戶資料失敗",
-		})
-		return
-	}
-
 	// 更新資料
 	profile.DisplayName = updateData.DisplayName
 	profile.Email = updateData.Email
 	profile.UpdatedAt = time.Now()
 
 	// 保存更新後的資料
-	updatedData, err := json.Marshal(profile)
-	if err != nil {
-		logger.WithError(err).Error("序列化用戶資料失敗")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "保存用戶資料失敗",
-		})
-		return
-	}
-
-	if err := rdb.Set(ctx, profileKey, updatedData, time.Hour*24*365).Err(); err != nil {
+	if err := configStore.SetConfig(ctx, profileKey, profile); err != nil {
 		logger.WithError(err).Error("保存用戶資料失敗")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "保存用戶資料失敗",
@@ -199,8 +174,9 @@ func ResetAccount(c *gin.Context) {
 	
 	// 重置用戶餘額
 	profileKey := fmt.Sprintf("user_profile:%s", userID)
-	profileJSON, err := rdb.Get(ctx, profileKey).Result()
-	if err != redis.Nil && err != nil {
+	var profile UserProfile
+	err := configStore.GetConfig(ctx, profileKey, &profile)
+	if err != services.ErrNotFound && err != nil {
 		logger.WithError(err).Error("獲取用戶資料失敗")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "獲取用戶資料失敗",
@@ -208,8 +184,7 @@ func ResetAccount(c *gin.Context) {
 		return
 	}
 
-	var profile UserProfile
-	if err == redis.Nil {
+	if err == services.ErrNotFound {
 		// 創建默認資料
 		profile = UserProfile{
 			UserID:         userID,
@@ -222,7 +197,6 @@ func ResetAccount(c *gin.Context) {
 			UpdatedAt:      time.Now(),
 		}
 	} else {
-		json.Unmarshal([]byte(profileJSON), &profile)
 		profile.CurrentBalance = request.ResetBalance
 		profile.InitialBalance = request.ResetBalance
 		profile.TotalTrades = 0
@@ -231,33 +205,24 @@ func ResetAccount(c *gin.Context) {
 
 	// 清除持倉（如果要求）
 	if request.ClearPositions {
-		portfolioKey := fmt.Sprintf("portfolio:%s", userID)
-		// 創建空的投資組合
-		emptyPortfolio := map[string]interface{}{
-			"userID":       userID,
-			"positions":    make(map[string]interface{}),
-			"cashBalance":  request.ResetBalance,
-			"totalValue":   request.ResetBalance,
-			"totalPL":      0.0,
-			"dayPL":        0.0,
-			"lastUpdated":  time.Now(),
+		// 清空持倉並重設現金，賬本記錄重置分錄
+		if err := tradingHistoryService.ResetPortfolio(userID, request.ResetBalance); err != nil {
+			logger.WithError(err).Error("重置投資組合失敗")
 		}
-		portfolioData, _ := json.Marshal(emptyPortfolio)
-		rdb.Set(ctx, portfolioKey, portfolioData, time.Hour*24*365)
 	}
 
 	// 清除交易記錄（如果要求）
 	if request.ClearTrades {
-		tradesKey := fmt.Sprintf("trades:%s", userID)
-		rdb.Del(ctx, tradesKey)
-		
-		statsKey := fmt.Sprintf("trading_stats:%s", userID)
-		rdb.Del(ctx, statsKey)
+		if err := tradeStore.DeleteUserTrades(ctx, userID); err != nil {
+			logger.WithError(err).Error("清除交易記錄失敗")
+		}
+		if err := portfolioStore.DeleteStats(ctx, userID); err != nil {
+			logger.WithError(err).Error("清除交易統計失敗")
+		}
 	}
 
 	// 保存更新後的用戶資料
-	profileData, _ := json.Marshal(profile)
-	rdb.Set(ctx, profileKey, profileData, time.Hour*24*365)
+	configStore.SetConfig(ctx, profileKey, profile)
 
 	response := ResetAccountResponse{
 		Success:    true,
@@ -71,7 +71,8 @@ func main() {
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowAllOrigins = true
 	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-User-ID"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-User-ID", handlers.IdempotencyKeyHeader, handlers.AdminTokenHeader}
+	corsConfig.ExposeHeaders = []string{handlers.IdempotentReplayedHeader}
 	r.Use(cors.New(corsConfig))
 
 	// 添加監控中間件
@@ -86,25 +87,58 @@ func main() {
 		// 訂單相關端點
 		orders := v1.Group("/orders")
 		{
-			orders.POST("", handlers.CreateOrder)          // 創建訂單
+			orders.POST("", handlers.Idempotent(), handlers.CreateOrder) // 創建訂單
 			orders.GET("/:id", handlers.GetOrder)          // 查詢訂單
-			orders.PUT("/:id", handlers.UpdateOrder)       // 修改訂單
-			orders.DELETE("/:id", handlers.CancelOrder)    // 取消訂單
+			orders.GET("/:id/fills", handlers.GetOrderFills) // 查詢訂單成交明細
+			orders.GET("/:id/events", handlers.GetOrderEvents) // 查詢訂單事件
+			orders.PUT("/:id", handlers.Idempotent(), handlers.UpdateOrder)    // 修改訂單
+			orders.DELETE("/:id", handlers.Idempotent(), handlers.CancelOrder) // 取消訂單
 			orders.GET("", handlers.GetUserOrders)         // 獲取用戶所有訂單
+			orders.POST("/bracket", handlers.Idempotent(), handlers.CreateBracketOrder) // 創建括號訂單
+			orders.POST("/oco", handlers.Idempotent(), handlers.CreateOCOOrder)         // 創建OCO訂單
+			orders.GET("/groups/:id", handlers.GetOrderGroup)         // 查詢訂單組
+			orders.DELETE("/groups/:id", handlers.CancelOrderGroup)   // 取消訂單組
 		}
 
 		// 投資組合端點
-		v1.GET("/portfolio", handlers.GetPortfolio)       // 獲取投資組合
+		v1.GET("/portfolio", handlers.GetPortfolio)                        // 獲取投資組合
+		v1.GET("/portfolio/performance", handlers.GetPortfolioPerformance) // 績效歷史及收益率
 
 		// 交易歷史端點
 		v1.GET("/trades", handlers.GetTradingHistory)     // 獲取交易歷史
 		v1.GET("/trading-stats", handlers.GetTradingStats) // 獲取交易統計
 
+		// 賬本端點
+		v1.GET("/ledger", handlers.GetLedger)                 // 獲取分錄及賬戶餘額
+		v1.GET("/ledger/reconcile", handlers.ReconcileLedger) // 投資組合與賬本對賬
+
+		// 出入金端點
+		funding := v1.Group("/funding")
+		{
+			funding.POST("/deposit", handlers.Idempotent(), handlers.Deposit)            // 入金
+			funding.POST("/withdraw", handlers.Idempotent(), handlers.Withdraw)          // 出金
+			funding.POST("/:id/reverse", handlers.Idempotent(), handlers.ReverseDeposit) // 入金退款
+			funding.GET("/history", handlers.GetFundingHistory)                          // 獲取出入金記錄
+		}
+
+		// 保證金賬戶端點
+		v1.GET("/margin", handlers.GetMarginStatus)             // 保證金狀況及當前追繳
+		v1.PUT("/margin/account-type", handlers.SetAccountType) // 切換現金或保證金賬戶
+		v1.GET("/margin/calls", handlers.GetMarginCalls)        // 保證金追繳記錄
+
 		// 市場數據端點
 		market := v1.Group("/market")
 		{
-			market.GET("/quote/:symbol", handlers.GetStockQuote)    // 獲取實時股價
-			market.GET("/stocks", handlers.GetSupportedStocks)      // 獲取支持的股票列表
+			market.GET("/quote/:symbol", handlers.GetStockQuote)          // 獲取實時股價
+			market.GET("/quotes", handlers.GetQuotes)                     // 批量獲取實時股價
+			market.GET("/stocks", handlers.GetSupportedStocks)            // 獲取支持的股票列表
+			market.GET("/securities/:symbol", handlers.GetSecurity)       // 獲取證券參考數據
+			market.GET("/borrow/:symbol", handlers.GetBorrowAvailability) // 獲取可借券數量
+			market.GET("/orderbook/:symbol", handlers.GetOrderBook)       // 獲取訂單簿深度
+			market.GET("/candles/:symbol", handlers.GetCandles)           // 獲取歷史K線
+			market.GET("/calendar", handlers.GetMarketCalendar)           // 獲取交易日曆
+			market.GET("/stream", handlers.StreamQuotes)                  // 實時報價推送（WebSocket/SSE）
+			market.POST("/stream/:id", handlers.UpdateQuoteStream)        // 更新SSE推送的訂閱
 		}
 
 		// 用戶管理端點
@@ -122,6 +156,15 @@ func main() {
 			system.PUT("/config", handlers.UpdateSystemConfig)    // 更新系統配置
 		}
 
+		// 管理端點，需要管理員令牌
+		admin := v1.Group("/admin", handlers.RequireAdmin())
+		{
+			admin.POST("/securities", handlers.SaveSecurity)                  // 新增或更新證券
+			admin.POST("/securities/import", handlers.ImportSecurities)       // CSV批量導入證券
+			admin.POST("/securities/:symbol/halt", handlers.HaltSecurity)     // 停牌
+			admin.POST("/securities/:symbol/resume", handlers.ResumeSecurity) // 復牌
+		}
+
 		// 🚨 安全測試端點 - 僅用於eBPF監控演示
 		security := v1.Group("/security")
 		{
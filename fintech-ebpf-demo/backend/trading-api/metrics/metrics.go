@@ -71,6 +71,49 @@ var (
 		},
 	)
 
+	// 外部行情來源指標
+	MarketDataRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "trading_api_market_data_requests_total",
+			Help: "Total number of upstream market data requests by result",
+		},
+		[]string{"provider", "result"},
+	)
+
+	MarketDataRetries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "trading_api_market_data_retries_total",
+			Help: "Total number of upstream market data retries",
+		},
+		[]string{"provider"},
+	)
+
+	MarketDataLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "trading_api_market_data_request_duration_seconds",
+			Help:    "Upstream market data request duration in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"provider"},
+	)
+
+	MarketDataBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "trading_api_market_data_breaker_state",
+			Help: "Circuit breaker state of upstream market data (0=closed, 1=half_open, 2=open)",
+		},
+		[]string{"provider"},
+	)
+
+	// 出入金指標
+	FundingTransfers = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "trading_api_funding_transfers_total",
+			Help: "Total number of deposits, withdrawals and reversals by final status",
+		},
+		[]string{"type", "status"},
+	)
+
 	// 風險指標
 	RiskAssessments = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -0,0 +1,34 @@
+package models
+
+import "strings"
+
+// 各貨幣最小單位的小數位數（ISO 4217），未列出的貨幣按2位處理
+var currencyPlaces = map[string]int32{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+	"JOD": 3,
+}
+
+const defaultCurrencyPlaces = 2
+
+// 貨幣最小單位的小數位數
+func CurrencyPlaces(currency string) int32 {
+	if places, ok := currencyPlaces[strings.ToUpper(currency)]; ok {
+		return places
+	}
+	return defaultCurrencyPlaces
+}
+
+// 按貨幣最小單位四捨五入，用於傭金及出入金等實際收付的金額
+func (d Decimal) RoundCurrency(currency string) Decimal {
+	return d.Round(CurrencyPlaces(currency))
+}
+
+// 金額是否可以用該貨幣的最小單位精確表示
+func (d Decimal) IsCurrencyAmount(currency string) bool {
+	return d.Places() <= CurrencyPlaces(currency)
+}
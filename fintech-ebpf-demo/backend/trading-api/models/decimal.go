@@ -0,0 +1,394 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 定點小數，以 10^-8 為最小單位存為 int64，用於價格、數量及金額，最大約 ±922億。
+// 加減、取負、比較及與 Decimal 常數比較可直接用運算符；兩個 Decimal 相乘除必須用 Mul、Div，
+// 與整數相乘用 MulInt。乘除結果按四捨五入（遠離零）保留8位小數，溢出時 panic；需要處理溢出時用 MulChecked、DivChecked
+type Decimal int64
+
+// 小數位數
+const DecimalPlaces = 8
+
+const decimalUnit = 100000000
+
+// 常用常數
+const (
+	DecimalZero Decimal = 0
+	DecimalOne  Decimal = decimalUnit
+)
+
+// 乘除結果超出 Decimal 的範圍
+var ErrDecimalOverflow = errors.New("decimal overflow")
+
+var ErrDecimalDivisionByZero = errors.New("decimal division by zero")
+
+// 10^n，n 為 0-8
+var pow10 = [...]int64{1, 10, 100, 1000, 10000, 100000, 1000000, 10000000, 100000000}
+
+// 整數轉換為 Decimal
+func DecimalFromInt(n int64) Decimal {
+	hi, lo := bits.Mul64(uint64(absInt64(n)), decimalUnit)
+	if hi != 0 || lo > math.MaxInt64 {
+		panic(fmt.Sprintf("decimal overflow: %d", n))
+	}
+	if n < 0 {
+		return -Decimal(lo)
+	}
+	return Decimal(lo)
+}
+
+// 浮點數按其十進制表示四捨五入到8位小數，用於行情等外部浮點數據；NaN、無窮大或超出範圍時返回錯誤
+func DecimalFromFloat(f float64) (Decimal, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("無效的數值: %v", f)
+	}
+	return ParseDecimal(strconv.FormatFloat(f, 'f', DecimalPlaces, 64))
+}
+
+// 十進制數的語法：可選符號、整數部分和/或小數部分、可選的十進制指數。
+// big.Rat 另外接受的分數、十六進制、八進制、二進制、下劃線分隔及十六進制浮點數均不接受
+var decimalPattern = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+
+// 解析十進制字符串，支持科學記數法，超過8位的小數四捨五入
+func ParseDecimal(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if !decimalPattern.MatchString(s) {
+		return 0, fmt.Errorf("無效的數值: %q", s)
+	}
+	// 限制指數大小，避免構造超大的中間值
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		if exp, err := strconv.Atoi(s[i+1:]); err != nil || exp > 30 || exp < -30 {
+			return 0, fmt.Errorf("無效的數值: %q", s)
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("無效的數值: %q", s)
+	}
+
+	num := new(big.Int).Mul(r.Num(), big.NewInt(decimalUnit))
+	quo, rem := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	twice := new(big.Int).Abs(rem)
+	if twice.Lsh(twice, 1).Cmp(r.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(int64(num.Sign())))
+	}
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("數值超出範圍: %s", s)
+	}
+	return Decimal(quo.Int64()), nil
+}
+
+// 解析常量字符串，失敗時 panic
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// 乘積
+func (d Decimal) Mul(x Decimal) Decimal {
+	product, err := d.MulChecked(x)
+	if err != nil {
+		panic(err.Error())
+	}
+	return product
+}
+
+// 乘積，溢出時返回 ErrDecimalOverflow 而不 panic，用於外部輸入參與的計算
+func (d Decimal) MulChecked(x Decimal) (Decimal, error) {
+	hi, lo := bits.Mul64(uint64(absInt64(int64(d))), uint64(absInt64(int64(x))))
+	product, ok := scaled(hi, lo, decimalUnit, (d < 0) != (x < 0))
+	if !ok {
+		return 0, ErrDecimalOverflow
+	}
+	return product, nil
+}
+
+// 商，除數為0時 panic
+func (d Decimal) Div(x Decimal) Decimal {
+	if x == 0 {
+		panic("decimal division by zero")
+	}
+	quotient, err := d.DivChecked(x)
+	if err != nil {
+		panic(err.Error())
+	}
+	return quotient
+}
+
+// 商，除數為0或溢出時返回錯誤而不 panic
+func (d Decimal) DivChecked(x Decimal) (Decimal, error) {
+	if x == 0 {
+		return 0, ErrDecimalDivisionByZero
+	}
+	hi, lo := bits.Mul64(uint64(absInt64(int64(d))), decimalUnit)
+	quotient, ok := scaled(hi, lo, uint64(absInt64(int64(x))), (d < 0) != (x < 0))
+	if !ok {
+		return 0, ErrDecimalOverflow
+	}
+	return quotient, nil
+}
+
+// 與整數的乘積
+func (d Decimal) MulInt(n int64) Decimal {
+	hi, lo := bits.Mul64(uint64(absInt64(int64(d))), uint64(absInt64(n)))
+	return mustScaled(scaled(hi, lo, 1, (d < 0) != (n < 0)))
+}
+
+// (hi, lo) / divisor 四捨五入後加上符號，超出範圍時 ok 為 false
+func scaled(hi, lo, divisor uint64, negative bool) (Decimal, bool) {
+	if hi >= divisor {
+		return 0, false
+	}
+	quo, rem := bits.Div64(hi, lo, divisor)
+	if rem >= divisor-rem {
+		quo++
+	}
+	if quo > math.MaxInt64 {
+		return 0, false
+	}
+	if negative {
+		return -Decimal(quo), true
+	}
+	return Decimal(quo), true
+}
+
+func mustScaled(d Decimal, ok bool) Decimal {
+	if !ok {
+		panic(ErrDecimalOverflow.Error())
+	}
+	return d
+}
+
+func absInt64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (d Decimal) Abs() Decimal {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// 符號：-1、0 或 1
+func (d Decimal) Sign() int {
+	switch {
+	case d < 0:
+		return -1
+	case d > 0:
+		return 1
+	}
+	return 0
+}
+
+func (d Decimal) IsZero() bool {
+	return d == 0
+}
+
+// 四捨五入（遠離零）到 places 位小數，places 為 0-8
+func (d Decimal) Round(places int32) Decimal {
+	if places >= DecimalPlaces {
+		return d
+	}
+	if places < 0 {
+		places = 0
+	}
+	unit := Decimal(pow10[DecimalPlaces-places])
+	quo, rem := d/unit, d%unit
+	if rem.Abs() >= unit-rem.Abs() {
+		quo += Decimal(d.Sign())
+	}
+	return quo * unit
+}
+
+// 向零截斷到 places 位小數
+func (d Decimal) Truncate(places int32) Decimal {
+	if places >= DecimalPlaces {
+		return d
+	}
+	if places < 0 {
+		places = 0
+	}
+	unit := Decimal(pow10[DecimalPlaces-places])
+	return d / unit * unit
+}
+
+// 是否為 step 的整數倍，step 不大於0時視為不限制
+func (d Decimal) IsMultipleOf(step Decimal) bool {
+	return step <= 0 || d%step == 0
+}
+
+// 小數位數（去掉末尾的0）
+func (d Decimal) Places() int32 {
+	frac := int64(d.Abs() % decimalUnit)
+	if frac == 0 {
+		return 0
+	}
+	places := int32(DecimalPlaces)
+	for frac%10 == 0 {
+		frac /= 10
+		places--
+	}
+	return places
+}
+
+// 轉換為浮點數，用於指標、風險評分等近似計算
+func (d Decimal) Float64() float64 {
+	return float64(d) / decimalUnit
+}
+
+func MinDecimal(a, b Decimal) Decimal {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func MaxDecimal(a, b Decimal) Decimal {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// 去掉末尾0的十進制表示
+func (d Decimal) String() string {
+	s := d.StringFixed(DecimalPlaces)
+	if strings.IndexByte(s, '.') >= 0 {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// 四捨五入到 places 位小數的十進制表示，保留末尾的0
+func (d Decimal) StringFixed(places int32) string {
+	if places > DecimalPlaces {
+		places = DecimalPlaces
+	}
+	if places < 0 {
+		places = 0
+	}
+	r := d.Round(places)
+
+	sign := ""
+	if r < 0 {
+		sign = "-"
+	}
+	abs := uint64(absInt64(int64(r)))
+	intPart := strconv.FormatUint(abs/decimalUnit, 10)
+	if places == 0 {
+		return sign + intPart
+	}
+	frac := fmt.Sprintf("%08d", abs%decimalUnit)
+	return sign + intPart + "." + frac[:places]
+}
+
+// 支持 %v、%s、%f、%.2f、%g 等格式，%d 輸出內部整數
+func (d Decimal) Format(f fmt.State, verb rune) {
+	var s string
+	switch verb {
+	case 'd':
+		s = strconv.FormatInt(int64(d), 10)
+	case 'f', 'F':
+		places := int32(DecimalPlaces)
+		if p, ok := f.Precision(); ok {
+			places = int32(p)
+		}
+		s = d.StringFixed(places)
+	case 'q':
+		s = strconv.Quote(d.String())
+	default:
+		s = d.String()
+	}
+	if f.Flag('+') && d >= 0 {
+		s = "+" + s
+	}
+	if width, ok := f.Width(); ok && len(s) < width {
+		pad := strings.Repeat(" ", width-len(s))
+		if f.Flag('-') {
+			s += pad
+		} else {
+			s = pad + s
+		}
+	}
+	fmt.Fprint(f, s)
+}
+
+// 編碼為 JSON 數字，保留精確的十進制值
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// 接受 JSON 數字或數字字符串，null 保持不變
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	v, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// 以字符串寫入數據庫 DECIMAL 欄位，避免經過浮點數
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// 讀取數據庫 DECIMAL 欄位，NULL 讀為0
+func (d *Decimal) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = 0
+	case []byte:
+		return d.scanString(string(v))
+	case string:
+		return d.scanString(v)
+	case int64:
+		if v > math.MaxInt64/decimalUnit || v < math.MinInt64/decimalUnit {
+			return fmt.Errorf("數值超出範圍: %d", v)
+		}
+		*d = DecimalFromInt(v)
+	case float64:
+		f, err := DecimalFromFloat(v)
+		if err != nil {
+			return err
+		}
+		*d = f
+	default:
+		return fmt.Errorf("cannot scan %T into Decimal", value)
+	}
+	return nil
+}
+
+func (d *Decimal) scanString(s string) error {
+	v, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
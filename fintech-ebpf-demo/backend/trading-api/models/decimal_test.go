@@ -0,0 +1,207 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Decimal
+	}{
+		{"1.5", 150000000},
+		{"  42 ", DecimalFromInt(42)},
+		{"+7", DecimalFromInt(7)},
+		{".5", DecimalOne / 2},
+		{"5.", DecimalFromInt(5)},
+		{"-0", 0},
+		// 超過8位的小數四捨五入，半數遠離零
+		{"0.000000014", 1},
+		{"0.000000015", 2},
+		{"0.000000005", 1},
+		{"-0.000000005", -1},
+		{"-0.000000015", -2},
+		// 科學記數法及指數上下限
+		{"1e3", DecimalFromInt(1000)},
+		{"1.5E-2", 1500000},
+		{"-2.5e+1", DecimalFromInt(-25)},
+		{"1e-30", 0},
+		{"92233720368", DecimalFromInt(92233720368)},
+	}
+	for _, tt := range tests {
+		got, err := ParseDecimal(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseDecimal(%q) = %d, %v, 期望 %d", tt.input, got, err, tt.want)
+		}
+	}
+
+	rejected := []string{
+		"", " ", "abc", "1e", "1e+", "--1", "1.2.3", "1 000", "NaN", "Inf", "-Infinity",
+		// big.Rat 接受但不是十進制數的寫法
+		"1/3", "0x10", "0X1F", "0b101", "0o17", "1_000", "0x1p-2",
+		// 指數超出限制或結果超出範圍
+		"1e31", "1e-31", "1e30", "92233720369", "-92233720369",
+	}
+	for _, input := range rejected {
+		if got, err := ParseDecimal(input); err == nil {
+			t.Errorf("ParseDecimal(%q) = %v, 期望錯誤", input, got)
+		}
+	}
+}
+
+func TestDecimalFromFloat(t *testing.T) {
+	if got, err := DecimalFromFloat(0.1); err != nil || got != MustParseDecimal("0.1") {
+		t.Errorf("DecimalFromFloat(0.1) = %v, %v, 期望 0.1", got, err)
+	}
+	if got, err := DecimalFromFloat(-187.123456789); err != nil || got != MustParseDecimal("-187.12345679") {
+		t.Errorf("DecimalFromFloat(-187.123456789) = %v, %v, 期望 -187.12345679", got, err)
+	}
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), 1e20} {
+		if got, err := DecimalFromFloat(f); err == nil {
+			t.Errorf("DecimalFromFloat(%v) = %v, 期望錯誤", f, got)
+		}
+	}
+}
+
+func TestDecimalRoundTruncate(t *testing.T) {
+	tests := []struct {
+		input    string
+		places   int32
+		round    string
+		truncate string
+	}{
+		{"1.235", 2, "1.24", "1.23"},
+		{"-1.235", 2, "-1.24", "-1.23"},
+		{"-1.234", 2, "-1.23", "-1.23"},
+		{"-1.239", 2, "-1.24", "-1.23"},
+		{"-0.5", 0, "-1", "0"},
+		{"-0.49999999", 0, "0", "0"},
+		{"-2.5", -1, "-3", "-2"}, // 負的位數按0處理
+		{"-0.12345678", 8, "-0.12345678", "-0.12345678"},
+	}
+	for _, tt := range tests {
+		d := MustParseDecimal(tt.input)
+		if got := d.Round(tt.places); got != MustParseDecimal(tt.round) {
+			t.Errorf("%s.Round(%d) = %v, 期望 %s", tt.input, tt.places, got, tt.round)
+		}
+		if got := d.Truncate(tt.places); got != MustParseDecimal(tt.truncate) {
+			t.Errorf("%s.Truncate(%d) = %v, 期望 %s", tt.input, tt.places, got, tt.truncate)
+		}
+	}
+}
+
+func TestDecimalMulChecked(t *testing.T) {
+	product, err := MaxOrderQuantity.MulChecked(MaxOrderPrice)
+	if err != ErrDecimalOverflow {
+		t.Errorf("上限數量乘以上限價格 = %v, err = %v, 期望 ErrDecimalOverflow", product, err)
+	}
+	if _, err := Decimal(-1 << 62).MulChecked(DecimalFromInt(2)); err != ErrDecimalOverflow {
+		t.Errorf("負數溢出 err = %v, 期望 ErrDecimalOverflow", err)
+	}
+
+	product, err = MustParseDecimal("-1.5").MulChecked(MustParseDecimal("2.25"))
+	if err != nil || product != MustParseDecimal("-3.375") {
+		t.Errorf("-1.5 × 2.25 = %v, err = %v, 期望 -3.375", product, err)
+	}
+}
+
+func TestDecimalDivChecked(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+		err  error
+	}{
+		{"1", "3", "0.33333333", nil},
+		{"2", "3", "0.66666667", nil},
+		{"-2", "3", "-0.66666667", nil},
+		{"2", "-3", "-0.66666667", nil},
+		{"-7.5", "-2.5", "3", nil},
+		{"0.00000001", "2", "0.00000001", nil}, // 半數遠離零
+		{"1", "0", "0", ErrDecimalDivisionByZero},
+		{"90000000000", "0.1", "0", ErrDecimalOverflow},
+	}
+	for _, tt := range tests {
+		got, err := MustParseDecimal(tt.a).DivChecked(MustParseDecimal(tt.b))
+		if err != tt.err || got != MustParseDecimal(tt.want) {
+			t.Errorf("%s ÷ %s = %v, err = %v, 期望 %s, err = %v", tt.a, tt.b, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	type payload struct {
+		Price    Decimal  `json:"price"`
+		Quantity *Decimal `json:"quantity,omitempty"`
+	}
+
+	for _, input := range []string{"0", "-12.5", "0.00000001", "92233720368.54775807"} {
+		data, err := json.Marshal(payload{Price: MustParseDecimal(input)})
+		if err != nil {
+			t.Fatalf("編碼 %s 失敗: %v", input, err)
+		}
+		if want := `{"price":` + input + `}`; string(data) != want {
+			t.Errorf("編碼 = %s, 期望 %s", data, want)
+		}
+		var decoded payload
+		if err := json.Unmarshal(data, &decoded); err != nil || decoded.Price != MustParseDecimal(input) {
+			t.Errorf("解碼 %s = %v, err = %v", data, decoded.Price, err)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  Decimal
+	}{
+		{`{"price": 1.25}`, MustParseDecimal("1.25")},
+		{`{"price": "1.25"}`, MustParseDecimal("1.25")},
+		{`{"price": 1e2}`, DecimalFromInt(100)},
+		{`{"price": null}`, DecimalFromInt(9)}, // null 保持原值
+	}
+	for _, tt := range tests {
+		decoded := payload{Price: DecimalFromInt(9)}
+		if err := json.Unmarshal([]byte(tt.input), &decoded); err != nil || decoded.Price != tt.want {
+			t.Errorf("解碼 %s = %v, err = %v, 期望 %v", tt.input, decoded.Price, err, tt.want)
+		}
+	}
+
+	for _, input := range []string{`{"price": "0x10"}`, `{"price": "1/3"}`, `{"price": "abc"}`, `{"price": true}`} {
+		var decoded payload
+		if err := json.Unmarshal([]byte(input), &decoded); err == nil {
+			t.Errorf("解碼 %s = %v, 期望錯誤", input, decoded.Price)
+		}
+	}
+}
+
+func TestDecimalScanValue(t *testing.T) {
+	value, err := MustParseDecimal("-1234.5").Value()
+	if err != nil || value != "-1234.5" {
+		t.Errorf("Value = %v, err = %v, 期望 \"-1234.5\"", value, err)
+	}
+
+	tests := []struct {
+		input interface{}
+		want  Decimal
+	}{
+		{nil, 0},
+		{"12.34", MustParseDecimal("12.34")},
+		{[]byte("-0.5"), MustParseDecimal("-0.5")},
+		{int64(3), DecimalFromInt(3)},
+		{0.1, MustParseDecimal("0.1")},
+		{value, MustParseDecimal("-1234.5")},
+	}
+	for _, tt := range tests {
+		d := DecimalFromInt(9)
+		if err := d.Scan(tt.input); err != nil || d != tt.want {
+			t.Errorf("Scan(%#v) = %v, err = %v, 期望 %v", tt.input, d, err, tt.want)
+		}
+	}
+
+	for _, input := range []interface{}{math.NaN(), math.Inf(1), "1/3", []byte("0x10"), int64(1) << 62, true} {
+		var d Decimal
+		if err := d.Scan(input); err == nil {
+			t.Errorf("Scan(%#v) = %v, 期望錯誤", input, d)
+		}
+	}
+}
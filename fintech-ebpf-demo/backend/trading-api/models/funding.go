@@ -0,0 +1,12 @@
+package models
+
+// 入金或出金請求，Method 為支付方式，未指定時入金用 credit_card、出金用 bank_transfer
+type FundingRequest struct {
+	Amount Decimal `json:"amount" binding:"required,gt=0"`
+	Method string  `json:"method,omitempty"`
+}
+
+// 入金退款請求
+type FundingReversalRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
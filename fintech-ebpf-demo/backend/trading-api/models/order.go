@@ -7,39 +7,78 @@ import (
 	"time"
 )
 
+// 單筆訂單的上限，保證數量、價格及名義金額的乘積與累計不會超出 Decimal 的範圍
+const (
+	MaxOrderQuantity Decimal = 100000000 * DecimalOne  // 1億股
+	MaxOrderPrice    Decimal = 10000000 * DecimalOne   // 每股1000萬
+	MaxOrderNotional Decimal = 1000000000 * DecimalOne // 數量乘以估算成交價，10億
+)
+
 // 訂單請求
 type OrderRequest struct {
-	Symbol      string  `json:"symbol" binding:"required"`
-	Side        string  `json:"side" binding:"required,oneof=buy sell"`
-	OrderType   string  `json:"order_type" binding:"required,oneof=market limit stop"`
-	Quantity    float64 `json:"quantity" binding:"required,gt=0"`
-	Price       float64 `json:"price"`
-	TimeInForce string  `json:"time_in_force,omitempty"`
+	Symbol       string     `json:"symbol" binding:"required"`
+	Side         string     `json:"side" binding:"required,oneof=buy sell"`
+	OrderType    string     `json:"order_type" binding:"required,oneof=market limit stop stop_limit trailing_stop market_if_touched"`
+	Quantity     Decimal    `json:"quantity" binding:"required,gt=0"`
+	Price        Decimal    `json:"price"`
+	StopPrice    Decimal    `json:"stop_price,omitempty"`    // 止損限價單的觸發價
+	TrailAmount  Decimal    `json:"trail_amount,omitempty"`  // 追蹤止損的固定距離
+	TrailPercent Decimal    `json:"trail_percent,omitempty"` // 追蹤止損的百分比距離
+	TimeInForce  string     `json:"time_in_force,omitempty"`
+	ExpireAt     *time.Time `json:"expire_at,omitempty"` // GTD訂單的到期時間
+	LotMethod    string     `json:"lot_method,omitempty"` // 賣單的稅批扣減方法：fifo、lifo、hifo 或 specific
+	LotIDs       []string   `json:"lot_ids,omitempty"`    // 按順序優先扣減的稅批
 }
 
 // 訂單修改請求
 type OrderUpdateRequest struct {
-	Quantity  *float64 `json:"quantity,omitempty"`
-	Price     *float64 `json:"price,omitempty"`
-	OrderType *string  `json:"order_type,omitempty"`
+	Quantity     *Decimal `json:"quantity,omitempty"`
+	Price        *Decimal `json:"price,omitempty"`
+	OrderType    *string  `json:"order_type,omitempty"`
+	StopPrice    *Decimal `json:"stop_price,omitempty"`
+	TrailAmount  *Decimal `json:"trail_amount,omitempty"`
+	TrailPercent *Decimal `json:"trail_percent,omitempty"`
 }
 
 // 訂單
 type Order struct {
-	ID           string    `json:"id"`
-	UserID       string    `json:"user_id"`
-	Symbol       string    `json:"symbol"`
-	Side         string    `json:"side"`
-	OrderType    string    `json:"order_type"`
-	Quantity     float64   `json:"quantity"`
-	Price        float64   `json:"price"`
-	Status       string    `json:"status"`
-	FilledQty    float64   `json:"filled_qty"`
-	RemainingQty float64   `json:"remaining_qty"`
-	AvgPrice     float64   `json:"avg_price"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	TimeInForce  string    `json:"time_in_force"`
+	ID            string      `json:"id"`
+	UserID        string      `json:"user_id"`
+	Symbol        string      `json:"symbol"`
+	Side          string      `json:"side"`
+	OrderType     string      `json:"order_type"`
+	Quantity      Decimal     `json:"quantity"`
+	Price         Decimal     `json:"price"`
+	Status        string      `json:"status"`
+	FilledQty     Decimal     `json:"filled_qty"`
+	RemainingQty  Decimal     `json:"remaining_qty"`
+	AvgPrice      Decimal     `json:"avg_price"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+	TimeInForce   string      `json:"time_in_force"`
+	ExpireAt      *time.Time  `json:"expire_at,omitempty"`
+	StopPrice     Decimal     `json:"stop_price,omitempty"`
+	TrailAmount   Decimal     `json:"trail_amount,omitempty"`
+	TrailPercent  Decimal     `json:"trail_percent,omitempty"`
+	HighWaterMark Decimal     `json:"high_water_mark,omitempty"` // 追蹤止損的最優價（買入單為最低價）
+	TriggeredAt   *time.Time  `json:"triggered_at,omitempty"`    // 條件單被觸發的時間
+	GroupID       string      `json:"group_id,omitempty"`        // 所屬訂單組
+	ParentOrderID string      `json:"parent_order_id,omitempty"` // 括號訂單的父訂單
+	OCOOrderIDs   []string    `json:"oco_order_ids,omitempty"`   // 本訂單成交時需撤銷的關聯訂單
+	LotMethod     string      `json:"lot_method,omitempty"`      // 賣單的稅批扣減方法，空為默認方法
+	LotIDs        []string    `json:"lot_ids,omitempty"`         // 按順序優先扣減的稅批
+	Liquidation   bool        `json:"liquidation,omitempty"`     // 保證金追繳逾期的強制平倉單
+	Fills         []OrderFill `json:"fills"`
+	Version       int64       `json:"version"` // 每次修改遞增，存儲據此拒絕過期副本的寫入
+}
+
+// 複製訂單
+func (o *Order) Clone() *Order {
+	clone := *o
+	clone.Fills = append([]OrderFill(nil), o.Fills...)
+	clone.OCOOrderIDs = append([]string(nil), o.OCOOrderIDs...)
+	clone.LotIDs = append([]string(nil), o.LotIDs...)
+	return &clone
 }
 
 // 訂單響應
@@ -52,12 +91,12 @@ type OrderResponse struct {
 
 // 投資組合
 type Portfolio struct {
-	UserID      string      `json:"user_id"`
-	TotalValue  float64     `json:"total_value"`
-	CashBalance float64     `json:"cash_balance"`
-	TotalPL     float64     `json:"total_pl"`
-	Positions   []Position  `json:"positions"`
-	LastUpdated time.Time   `json:"last_updated"`
+	UserID      string     `json:"user_id"`
+	TotalValue  Decimal    `json:"total_value"`
+	CashBalance Decimal    `json:"cash_balance"`
+	TotalPL     Decimal    `json:"total_pl"`
+	Positions   []Position `json:"positions"`
+	LastUpdated time.Time  `json:"last_updated"`
 }
 
 // 持倉
@@ -65,10 +104,10 @@ type Position struct {
 	ID           string    `json:"id"`
 	UserID       string    `json:"user_id"`
 	Symbol       string    `json:"symbol"`
-	Quantity     float64   `json:"quantity"`
-	AvgPrice     float64   `json:"avg_price"`
-	MarketValue  float64   `json:"market_value"`
-	UnrealizedPL float64   `json:"unrealized_pl"`
+	Quantity     Decimal   `json:"quantity"`
+	AvgPrice     Decimal   `json:"avg_price"`
+	MarketValue  Decimal   `json:"market_value"`
+	UnrealizedPL Decimal   `json:"unrealized_pl"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
@@ -86,8 +125,8 @@ type TradeEvent struct {
 	UserID    string    `json:"user_id"`
 	EventType string    `json:"event_type"`
 	Symbol    string    `json:"symbol"`
-	Quantity  float64   `json:"quantity"`
-	Price     float64   `json:"price"`
+	Quantity  Decimal   `json:"quantity"`
+	Price     Decimal   `json:"price"`
 	Metadata  JSONField `json:"metadata"`
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -105,10 +144,11 @@ type RiskAssessment struct {
 
 // 健康檢查
 type HealthCheck struct {
-	Status    string            `json:"status"`
-	Timestamp time.Time         `json:"timestamp"`
-	Version   string            `json:"version"`
-	Services  map[string]string `json:"services"`
+	Status          string            `json:"status"`
+	Timestamp       time.Time         `json:"timestamp"`
+	Version         string            `json:"version"`
+	Services        map[string]string `json:"services"`
+	CircuitBreakers map[string]string `json:"circuit_breakers,omitempty"` // 外部行情來源的熔斷狀態
 }
 
 // 錯誤響應
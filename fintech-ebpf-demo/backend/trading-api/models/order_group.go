@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// 訂單組類型
+const (
+	OrderGroupBracket = "bracket" // 括號訂單：入場單成交後啟用止盈、止損子訂單
+	OrderGroupOCO     = "oco"     // 二選一訂單：任一成交即撤銷另一筆
+)
+
+// 訂單組狀態
+const (
+	OrderGroupActive    = "active"
+	OrderGroupTriggered = "triggered" // 入場單已成交，止盈、止損子訂單已啟用
+	OrderGroupCompleted = "completed"
+	OrderGroupCancelled = "cancelled"
+)
+
+// 訂單組
+type OrderGroup struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"user_id"`
+	Type          string    `json:"type"`
+	Symbol        string    `json:"symbol"`
+	Status        string    `json:"status"`
+	ParentOrderID string    `json:"parent_order_id,omitempty"`
+	OrderIDs      []string  `json:"order_ids"` // 括號訂單為子訂單，OCO為兩筆訂單
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// 訂單組是否仍未結束
+func (g *OrderGroup) IsOpen() bool {
+	return g.Status == OrderGroupActive || g.Status == OrderGroupTriggered
+}
+
+// 組內所有訂單ID（含父訂單）
+func (g *OrderGroup) MemberIDs() []string {
+	if g.ParentOrderID == "" {
+		return append([]string(nil), g.OrderIDs...)
+	}
+	return append([]string{g.ParentOrderID}, g.OrderIDs...)
+}
+
+// 括號訂單請求
+type BracketOrderRequest struct {
+	Entry              OrderRequest `json:"entry" binding:"required"`
+	TakeProfitPrice    Decimal      `json:"take_profit_price" binding:"required,gt=0"`
+	StopLossPrice      Decimal      `json:"stop_loss_price" binding:"required,gt=0"`
+	StopLossLimitPrice Decimal      `json:"stop_loss_limit_price,omitempty"` // 指定時止損腿為止損限價單
+}
+
+// OCO訂單請求
+type OCOOrderRequest struct {
+	Orders []OrderRequest `json:"orders" binding:"required,len=2,dive"`
+}
+
+// 訂單組響應
+type OrderGroupResponse struct {
+	Group   *OrderGroup `json:"group"`
+	Orders  []*Order    `json:"orders"`
+	Message string      `json:"message"`
+	Success bool        `json:"success"`
+}
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// 訂單狀態
+const (
+	OrderStatusNew             = "new"
+	OrderStatusPartiallyFilled = "partially_filled"
+	OrderStatusFilled          = "filled"
+	OrderStatusCancelled       = "cancelled"
+	OrderStatusRejected        = "rejected"
+	OrderStatusExpired         = "expired"
+	OrderStatusHeld            = "held" // 等待父訂單成交後才生效的子訂單
+
+	// 舊版本寫入的待成交狀態，讀取時視為 new
+	orderStatusLegacyPending = "pending"
+)
+
+// 全部訂單狀態
+var OrderStatuses = []string{
+	OrderStatusNew,
+	OrderStatusPartiallyFilled,
+	OrderStatusFilled,
+	OrderStatusCancelled,
+	OrderStatusRejected,
+	OrderStatusExpired,
+	OrderStatusHeld,
+}
+
+// 檢查訂單狀態是否合法
+func IsValidOrderStatus(status string) bool {
+	for _, known := range OrderStatuses {
+		if status == known {
+			return true
+		}
+	}
+	return false
+}
+
+// 訂單有效期類型
+const (
+	TimeInForceDay = "DAY" // 當日有效，收盤時過期
+	TimeInForceGTC = "GTC" // 撤銷前有效
+	TimeInForceIOC = "IOC" // 立即成交，剩餘取消
+	TimeInForceFOK = "FOK" // 全部成交否則拒絕
+	TimeInForceGTD = "GTD" // 指定時間前有效
+)
+
+// 檢查有效期類型是否合法
+func IsValidTimeInForce(tif string) bool {
+	switch tif {
+	case TimeInForceDay, TimeInForceGTC, TimeInForceIOC, TimeInForceFOK, TimeInForceGTD:
+		return true
+	}
+	return false
+}
+
+// 合法的狀態轉換
+var orderTransitions = map[string][]string{
+	OrderStatusNew: {
+		OrderStatusPartiallyFilled,
+		OrderStatusFilled,
+		OrderStatusCancelled,
+		OrderStatusRejected,
+		OrderStatusExpired,
+	},
+	OrderStatusPartiallyFilled: {
+		OrderStatusPartiallyFilled,
+		OrderStatusFilled,
+		OrderStatusCancelled,
+		OrderStatusExpired,
+	},
+	OrderStatusHeld: {
+		OrderStatusNew,
+		OrderStatusCancelled,
+	},
+}
+
+// 非法狀態轉換錯誤
+type InvalidTransitionError struct {
+	OrderID string
+	From    string
+	To      string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("訂單 %s 不能從 %s 轉換為 %s", e.OrderID, e.From, e.To)
+}
+
+// 訂單成交明細
+type OrderFill struct {
+	FillID     string    `json:"fill_id"`
+	Quantity   Decimal   `json:"quantity"`
+	Price      Decimal   `json:"price"`
+	Liquidity  string    `json:"liquidity"`
+	ExecutedAt time.Time `json:"executed_at"`
+}
+
+// 將舊版狀態轉換為當前狀態
+func (o *Order) NormalizeStatus() {
+	if o.Status == orderStatusLegacyPending || o.Status == "" {
+		if o.FilledQty > 0 {
+			o.Status = OrderStatusPartiallyFilled
+		} else {
+			o.Status = OrderStatusNew
+		}
+	}
+}
+
+// 訂單是否仍可成交、修改或取消
+func (o *Order) IsActive() bool {
+	return o.Status == OrderStatusNew || o.Status == OrderStatusPartiallyFilled
+}
+
+// 訂單是否已處於終態
+func (o *Order) IsTerminal() bool {
+	return !o.IsActive() && o.Status != OrderStatusHeld
+}
+
+// 檢查是否可以轉換到目標狀態
+func (o *Order) CanTransitionTo(status string) bool {
+	for _, allowed := range orderTransitions[o.Status] {
+		if allowed == status {
+			return true
+		}
+	}
+	return false
+}
+
+// 轉換訂單狀態，非法轉換返回 *InvalidTransitionError
+func (o *Order) TransitionTo(status string) error {
+	if !o.CanTransitionTo(status) {
+		return &InvalidTransitionError{OrderID: o.ID, From: o.Status, To: status}
+	}
+
+	o.Status = status
+	o.Touch(time.Now())
+
+	// 終止狀態下不再有剩餘待成交數量
+	if status == OrderStatusCancelled || status == OrderStatusExpired || status == OrderStatusRejected {
+		o.RemainingQty = 0
+	}
+	return nil
+}
+
+// 記錄一筆成交：更新成交數量、成交量加權均價及狀態
+func (o *Order) ApplyFill(fillID string, qty, price Decimal, liquidity string, executedAt time.Time) error {
+	if qty <= 0 {
+		return fmt.Errorf("訂單 %s 成交數量必須大於0", o.ID)
+	}
+	if qty > o.RemainingQty {
+		return fmt.Errorf("訂單 %s 成交數量 %v 超過剩餘數量 %v", o.ID, qty, o.RemainingQty)
+	}
+
+	next := OrderStatusPartiallyFilled
+	if qty == o.RemainingQty {
+		next = OrderStatusFilled
+	}
+	if !o.CanTransitionTo(next) {
+		return &InvalidTransitionError{OrderID: o.ID, From: o.Status, To: next}
+	}
+
+	notional := o.notional() + price.Mul(qty)
+	o.FilledQty += qty
+	o.RemainingQty = o.Quantity - o.FilledQty
+	if next == OrderStatusFilled {
+		o.RemainingQty = 0
+	}
+	o.AvgPrice = notional.Div(o.FilledQty)
+	o.Fills = append(o.Fills, OrderFill{
+		FillID:     fillID,
+		Quantity:   qty,
+		Price:      price,
+		Liquidity:  liquidity,
+		ExecutedAt: executedAt,
+	})
+
+	o.Status = next
+	o.Touch(executedAt)
+	return nil
+}
+
+// 記錄一次修改：更新修改時間並遞增版本號
+func (o *Order) Touch(now time.Time) {
+	o.UpdatedAt = now
+	o.Version++
+}
+
+// 已成交金額，按每筆成交累加以免均價的捨入誤差累積；沒有成交明細的舊訂單按均價計算
+func (o *Order) notional() Decimal {
+	if len(o.Fills) == 0 {
+		return o.AvgPrice.Mul(o.FilledQty)
+	}
+	var total Decimal
+	for _, fill := range o.Fills {
+		total += fill.Price.Mul(fill.Quantity)
+	}
+	return total
+}
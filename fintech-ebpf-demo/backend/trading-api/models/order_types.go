@@ -0,0 +1,76 @@
+package models
+
+// 訂單類型
+const (
+	OrderTypeMarket          = "market"
+	OrderTypeLimit           = "limit"
+	OrderTypeStop            = "stop"              // 止損單：觸及 Price 後按市價成交
+	OrderTypeStopLimit       = "stop_limit"        // 止損限價單：觸及 StopPrice 後以 Price 掛限價單
+	OrderTypeTrailingStop    = "trailing_stop"     // 追蹤止損單：觸發價隨高水位移動
+	OrderTypeMarketIfTouched = "market_if_touched" // 觸價單：觸及 Price 後按市價成交
+)
+
+// 檢查訂單類型是否合法
+func IsValidOrderType(orderType string) bool {
+	switch orderType {
+	case OrderTypeMarket, OrderTypeLimit, OrderTypeStop, OrderTypeStopLimit,
+		OrderTypeTrailingStop, OrderTypeMarketIfTouched:
+		return true
+	}
+	return false
+}
+
+// 是否為需等待價格觸發的條件單
+func (o *Order) IsConditional() bool {
+	switch o.OrderType {
+	case OrderTypeStop, OrderTypeStopLimit, OrderTypeTrailingStop, OrderTypeMarketIfTouched:
+		return true
+	}
+	return false
+}
+
+// 觸發後是否以限價成交
+func (o *Order) HasLimitPrice() bool {
+	return o.OrderType == OrderTypeLimit || o.OrderType == OrderTypeStopLimit
+}
+
+// 條件單的觸發價格
+func (o *Order) TriggerPrice() Decimal {
+	switch o.OrderType {
+	case OrderTypeStopLimit, OrderTypeTrailingStop:
+		return o.StopPrice
+	}
+	return o.Price
+}
+
+// 追蹤止損單的追蹤距離
+func (o *Order) trailOffset() Decimal {
+	if o.TrailPercent > 0 {
+		return o.HighWaterMark.Mul(o.TrailPercent).Div(DecimalFromInt(100))
+	}
+	return o.TrailAmount
+}
+
+// 以最新市價更新追蹤止損單的高水位及觸發價。
+// 賣出單追蹤最高價，買入單追蹤最低價；返回觸發價是否變動。
+func (o *Order) UpdateTrail(marketPrice Decimal) bool {
+	if o.OrderType != OrderTypeTrailingStop || marketPrice <= 0 {
+		return false
+	}
+
+	if o.HighWaterMark == 0 ||
+		(o.Side == "sell" && marketPrice > o.HighWaterMark) ||
+		(o.Side == "buy" && marketPrice < o.HighWaterMark) {
+		o.HighWaterMark = marketPrice
+	}
+
+	stopPrice := o.HighWaterMark - o.trailOffset()
+	if o.Side == "buy" {
+		stopPrice = o.HighWaterMark + o.trailOffset()
+	}
+	if stopPrice == o.StopPrice {
+		return false
+	}
+	o.StopPrice = stopPrice
+	return true
+}
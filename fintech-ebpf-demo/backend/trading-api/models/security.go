@@ -0,0 +1,137 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 證券交易狀態
+const (
+	SecurityStatusActive   = "active"   // 正常交易
+	SecurityStatusHalted   = "halted"   // 停牌，暫停受理新訂單
+	SecurityStatusDelisted = "delisted" // 已退市
+)
+
+// 未指定時的默認值：最小價格變動0.01美元，數量精度與訂單數量一致（支持碎股）
+const (
+	DefaultTickSize = DecimalOne / 100
+	DefaultLotSize  = DecimalOne / 1000000
+	DefaultCurrency = "USD"
+)
+
+// 未指定時的保證金比例（%）：初始保證金按 Reg T 的50%，維持保證金取空頭常用的30%
+const (
+	DefaultInitialMargin     = DecimalOne * 50
+	DefaultMaintenanceMargin = DecimalOne * 30
+)
+
+// 證券參考數據
+type Security struct {
+	Symbol     string    `json:"symbol"`
+	Name       string    `json:"name"`
+	Exchange   string    `json:"exchange"` // 交易所代碼，對應交易日曆，如 XNAS
+	Sector     string    `json:"sector"`
+	Currency   string    `json:"currency"`
+	LotSize    Decimal   `json:"lot_size"`  // 數量必須是其整數倍
+	TickSize   Decimal   `json:"tick_size"` // 價格必須是其整數倍
+	Status     string    `json:"status"`
+	HaltReason string    `json:"halt_reason,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	InitialMargin     Decimal `json:"initial_margin"`     // 開倉時的保證金比例（%），100 表示不可融資
+	MaintenanceMargin Decimal `json:"maintenance_margin"` // 持倉的維持保證金比例（%）
+	BorrowLimit       Decimal `json:"borrow_limit"`       // 可借券總股數，0 表示不可賣空
+}
+
+func IsValidSecurityStatus(status string) bool {
+	switch status {
+	case SecurityStatusActive, SecurityStatusHalted, SecurityStatusDelisted:
+		return true
+	}
+	return false
+}
+
+// 規範化並補齊默認值，返回第一個無效欄位的錯誤
+func (s *Security) Normalize() error {
+	s.Symbol = strings.ToUpper(strings.TrimSpace(s.Symbol))
+	s.Exchange = strings.ToUpper(strings.TrimSpace(s.Exchange))
+	s.Currency = strings.ToUpper(strings.TrimSpace(s.Currency))
+	s.Status = strings.ToLower(strings.TrimSpace(s.Status))
+
+	if s.Symbol == "" || len(s.Symbol) > 10 {
+		return fmt.Errorf("股票代碼必須為1-10個字符")
+	}
+	if s.Name == "" {
+		s.Name = s.Symbol
+	}
+	if s.Currency == "" {
+		s.Currency = DefaultCurrency
+	}
+	if s.Status == "" {
+		s.Status = SecurityStatusActive
+	}
+	if !IsValidSecurityStatus(s.Status) {
+		return fmt.Errorf("無效的交易狀態: %s", s.Status)
+	}
+	if s.TickSize == 0 {
+		s.TickSize = DefaultTickSize
+	}
+	if s.LotSize == 0 {
+		s.LotSize = DefaultLotSize
+	}
+	if s.TickSize < 0 || s.LotSize < 0 {
+		return fmt.Errorf("最小價格變動和最小交易單位必須大於0")
+	}
+	if s.InitialMargin == 0 {
+		s.InitialMargin = DefaultInitialMargin
+	}
+	if s.MaintenanceMargin == 0 {
+		s.MaintenanceMargin = MinDecimal(DefaultMaintenanceMargin, s.InitialMargin)
+	}
+	if s.InitialMargin < 0 || s.InitialMargin > DecimalOne*100 || s.MaintenanceMargin < 0 || s.MaintenanceMargin > s.InitialMargin {
+		return fmt.Errorf("保證金比例必須在0-100%%之間，且維持保證金不得高於初始保證金")
+	}
+	if s.BorrowLimit < 0 {
+		return fmt.Errorf("可借券股數不能為負數")
+	}
+	if s.Status == SecurityStatusActive {
+		s.HaltReason = ""
+	}
+	return nil
+}
+
+func (s *Security) IsTradable() bool {
+	return s.Status == SecurityStatusActive
+}
+
+// 價格是否為最小價格變動的整數倍
+func (s *Security) ValidPrice(price Decimal) bool {
+	return price.IsMultipleOf(s.TickSize)
+}
+
+// 數量是否為最小交易單位的整數倍
+func (s *Security) ValidQuantity(quantity Decimal) bool {
+	return quantity.IsMultipleOf(s.LotSize)
+}
+
+// 初始保證金比例，以小數表示；舊數據未設置時使用默認值
+func (s *Security) InitialMarginRate() Decimal {
+	if s.InitialMargin == 0 {
+		return DefaultInitialMargin / 100
+	}
+	return s.InitialMargin / 100
+}
+
+// 維持保證金比例，以小數表示；舊數據未設置時使用默認值
+func (s *Security) MaintenanceMarginRate() Decimal {
+	if s.MaintenanceMargin == 0 {
+		return MinDecimal(DefaultMaintenanceMargin/100, s.InitialMarginRate())
+	}
+	return s.MaintenanceMargin / 100
+}
+
+// 是否可賣空
+func (s *Security) IsShortable() bool {
+	return s.BorrowLimit > 0
+}
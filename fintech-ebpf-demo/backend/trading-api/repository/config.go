@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"trading-api/services"
+)
+
+// 配置以JSON字串保存在 system_configs.config_value
+func (r *Repository) GetConfig(ctx context.Context, key string, dest interface{}) error {
+	var value string
+	err := r.db.QueryRowContext(ctx,
+		`SELECT config_value FROM system_configs WHERE config_key = $1`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return services.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(value), dest)
+}
+
+func (r *Repository) SetConfig(ctx context.Context, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO system_configs (config_key, config_value) VALUES ($1, $2)
+		ON CONFLICT (config_key) DO UPDATE SET config_value = EXCLUDED.config_value`,
+		key, string(data))
+	return err
+}
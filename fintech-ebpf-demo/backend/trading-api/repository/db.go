@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"trading-api/config"
+	"trading-api/models"
+	"trading-api/services"
+)
+
+//go:embed schema.sql
+var schemaSQL string
+
+// 可在事務內外共用的查詢接口
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// 基於Postgres的存儲，實現 services 中的 OrderStore、TradeStore、PortfolioStore、ConfigStore 和 SecurityStore
+type Repository struct {
+	db *sql.DB
+}
+
+// 連接數據庫並執行表結構擴展
+func Open(cfg config.DatabaseConfig) (*Repository, error) {
+	sslMode := cfg.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, sslMode)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(20)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(30 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("連接數據庫失敗: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, schemaSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("更新數據庫表結構失敗: %w", err)
+	}
+	return New(db), nil
+}
+
+func New(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+var (
+	_ services.OrderStore     = (*Repository)(nil)
+	_ services.TradeStore     = (*Repository)(nil)
+	_ services.PortfolioStore = (*Repository)(nil)
+	_ services.ConfigStore    = (*Repository)(nil)
+	_ services.SecurityStore  = (*Repository)(nil)
+	_ services.LedgerStore    = (*Repository)(nil)
+)
+
+// 檢查數據庫連接
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+func (r *Repository) Close() error {
+	return r.db.Close()
+}
+
+// 在事務中執行 fn，出錯時回滾
+func (r *Repository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// 按用戶名獲取用戶ID，不存在時創建
+// trading-api 的用戶標識（X-User-ID）對應 users.username
+func ensureUser(ctx context.Context, q querier, userID string) (int64, error) {
+	return ensureRow(ctx, q,
+		`SELECT id FROM users WHERE username = $1`,
+		`INSERT INTO users (username, email, password_hash)
+		 VALUES ($1, $1 || '@trading-api.local', '')
+		 ON CONFLICT (username) DO NOTHING`,
+		userID)
+}
+
+// 按代碼獲取股票ID，不存在時創建
+func ensureStock(ctx context.Context, q querier, symbol string) (int64, error) {
+	return ensureRow(ctx, q,
+		`SELECT id FROM stocks WHERE symbol = $1`,
+		`INSERT INTO stocks (symbol, name) VALUES ($1, $1)
+		 ON CONFLICT (symbol) DO NOTHING`,
+		symbol)
+}
+
+// 先查詢，不存在時插入後再查詢；避免每次都觸發 updated_at 更新
+func ensureRow(ctx context.Context, q querier, selectSQL, insertSQL, key string) (int64, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, selectSQL, key).Scan(&id)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+	if _, err := q.ExecContext(ctx, insertSQL, key); err != nil {
+		return 0, err
+	}
+	err = q.QueryRowContext(ctx, selectSQL, key).Scan(&id)
+	return id, err
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullDecimal(d models.Decimal) interface{} {
+	if d == 0 {
+		return nil
+	}
+	return d
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"trading-api/services"
+)
+
+// 分錄與分錄行在同一事務中寫入；entry_uuid 已存在時不做任何修改
+func (r *Repository) AppendEntry(ctx context.Context, entry *services.JournalEntry) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		return appendEntry(ctx, tx, entry)
+	})
+}
+
+func appendEntry(ctx context.Context, q querier, entry *services.JournalEntry) error {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	userID, err := ensureUser(ctx, q, entry.UserID)
+	if err != nil {
+		return err
+	}
+
+	var entryID int64
+	err = q.QueryRowContext(ctx, `
+		INSERT INTO ledger_entries (entry_uuid, user_id, entry_type, trade_uuid, payload, posted_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (entry_uuid) DO NOTHING
+		RETURNING id`,
+		entry.ID, userID, entry.Type, nullString(entry.TradeID), string(payload), entry.PostedAt.UTC(),
+	).Scan(&entryID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, line := range entry.Lines {
+		if _, err := q.ExecContext(ctx, `
+			INSERT INTO ledger_lines (entry_id, account, amount, quantity)
+			VALUES ($1, $2, $3, $4)`,
+			entryID, line.Account, line.Amount, line.Quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LIMIT NULL 即不限數量
+func (r *Repository) ListEntries(ctx context.Context, userID string, limit int) ([]*services.JournalEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT e.payload FROM ledger_entries e
+		JOIN users u ON u.id = e.user_id
+		WHERE u.username = $1
+		ORDER BY e.id DESC
+		LIMIT NULLIF($2, 0)`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*services.JournalEntry, 0)
+	for rows.Next() {
+		var payload []byte
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var entry services.JournalEntry
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
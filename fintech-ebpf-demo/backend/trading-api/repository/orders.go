@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"trading-api/models"
+	"trading-api/services"
+)
+
+// 插入或更新訂單
+func (r *Repository) SaveOrder(ctx context.Context, order *models.Order) error {
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	userID, err := ensureUser(ctx, r.db, order.UserID)
+	if err != nil {
+		return err
+	}
+	stockID, err := ensureStock(ctx, r.db, order.Symbol)
+	if err != nil {
+		return err
+	}
+
+	var filledAt sql.NullTime
+	if order.Status == models.OrderStatusFilled && len(order.Fills) > 0 {
+		filledAt = sql.NullTime{Time: order.Fills[len(order.Fills)-1].ExecutedAt.UTC(), Valid: true}
+	}
+
+	// lib/pq 將 []byte 作為 bytea 傳遞，JSONB 欄位以字串寫入
+	// 已存儲的版本更新時不覆蓋
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO orders (
+			order_uuid, user_id, stock_id, symbol, order_type, side,
+			quantity, price, filled_quantity, remaining_quantity, status,
+			order_date, filled_date, time_in_force, avg_price, stop_price,
+			expire_at, group_id, payload, version, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $12)
+		ON CONFLICT (order_uuid) DO UPDATE SET
+			order_type = EXCLUDED.order_type,
+			quantity = EXCLUDED.quantity,
+			price = EXCLUDED.price,
+			filled_quantity = EXCLUDED.filled_quantity,
+			remaining_quantity = EXCLUDED.remaining_quantity,
+			status = EXCLUDED.status,
+			filled_date = EXCLUDED.filled_date,
+			avg_price = EXCLUDED.avg_price,
+			stop_price = EXCLUDED.stop_price,
+			expire_at = EXCLUDED.expire_at,
+			group_id = EXCLUDED.group_id,
+			payload = EXCLUDED.payload,
+			version = EXCLUDED.version
+		WHERE orders.version <= EXCLUDED.version`,
+		order.ID, userID, stockID, order.Symbol, order.OrderType, order.Side,
+		order.Quantity, nullDecimal(order.Price), order.FilledQty, order.RemainingQty, order.Status,
+		order.CreatedAt.UTC(), filledAt, order.TimeInForce, order.AvgPrice, nullDecimal(order.StopPrice),
+		nullTime(order.ExpireAt), nullString(order.GroupID), string(payload), order.Version,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return services.ErrStaleOrder
+	}
+	return nil
+}
+
+func (r *Repository) GetOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	var payload []byte
+	err := r.db.QueryRowContext(ctx,
+		`SELECT payload FROM orders WHERE order_uuid = $1`, orderID).Scan(&payload)
+	if err == sql.ErrNoRows {
+		return nil, services.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeOrder(payload)
+}
+
+// 按毫秒時間戳及訂單ID排序，與Redis索引的游標格式一致
+const orderSortExpr = `CAST(FLOOR(EXTRACT(EPOCH FROM o.order_date) * 1000) AS BIGINT)`
+
+func (r *Repository) ListUserOrders(ctx context.Context, query services.OrderQuery) (*services.OrderPage, error) {
+	cursor, err := services.DecodeOrderCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := []string{"u.username = $1", "o.payload IS NOT NULL"}
+	args := []interface{}{query.UserID}
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if len(query.Statuses) > 0 {
+		addCondition("o.status = ANY($%d)", pq.Array(query.Statuses))
+	}
+	if query.Symbol != "" {
+		addCondition("o.symbol = $%d", query.Symbol)
+	}
+	if query.Side != "" {
+		addCondition("o.side = $%d", query.Side)
+	}
+	if query.From != nil {
+		addCondition("o.order_date >= $%d", query.From.UTC())
+	}
+	if query.To != nil {
+		addCondition("o.order_date < $%d", query.To.UTC())
+	}
+
+	direction, comparison := "ASC", ">"
+	if query.Desc {
+		direction, comparison = "DESC", "<"
+	}
+	if cursor != nil {
+		args = append(args, cursor.CreatedMs, cursor.OrderID)
+		conditions = append(conditions, fmt.Sprintf(`(%s, o.order_uuid COLLATE "C") %s ($%d, $%d)`,
+			orderSortExpr, comparison, len(args)-1, len(args)))
+	}
+
+	statement := fmt.Sprintf(`
+		SELECT o.payload FROM orders o
+		JOIN users u ON u.id = o.user_id
+		WHERE %s
+		ORDER BY %s %s, o.order_uuid COLLATE "C" %s`,
+		strings.Join(conditions, " AND "), orderSortExpr, direction, direction)
+	if query.Limit > 0 {
+		args = append(args, query.Limit+1)
+		statement += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]*models.Order, 0)
+	for rows.Next() {
+		var payload []byte
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		order, err := decodeOrder(payload)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return services.NewOrderPage(orders, query.Limit), nil
+}
+
+func (r *Repository) ListActiveOrders(ctx context.Context) ([]*models.Order, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT payload FROM orders
+		WHERE status = ANY($1) AND payload IS NOT NULL
+		ORDER BY order_date, order_uuid COLLATE "C"`,
+		pq.Array([]string{models.OrderStatusNew, models.OrderStatusPartiallyFilled}))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]*models.Order, 0)
+	for rows.Next() {
+		var payload []byte
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		order, err := decodeOrder(payload)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func decodeOrder(payload []byte) (*models.Order, error) {
+	var order models.Order
+	if err := json.Unmarshal(payload, &order); err != nil {
+		return nil, err
+	}
+	order.NormalizeStatus()
+	return &order, nil
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"trading-api/services"
+)
+
+// 投資組合對應 accounts 表中用戶唯一的交易賬戶及 holdings 表的持倉，賬戶類型保存在 account_type
+
+// 從賬戶和持倉重建投資組合，賬戶不存在時返回 ErrNotFound
+func (r *Repository) GetPortfolio(ctx context.Context, userID string) (*services.Portfolio, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `SELECT id FROM users WHERE username = $1`, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, services.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return loadPortfolio(ctx, r.db, id, userID, false)
+}
+
+// 在事務中鎖定賬戶行後讀-改-寫，賬戶不存在時以初始資金開戶
+func (r *Repository) UpdatePortfolio(ctx context.Context, userID string, fn func(*services.Portfolio) error) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		id, err := ensureAccount(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		portfolio, err := loadPortfolio(ctx, tx, id, userID, true)
+		if err != nil {
+			return err
+		}
+		if err := fn(portfolio); err != nil {
+			return err
+		}
+		return writePortfolio(ctx, tx, id, portfolio)
+	})
+}
+
+// 投資組合與分錄在同一事務中寫入
+func (r *Repository) JournalPortfolio(ctx context.Context, userID string, fn func(*services.Portfolio) ([]*services.JournalEntry, error)) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		id, err := ensureAccount(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		portfolio, err := loadPortfolio(ctx, tx, id, userID, true)
+		if err != nil {
+			return err
+		}
+		entries, err := fn(portfolio)
+		if err != nil {
+			return err
+		}
+		if err := writePortfolio(ctx, tx, id, portfolio); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := appendEntry(ctx, tx, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 以給定的投資組合覆蓋賬戶餘額和持倉
+func (r *Repository) SavePortfolio(ctx context.Context, portfolio *services.Portfolio) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		id, err := ensureAccount(ctx, tx, portfolio.UserID)
+		if err != nil {
+			return err
+		}
+		return writePortfolio(ctx, tx, id, portfolio)
+	})
+}
+
+// 確保用戶及其交易賬戶存在，返回用戶ID
+func ensureAccount(ctx context.Context, q querier, userID string) (int64, error) {
+	id, err := ensureUser(ctx, q, userID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = q.ExecContext(ctx, `
+		INSERT INTO accounts (user_id, account_number, account_type, balance, available_balance)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (user_id) DO NOTHING`,
+		id, fmt.Sprintf("TRD-%010d", id), services.AccountTypeCash, services.InitialCashBalance)
+	return id, err
+}
+
+func loadPortfolio(ctx context.Context, q querier, id int64, userID string, forUpdate bool) (*services.Portfolio, error) {
+	lock := ""
+	if forUpdate {
+		lock = " FOR UPDATE"
+	}
+
+	portfolio := services.NewPortfolio(userID)
+	err := q.QueryRowContext(ctx, `
+		SELECT balance, account_type, updated_at FROM accounts
+		WHERE user_id = $1`+lock,
+		id).Scan(&portfolio.CashBalance, &portfolio.AccountType, &portfolio.LastUpdated)
+	if err == sql.ErrNoRows {
+		return nil, services.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT symbol, quantity, avg_price, COALESCE(last_price, avg_price),
+			COALESCE(previous_close, avg_price), updated_at, lots
+		FROM holdings
+		WHERE user_id = $1 AND quantity <> 0`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	portfolio.TotalValue = portfolio.CashBalance
+	for rows.Next() {
+		var position services.Position
+		var lots []byte
+		if err := rows.Scan(&position.Symbol, &position.Quantity, &position.AvgCost,
+			&position.LastPrice, &position.PreviousClose, &position.LastUpdated, &lots); err != nil {
+			return nil, err
+		}
+		if len(lots) > 0 {
+			if err := json.Unmarshal(lots, &position.Lots); err != nil {
+				return nil, err
+			}
+		}
+		position.Short = position.Quantity < 0
+		position.MarketValue = position.Quantity.Mul(position.LastPrice)
+		position.UnrealizedPL = position.MarketValue - position.Quantity.Mul(position.AvgCost)
+		position.DayPL = position.Quantity.Mul(position.LastPrice - position.PreviousClose)
+		portfolio.Positions[position.Symbol] = &position
+
+		portfolio.TotalValue += position.MarketValue
+		portfolio.TotalPL += position.UnrealizedPL
+		portfolio.DayPL += position.DayPL
+	}
+	return portfolio, rows.Err()
+}
+
+// 更新賬戶餘額並以投資組合中的持倉覆蓋 holdings，已平倉的股票刪除
+func writePortfolio(ctx context.Context, tx *sql.Tx, id int64, portfolio *services.Portfolio) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE accounts SET balance = $2, available_balance = $3, account_type = $4
+		WHERE user_id = $1`,
+		id, portfolio.CashBalance, portfolio.CashBalance-portfolio.ReservedCash, accountType(portfolio))
+	if err != nil {
+		return err
+	}
+
+	symbols := make([]string, 0, len(portfolio.Positions))
+	for symbol, position := range portfolio.Positions {
+		stockID, err := ensureStock(ctx, tx, symbol)
+		if err != nil {
+			return err
+		}
+		lots, err := json.Marshal(position.Lots)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO holdings (user_id, stock_id, symbol, quantity, avg_price, total_cost,
+				market_value, last_price, previous_close, lots)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (user_id, stock_id) DO UPDATE SET
+				quantity = EXCLUDED.quantity,
+				avg_price = EXCLUDED.avg_price,
+				total_cost = EXCLUDED.total_cost,
+				market_value = EXCLUDED.market_value,
+				last_price = EXCLUDED.last_price,
+				previous_close = EXCLUDED.previous_close,
+				lots = EXCLUDED.lots`,
+			id, stockID, symbol, position.Quantity, position.AvgCost, position.Quantity.Mul(position.AvgCost),
+			position.MarketValue, position.LastPrice, position.PreviousClose, string(lots),
+		)
+		if err != nil {
+			return err
+		}
+		symbols = append(symbols, symbol)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM holdings WHERE user_id = $1 AND symbol <> ALL($2)`,
+		id, pq.Array(symbols))
+	return err
+}
+
+// 未設置賬戶類型的投資組合按現金賬戶保存
+func accountType(portfolio *services.Portfolio) string {
+	if portfolio.AccountType == "" {
+		return services.AccountTypeCash
+	}
+	return portfolio.AccountType
+}
@@ -0,0 +1,136 @@
+-- trading-api 對 init.sql 基礎表結構的擴展
+-- 每次啟動時執行，所有語句均可重複執行
+
+-- 數量支持碎股
+ALTER TABLE orders ALTER COLUMN quantity TYPE DECIMAL(18,6);
+ALTER TABLE orders ALTER COLUMN filled_quantity TYPE DECIMAL(18,6);
+ALTER TABLE orders ALTER COLUMN remaining_quantity TYPE DECIMAL(18,6);
+ALTER TABLE trades ALTER COLUMN quantity TYPE DECIMAL(18,6);
+ALTER TABLE holdings ALTER COLUMN quantity TYPE DECIMAL(18,6);
+
+-- 訂單：外部ID及交易引擎所需欄位，payload 保存完整訂單供無損讀取
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS order_uuid VARCHAR(64);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS time_in_force VARCHAR(3);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS avg_price DECIMAL(20,8) DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS stop_price DECIMAL(20,8);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS expire_at TIMESTAMPTZ;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS group_id VARCHAR(64);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payload JSONB;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_order_uuid ON orders(order_uuid);
+CREATE INDEX IF NOT EXISTS idx_orders_user_date ON orders(user_id, order_date);
+-- 啟動時按此恢復訂單簿中的未完成訂單
+CREATE INDEX IF NOT EXISTS idx_orders_active ON orders(order_date) WHERE status IN ('new', 'partially_filled');
+
+-- 交易記錄：外部ID、成交明細及完整記錄
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS trade_uuid VARCHAR(64);
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS order_uuid VARCHAR(64);
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS fill_id VARCHAR(64);
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS liquidity VARCHAR(10);
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS net_amount DECIMAL(20,8);
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS payload JSONB;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trades_trade_uuid ON trades(trade_uuid);
+CREATE INDEX IF NOT EXISTS idx_trades_trade_date ON trades(trade_date);
+
+-- 持倉：保存最新價格以便在不查詢行情時重建投資組合
+ALTER TABLE holdings ADD COLUMN IF NOT EXISTS market_value DECIMAL(20,8) DEFAULT 0;
+ALTER TABLE holdings ADD COLUMN IF NOT EXISTS last_price DECIMAL(20,8);
+ALTER TABLE holdings ADD COLUMN IF NOT EXISTS previous_close DECIMAL(20,8);
+-- 稅批明細，為空時以 quantity 及 avg_price 視作一個稅批
+ALTER TABLE holdings ADD COLUMN IF NOT EXISTS lots JSONB;
+
+-- 交易統計
+CREATE TABLE IF NOT EXISTS trading_stats (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id),
+    payload JSONB NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 證券參考數據：交易所使用交易日曆代碼，數量及價格按最小單位校驗
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS currency VARCHAR(3) DEFAULT 'USD';
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS lot_size DECIMAL(18,6) DEFAULT 0.000001;
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS tick_size DECIMAL(10,4) DEFAULT 0.01;
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS status VARCHAR(10) DEFAULT 'active';
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS halt_reason VARCHAR(200);
+
+-- 複式記賬分錄，只追加不修改；ledger_lines 展開分錄行，便於按賬戶審計
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id SERIAL PRIMARY KEY,
+    entry_uuid VARCHAR(100) UNIQUE NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    entry_type VARCHAR(20) NOT NULL,
+    trade_uuid VARCHAR(64),
+    payload JSONB NOT NULL,
+    posted_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_user ON ledger_entries(user_id, id);
+
+CREATE TABLE IF NOT EXISTS ledger_lines (
+    id SERIAL PRIMARY KEY,
+    entry_id INTEGER NOT NULL REFERENCES ledger_entries(id),
+    account VARCHAR(50) NOT NULL,
+    amount DECIMAL(20,8) NOT NULL,
+    quantity DECIMAL(18,6) NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_ledger_lines_entry ON ledger_lines(entry_id);
+
+-- 價格及金額保留8位小數，與程序中的定點小數一致，寫入時不再捨入
+ALTER TABLE accounts ALTER COLUMN balance TYPE DECIMAL(20,8);
+ALTER TABLE accounts ALTER COLUMN available_balance TYPE DECIMAL(20,8);
+ALTER TABLE orders ALTER COLUMN price TYPE DECIMAL(20,8);
+ALTER TABLE orders ALTER COLUMN avg_price TYPE DECIMAL(20,8);
+ALTER TABLE orders ALTER COLUMN stop_price TYPE DECIMAL(20,8);
+ALTER TABLE trades ALTER COLUMN price TYPE DECIMAL(20,8);
+ALTER TABLE trades ALTER COLUMN total_amount TYPE DECIMAL(20,8);
+ALTER TABLE trades ALTER COLUMN commission TYPE DECIMAL(20,8);
+ALTER TABLE trades ALTER COLUMN net_amount TYPE DECIMAL(20,8);
+ALTER TABLE holdings ALTER COLUMN avg_price TYPE DECIMAL(20,8);
+ALTER TABLE holdings ALTER COLUMN total_cost TYPE DECIMAL(20,8);
+ALTER TABLE holdings ALTER COLUMN market_value TYPE DECIMAL(20,8);
+ALTER TABLE holdings ALTER COLUMN last_price TYPE DECIMAL(20,8);
+ALTER TABLE holdings ALTER COLUMN previous_close TYPE DECIMAL(20,8);
+ALTER TABLE ledger_lines ALTER COLUMN amount TYPE DECIMAL(20,8);
+
+-- 保證金交易：account_type 區分現金賬戶（cash）與保證金賬戶（margin）；空頭持倉的 quantity 為負數。
+-- 舊版的交易賬戶 account_type 為 trading（init.sql 的默認值），賬戶類型保存在 trading_mode，遷移後刪除該欄位。
+-- 只轉換 trading 及空值，其他類型的賬戶或同一用戶的多個賬戶無法對應到唯一的交易賬戶，遷移中止，需人工處理
+DO $$
+DECLARE
+    unknown_type TEXT;
+    duplicate_user INTEGER;
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'accounts' AND column_name = 'trading_mode') THEN
+        UPDATE accounts SET account_type = CASE WHEN trading_mode = 'margin' THEN 'margin' ELSE 'cash' END
+        WHERE account_type IS NULL OR account_type = 'trading';
+    ELSE
+        UPDATE accounts SET account_type = 'cash' WHERE account_type IS NULL OR account_type = 'trading';
+    END IF;
+
+    SELECT account_type INTO unknown_type FROM accounts
+    WHERE account_type NOT IN ('cash', 'margin') LIMIT 1;
+    IF FOUND THEN
+        RAISE EXCEPTION '無法遷移賬戶類型 %：只支持 trading、cash 及 margin', unknown_type;
+    END IF;
+
+    SELECT user_id INTO duplicate_user FROM accounts
+    WHERE user_id IS NOT NULL GROUP BY user_id HAVING COUNT(*) > 1 LIMIT 1;
+    IF FOUND THEN
+        RAISE EXCEPTION '用戶 % 有多個賬戶，每個用戶只能有一個交易賬戶', duplicate_user;
+    END IF;
+END $$;
+ALTER TABLE accounts DROP COLUMN IF EXISTS trading_mode;
+ALTER TABLE accounts ALTER COLUMN account_type SET DEFAULT 'cash';
+ALTER TABLE accounts ALTER COLUMN account_type SET NOT NULL;
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'accounts_account_type_check') THEN
+        ALTER TABLE accounts ADD CONSTRAINT accounts_account_type_check CHECK (account_type IN ('cash', 'margin'));
+    END IF;
+END $$;
+-- 每個用戶一個交易賬戶
+DROP INDEX IF EXISTS idx_accounts_user_type;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_user ON accounts(user_id);
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS initial_margin DECIMAL(10,4) DEFAULT 50;
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS maintenance_margin DECIMAL(10,4) DEFAULT 30;
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS borrow_limit DECIMAL(18,6) DEFAULT 0;
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"trading-api/models"
+	"trading-api/services"
+)
+
+const securityColumns = `symbol, name, COALESCE(exchange, ''), COALESCE(sector, ''), COALESCE(currency, 'USD'),
+	COALESCE(lot_size, 0), COALESCE(tick_size, 0), COALESCE(status, 'active'), COALESCE(halt_reason, ''), updated_at,
+	COALESCE(initial_margin, 0), COALESCE(maintenance_margin, 0), COALESCE(borrow_limit, 0)`
+
+func scanSecurity(row interface{ Scan(...interface{}) error }) (*models.Security, error) {
+	var security models.Security
+	err := row.Scan(&security.Symbol, &security.Name, &security.Exchange, &security.Sector, &security.Currency,
+		&security.LotSize, &security.TickSize, &security.Status, &security.HaltReason, &security.UpdatedAt,
+		&security.InitialMargin, &security.MaintenanceMargin, &security.BorrowLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &security, nil
+}
+
+func (r *Repository) GetSecurity(ctx context.Context, symbol string) (*models.Security, error) {
+	security, err := scanSecurity(r.db.QueryRowContext(ctx,
+		`SELECT `+securityColumns+` FROM stocks WHERE symbol = $1`, symbol))
+	if err == sql.ErrNoRows {
+		return nil, services.ErrNotFound
+	}
+	return security, err
+}
+
+func (r *Repository) ListSecurities(ctx context.Context) ([]*models.Security, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+securityColumns+` FROM stocks ORDER BY symbol`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	securities := make([]*models.Security, 0)
+	for rows.Next() {
+		security, err := scanSecurity(rows)
+		if err != nil {
+			return nil, err
+		}
+		securities = append(securities, security)
+	}
+	return securities, rows.Err()
+}
+
+// 按股票代碼插入或更新，價格、市值等行情欄位保持不變
+func (r *Repository) SaveSecurity(ctx context.Context, security *models.Security) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO stocks (symbol, name, exchange, sector, currency, lot_size, tick_size, status, halt_reason, updated_at,
+			initial_margin, maintenance_margin, borrow_limit)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, $12, $13)
+		ON CONFLICT (symbol) DO UPDATE SET
+			name = EXCLUDED.name, exchange = EXCLUDED.exchange, sector = EXCLUDED.sector,
+			currency = EXCLUDED.currency, lot_size = EXCLUDED.lot_size, tick_size = EXCLUDED.tick_size,
+			status = EXCLUDED.status, halt_reason = EXCLUDED.halt_reason, updated_at = EXCLUDED.updated_at,
+			initial_margin = EXCLUDED.initial_margin, maintenance_margin = EXCLUDED.maintenance_margin,
+			borrow_limit = EXCLUDED.borrow_limit`,
+		security.Symbol, security.Name, security.Exchange, security.Sector, security.Currency,
+		security.LotSize, security.TickSize, security.Status, security.HaltReason, security.UpdatedAt,
+		security.InitialMargin, security.MaintenanceMargin, security.BorrowLimit)
+	return err
+}
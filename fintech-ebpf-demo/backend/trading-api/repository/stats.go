@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"trading-api/services"
+)
+
+func (r *Repository) GetStats(ctx context.Context, userID string) (*services.TradingStats, error) {
+	var payload []byte
+	err := r.db.QueryRowContext(ctx, `
+		SELECT s.payload FROM trading_stats s
+		JOIN users u ON u.id = s.user_id
+		WHERE u.username = $1`, userID).Scan(&payload)
+	if err == sql.ErrNoRows {
+		return nil, services.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stats services.TradingStats
+	if err := json.Unmarshal(payload, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// 先插入空統計再鎖定該行，首次並發更新也不會丟失
+func (r *Repository) UpdateStats(ctx context.Context, userID string, fn func(*services.TradingStats) error) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		id, err := ensureUser(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		initial, err := json.Marshal(&services.TradingStats{UserID: userID})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO trading_stats (user_id, payload) VALUES ($1, $2)
+			ON CONFLICT (user_id) DO NOTHING`, id, string(initial)); err != nil {
+			return err
+		}
+
+		var payload []byte
+		if err := tx.QueryRowContext(ctx, `
+			SELECT payload FROM trading_stats WHERE user_id = $1 FOR UPDATE`, id).Scan(&payload); err != nil {
+			return err
+		}
+		var stats services.TradingStats
+		if err := json.Unmarshal(payload, &stats); err != nil {
+			return err
+		}
+
+		if err := fn(&stats); err != nil {
+			return err
+		}
+
+		updated, err := json.Marshal(&stats)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE trading_stats SET payload = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE user_id = $1`, id, string(updated))
+		return err
+	})
+}
+
+func (r *Repository) DeleteStats(ctx context.Context, userID string) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM trading_stats
+		WHERE user_id = (SELECT id FROM users WHERE username = $1)`, userID)
+	return err
+}
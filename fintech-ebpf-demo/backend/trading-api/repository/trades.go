@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+
+	"trading-api/services"
+)
+
+// 保存交易記錄，重複保存同一筆交易不會產生新記錄
+func (r *Repository) SaveTrade(ctx context.Context, trade *services.TradeRecord) error {
+	payload, err := json.Marshal(trade)
+	if err != nil {
+		return err
+	}
+
+	userID, err := ensureUser(ctx, r.db, trade.UserID)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO trades (
+			trade_uuid, order_id, order_uuid, user_id, symbol, side, quantity, price,
+			total_amount, commission, net_amount, fill_id, liquidity, trade_date, payload
+		) VALUES (
+			$1, (SELECT id FROM orders WHERE order_uuid = $2), $2, $3, $4, $5, $6, $7,
+			$8, $9, $10, $11, $12, $13, $14
+		)
+		ON CONFLICT (trade_uuid) DO NOTHING`,
+		trade.ID, trade.OrderID, userID, trade.Symbol, trade.Side, trade.Quantity, trade.Price,
+		trade.Amount, trade.Commission, trade.NetAmount, nullString(trade.FillID), nullString(trade.Liquidity),
+		trade.ExecutedAt.UTC(), string(payload),
+	)
+	return err
+}
+
+func (r *Repository) ListUserTrades(ctx context.Context, userID string, limit int) ([]*services.TradeRecord, error) {
+	return r.listTrades(ctx, `
+		SELECT t.payload FROM trades t
+		JOIN users u ON u.id = t.user_id
+		WHERE u.username = $1 AND t.payload IS NOT NULL
+		ORDER BY t.trade_date DESC
+		LIMIT $2`, userID, limit)
+}
+
+func (r *Repository) ListSymbolTrades(ctx context.Context, symbol string, limit int) ([]*services.TradeRecord, error) {
+	return r.listTrades(ctx, `
+		SELECT payload FROM trades
+		WHERE symbol = $1 AND payload IS NOT NULL
+		ORDER BY trade_date DESC
+		LIMIT $2`, symbol, limit)
+}
+
+func (r *Repository) listTrades(ctx context.Context, query string, args ...interface{}) ([]*services.TradeRecord, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trades := make([]*services.TradeRecord, 0)
+	for rows.Next() {
+		var payload []byte
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var trade services.TradeRecord
+		if err := json.Unmarshal(payload, &trade); err != nil {
+			return nil, err
+		}
+		trades = append(trades, &trade)
+	}
+	return trades, rows.Err()
+}
+
+func (r *Repository) DeleteUserTrades(ctx context.Context, userID string) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM trades
+		WHERE user_id = (SELECT id FROM users WHERE username = $1)`, userID)
+	return err
+}
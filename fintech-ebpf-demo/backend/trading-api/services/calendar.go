@@ -0,0 +1,380 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const calendarDateLayout = "2006-01-02"
+
+// 交易所交易日曆：常規交易時段、週末、休市日及提前收盤日，均按交易所當地時間
+type TradingCalendar struct {
+	Code     string
+	Name     string
+	Location *time.Location
+
+	open    int // 開盤時間，當地零點起的分鐘數
+	close   int
+	weekend map[time.Weekday]bool
+	rules   func(year int) []CalendarDay // 按規則生成的特殊日期，如美股假期
+
+	mu    sync.Mutex
+	extra []CalendarDay                  // 載入的特殊日期，與規則生成的同日時優先
+	years map[int]map[string]CalendarDay // 按年份緩存的特殊日期
+}
+
+// 休市日或提前收盤日
+type CalendarDay struct {
+	Date  string `json:"date"` // 當地日期 YYYY-MM-DD
+	Name  string `json:"name"`
+	Close string `json:"close,omitempty"` // 提前收盤時間 HH:MM，休市日為空
+}
+
+func (d CalendarDay) IsHoliday() bool {
+	return d.Close == ""
+}
+
+// open、close 為 HH:MM；weekend 為空時默認週六、週日休市
+func NewTradingCalendar(code, name, timezone, open, close string, weekend []time.Weekday) (*TradingCalendar, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("無效的時區 %q: %w", timezone, err)
+	}
+	openMinute, err := parseClock(open)
+	if err != nil {
+		return nil, err
+	}
+	closeMinute, err := parseClock(close)
+	if err != nil {
+		return nil, err
+	}
+	if openMinute >= closeMinute {
+		return nil, fmt.Errorf("開盤時間 %s 必須早於收盤時間 %s", open, close)
+	}
+	if len(weekend) == 0 {
+		weekend = []time.Weekday{time.Saturday, time.Sunday}
+	}
+
+	calendar := &TradingCalendar{
+		Code:     strings.ToUpper(code),
+		Name:     name,
+		Location: loc,
+		open:     openMinute,
+		close:    closeMinute,
+		weekend:  make(map[time.Weekday]bool, len(weekend)),
+		years:    make(map[int]map[string]CalendarDay),
+	}
+	for _, day := range weekend {
+		calendar.weekend[day] = true
+	}
+	return calendar, nil
+}
+
+// 常規開盤時間 HH:MM
+func (c *TradingCalendar) OpenTime() string {
+	return formatClock(c.open)
+}
+
+// 常規收盤時間 HH:MM
+func (c *TradingCalendar) CloseTime() string {
+	return formatClock(c.close)
+}
+
+// 補充休市日或提前收盤日，如臨時休市；同一日期以最後添加的為準
+func (c *TradingCalendar) AddDays(days ...CalendarDay) error {
+	for _, day := range days {
+		if _, err := time.Parse(calendarDateLayout, day.Date); err != nil {
+			return fmt.Errorf("無效的日期 %q", day.Date)
+		}
+		if day.Close != "" {
+			closeMinute, err := parseClock(day.Close)
+			if err != nil {
+				return err
+			}
+			if closeMinute <= c.open || closeMinute >= c.close {
+				return fmt.Errorf("%s 的提前收盤時間 %s 不在常規交易時段內", day.Date, day.Close)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.extra = append(c.extra, days...)
+	c.years = make(map[int]map[string]CalendarDay)
+	return nil
+}
+
+// t 所在當地日期是否為交易日
+func (c *TradingCalendar) IsTradingDay(t time.Time) bool {
+	local := t.In(c.Location)
+	if c.weekend[local.Weekday()] {
+		return false
+	}
+	day, special := c.special(local)
+	return !special || !day.IsHoliday()
+}
+
+// t 所在當地日期的開盤及收盤時間，非交易日 ok 為 false
+func (c *TradingCalendar) Session(t time.Time) (open, close time.Time, ok bool) {
+	if !c.IsTradingDay(t) {
+		return open, close, false
+	}
+	closeMinute := c.close
+	if day, special := c.special(t.In(c.Location)); special {
+		closeMinute, _ = parseClock(day.Close)
+	}
+	return c.at(t, c.open), c.at(t, closeMinute), true
+}
+
+// t 是否處於交易時段
+func (c *TradingCalendar) IsOpen(t time.Time) bool {
+	open, close, ok := c.Session(t)
+	return ok && !t.Before(open) && t.Before(close)
+}
+
+// t 之後最近一次開盤時間
+func (c *TradingCalendar) NextOpen(t time.Time) time.Time {
+	return c.nextSession(t, func(open, close time.Time) time.Time { return open })
+}
+
+// t 之後最近一次收盤時間，交易時段內為當日收盤
+func (c *TradingCalendar) NextClose(t time.Time) time.Time {
+	return c.nextSession(t, func(open, close time.Time) time.Time { return close })
+}
+
+// from 至 to（含）之間的休市日及提前收盤日，按日期排序
+func (c *TradingCalendar) SpecialDays(from, to time.Time) []CalendarDay {
+	first := from.In(c.Location).Format(calendarDateLayout)
+	last := to.In(c.Location).Format(calendarDateLayout)
+
+	days := make([]CalendarDay, 0)
+	for year := from.In(c.Location).Year(); year <= to.In(c.Location).Year(); year++ {
+		for _, day := range c.yearDays(year) {
+			if day.Date >= first && day.Date <= last {
+				days = append(days, day)
+			}
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days
+}
+
+// 逐日查找 t 之後的交易時段，pick 選取開盤或收盤時間
+func (c *TradingCalendar) nextSession(t time.Time, pick func(open, close time.Time) time.Time) time.Time {
+	local := t.In(c.Location)
+	date := time.Date(local.Year(), local.Month(), local.Day(), 12, 0, 0, 0, c.Location)
+	for i := 0; i < 370; i++ {
+		if open, close, ok := c.Session(date); ok {
+			if at := pick(open, close); at.After(t) {
+				return at
+			}
+		}
+		date = date.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+// t 所在當地日期的指定時刻
+func (c *TradingCalendar) at(t time.Time, minute int) time.Time {
+	local := t.In(c.Location)
+	return time.Date(local.Year(), local.Month(), local.Day(), minute/60, minute%60, 0, 0, c.Location)
+}
+
+// 交易時段分鐘數，非交易日為0
+func (c *TradingCalendar) sessionMinutes(t time.Time) int {
+	open, close, ok := c.Session(t)
+	if !ok {
+		return 0
+	}
+	return int(close.Sub(open) / time.Minute)
+}
+
+func (c *TradingCalendar) special(local time.Time) (CalendarDay, bool) {
+	day, exists := c.yearDays(local.Year())[local.Format(calendarDateLayout)]
+	return day, exists
+}
+
+func (c *TradingCalendar) yearDays(year int) map[string]CalendarDay {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if days, exists := c.years[year]; exists {
+		return days
+	}
+
+	days := make(map[string]CalendarDay)
+	if c.rules != nil {
+		for _, day := range c.rules(year) {
+			days[day.Date] = day
+		}
+	}
+	prefix := fmt.Sprintf("%04d-", year)
+	for _, day := range c.extra {
+		if strings.HasPrefix(day.Date, prefix) {
+			days[day.Date] = day
+		}
+	}
+	c.years[year] = days
+	return days
+}
+
+// 常用交易所名稱對應的日曆代碼
+var calendarAliases = map[string]string{
+	"NYSE":   "XNYS",
+	"NASDAQ": "XNAS",
+}
+
+// 按代碼管理的交易日曆，內置紐約證券交易所（XNYS）及納斯達克（XNAS）
+type CalendarService struct {
+	calendars   map[string]*TradingCalendar
+	defaultCode string
+}
+
+func NewCalendarService() *CalendarService {
+	s := &CalendarService{
+		calendars:   make(map[string]*TradingCalendar),
+		defaultCode: usMarketCalendar.Code,
+	}
+	s.Register(usMarketCalendar)
+	s.Register(newUSMarketCalendar("XNAS", "Nasdaq Stock Market"))
+	return s
+}
+
+func (s *CalendarService) Register(calendar *TradingCalendar) {
+	s.calendars[calendar.Code] = calendar
+}
+
+// 按代碼查找日曆，亦接受常用的交易所名稱
+func (s *CalendarService) Calendar(code string) (*TradingCalendar, bool) {
+	code = strings.ToUpper(code)
+	if alias, exists := calendarAliases[code]; exists {
+		code = alias
+	}
+	calendar, exists := s.calendars[code]
+	return calendar, exists
+}
+
+// 默認交易日曆，訂單受理及DAY訂單過期按此計算
+func (s *CalendarService) Default() *TradingCalendar {
+	return s.calendars[s.defaultCode]
+}
+
+func (s *CalendarService) SetDefault(code string) error {
+	calendar, exists := s.Calendar(code)
+	if !exists {
+		return fmt.Errorf("未知的交易日曆: %s", code)
+	}
+	s.defaultCode = calendar.Code
+	return nil
+}
+
+// 已註冊的日曆代碼，按字母排序
+func (s *CalendarService) Codes() []string {
+	codes := make([]string, 0, len(s.calendars))
+	for code := range s.calendars {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// 日曆文件格式；code 與已有日曆相同時只補充其休市日和提前收盤日
+type calendarFile struct {
+	Code        string        `json:"code"`
+	Name        string        `json:"name"`
+	Timezone    string        `json:"timezone"`
+	Open        string        `json:"open"`
+	Close       string        `json:"close"`
+	Weekend     []string      `json:"weekend"`
+	Holidays    []CalendarDay `json:"holidays"`
+	EarlyCloses []CalendarDay `json:"early_closes"`
+}
+
+// 載入目錄下所有 .json 日曆文件
+func (s *CalendarService) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := s.Load(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CalendarService) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file calendarFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("解析交易日曆 %s 失敗: %w", path, err)
+	}
+	if file.Code == "" {
+		return fmt.Errorf("交易日曆 %s 缺少 code", path)
+	}
+
+	for i := range file.Holidays {
+		file.Holidays[i].Close = ""
+	}
+	for _, day := range file.EarlyCloses {
+		if day.Close == "" {
+			return fmt.Errorf("交易日曆 %s: %s 缺少提前收盤時間", path, day.Date)
+		}
+	}
+	days := append(file.Holidays, file.EarlyCloses...)
+
+	calendar, exists := s.Calendar(file.Code)
+	if !exists {
+		weekend := make([]time.Weekday, 0, len(file.Weekend))
+		for _, name := range file.Weekend {
+			day, ok := parseWeekday(name)
+			if !ok {
+				return fmt.Errorf("交易日曆 %s: 無效的週末 %q", path, name)
+			}
+			weekend = append(weekend, day)
+		}
+		calendar, err = NewTradingCalendar(file.Code, file.Name, file.Timezone, file.Open, file.Close, weekend)
+		if err != nil {
+			return fmt.Errorf("交易日曆 %s: %w", path, err)
+		}
+		s.Register(calendar)
+	}
+
+	if err := calendar.AddDays(days...); err != nil {
+		return fmt.Errorf("交易日曆 %s: %w", path, err)
+	}
+	return nil
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), name) || strings.EqualFold(day.String()[:3], name) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// HH:MM 轉為零點起的分鐘數
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("無效的時間 %q，應為 HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func formatClock(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
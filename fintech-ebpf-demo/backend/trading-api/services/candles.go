@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+// K線（OHLCV）
+type Candle struct {
+	Time   time.Time `json:"time"` // 開始時間
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume int64     `json:"volume"`
+	Filled bool      `json:"filled,omitempty"` // 數據空缺，以前一收盤價補齊
+}
+
+// 行情來源不直接提供該週期，需由更小週期聚合
+var ErrUnsupportedInterval = errors.New("行情來源不支持該K線週期")
+
+// K線週期
+type CandleInterval struct {
+	Name         string
+	Duration     time.Duration
+	DefaultRange time.Duration // 未指定 from 時返回的時間範圍
+	MaxRange     time.Duration // 單次查詢的最大時間範圍
+
+	base  string        // 行情來源不支持時由此週期聚合
+	chunk time.Duration // 緩存分段長度
+	ttl   time.Duration // 緩存保留時間
+}
+
+const oneDay = 24 * time.Hour
+
+var candleIntervals = map[string]*CandleInterval{
+	"1m": {Name: "1m", Duration: time.Minute, DefaultRange: oneDay, MaxRange: 7 * oneDay, chunk: oneDay, ttl: 7 * oneDay},
+	"5m": {Name: "5m", Duration: 5 * time.Minute, DefaultRange: 5 * oneDay, MaxRange: 60 * oneDay, base: "1m", chunk: 7 * oneDay, ttl: 30 * oneDay},
+	"1h": {Name: "1h", Duration: time.Hour, DefaultRange: 30 * oneDay, MaxRange: 730 * oneDay, base: "5m", chunk: 30 * oneDay, ttl: 365 * oneDay},
+	"1d": {Name: "1d", Duration: oneDay, DefaultRange: 365 * oneDay, MaxRange: 20 * 365 * oneDay, base: "1h", chunk: 365 * oneDay, ttl: 365 * oneDay},
+}
+
+func ParseCandleInterval(name string) (*CandleInterval, bool) {
+	interval, exists := candleIntervals[name]
+	return interval, exists
+}
+
+// 歷史K線服務：按分段緩存已完成的K線，缺失的分段從行情來源獲取
+type CandleService struct {
+	logger   *logrus.Logger
+	redis    *redis.Client
+	provider QuoteProvider
+	now      func() time.Time
+}
+
+func NewCandleService(logger *logrus.Logger, redisClient *redis.Client, provider QuoteProvider) *CandleService {
+	return &CandleService{
+		logger:   logger,
+		redis:    redisClient,
+		provider: provider,
+		now:      time.Now,
+	}
+}
+
+// K線數據：有序集合，分數為開始時間（Unix秒）
+func candlesKey(symbol string, interval *CandleInterval) string {
+	return fmt.Sprintf("candles:%s:%s", symbol, interval.Name)
+}
+
+// 已緩存的分段開始時間集合
+func candleChunksKey(symbol string, interval *CandleInterval) string {
+	return fmt.Sprintf("candle_chunks:%s:%s", symbol, interval.Name)
+}
+
+// 獲取 [from, to) 內的K線，同一交易日內的空缺以前一收盤價補齊
+func (s *CandleService) GetCandles(ctx context.Context, symbol string, interval *CandleInterval, from, to time.Time) ([]Candle, error) {
+	candles, err := s.loadCandles(ctx, strings.ToUpper(symbol), interval, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return fillCandleGaps(candles, interval.Duration), nil
+}
+
+func (s *CandleService) loadCandles(ctx context.Context, symbol string, interval *CandleInterval, from, to time.Time) ([]Candle, error) {
+	now := s.now()
+	candles := make([]Candle, 0)
+	for start := from.Truncate(interval.chunk); start.Before(to) && !start.After(now); start = start.Add(interval.chunk) {
+		bars, err := s.loadChunk(ctx, symbol, interval, start, start.Add(interval.chunk), now)
+		if err != nil {
+			return nil, err
+		}
+		for _, bar := range bars {
+			if !bar.Time.Before(from) && bar.Time.Before(to) {
+				candles = append(candles, bar)
+			}
+		}
+	}
+	return candles, nil
+}
+
+// 已結束的分段優先讀緩存，未命中時獲取後寫入；包含當前時間的分段每次重新獲取
+// 緩存不可用時直接使用行情來源
+func (s *CandleService) loadChunk(ctx context.Context, symbol string, interval *CandleInterval, start, end, now time.Time) ([]Candle, error) {
+	fields := logrus.Fields{"symbol": symbol, "interval": interval.Name, "chunk": start}
+
+	complete := !end.After(now)
+	if complete {
+		bars, cached, err := s.readChunk(ctx, symbol, interval, start, end)
+		if err != nil {
+			s.logger.WithError(err).WithFields(fields).Warn("讀取K線緩存失敗")
+		} else if cached {
+			return bars, nil
+		}
+	}
+
+	bars, err := s.fetchCandles(ctx, symbol, interval, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	if complete {
+		if err := s.writeChunk(ctx, symbol, interval, start, end, bars); err != nil {
+			s.logger.WithError(err).WithFields(fields).Warn("寫入K線緩存失敗")
+		}
+	}
+	return bars, nil
+}
+
+// 行情來源不支持該週期時，由更小週期的K線聚合
+func (s *CandleService) fetchCandles(ctx context.Context, symbol string, interval *CandleInterval, from, to time.Time) ([]Candle, error) {
+	bars, err := s.provider.FetchCandles(ctx, symbol, interval.Duration, from, to)
+	if !errors.Is(err, ErrUnsupportedInterval) || interval.base == "" {
+		return bars, err
+	}
+
+	baseBars, err := s.loadCandles(ctx, symbol, candleIntervals[interval.base], from, to)
+	if err != nil {
+		return nil, err
+	}
+	return aggregateCandles(baseBars, interval.Duration), nil
+}
+
+func (s *CandleService) readChunk(ctx context.Context, symbol string, interval *CandleInterval, start, end time.Time) ([]Candle, bool, error) {
+	cached, err := s.redis.SIsMember(ctx, candleChunksKey(symbol, interval), start.Unix()).Result()
+	if err != nil || !cached {
+		return nil, false, err
+	}
+
+	members, err := s.redis.ZRangeByScore(ctx, candlesKey(symbol, interval), &redis.ZRangeBy{
+		Min: strconv.FormatInt(start.Unix(), 10),
+		Max: "(" + strconv.FormatInt(end.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	bars := make([]Candle, 0, len(members))
+	for _, member := range members {
+		var bar Candle
+		if err := json.Unmarshal([]byte(member), &bar); err != nil {
+			return nil, false, err
+		}
+		bars = append(bars, bar)
+	}
+	return bars, true, nil
+}
+
+// 替換分段內的K線並標記分段已緩存；沒有K線的分段（如休市）同樣標記
+func (s *CandleService) writeChunk(ctx context.Context, symbol string, interval *CandleInterval, start, end time.Time, bars []Candle) error {
+	members := make([]*redis.Z, 0, len(bars))
+	for _, bar := range bars {
+		data, err := json.Marshal(bar)
+		if err != nil {
+			return err
+		}
+		members = append(members, &redis.Z{Score: float64(bar.Time.Unix()), Member: data})
+	}
+
+	key, chunksKey := candlesKey(symbol, interval), candleChunksKey(symbol, interval)
+	_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, strconv.FormatInt(start.Unix(), 10), "("+strconv.FormatInt(end.Unix(), 10))
+		if len(members) > 0 {
+			pipe.ZAdd(ctx, key, members...)
+		}
+		pipe.SAdd(ctx, chunksKey, start.Unix())
+		pipe.Expire(ctx, key, interval.ttl)
+		pipe.Expire(ctx, chunksKey, interval.ttl)
+		return nil
+	})
+	return err
+}
+
+// K線所屬的週期開始時間：日內週期從開盤時間起對齊，日線為美東零點
+func candleBucket(t time.Time, interval time.Duration) time.Time {
+	if interval >= oneDay {
+		return marketDay(t)
+	}
+	open := sessionOpen(t)
+	if t.Before(open) {
+		return t.Truncate(interval)
+	}
+	return open.Add(t.Sub(open) / interval * interval)
+}
+
+// 將按時間排序的K線聚合為更大的週期
+func aggregateCandles(bars []Candle, interval time.Duration) []Candle {
+	aggregated := make([]Candle, 0)
+	for _, bar := range bars {
+		bucket := candleBucket(bar.Time, interval)
+		last := len(aggregated) - 1
+		if last < 0 || !aggregated[last].Time.Equal(bucket) {
+			bar.Time = bucket
+			aggregated = append(aggregated, bar)
+			continue
+		}
+
+		current := &aggregated[last]
+		current.High = max(current.High, bar.High)
+		current.Low = min(current.Low, bar.Low)
+		current.Close = bar.Close
+		current.Volume += bar.Volume
+		current.Filled = current.Filled && bar.Filled
+	}
+	return aggregated
+}
+
+// 補齊兩根K線之間的空缺：日內週期只補同一交易日內的空缺，日線只補交易日
+func fillCandleGaps(bars []Candle, interval time.Duration) []Candle {
+	filled := make([]Candle, 0, len(bars))
+	for _, bar := range bars {
+		if len(filled) > 0 {
+			prev := filled[len(filled)-1]
+			for _, slot := range missingSlots(prev.Time, bar.Time, interval) {
+				filled = append(filled, Candle{
+					Time:   slot,
+					Open:   prev.Close,
+					High:   prev.Close,
+					Low:    prev.Close,
+					Close:  prev.Close,
+					Filled: true,
+				})
+			}
+		}
+		filled = append(filled, bar)
+	}
+	return filled
+}
+
+// prev 與 next 之間應有但缺失的K線開始時間
+func missingSlots(prev, next time.Time, interval time.Duration) []time.Time {
+	var slots []time.Time
+	if interval >= oneDay {
+		for date := marketDay(prev).AddDate(0, 0, 1); date.Before(marketDay(next)); date = date.AddDate(0, 0, 1) {
+			if isTradingDay(date) {
+				slots = append(slots, date)
+			}
+		}
+		return slots
+	}
+
+	if !marketDay(prev).Equal(marketDay(next)) {
+		return nil
+	}
+	for slot := prev.Add(interval); slot.Before(next); slot = slot.Add(interval) {
+		slots = append(slots, slot)
+	}
+	return slots
+}
@@ -0,0 +1,449 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/metrics"
+	"trading-api/models"
+)
+
+// 出入金類型
+const (
+	FundingDeposit    = "deposit"
+	FundingWithdrawal = "withdrawal"
+)
+
+// 出入金狀態
+const (
+	FundingPending   = "pending" // 等待支付網關結果，出金的現金已凍結；網關無響應時保持此狀態待人工核對
+	FundingCompleted = "completed"
+	FundingFailed    = "failed"
+	FundingReversing = "reversing" // 入金退款處理中，現金已凍結
+	FundingReversed  = "reversed"  // 入金已退款
+)
+
+// 只有已完成的入金可以退款
+var ErrTransferNotReversible = errors.New("只有已完成的入金可以退款")
+
+// 出入金記錄，ID 同時作為支付網關的訂單號
+type FundingTransfer struct {
+	ID            string         `json:"id"`
+	UserID        string         `json:"userId"`
+	Type          string         `json:"type"`
+	Status        string         `json:"status"`
+	Amount        models.Decimal `json:"amount"`
+	Currency      string         `json:"currency"`
+	Method        string         `json:"method"`
+	PaymentID     string         `json:"paymentId,omitempty"`
+	TransactionID string         `json:"transactionId,omitempty"`
+	RefundID      string         `json:"refundId,omitempty"`
+	Reversals     int            `json:"reversals,omitempty"` // 退款嘗試次數，用於區分每次凍結及解凍的分錄
+	Message       string         `json:"message,omitempty"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+}
+
+// 出入金服務：經支付網關收付款，成功後才增減投資組合現金並記賬。
+// 出金及退款先把現金凍結到 funding_hold，支付失敗時解凍，避免處理期間被用於下單
+type FundingService struct {
+	logger       *logrus.Logger
+	redis        *redis.Client
+	gateway      PaymentGateway
+	history      *TradingHistoryService
+	ledger       *LedgerService
+	reservations *ReservationService
+}
+
+func NewFundingService(logger *logrus.Logger, redisClient *redis.Client, gateway PaymentGateway,
+	history *TradingHistoryService, ledger *LedgerService, reservations *ReservationService) *FundingService {
+	return &FundingService{
+		logger:       logger,
+		redis:        redisClient,
+		gateway:      gateway,
+		history:      history,
+		ledger:       ledger,
+		reservations: reservations,
+	}
+}
+
+func fundingKey(transferID string) string {
+	return fmt.Sprintf("funding:%s", transferID)
+}
+
+// 用戶出入金索引：有序集合，分數為創建時間（毫秒）
+func userFundingKey(userID string) string {
+	return fmt.Sprintf("user_funding:%s", userID)
+}
+
+// 入金：支付成功後增加現金；支付成功但入賬失敗時自動退款。
+// 返回錯誤且記錄不為nil表示支付網關無響應，記錄保持 pending
+func (s *FundingService) Deposit(ctx context.Context, userID string, amount models.Decimal, currency, method string) (*FundingTransfer, error) {
+	transfer := newFundingTransfer(userID, FundingDeposit, amount, currency, method)
+	if err := s.save(ctx, transfer); err != nil {
+		return nil, err
+	}
+
+	result, err := s.gateway.Process(context.Background(), s.paymentRequest(transfer))
+	if err != nil {
+		return transfer, s.gatewayError(ctx, transfer, err, nil)
+	}
+	transfer.PaymentID, transfer.TransactionID = result.PaymentID, result.TransactionID
+	if result.Status != PaymentSuccess {
+		s.finish(ctx, transfer, FundingFailed, result.Message)
+		return transfer, nil
+	}
+
+	entry := &JournalEntry{
+		ID:     "deposit:" + transfer.ID,
+		UserID: userID,
+		Type:   EntryDeposit,
+		Memo:   fmt.Sprintf("入金 %s", transfer.ID),
+		Lines: []JournalLine{
+			{Account: AccountCash, Amount: amount},
+			{Account: AccountFunding, Amount: -amount},
+		},
+	}
+	if err := s.moveCash(ctx, userID, amount, entry); err != nil {
+		s.logger.WithError(err).WithField("transfer_id", transfer.ID).Error("入金入賬失敗，退回款項")
+		s.refundUncredited(ctx, transfer)
+		return transfer, nil
+	}
+
+	s.finish(ctx, transfer, FundingCompleted, result.Message)
+	return transfer, nil
+}
+
+// 出金：先凍結可用現金，支付成功後轉出，失敗時解凍。可用現金不足時返回 *InsufficientBalanceError
+func (s *FundingService) Withdraw(ctx context.Context, userID string, amount models.Decimal, currency, method string) (*FundingTransfer, error) {
+	transfer := newFundingTransfer(userID, FundingWithdrawal, amount, currency, method)
+	if err := s.hold(ctx, transfer, "hold:"+transfer.ID); err != nil {
+		return nil, err
+	}
+	if err := s.save(ctx, transfer); err != nil {
+		s.release(ctx, transfer, "release:"+transfer.ID)
+		return nil, err
+	}
+
+	result, err := s.gateway.Process(context.Background(), s.paymentRequest(transfer))
+	if err != nil {
+		return transfer, s.gatewayError(ctx, transfer, err, func() {
+			s.release(ctx, transfer, "release:"+transfer.ID)
+		})
+	}
+	transfer.PaymentID, transfer.TransactionID = result.PaymentID, result.TransactionID
+	if result.Status != PaymentSuccess {
+		s.release(ctx, transfer, "release:"+transfer.ID)
+		s.finish(ctx, transfer, FundingFailed, result.Message)
+		return transfer, nil
+	}
+
+	s.post(ctx, &JournalEntry{
+		ID:     "withdrawal:" + transfer.ID,
+		UserID: userID,
+		Type:   EntryWithdrawal,
+		Memo:   fmt.Sprintf("出金 %s", transfer.ID),
+		Lines: []JournalLine{
+			{Account: AccountFunding, Amount: amount},
+			{Account: AccountFundingHold, Amount: -amount},
+		},
+	})
+	s.finish(ctx, transfer, FundingCompleted, result.Message)
+	return transfer, nil
+}
+
+// 入金退款：凍結等額現金後經支付網關退款，退款失敗時解凍並恢復為已完成。
+// 記錄不存在返回 ErrNotFound，狀態不符返回 ErrTransferNotReversible，可用現金不足返回 *InsufficientBalanceError
+func (s *FundingService) Reverse(ctx context.Context, userID, transferID, reason string) (*FundingTransfer, error) {
+	transfer, err := s.claimReversal(ctx, userID, transferID)
+	if err != nil {
+		return nil, err
+	}
+
+	attempt := fmt.Sprintf("reversal:%s:%d", transfer.ID, transfer.Reversals)
+	if err := s.hold(ctx, transfer, "hold:"+attempt); err != nil {
+		s.cancelReversal(ctx, transfer, "可用現金不足，退款取消")
+		return nil, err
+	}
+
+	result, err := s.gateway.Refund(context.Background(), RefundRequest{
+		PaymentID: transfer.PaymentID,
+		Amount:    transfer.Amount,
+		Reason:    reason,
+	})
+	if err != nil {
+		return transfer, s.gatewayError(ctx, transfer, err, func() {
+			s.release(ctx, transfer, "release:"+attempt)
+		})
+	}
+	if result.Status != RefundProcessed {
+		s.release(ctx, transfer, "release:"+attempt)
+		s.cancelReversal(ctx, transfer, "退款失敗")
+		return transfer, nil
+	}
+
+	transfer.RefundID = result.RefundID
+	s.post(ctx, &JournalEntry{
+		ID:     "reversal:" + transfer.ID,
+		UserID: userID,
+		Type:   EntryDepositReversal,
+		Memo:   fmt.Sprintf("入金退款 %s", transfer.ID),
+		Lines: []JournalLine{
+			{Account: AccountFunding, Amount: transfer.Amount},
+			{Account: AccountFundingHold, Amount: -transfer.Amount},
+		},
+	})
+	s.finish(ctx, transfer, FundingReversed, reason)
+	return transfer, nil
+}
+
+// 讀取用戶的出入金記錄，不存在或不屬於該用戶時返回 ErrNotFound
+func (s *FundingService) Get(ctx context.Context, userID, transferID string) (*FundingTransfer, error) {
+	var transfer FundingTransfer
+	if err := getJSON(ctx, s.redis, fundingKey(transferID), &transfer); err != nil {
+		return nil, err
+	}
+	if transfer.UserID != userID {
+		return nil, ErrNotFound
+	}
+	return &transfer, nil
+}
+
+// 按創建時間倒序列出用戶的出入金記錄
+func (s *FundingService) History(ctx context.Context, userID string, limit int) ([]*FundingTransfer, error) {
+	ids, err := s.redis.ZRevRange(ctx, userFundingKey(userID), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := make([]*FundingTransfer, 0, len(ids))
+	for _, id := range ids {
+		var transfer FundingTransfer
+		if err := getJSON(ctx, s.redis, fundingKey(id), &transfer); err != nil {
+			continue
+		}
+		transfers = append(transfers, &transfer)
+	}
+	return transfers, nil
+}
+
+func newFundingTransfer(userID, transferType string, amount models.Decimal, currency, method string) *FundingTransfer {
+	now := time.Now()
+	return &FundingTransfer{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Type:      transferType,
+		Status:    FundingPending,
+		Amount:    amount,
+		Currency:  currency,
+		Method:    method,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func (s *FundingService) paymentRequest(transfer *FundingTransfer) PaymentRequest {
+	return PaymentRequest{
+		OrderID:  transfer.ID,
+		UserID:   transfer.UserID,
+		Amount:   transfer.Amount,
+		Currency: transfer.Currency,
+		Method:   transfer.Method,
+	}
+}
+
+// 支付網關請求出錯：網關明確拒絕（4xx）時款項未處理，執行 rollback 並標記失敗；
+// 其餘錯誤無法確定是否已收付款，保持凍結及當前狀態待人工核對
+func (s *FundingService) gatewayError(ctx context.Context, transfer *FundingTransfer, err error, rollback func()) error {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode < 500 {
+		if rollback != nil {
+			rollback()
+		}
+		message := fmt.Sprintf("支付網關拒絕請求: %d", statusErr.StatusCode)
+		if transfer.Status == FundingReversing {
+			s.cancelReversal(ctx, transfer, message)
+		} else {
+			s.finish(ctx, transfer, FundingFailed, message)
+		}
+		return err
+	}
+
+	s.logger.WithError(err).WithFields(logrus.Fields{
+		"transfer_id": transfer.ID,
+		"type":        transfer.Type,
+		"status":      transfer.Status,
+	}).Error("支付網關無響應，出入金結果未知，需人工核對")
+	transfer.Message = "支付網關無響應，結果待核對"
+	transfer.UpdatedAt = time.Now()
+	if saveErr := s.save(ctx, transfer); saveErr != nil {
+		s.logger.WithError(saveErr).WithField("transfer_id", transfer.ID).Error("保存出入金記錄失敗")
+	}
+	return err
+}
+
+// 入金已收款但未入賬，直接退款
+func (s *FundingService) refundUncredited(ctx context.Context, transfer *FundingTransfer) {
+	result, err := s.gateway.Refund(context.Background(), RefundRequest{
+		PaymentID: transfer.PaymentID,
+		Amount:    transfer.Amount,
+		Reason:    "入賬失敗",
+	})
+	if err != nil || result.Status != RefundProcessed {
+		s.logger.WithError(err).WithField("transfer_id", transfer.ID).Error("入金退款失敗，需人工處理")
+		s.finish(ctx, transfer, FundingFailed, "入賬失敗且退款失敗，需人工處理")
+		return
+	}
+	transfer.RefundID = result.RefundID
+	s.finish(ctx, transfer, FundingReversed, "入賬失敗，已退款")
+}
+
+// 凍結現金：從可用現金轉入 funding_hold
+func (s *FundingService) hold(ctx context.Context, transfer *FundingTransfer, entryID string) error {
+	return s.moveCash(ctx, transfer.UserID, -transfer.Amount, &JournalEntry{
+		ID:     entryID,
+		UserID: transfer.UserID,
+		Type:   EntryFundingHold,
+		Memo:   fmt.Sprintf("凍結 %s", transfer.ID),
+		Lines: []JournalLine{
+			{Account: AccountFundingHold, Amount: transfer.Amount},
+			{Account: AccountCash, Amount: -transfer.Amount},
+		},
+	})
+}
+
+func (s *FundingService) release(ctx context.Context, transfer *FundingTransfer, entryID string) {
+	err := s.moveCash(ctx, transfer.UserID, transfer.Amount, &JournalEntry{
+		ID:     entryID,
+		UserID: transfer.UserID,
+		Type:   EntryFundingRelease,
+		Memo:   fmt.Sprintf("解凍 %s", transfer.ID),
+		Lines: []JournalLine{
+			{Account: AccountCash, Amount: transfer.Amount},
+			{Account: AccountFundingHold, Amount: -transfer.Amount},
+		},
+	})
+	if err != nil {
+		s.logger.WithError(err).WithField("transfer_id", transfer.ID).Error("解凍現金失敗，需人工處理")
+	}
+}
+
+// 增減投資組合現金並在同一事務中記賬，記賬失敗時現金不變。減少時先在預留中為該筆金額佔位，
+// 與並發的掛單預留互斥，不得超過扣除掛單預留後的可用現金，保證金賬戶同時不得超過初始保證金盈餘
+func (s *FundingService) moveCash(ctx context.Context, userID string, amount models.Decimal, entry *JournalEntry) error {
+	if amount < 0 {
+		holdID := "funding:" + entry.ID
+		if err := s.reservations.ReserveCash(userID, holdID, -amount); err != nil {
+			return err
+		}
+		// 現金扣減後才釋放佔位，失敗時直接釋放
+		defer func() {
+			if err := s.reservations.Release(userID, holdID); err != nil {
+				s.logger.WithError(err).WithField("entry_id", entry.ID).Error("釋放出金預留失敗")
+			}
+		}()
+	}
+
+	return s.history.journalPortfolio(ctx, userID, func(portfolio *Portfolio) ([]*JournalEntry, error) {
+		portfolio.CashBalance += amount
+		portfolio.TotalValue += amount
+		portfolio.LastUpdated = time.Now()
+		return []*JournalEntry{entry}, nil
+	})
+}
+
+// 過賬只涉及 funding_hold 與外部資金、不改變投資組合的分錄；失敗時記錄日誌，差異由對賬發現
+func (s *FundingService) post(ctx context.Context, entry *JournalEntry) {
+	if err := s.ledger.Post(ctx, entry); err != nil {
+		s.logger.WithError(err).WithField("entry_id", entry.ID).Error("出入金記賬失敗")
+	}
+}
+
+// 以樂觀鎖把已完成的入金標記為退款中，防止重複退款
+func (s *FundingService) claimReversal(ctx context.Context, userID, transferID string) (*FundingTransfer, error) {
+	key := fundingKey(transferID)
+	var transfer FundingTransfer
+
+	err := watchKeys(ctx, s.redis, func(tx *redis.Tx) error {
+		if err := getJSON(ctx, tx, key, &transfer); err != nil {
+			return err
+		}
+		if transfer.UserID != userID {
+			return ErrNotFound
+		}
+		if transfer.Type != FundingDeposit || transfer.Status != FundingCompleted {
+			return ErrTransferNotReversible
+		}
+
+		transfer.Status = FundingReversing
+		transfer.Reversals++
+		transfer.UpdatedAt = time.Now()
+		transferJSON, err := json.Marshal(&transfer)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, transferJSON, 0)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+// 更新為最終狀態並記錄指標
+func (s *FundingService) finish(ctx context.Context, transfer *FundingTransfer, status, message string) {
+	transfer.Status = status
+	transfer.Message = message
+	transfer.UpdatedAt = time.Now()
+	if err := s.save(ctx, transfer); err != nil {
+		s.logger.WithError(err).WithField("transfer_id", transfer.ID).Error("保存出入金記錄失敗")
+	}
+
+	metrics.FundingTransfers.WithLabelValues(transfer.Type, status).Inc()
+	s.logger.WithFields(logrus.Fields{
+		"transfer_id": transfer.ID,
+		"user_id":     transfer.UserID,
+		"type":        transfer.Type,
+		"amount":      transfer.Amount,
+		"status":      status,
+		"payment_id":  transfer.PaymentID,
+	}).Info("出入金處理完成")
+}
+
+// 退款未成功，入金恢復為已完成
+func (s *FundingService) cancelReversal(ctx context.Context, transfer *FundingTransfer, message string) {
+	transfer.Status = FundingCompleted
+	transfer.Message = message
+	transfer.UpdatedAt = time.Now()
+	if err := s.save(ctx, transfer); err != nil {
+		s.logger.WithError(err).WithField("transfer_id", transfer.ID).Error("保存出入金記錄失敗")
+	}
+	metrics.FundingTransfers.WithLabelValues("reversal", FundingFailed).Inc()
+}
+
+func (s *FundingService) save(ctx context.Context, transfer *FundingTransfer) error {
+	transferJSON, err := json.Marshal(transfer)
+	if err != nil {
+		return err
+	}
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, fundingKey(transfer.ID), transferJSON, 0)
+		pipe.ZAdd(ctx, userFundingKey(transfer.UserID), &redis.Z{
+			Score:  float64(transfer.CreatedAt.UnixMilli()),
+			Member: transfer.ID,
+		})
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+// 冪等記錄狀態
+const (
+	IdempotencyInProgress = "in_progress"
+	IdempotencyCompleted  = "completed"
+)
+
+// 冪等鍵保留時間
+const idempotencyTTL = 24 * time.Hour
+
+// 冪等記錄：保存首次請求的指紋及響應，供重試時重放
+type IdempotencyRecord struct {
+	Key         string    `json:"key"`
+	Fingerprint string    `json:"fingerprint"`
+	Status      string    `json:"status"`
+	StatusCode  int       `json:"statusCode,omitempty"`
+	ContentType string    `json:"contentType,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// 冪等服務：以Redis保存請求冪等鍵
+type IdempotencyService struct {
+	logger *logrus.Logger
+	redis  *redis.Client
+}
+
+func NewIdempotencyService(logger *logrus.Logger, redisClient *redis.Client) *IdempotencyService {
+	return &IdempotencyService{
+		logger: logger,
+		redis:  redisClient,
+	}
+}
+
+func idempotencyKey(scope, key string) string {
+	return fmt.Sprintf("idempotency:%s:%s", scope, key)
+}
+
+// 佔用冪等鍵。成功佔用返回 (nil, true)；鍵已存在時返回已有記錄
+func (s *IdempotencyService) Begin(scope, key, fingerprint string) (*IdempotencyRecord, bool, error) {
+	record := &IdempotencyRecord{
+		Key:         key,
+		Fingerprint: fingerprint,
+		Status:      IdempotencyInProgress,
+		CreatedAt:   time.Now(),
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ctx := context.Background()
+	acquired, err := s.redis.SetNX(ctx, idempotencyKey(scope, key), recordJSON, idempotencyTTL).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if acquired {
+		return nil, true, nil
+	}
+
+	existingJSON, err := s.redis.Get(ctx, idempotencyKey(scope, key)).Result()
+	if err == redis.Nil {
+		// 已有記錄剛好過期，重新佔用
+		return s.Begin(scope, key, fingerprint)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var existing IdempotencyRecord
+	if err := json.Unmarshal([]byte(existingJSON), &existing); err != nil {
+		return nil, false, err
+	}
+	return &existing, false, nil
+}
+
+// 保存首次請求的響應
+func (s *IdempotencyService) Complete(scope, key, fingerprint string, statusCode int, contentType string, body []byte) error {
+	record := &IdempotencyRecord{
+		Key:         key,
+		Fingerprint: fingerprint,
+		Status:      IdempotencyCompleted,
+		StatusCode:  statusCode,
+		ContentType: contentType,
+		Body:        body,
+		CreatedAt:   time.Now(),
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"scope":      scope,
+		"key":        key,
+		"statusCode": statusCode,
+	}).Debug("冪等響應已保存")
+
+	return s.redis.Set(context.Background(), idempotencyKey(scope, key), recordJSON, idempotencyTTL).Err()
+}
+
+// 釋放冪等鍵，允許客戶端重試
+func (s *IdempotencyService) Release(scope, key string) error {
+	return s.redis.Del(context.Background(), idempotencyKey(scope, key)).Err()
+}
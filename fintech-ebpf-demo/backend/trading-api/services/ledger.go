@@ -0,0 +1,478 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+)
+
+// 賬戶，每個用戶一套；證券賬戶按股票劃分子賬戶
+const (
+	AccountCash        = "cash"         // 現金
+	AccountSecurities  = "securities"   // 持倉，按成交價計量，不含手續費
+	AccountCommission  = "commission"   // 已付手續費，即平台的手續費收入
+	AccountRealizedPL  = "realized_pl"  // 已實現損益，按成交價計算，不含手續費
+	AccountFunding     = "funding"      // 外部資金：初始資金、入金、出金及重置
+	AccountFundingHold = "funding_hold" // 等待支付網關結果的出金及入金退款
+	AccountInterest    = "interest"     // 已付融資利息
+)
+
+// 分錄類型
+const (
+	EntryOpening  = "opening" // 啟用賬本時按當時的投資組合建立的期初餘額
+	EntryTrade    = "trade"
+	EntryFee      = "fee"
+	EntryReset    = "reset"
+	EntryInterest = "interest" // 融資借款的利息
+
+	EntryDeposit         = "deposit"
+	EntryWithdrawal      = "withdrawal"
+	EntryDepositReversal = "deposit_reversal"
+	EntryFundingHold     = "funding_hold"    // 出金或退款前凍結現金
+	EntryFundingRelease  = "funding_release" // 支付失敗，解凍現金
+)
+
+// 持倉成本對賬的容許誤差：稅批按剩餘數量重算成交價成本時，乘積超過8位小數的部分會被捨入。
+// 借貸合計、現金及股數均為精確比較
+const reconcileCostTolerance = models.DecimalOne / 1000000
+
+// 分錄借貸不平衡
+var ErrUnbalancedEntry = errors.New("分錄借貸不平衡")
+
+func SecuritiesAccount(symbol string) string {
+	return AccountSecurities + ":" + symbol
+}
+
+// 分錄行：金額借方為正、貸方為負
+type JournalLine struct {
+	Account  string         `json:"account"`
+	Amount   models.Decimal `json:"amount"`
+	Quantity models.Decimal `json:"quantity,omitempty"` // 證券賬戶的股數變動
+}
+
+// 分錄：所有行的金額合計為零，過賬後不再修改
+type JournalEntry struct {
+	ID       string        `json:"id"`
+	UserID   string        `json:"userId"`
+	Type     string        `json:"type"`
+	TradeID  string        `json:"tradeId,omitempty"`
+	Memo     string        `json:"memo"`
+	Lines    []JournalLine `json:"lines"`
+	PostedAt time.Time     `json:"postedAt"`
+}
+
+// 賬戶餘額，借方為正
+type AccountBalance struct {
+	Account  string         `json:"account"`
+	Balance  models.Decimal `json:"balance"`
+	Quantity models.Decimal `json:"quantity,omitempty"`
+}
+
+// 投資組合與賬本之間的差異
+type ReconciliationItem struct {
+	Account    string         `json:"account"`
+	Field      string         `json:"field"` // "balance" 或 "quantity"
+	Ledger     models.Decimal `json:"ledger"`
+	Portfolio  models.Decimal `json:"portfolio"`
+	Difference models.Decimal `json:"difference"`
+}
+
+type Reconciliation struct {
+	UserID      string               `json:"userId"`
+	Balanced    bool                 `json:"balanced"`   // 賬本借貸合計為零
+	Reconciled  bool                 `json:"reconciled"` // 投資組合與賬本一致
+	Differences []ReconciliationItem `json:"differences"`
+	Balances    []AccountBalance     `json:"balances"`
+	CheckedAt   time.Time            `json:"checkedAt"`
+}
+
+// 複式記賬：交易、手續費、重置等資金變動均以只追加的分錄記錄，
+// 投資組合中的現金與持倉是其投影，可隨時對賬。成交、重置、出入金及利息分錄與投影在同一事務中寫入，
+// 記賬失敗時操作不生效；不改變投資組合的出入金凍結分錄記賬失敗不阻斷操作，差異由對賬發現
+type LedgerService struct {
+	logger *logrus.Logger
+	store  LedgerStore
+	opened sync.Map // 已有分錄的用戶
+}
+
+func NewLedgerService(logger *logrus.Logger, store LedgerStore) *LedgerService {
+	return &LedgerService{
+		logger: logger,
+		store:  store,
+	}
+}
+
+// 校驗借貸平衡（合計必須精確為零）後過賬；ID已存在的分錄不會重複記賬
+func (s *LedgerService) Post(ctx context.Context, entry *JournalEntry) error {
+	if err := prepareEntry(entry); err != nil {
+		return err
+	}
+	if err := s.store.AppendEntry(ctx, entry); err != nil {
+		return err
+	}
+	s.opened.Store(entry.UserID, true)
+	return nil
+}
+
+// 校驗借貸平衡，並補全缺省的ID及過賬時間
+func prepareEntry(entry *JournalEntry) error {
+	var total models.Decimal
+	for _, line := range entry.Lines {
+		total += line.Amount
+	}
+	if total != 0 {
+		return fmt.Errorf("%w: %s 差額 %v", ErrUnbalancedEntry, entry.Type, total)
+	}
+
+	if entry.ID == "" {
+		entry.ID = uuid.New().String()
+	}
+	if entry.PostedAt.IsZero() {
+		entry.PostedAt = time.Now()
+	}
+	return nil
+}
+
+// 以投資組合存儲的 JournalPortfolio 修改投影並過賬 fn 返回的分錄，兩者同時生效或同時失敗。
+// 賬本尚無該用戶的分錄時，按修改前的投資組合在同一事務中先寫入期初餘額
+func (s *LedgerService) Journal(ctx context.Context, portfolios PortfolioStore, userID string, fn func(*Portfolio) ([]*JournalEntry, error)) error {
+	opening, err := s.needsOpening(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("讀取賬本失敗: %w", err)
+	}
+
+	err = portfolios.JournalPortfolio(ctx, userID, func(portfolio *Portfolio) ([]*JournalEntry, error) {
+		var entries []*JournalEntry
+		if opening {
+			entries = append(entries, openingEntry(portfolio))
+		}
+		posted, err := fn(portfolio)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, posted...)
+		for _, entry := range entries {
+			if err := prepareEntry(entry); err != nil {
+				return nil, err
+			}
+		}
+		return entries, nil
+	})
+	if err != nil {
+		return err
+	}
+	s.opened.Store(userID, true)
+	return nil
+}
+
+// 本進程是否已確認用戶有分錄，不訪問存儲
+func (s *LedgerService) Opened(userID string) bool {
+	_, opened := s.opened.Load(userID)
+	return opened
+}
+
+// 用戶尚無分錄時，按 portfolio 的現金及持倉建立期初餘額，對應外部資金。
+// portfolio 應為首筆過賬前的狀態；分錄ID固定，並發調用時只記賬一次
+func (s *LedgerService) Open(ctx context.Context, portfolio *Portfolio) {
+	opening, err := s.needsOpening(ctx, portfolio.UserID)
+	if err != nil {
+		s.logger.WithError(err).WithField("user_id", portfolio.UserID).Warn("讀取賬本失敗")
+		return
+	}
+	if !opening {
+		return
+	}
+	if err := s.Post(ctx, openingEntry(portfolio)); err != nil {
+		s.logger.WithError(err).WithField("user_id", portfolio.UserID).Error("建立期初餘額失敗")
+	}
+}
+
+// 用戶是否尚無任何分錄
+func (s *LedgerService) needsOpening(ctx context.Context, userID string) (bool, error) {
+	if s.Opened(userID) {
+		return false, nil
+	}
+	entries, err := s.store.ListEntries(ctx, userID, 1)
+	if err != nil {
+		return false, err
+	}
+	if len(entries) > 0 {
+		s.opened.Store(userID, true)
+		return false, nil
+	}
+	return true, nil
+}
+
+func openingEntry(portfolio *Portfolio) *JournalEntry {
+	entry := &JournalEntry{
+		ID:     "opening:" + portfolio.UserID,
+		UserID: portfolio.UserID,
+		Type:   EntryOpening,
+		Memo:   "期初餘額",
+	}
+	total := portfolio.CashBalance
+	entry.Lines = append(entry.Lines, JournalLine{Account: AccountCash, Amount: portfolio.CashBalance})
+	for _, symbol := range sortedSymbols(portfolio.Positions) {
+		position := portfolio.Positions[symbol]
+		cost := position.PriceCost()
+		total += cost
+		entry.Lines = append(entry.Lines, JournalLine{
+			Account:  SecuritiesAccount(symbol),
+			Amount:   cost,
+			Quantity: position.Quantity,
+		})
+	}
+	entry.Lines = append(entry.Lines, JournalLine{Account: AccountFunding, Amount: -total})
+	return entry
+}
+
+// 成交及其手續費的分錄。證券賬戶按成交價計量：平倉部分按稅批的成交價結轉，
+// 差額計入已實現損益；開倉部分按本次成交價記入，空頭為貸方。trade.Realized 須已按本次成交計算
+func tradeEntries(trade *TradeRecord) []*JournalEntry {
+	entry := &JournalEntry{
+		ID:       "trade:" + trade.ID,
+		UserID:   trade.UserID,
+		Type:     EntryTrade,
+		TradeID:  trade.ID,
+		Memo:     trade.Notes,
+		PostedAt: trade.ExecutedAt,
+	}
+
+	closedQty, closedCost := models.Decimal(0), models.Decimal(0)
+	if trade.Realized != nil {
+		closedQty = trade.Realized.Quantity
+		for _, relief := range trade.Realized.Lots {
+			closedCost += relief.Quantity.Mul(relief.Price)
+		}
+	}
+	opened := (trade.Quantity - closedQty).Mul(trade.Price)
+
+	// 買入平空或開多，賣出平多或開空；已實現損益為證券賬戶結轉額與成交金額之差
+	securities, cash, quantity := closedCost+opened, -trade.Amount, trade.Quantity
+	if trade.Side != "buy" {
+		securities, cash, quantity = -securities, trade.Amount, -trade.Quantity
+	}
+	entry.Lines = []JournalLine{
+		{Account: SecuritiesAccount(trade.Symbol), Amount: securities, Quantity: quantity},
+		{Account: AccountCash, Amount: cash},
+	}
+	if pl := -(securities + cash); pl != 0 {
+		entry.Lines = append(entry.Lines, JournalLine{Account: AccountRealizedPL, Amount: pl})
+	}
+	entries := []*JournalEntry{entry}
+
+	if trade.Commission == 0 {
+		return entries
+	}
+	return append(entries, &JournalEntry{
+		ID:       "fee:" + trade.ID,
+		UserID:   trade.UserID,
+		Type:     EntryFee,
+		TradeID:  trade.ID,
+		Memo:     fmt.Sprintf("%s %s 手續費", trade.Side, trade.Symbol),
+		PostedAt: trade.ExecutedAt,
+		Lines: []JournalLine{
+			{Account: AccountCommission, Amount: trade.Commission},
+			{Account: AccountCash, Amount: -trade.Commission},
+		},
+	})
+}
+
+// 帳戶重置的分錄：按重置前的投資組合將現金及持倉結轉至外部資金，再注入 balance 的現金。
+// 已實現損益、手續費及利息為歷史累計，凍結中的出入金仍待支付網關結果，均不結轉
+func resetEntry(portfolio *Portfolio, balance models.Decimal) *JournalEntry {
+	entry := &JournalEntry{
+		UserID: portfolio.UserID,
+		Type:   EntryReset,
+		Memo:   fmt.Sprintf("帳戶重置，新餘額 $%.2f", balance),
+	}
+	total := balance - portfolio.CashBalance
+	entry.Lines = append(entry.Lines, JournalLine{Account: AccountCash, Amount: total})
+	for _, symbol := range sortedSymbols(portfolio.Positions) {
+		position := portfolio.Positions[symbol]
+		cost := position.PriceCost()
+		total -= cost
+		entry.Lines = append(entry.Lines, JournalLine{
+			Account:  SecuritiesAccount(symbol),
+			Amount:   -cost,
+			Quantity: -position.Quantity,
+		})
+	}
+	entry.Lines = append(entry.Lines, JournalLine{Account: AccountFunding, Amount: -total})
+	return entry
+}
+
+// 按過賬時間倒序列出分錄；account 不為空時只返回涉及該賬戶的分錄，limit 為0時不限數量
+func (s *LedgerService) Entries(ctx context.Context, userID, account string, limit int) ([]*JournalEntry, error) {
+	if account == "" {
+		return s.store.ListEntries(ctx, userID, limit)
+	}
+
+	entries, err := s.store.ListEntries(ctx, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]*JournalEntry, 0)
+	for _, entry := range entries {
+		if limit > 0 && len(matched) >= limit {
+			break
+		}
+		for _, line := range entry.Lines {
+			if line.Account == account || strings.HasPrefix(line.Account, account+":") {
+				matched = append(matched, entry)
+				break
+			}
+		}
+	}
+	return matched, nil
+}
+
+// 外部資金流動：正數為流入投資組合，負數為流出
+type ExternalFlow struct {
+	EntryID  string         `json:"entryId"`
+	Type     string         `json:"type"`
+	Amount   models.Decimal `json:"amount"`
+	PostedAt time.Time      `json:"postedAt"`
+}
+
+// 按過賬時間升序列出外部資金流動，即外部資金及凍結賬戶的變動；
+// 期初餘額是啟用賬本前已有的資金，不視作流動
+func (s *LedgerService) ExternalFlows(ctx context.Context, userID string) ([]ExternalFlow, error) {
+	entries, err := s.store.ListEntries(ctx, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	flows := make([]ExternalFlow, 0)
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Type == EntryOpening {
+			continue
+		}
+		var amount models.Decimal
+		for _, line := range entry.Lines {
+			if line.Account == AccountFunding || line.Account == AccountFundingHold {
+				amount -= line.Amount
+			}
+		}
+		if amount != 0 {
+			flows = append(flows, ExternalFlow{EntryID: entry.ID, Type: entry.Type, Amount: amount, PostedAt: entry.PostedAt})
+		}
+	}
+	sort.SliceStable(flows, func(i, j int) bool { return flows[i].PostedAt.Before(flows[j].PostedAt) })
+	return flows, nil
+}
+
+// 由全部分錄匯總各賬戶餘額，按賬戶名稱排序
+func (s *LedgerService) Balances(ctx context.Context, userID string) ([]AccountBalance, error) {
+	entries, err := s.store.ListEntries(ctx, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]*AccountBalance)
+	for _, entry := range entries {
+		for _, line := range entry.Lines {
+			balance, exists := totals[line.Account]
+			if !exists {
+				balance = &AccountBalance{Account: line.Account}
+				totals[line.Account] = balance
+			}
+			balance.Balance += line.Amount
+			balance.Quantity += line.Quantity
+		}
+	}
+
+	balances := make([]AccountBalance, 0, len(totals))
+	for _, balance := range totals {
+		balances = append(balances, *balance)
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Account < balances[j].Account })
+	return balances, nil
+}
+
+// 試算平衡並逐項核對投資組合的現金、持倉數量及成本
+func (s *LedgerService) Reconcile(ctx context.Context, portfolio *Portfolio) (*Reconciliation, error) {
+	balances, err := s.Balances(ctx, portfolio.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Reconciliation{
+		UserID:      portfolio.UserID,
+		Differences: make([]ReconciliationItem, 0),
+		Balances:    balances,
+		CheckedAt:   time.Now(),
+	}
+
+	ledger := make(map[string]AccountBalance, len(balances))
+	var total models.Decimal
+	for _, b := range balances {
+		ledger[b.Account] = b
+		total += b.Balance
+	}
+	result.Balanced = total == 0
+
+	compare := func(account, field string, ledgerValue, portfolioValue, tolerance models.Decimal) {
+		if (ledgerValue - portfolioValue).Abs() > tolerance {
+			result.Differences = append(result.Differences, ReconciliationItem{
+				Account:    account,
+				Field:      field,
+				Ledger:     ledgerValue,
+				Portfolio:  portfolioValue,
+				Difference: portfolioValue - ledgerValue,
+			})
+		}
+	}
+
+	compare(AccountCash, "balance", ledger[AccountCash].Balance, portfolio.CashBalance, 0)
+
+	symbols := make(map[string]bool)
+	for symbol := range portfolio.Positions {
+		symbols[symbol] = true
+	}
+	for account := range ledger {
+		if symbol := strings.TrimPrefix(account, AccountSecurities+":"); symbol != account {
+			symbols[symbol] = true
+		}
+	}
+	for _, symbol := range sortedKeys(symbols) {
+		account := SecuritiesAccount(symbol)
+		var quantity, cost models.Decimal
+		if position, exists := portfolio.Positions[symbol]; exists {
+			quantity, cost = position.Quantity, position.PriceCost()
+		}
+		compare(account, "quantity", ledger[account].Quantity, quantity, 0)
+		compare(account, "balance", ledger[account].Balance, cost, reconcileCostTolerance)
+	}
+
+	result.Reconciled = result.Balanced && len(result.Differences) == 0
+	return result, nil
+}
+
+func sortedSymbols(positions map[string]*Position) []string {
+	symbols := make([]string, 0, len(positions))
+	for symbol := range positions {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
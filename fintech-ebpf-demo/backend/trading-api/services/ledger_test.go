@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+	"testing/quick"
+
+	"trading-api/models"
+)
+
+// 任意順序的買賣（含賣空、部分平倉及多隻股票）後，賬本借貸平衡並與投資組合一致，
+// 現金、手續費及各股票的數量等於逐筆成交之和
+func TestLedgerConservedAcrossFills(t *testing.T) {
+	symbols := []string{"AAPL", "MSFT", "TSLA"}
+	sides := []string{"buy", "sell"}
+
+	property := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		service := newTestHistoryService(NewMemoryStore())
+		const userID = "property_user"
+
+		cash, commission := InitialCashBalance, models.Decimal(0)
+		quantities := make(map[string]models.Decimal)
+		for i := 0; i < 40; i++ {
+			symbol, side := symbols[r.Intn(len(symbols))], sides[r.Intn(len(sides))]
+			quantity := models.DecimalFromInt(r.Int63n(200)+1) / 4    // 0.25 股的整數倍
+			price := models.DecimalFromInt(r.Int63n(50000)+100) / 100 // 1.00 - 500.99
+			trade, err := service.RecordTrade(fmt.Sprintf("order_%d", i), userID, symbol, side, quantity, price, models.OrderTypeMarket, testQuote(symbol, 100))
+			if err != nil {
+				t.Logf("seed %d: 記錄交易失敗: %v", seed, err)
+				return false
+			}
+
+			commission += trade.Commission
+			if side == "buy" {
+				cash -= trade.NetAmount
+				quantities[symbol] += quantity
+			} else {
+				cash += trade.NetAmount
+				quantities[symbol] -= quantity
+			}
+		}
+
+		ctx := context.Background()
+		portfolio, err := service.GetPortfolio(userID)
+		if err != nil {
+			t.Logf("seed %d: 讀取投資組合失敗: %v", seed, err)
+			return false
+		}
+		reconciliation, err := service.ledger.Reconcile(ctx, portfolio)
+		if err != nil {
+			t.Logf("seed %d: 對賬失敗: %v", seed, err)
+			return false
+		}
+		if !reconciliation.Balanced || !reconciliation.Reconciled {
+			t.Logf("seed %d: 借貸平衡 %v, 差異 %+v", seed, reconciliation.Balanced, reconciliation.Differences)
+			return false
+		}
+
+		balances := make(map[string]AccountBalance)
+		for _, b := range reconciliation.Balances {
+			balances[b.Account] = b
+		}
+		ok := balances[AccountCash].Balance == cash && balances[AccountCommission].Balance == commission
+		for symbol, quantity := range quantities {
+			ok = ok && balances[SecuritiesAccount(symbol)].Quantity == quantity
+		}
+		if !ok {
+			t.Logf("seed %d: 賬本餘額 %+v, 期望現金 %v、手續費 %v、數量 %v", seed, balances, cash, commission, quantities)
+		}
+		return ok
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 50}); err != nil {
+		t.Error(err)
+	}
+}
+
+// 重置分錄與重置後的投資組合同時寫入，重置後仍可對賬；存儲失敗時兩者均不變
+func TestResetPortfolioJournaled(t *testing.T) {
+	store := NewMemoryStore()
+	service := newTestHistoryService(store)
+	ctx := context.Background()
+	const userID = "reset_user"
+
+	for i, side := range []string{"buy", "buy", "sell"} {
+		if _, err := service.RecordTrade(fmt.Sprintf("order_%d", i), userID, "AAPL", side, models.DecimalFromInt(3), models.DecimalFromInt(int64(100+i)), models.OrderTypeMarket, testQuote("AAPL", 100)); err != nil {
+			t.Fatalf("記錄交易失敗: %v", err)
+		}
+	}
+
+	balance := models.DecimalFromInt(50000)
+	failing := NewTradingHistoryService(newTestLogger(), store, &failingPortfolioStore{MemoryStore: store}, service.ledger, LotMethodFIFO)
+	if err := failing.ResetPortfolio(userID, balance); err == nil {
+		t.Fatal("記賬失敗時應返回錯誤")
+	}
+	if entries, _ := store.ListEntries(ctx, userID, 0); slices.ContainsFunc(entries, func(entry *JournalEntry) bool { return entry.Type == EntryReset }) {
+		t.Error("重置失敗時不應過賬重置分錄")
+	}
+
+	if err := service.ResetPortfolio(userID, balance); err != nil {
+		t.Fatalf("重置失敗: %v", err)
+	}
+	portfolio, err := service.GetPortfolio(userID)
+	if err != nil {
+		t.Fatalf("讀取投資組合失敗: %v", err)
+	}
+	if portfolio.CashBalance != balance || len(portfolio.Positions) != 0 {
+		t.Errorf("重置後現金 %v、持倉 %+v, 期望現金 %v 且無持倉", portfolio.CashBalance, portfolio.Positions, balance)
+	}
+	reconciliation, err := service.ledger.Reconcile(ctx, portfolio)
+	if err != nil {
+		t.Fatalf("對賬失敗: %v", err)
+	}
+	if !reconciliation.Reconciled {
+		t.Errorf("重置後借貸平衡 %v, 差異 %+v", reconciliation.Balanced, reconciliation.Differences)
+	}
+}
+
+// 融資利息與投資組合在同一事務中記賬；記賬失敗時不扣款
+func TestMarginInterestJournaled(t *testing.T) {
+	store := NewMemoryStore()
+	service := newTestHistoryService(store)
+	ctx := context.Background()
+	const userID = "interest_user"
+
+	if err := service.modifyPortfolio(ctx, userID, func(portfolio *Portfolio) error {
+		portfolio.AccountType = AccountTypeMargin
+		return nil
+	}); err != nil {
+		t.Fatalf("設置保證金賬戶失敗: %v", err)
+	}
+	if _, err := service.RecordTrade("order_1", userID, "AAPL", "buy", models.DecimalFromInt(1500), models.DecimalFromInt(100), models.OrderTypeMarket, testQuote("AAPL", 100)); err != nil {
+		t.Fatalf("記錄交易失敗: %v", err)
+	}
+	before, err := service.GetPortfolio(userID)
+	if err != nil || before.CashBalance >= 0 {
+		t.Fatalf("融資買入後現金 %v, err = %v, 期望為負", before.CashBalance, err)
+	}
+
+	rate := models.DecimalFromInt(5)
+	failing := NewTradingHistoryService(newTestLogger(), store, &failingPortfolioStore{MemoryStore: store}, service.ledger, LotMethodFIFO)
+	if err := (&MarginService{logger: newTestLogger(), history: failing}).chargeInterest(ctx, userID, "2026-01-02", rate); err == nil {
+		t.Fatal("記賬失敗時應返回錯誤")
+	}
+	if entries, _ := store.ListEntries(ctx, userID, 0); slices.ContainsFunc(entries, func(entry *JournalEntry) bool { return entry.Type == EntryInterest }) {
+		t.Error("計息失敗時不應過賬利息分錄")
+	}
+
+	margin := &MarginService{logger: newTestLogger(), history: service}
+	if err := margin.chargeInterest(ctx, userID, "2026-01-02", rate); err != nil {
+		t.Fatalf("計息失敗: %v", err)
+	}
+	portfolio, err := service.GetPortfolio(userID)
+	if err != nil {
+		t.Fatalf("讀取投資組合失敗: %v", err)
+	}
+	if portfolio.CashBalance >= before.CashBalance {
+		t.Errorf("計息後現金 %v, 期望低於 %v", portfolio.CashBalance, before.CashBalance)
+	}
+	reconciliation, err := service.ledger.Reconcile(ctx, portfolio)
+	if err != nil {
+		t.Fatalf("對賬失敗: %v", err)
+	}
+	if !reconciliation.Reconciled {
+		t.Errorf("計息後借貸平衡 %v, 差異 %+v", reconciliation.Balanced, reconciliation.Differences)
+	}
+}
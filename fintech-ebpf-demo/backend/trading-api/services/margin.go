@@ -0,0 +1,679 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+)
+
+// 保證金追繳狀態
+const (
+	MarginCallOpen       = "open"       // 等待補足
+	MarginCallMet        = "met"        // 淨值已回到維持保證金以上
+	MarginCallLiquidated = "liquidated" // 逾期未補足，已強制平倉
+)
+
+// 融資利息按每年360天計
+const interestDaysPerYear = 360
+
+// 每個用戶保留的已結束追繳記錄數
+const marginCallHistoryLimit = 100
+
+// 保證金賬戶用戶，監控追繳及計息的範圍
+const marginUsersKey = "margin_users"
+
+// 已借出及掛單已預定的借券股數：哈希，股票代碼 → 數量的最小單位
+const borrowedSharesKey = "borrowed_shares"
+
+func marginCallKey(userID string) string {
+	return fmt.Sprintf("margin_call:%s", userID)
+}
+
+func marginCallHistoryKey(userID string) string {
+	return fmt.Sprintf("margin_call_history:%s", userID)
+}
+
+// 當日計息標記，多實例時只計一次
+func marginInterestKey(userID, date string) string {
+	return fmt.Sprintf("margin_interest:%s:%s", userID, date)
+}
+
+// 存在空頭持倉或融資借款時不能轉為現金賬戶
+var ErrMarginInUse = errors.New("存在空頭持倉或融資借款，不能轉為現金賬戶")
+
+// 借券不足錯誤
+type BorrowUnavailableError struct {
+	Symbol    string
+	Available models.Decimal
+	Required  models.Decimal
+}
+
+func (e *BorrowUnavailableError) Error() string {
+	return fmt.Sprintf("可借券不足: %s 可借 %v 股, 需要 %v 股", e.Symbol, e.Available, e.Required)
+}
+
+// 單個持倉的保證金要求，比例為百分比
+type PositionMargin struct {
+	Symbol                 string         `json:"symbol"`
+	Quantity               models.Decimal `json:"quantity"`
+	MarketValue            models.Decimal `json:"marketValue"`
+	InitialMargin          models.Decimal `json:"initialMargin"`
+	MaintenanceMargin      models.Decimal `json:"maintenanceMargin"`
+	InitialRequirement     models.Decimal `json:"initialRequirement"`
+	MaintenanceRequirement models.Decimal `json:"maintenanceRequirement"`
+}
+
+// 賬戶的保證金狀況；現金賬戶按全額計算，初始保證金盈餘即可用現金
+type MarginStatus struct {
+	UserID                 string           `json:"userId"`
+	AccountType            string           `json:"accountType"`
+	CashBalance            models.Decimal   `json:"cashBalance"`
+	LongValue              models.Decimal   `json:"longValue"`
+	ShortValue             models.Decimal   `json:"shortValue"`   // 空頭市值，正數
+	Equity                 models.Decimal   `json:"equity"`       // 現金加多頭市值減空頭市值
+	DebitBalance           models.Decimal   `json:"debitBalance"` // 現金為負時的融資借款
+	InitialRequirement     models.Decimal   `json:"initialRequirement"`
+	MaintenanceRequirement models.Decimal   `json:"maintenanceRequirement"`
+	ExcessEquity           models.Decimal   `json:"excessEquity"`      // 淨值減持倉及掛單的初始保證金要求
+	BuyingPower            models.Decimal   `json:"buyingPower"`       // 按默認初始保證金比例估算的可開倉市值
+	MaintenanceExcess      models.Decimal   `json:"maintenanceExcess"` // 為負時觸發保證金追繳
+	Positions              []PositionMargin `json:"positions"`
+	CheckedAt              time.Time        `json:"checkedAt"`
+}
+
+// 保證金追繳：淨值低於維持保證金要求時發出，期限內未補足則強制平倉
+type MarginCall struct {
+	ID          string         `json:"id"`
+	UserID      string         `json:"userId"`
+	Status      string         `json:"status"`
+	Equity      models.Decimal `json:"equity"`      // 發出時的淨值
+	Requirement models.Decimal `json:"requirement"` // 發出時的維持保證金要求
+	Deficit     models.Decimal `json:"deficit"`
+	IssuedAt    time.Time      `json:"issuedAt"`
+	DueAt       time.Time      `json:"dueAt"`
+	ResolvedAt  *time.Time     `json:"resolvedAt,omitempty"`
+	OrderIDs    []string       `json:"orderIds,omitempty"` // 強制平倉訂單
+}
+
+// 強制平倉的一筆市價單
+type LiquidationOrder struct {
+	Symbol   string         `json:"symbol"`
+	Side     string         `json:"side"`
+	Quantity models.Decimal `json:"quantity"`
+}
+
+// 逾期未補足的追繳及其平倉計劃
+type Liquidation struct {
+	Call   *MarginCall
+	Orders []LiquidationOrder
+}
+
+// 股票的借券情況
+type BorrowAvailability struct {
+	Symbol    string         `json:"symbol"`
+	Shortable bool           `json:"shortable"`
+	Limit     models.Decimal `json:"limit"`
+	Borrowed  models.Decimal `json:"borrowed"` // 已借出及掛單已預定的股數
+	Available models.Decimal `json:"available"`
+}
+
+type MarginOptions struct {
+	InterestRate    float64       // 融資年利率（%）
+	CallGracePeriod time.Duration // 追繳發出後補足的期限
+}
+
+// 保證金服務：按證券的保證金比例計算購買力，管理借券額度、融資計息及追繳平倉
+type MarginService struct {
+	logger     *logrus.Logger
+	redis      *redis.Client
+	history    *TradingHistoryService
+	securities *SecurityService
+	marketData *MarketDataService
+	calendar   *TradingCalendar // 計息日期所用的時區
+	opts       MarginOptions
+}
+
+func NewMarginService(logger *logrus.Logger, redisClient *redis.Client, history *TradingHistoryService,
+	securities *SecurityService, marketData *MarketDataService, calendar *TradingCalendar, opts MarginOptions) *MarginService {
+	return &MarginService{
+		logger:     logger,
+		redis:      redisClient,
+		history:    history,
+		securities: securities,
+		marketData: marketData,
+		calendar:   calendar,
+		opts:       opts,
+	}
+}
+
+// 切換賬戶類型；轉為現金賬戶時不得有空頭持倉或融資借款，否則返回 ErrMarginInUse
+func (s *MarginService) SetAccountType(ctx context.Context, userID, accountType string) error {
+	if accountType != AccountTypeCash && accountType != AccountTypeMargin {
+		return fmt.Errorf("無效的賬戶類型: %s", accountType)
+	}
+
+	err := s.history.modifyPortfolio(ctx, userID, func(portfolio *Portfolio) error {
+		if accountType == AccountTypeCash {
+			if portfolio.CashBalance < 0 {
+				return ErrMarginInUse
+			}
+			for _, position := range portfolio.Positions {
+				if position.Short {
+					return ErrMarginInUse
+				}
+			}
+		}
+		portfolio.AccountType = accountType
+		portfolio.LastUpdated = time.Now()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if accountType == AccountTypeMargin {
+		err = s.redis.SAdd(ctx, marginUsersKey, userID).Err()
+	} else {
+		err = s.redis.SRem(ctx, marginUsersKey, userID).Err()
+	}
+	if err != nil {
+		return err
+	}
+	s.logger.WithFields(logrus.Fields{"user_id": userID, "account_type": accountType}).Info("賬戶類型已切換")
+	return nil
+}
+
+// 以最新報價計算保證金狀況；holds 為nil時只計算持倉
+func (s *MarginService) Status(ctx context.Context, portfolio *Portfolio, holds *HoldSummary) (*MarginStatus, error) {
+	securities, quotes, err := s.marketInputs(ctx, portfolio, holds)
+	if err != nil {
+		return nil, err
+	}
+	return evaluateMargin(portfolio, holds, securities, quotes), nil
+}
+
+// 保證金賬戶可轉出的現金：不超過初始保證金盈餘
+func (s *MarginService) Withdrawable(ctx context.Context, portfolio *Portfolio, holds *HoldSummary) (models.Decimal, error) {
+	status, err := s.Status(ctx, portfolio, holds)
+	if err != nil {
+		return 0, err
+	}
+	return status.ExcessEquity, nil
+}
+
+// 校驗保證金賬戶的新預留：賣空須有借券額度，增加保證金要求時不得超過淨值。
+// before 及 after 為加入預留前後的預留匯總
+func (s *MarginService) checkHold(ctx context.Context, portfolio *Portfolio, before, after *HoldSummary, hold *Hold) error {
+	if hold.Borrowed > 0 {
+		security, err := s.securities.Get(ctx, hold.Symbol)
+		if err != nil {
+			return err
+		}
+		if !security.IsShortable() {
+			return &BorrowUnavailableError{Symbol: hold.Symbol, Required: hold.Borrowed}
+		}
+	}
+
+	securities, quotes, err := s.marketInputs(ctx, portfolio, after)
+	if err != nil {
+		return err
+	}
+	previous := evaluateMargin(portfolio, before, securities, quotes)
+	status := evaluateMargin(portfolio, after, securities, quotes)
+	if status.InitialRequirement > previous.InitialRequirement && status.ExcessEquity < 0 {
+		return &InsufficientBalanceError{
+			Side:      hold.Side,
+			Symbol:    hold.Symbol,
+			Margin:    true,
+			Available: previous.ExcessEquity,
+			Required:  status.InitialRequirement - previous.InitialRequirement,
+		}
+	}
+	return nil
+}
+
+// 持倉及掛單涉及的證券參考數據及報價；取不到報價的股票以持倉的上次市價計算
+func (s *MarginService) marketInputs(ctx context.Context, portfolio *Portfolio, holds *HoldSummary) (map[string]*models.Security, map[string]*StockQuote, error) {
+	set := make(map[string]bool)
+	for symbol := range portfolio.Positions {
+		set[symbol] = true
+	}
+	if holds != nil {
+		for symbol := range holds.Buys {
+			set[symbol] = true
+		}
+		for symbol := range holds.Shares {
+			set[symbol] = true
+		}
+	}
+	symbols := sortedKeys(set)
+
+	securities := make(map[string]*models.Security, len(symbols))
+	for _, symbol := range symbols {
+		security, err := s.securities.Get(ctx, symbol)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		securities[symbol] = security
+	}
+
+	quotes := make(map[string]*StockQuote)
+	if len(symbols) > 0 {
+		quotes, _ = s.marketData.GetMultipleQuotes(ctx, symbols)
+	}
+	return securities, quotes, nil
+}
+
+// 保證金比例（小數）；現金賬戶全額計算，沒有參考數據的股票使用默認比例
+func marginRates(portfolio *Portfolio, security *models.Security) (initial, maintenance models.Decimal) {
+	if !portfolio.IsMargin() {
+		return models.DecimalOne, models.DecimalOne
+	}
+	if security == nil {
+		security = &models.Security{}
+	}
+	return security.InitialMarginRate(), security.MaintenanceMarginRate()
+}
+
+// 計算保證金狀況。多頭及空頭持倉按市值絕對值乘以比例計算要求；掛單只計增加風險的部分：
+// 買單扣除可平空的市值，賣單只計超出多頭持股、需要借券的股數
+func evaluateMargin(portfolio *Portfolio, holds *HoldSummary, securities map[string]*models.Security, quotes map[string]*StockQuote) *MarginStatus {
+	status := &MarginStatus{
+		UserID:      portfolio.UserID,
+		AccountType: portfolio.AccountType,
+		CashBalance: portfolio.CashBalance,
+		Positions:   make([]PositionMargin, 0, len(portfolio.Positions)),
+		CheckedAt:   time.Now(),
+	}
+	if status.AccountType == "" {
+		status.AccountType = AccountTypeCash
+	}
+
+	price := func(symbol string) models.Decimal {
+		if quote, exists := quotes[symbol]; exists {
+			return quote.Price
+		}
+		if position, exists := portfolio.Positions[symbol]; exists {
+			return position.LastPrice
+		}
+		return 0
+	}
+
+	for _, symbol := range sortedSymbols(portfolio.Positions) {
+		position := portfolio.Positions[symbol]
+		initial, maintenance := marginRates(portfolio, securities[symbol])
+		value := position.Quantity.Mul(price(symbol))
+		item := PositionMargin{
+			Symbol:                 symbol,
+			Quantity:               position.Quantity,
+			MarketValue:            value,
+			InitialMargin:          initial.MulInt(100),
+			MaintenanceMargin:      maintenance.MulInt(100),
+			InitialRequirement:     value.Abs().Mul(initial),
+			MaintenanceRequirement: value.Abs().Mul(maintenance),
+		}
+		if value < 0 {
+			status.ShortValue -= value
+		} else {
+			status.LongValue += value
+		}
+		status.InitialRequirement += item.InitialRequirement
+		status.MaintenanceRequirement += item.MaintenanceRequirement
+		status.Positions = append(status.Positions, item)
+	}
+
+	if holds != nil {
+		for symbol, notional := range holds.Buys {
+			initial, _ := marginRates(portfolio, securities[symbol])
+			if position := portfolio.Positions[symbol]; position != nil && position.Short {
+				notional = models.MaxDecimal(0, notional+position.Quantity.Mul(price(symbol)))
+			}
+			status.InitialRequirement += notional.Mul(initial)
+		}
+		for symbol := range holds.Shares {
+			initial, _ := marginRates(portfolio, securities[symbol])
+			status.InitialRequirement += shortQuantity(portfolio, holds, symbol).Mul(price(symbol)).Mul(initial)
+		}
+	}
+
+	status.Equity = status.CashBalance + status.LongValue - status.ShortValue
+	if status.CashBalance < 0 {
+		status.DebitBalance = -status.CashBalance
+	}
+	status.ExcessEquity = status.Equity - status.InitialRequirement
+	status.MaintenanceExcess = status.Equity - status.MaintenanceRequirement
+	status.BuyingPower = models.MaxDecimal(0, status.ExcessEquity)
+	if portfolio.IsMargin() {
+		status.BuyingPower = status.BuyingPower.Div(models.DefaultInitialMargin / 100)
+	}
+	return status
+}
+
+// 賣單預留中超出多頭持股、需要借券的股數
+func shortQuantity(portfolio *Portfolio, holds *HoldSummary, symbol string) models.Decimal {
+	var owned models.Decimal
+	if position := portfolio.Positions[symbol]; position != nil && position.Quantity > 0 {
+		owned = position.Quantity
+	}
+	return models.MaxDecimal(0, holds.Shares[symbol]-owned)
+}
+
+// 股票的借券額度及已借出數量
+func (s *MarginService) BorrowAvailability(ctx context.Context, symbol string) (*BorrowAvailability, error) {
+	security, err := s.securities.Get(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	borrowed, err := borrowedShares(ctx, s.redis, security.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	return &BorrowAvailability{
+		Symbol:    security.Symbol,
+		Shortable: security.IsShortable(),
+		Limit:     security.BorrowLimit,
+		Borrowed:  borrowed,
+		Available: models.MaxDecimal(0, security.BorrowLimit-borrowed),
+	}, nil
+}
+
+// 預定借券：可借數量不足時返回 *BorrowUnavailableError；在預留事務內調用，由調用方提交增量
+func (s *MarginService) checkBorrow(ctx context.Context, client redis.Cmdable, symbol string, quantity models.Decimal) error {
+	security, err := s.securities.Get(ctx, symbol)
+	if err != nil {
+		return err
+	}
+	borrowed, err := borrowedShares(ctx, client, symbol)
+	if err != nil {
+		return err
+	}
+	if available := security.BorrowLimit - borrowed; quantity > available {
+		return &BorrowUnavailableError{Symbol: symbol, Available: models.MaxDecimal(0, available), Required: quantity}
+	}
+	return nil
+}
+
+// 歸還借券：空頭平倉、重置或預定借券的掛單結束時調用
+func (s *MarginService) ReturnBorrow(symbol string, quantity models.Decimal) {
+	if quantity <= 0 {
+		return
+	}
+	if err := s.redis.HIncrBy(context.Background(), borrowedSharesKey, symbol, -int64(quantity)).Err(); err != nil {
+		s.logger.WithError(err).WithField("symbol", symbol).Error("歸還借券失敗")
+	}
+}
+
+func borrowedShares(ctx context.Context, client redis.Cmdable, symbol string) (models.Decimal, error) {
+	units, err := client.HGet(ctx, borrowedSharesKey, symbol).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return models.MaxDecimal(0, models.Decimal(units)), err
+}
+
+// 按日計算融資利息：每個保證金賬戶每天一次，以當時的融資借款按年利率/360計息，
+// 從現金扣除並記入利息賬戶
+func (s *MarginService) AccrueInterest(ctx context.Context, now time.Time) {
+	if s.opts.InterestRate <= 0 {
+		return
+	}
+	userIDs, err := s.redis.SMembers(ctx, marginUsersKey).Result()
+	if err != nil {
+		s.logger.WithError(err).Warn("讀取保證金賬戶失敗")
+		return
+	}
+
+	date := now.In(s.calendar.Location).Format(calendarDateLayout)
+	rate, err := models.DecimalFromFloat(s.opts.InterestRate)
+	if err != nil {
+		s.logger.WithError(err).Error("融資利率配置無效")
+		return
+	}
+	for _, userID := range userIDs {
+		claimed, err := s.redis.SetNX(ctx, marginInterestKey(userID, date), now.Unix(), 48*time.Hour).Result()
+		if err != nil || !claimed {
+			continue
+		}
+		if err := s.chargeInterest(ctx, userID, date, rate); err != nil {
+			s.redis.Del(ctx, marginInterestKey(userID, date))
+			s.logger.WithError(err).WithField("user_id", userID).Error("融資計息失敗")
+		}
+	}
+}
+
+// 利息與投資組合在同一事務中記賬，記賬失敗時不扣款，由下次計息重試
+func (s *MarginService) chargeInterest(ctx context.Context, userID, date string, rate models.Decimal) error {
+	var interest models.Decimal
+	err := s.history.journalPortfolio(ctx, userID, func(portfolio *Portfolio) ([]*JournalEntry, error) {
+		interest = 0
+		if !portfolio.IsMargin() || portfolio.CashBalance >= 0 {
+			return nil, nil
+		}
+		interest = (-portfolio.CashBalance).Mul(rate).Div(models.DecimalFromInt(100 * interestDaysPerYear)).RoundCurrency(models.DefaultCurrency)
+		if interest == 0 {
+			return nil, nil
+		}
+		portfolio.CashBalance -= interest
+		portfolio.TotalValue -= interest
+		portfolio.LastUpdated = time.Now()
+		return []*JournalEntry{{
+			ID:     fmt.Sprintf("interest:%s:%s", userID, date),
+			UserID: userID,
+			Type:   EntryInterest,
+			Memo:   fmt.Sprintf("%s 融資利息", date),
+			Lines: []JournalLine{
+				{Account: AccountInterest, Amount: interest},
+				{Account: AccountCash, Amount: -interest},
+			},
+		}}, nil
+	})
+	if err != nil || interest == 0 {
+		return err
+	}
+	s.logger.WithFields(logrus.Fields{"user_id": userID, "date": date, "interest": interest}).Info("已計提融資利息")
+	return nil
+}
+
+// 檢查所有保證金賬戶：淨值低於維持保證金要求時發出追繳，回到要求以上時結束追繳；
+// 返回逾期未補足或淨值已不為正、需要強制平倉的追繳
+func (s *MarginService) CheckMarginCalls(ctx context.Context, now time.Time) []*Liquidation {
+	userIDs, err := s.redis.SMembers(ctx, marginUsersKey).Result()
+	if err != nil {
+		s.logger.WithError(err).Warn("讀取保證金賬戶失敗")
+		return nil
+	}
+
+	liquidations := make([]*Liquidation, 0)
+	for _, userID := range userIDs {
+		liquidation, err := s.checkMarginCall(ctx, userID, now)
+		if err != nil {
+			s.logger.WithError(err).WithField("user_id", userID).Warn("檢查保證金失敗")
+			continue
+		}
+		if liquidation != nil {
+			liquidations = append(liquidations, liquidation)
+		}
+	}
+	return liquidations
+}
+
+func (s *MarginService) checkMarginCall(ctx context.Context, userID string, now time.Time) (*Liquidation, error) {
+	portfolio, err := s.history.GetPortfolio(userID)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	call, err := s.Call(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	securities, quotes, err := s.marketInputs(ctx, portfolio, nil)
+	if err != nil {
+		return nil, err
+	}
+	status := evaluateMargin(portfolio, nil, securities, quotes)
+
+	if !portfolio.IsMargin() || status.MaintenanceExcess >= 0 {
+		if call != nil {
+			return nil, s.finishCall(ctx, call, MarginCallMet, nil)
+		}
+		return nil, nil
+	}
+
+	if call == nil {
+		call = &MarginCall{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			Status:      MarginCallOpen,
+			Equity:      status.Equity,
+			Requirement: status.MaintenanceRequirement,
+			Deficit:     -status.MaintenanceExcess,
+			IssuedAt:    now,
+			DueAt:       now.Add(s.opts.CallGracePeriod),
+		}
+		if err := s.saveCall(ctx, call); err != nil {
+			return nil, err
+		}
+		s.logger.WithFields(logrus.Fields{
+			"user_id":     userID,
+			"equity":      call.Equity,
+			"requirement": call.Requirement,
+			"due_at":      call.DueAt,
+		}).Warn("淨值低於維持保證金，已發出保證金追繳")
+	}
+
+	if now.Before(call.DueAt) && status.Equity > 0 {
+		return nil, nil
+	}
+	orders := liquidationPlan(status, securities)
+	if len(orders) == 0 {
+		return nil, nil
+	}
+	return &Liquidation{Call: call, Orders: orders}, nil
+}
+
+// 強制平倉計劃：按維持保證金要求由大到小平倉，直至補足差額。
+// 平倉市值 V 使要求減少 V×比例，手續費使淨值減少 V×費率，所需市值為差額/(比例-費率)
+func liquidationPlan(status *MarginStatus, securities map[string]*models.Security) []LiquidationOrder {
+	positions := append([]PositionMargin(nil), status.Positions...)
+	sort.SliceStable(positions, func(i, j int) bool {
+		return positions[i].MaintenanceRequirement > positions[j].MaintenanceRequirement
+	})
+
+	deficit := -status.MaintenanceExcess
+	orders := make([]LiquidationOrder, 0)
+	for _, position := range positions {
+		if deficit <= 0 {
+			break
+		}
+		if position.Quantity == 0 || position.MarketValue == 0 {
+			continue
+		}
+		held := position.Quantity.Abs()
+		price := position.MarketValue.Abs().Div(held)
+		effective := position.MaintenanceMargin/100 - CommissionRate
+
+		quantity := held
+		if effective > 0 && status.Equity > 0 {
+			lotSize := models.DefaultLotSize
+			if security := securities[position.Symbol]; security != nil {
+				lotSize = security.LotSize
+			}
+			needed := deficit.Div(effective).Div(price)
+			lots := int64(needed / lotSize)
+			if lotSize.MulInt(lots) < needed {
+				lots++
+			}
+			quantity = models.MinDecimal(held, lotSize.MulInt(lots))
+		}
+
+		side := "sell"
+		if position.Quantity < 0 {
+			side = "buy"
+		}
+		orders = append(orders, LiquidationOrder{Symbol: position.Symbol, Side: side, Quantity: quantity})
+		deficit -= quantity.Mul(price).Mul(effective)
+	}
+	return orders
+}
+
+// 記錄強制平倉的訂單並結束追繳
+func (s *MarginService) CompleteLiquidation(ctx context.Context, call *MarginCall, orderIDs []string) error {
+	return s.finishCall(ctx, call, MarginCallLiquidated, orderIDs)
+}
+
+// 當前未結束的追繳，沒有時返回nil
+func (s *MarginService) Call(ctx context.Context, userID string) (*MarginCall, error) {
+	var call MarginCall
+	if err := getJSON(ctx, s.redis, marginCallKey(userID), &call); err != nil {
+		if err == ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &call, nil
+}
+
+// 已結束的追繳記錄，由新到舊
+func (s *MarginService) CallHistory(ctx context.Context, userID string, limit int) ([]*MarginCall, error) {
+	items, err := s.redis.LRange(ctx, marginCallHistoryKey(userID), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	calls := make([]*MarginCall, 0, len(items))
+	for _, item := range items {
+		var call MarginCall
+		if err := json.Unmarshal([]byte(item), &call); err != nil {
+			continue
+		}
+		calls = append(calls, &call)
+	}
+	return calls, nil
+}
+
+func (s *MarginService) saveCall(ctx context.Context, call *MarginCall) error {
+	callJSON, err := json.Marshal(call)
+	if err != nil {
+		return err
+	}
+	return s.redis.Set(ctx, marginCallKey(call.UserID), callJSON, 0).Err()
+}
+
+// 結束追繳並移入歷史記錄
+func (s *MarginService) finishCall(ctx context.Context, call *MarginCall, status string, orderIDs []string) error {
+	resolvedAt := time.Now()
+	call.Status = status
+	call.ResolvedAt = &resolvedAt
+	call.OrderIDs = orderIDs
+
+	callJSON, err := json.Marshal(call)
+	if err != nil {
+		return err
+	}
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, marginCallKey(call.UserID))
+		pipe.LPush(ctx, marginCallHistoryKey(call.UserID), callJSON)
+		pipe.LTrim(ctx, marginCallHistoryKey(call.UserID), 0, marginCallHistoryLimit-1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.WithFields(logrus.Fields{"user_id": call.UserID, "call_id": call.ID, "status": status}).Info("保證金追繳已結束")
+	return nil
+}
@@ -2,43 +2,96 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
-	"strings"
 	"encoding/json"
-	"net/http"
-	"io"
-	"math/rand"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+
+	"trading-api/models"
+)
+
+const (
+	// 緩存報價在此時間內視為最新
+	quoteFreshTTL = time.Minute
+	// 批量查詢時，此時間內的過期報價先返回再後台刷新
+	quoteStaleTTL = 5 * time.Minute
+	// 報價在Redis中的保留時間，行情來源不可用時作為最後已知價格返回
+	quoteCacheTTL = 24 * time.Hour
 )
 
 type MarketDataService struct {
-	logger *logrus.Logger
-	redis  *redis.Client
+	logger           *logrus.Logger
+	redis            *redis.Client
+	provider         QuoteProvider
+	batchConcurrency int           // 批量查詢時同時向行情來源發出的請求數上限
+	timeout          time.Duration // 調用方等待上游報價的最長時間，超時後返回最後已知價格
+
+	inflight singleflight.Group
+
+	listenersMux sync.RWMutex
+	listeners    []func(*StockQuote)
 }
 
 type StockQuote struct {
-	Symbol           string  `json:"symbol"`
-	Price            float64 `json:"price"`
-	PreviousClose    float64 `json:"previousClose"`
-	Open             float64 `json:"open"`
-	High             float64 `json:"high"`
-	Low              float64 `json:"low"`
-	Volume           int64   `json:"volume"`
-	MarketCap        int64   `json:"marketCap"`
-	PERatio          float64 `json:"peRatio"`
-	EPS              float64 `json:"eps"`
-	DividendYield    float64 `json:"dividendYield"`
-	Beta             float64 `json:"beta"`
-	LastUpdated      time.Time `json:"lastUpdated"`
-	IsMarketOpen     bool    `json:"isMarketOpen"`
-	Currency         string  `json:"currency"`
-	Exchange         string  `json:"exchange"`
-	CompanyName      string  `json:"companyName"`
-	ChangePercent    float64 `json:"changePercent"`
-	Change           float64 `json:"change"`
+	Symbol        string         `json:"symbol"`
+	Price         models.Decimal `json:"price"`
+	PreviousClose models.Decimal `json:"previousClose"`
+	Open          models.Decimal `json:"open"`
+	High          models.Decimal `json:"high"`
+	Low           models.Decimal `json:"low"`
+	Volume        int64          `json:"volume"`
+	MarketCap     int64          `json:"marketCap"`
+	PERatio       float64        `json:"peRatio"`
+	EPS           float64        `json:"eps"`
+	DividendYield float64        `json:"dividendYield"`
+	Beta          float64        `json:"beta"`
+	LastUpdated   time.Time      `json:"lastUpdated"`
+	IsMarketOpen  bool           `json:"isMarketOpen"`
+	Currency      string         `json:"currency"`
+	Exchange      string         `json:"exchange"`
+	CompanyName   string         `json:"companyName"`
+	ChangePercent models.Decimal `json:"changePercent"`
+	Change        models.Decimal `json:"change"`
+	Source        string         `json:"source,omitempty"` // 行情來源
+	Stale         bool           `json:"stale,omitempty"`  // 行情來源不可用時返回的最後已知價格
+}
+
+// 以行情來源的浮點數據設置各價格欄位並計算漲跌；NaN、無窮大或超出範圍的數據返回錯誤
+func (q *StockQuote) setPrices(price, previousClose, open, high, low float64) error {
+	fields := []struct {
+		name  string
+		dst   *models.Decimal
+		value float64
+	}{
+		{"price", &q.Price, price},
+		{"previous_close", &q.PreviousClose, previousClose},
+		{"open", &q.Open, open},
+		{"high", &q.High, high},
+		{"low", &q.Low, low},
+	}
+	for _, field := range fields {
+		value, err := models.DecimalFromFloat(field.value)
+		if err != nil {
+			return fmt.Errorf("%s 的 %s 行情數據無效: %w", q.Symbol, field.name, err)
+		}
+		*field.dst = value
+	}
+	q.setChange()
+	return nil
+}
+
+// 按現價與前收盤價計算漲跌額及漲跌幅（百分比，保留4位小數）；前收盤價為0或漲跌幅超出範圍時漲跌幅為0
+func (q *StockQuote) setChange() {
+	q.Change = q.Price - q.PreviousClose
+	q.ChangePercent = 0
+	if percent, err := q.Change.MulInt(100).DivChecked(q.PreviousClose); err == nil {
+		q.ChangePercent = percent.Round(4)
+	}
 }
 
 type YahooFinanceResponse struct {
@@ -67,332 +120,263 @@ type YahooFinanceResponse struct {
 	} `json:"quoteResponse"`
 }
 
-func NewMarketDataService(logger *logrus.Logger, redisClient *redis.Client) *MarketDataService {
+func NewMarketDataService(logger *logrus.Logger, redisClient *redis.Client, provider QuoteProvider, batchConcurrency int, timeout time.Duration) *MarketDataService {
+	if batchConcurrency < 1 {
+		batchConcurrency = 1
+	}
 	return &MarketDataService{
-		logger: logger,
-		redis:  redisClient,
+		logger:           logger,
+		redis:            redisClient,
+		provider:         provider,
+		batchConcurrency: batchConcurrency,
+		timeout:          timeout,
 	}
 }
 
-// 獲取實時股價
-func (s *MarketDataService) GetStockQuote(symbol string) (*StockQuote, error) {
+// 獲取實時股價，等待上游的時間以 ctx 及 timeout 中較早者為準
+func (s *MarketDataService) GetStockQuote(ctx context.Context, symbol string) (*StockQuote, error) {
 	// 首先檢查Redis緩存
-	cacheKey := fmt.Sprintf("quote:%s", symbol)
-	cached, err := s.redis.Get(context.Background(), cacheKey).Result()
-	
-	if err == nil {
-		var quote StockQuote
-		if json.Unmarshal([]byte(cached), &quote) == nil {
-			// 檢查緩存是否過期（1分鐘）
-			if time.Since(quote.LastUpdated) < time.Minute {
-				s.logger.WithField("symbol", symbol).Debug("從緩存返回股價")
-				return &quote, nil
-			}
-		}
-	}
-
-	// 從Yahoo Finance API獲取實時數據
-	quote, err := s.fetchFromYahooFinance(symbol)
-	if err != nil {
-		s.logger.WithError(err).WithField("symbol", symbol).Error("獲取Yahoo Finance數據失敗")
-		return nil, err
+	quote := s.cachedQuote(symbol)
+	if quote != nil && time.Since(quote.LastUpdated) < quoteFreshTTL {
+		s.logger.WithField("symbol", symbol).Debug("從緩存返回股價")
+		return quote, nil
 	}
 
-	// 緩存結果
-	quoteJSON, _ := json.Marshal(quote)
-	s.redis.Set(context.Background(), cacheKey, quoteJSON, time.Minute*5)
+	return s.loadQuote(ctx, symbol)
+}
 
-	return quote, nil
+// 跳過緩存直接從行情來源獲取，供實時推送輪詢使用
+func (s *MarketDataService) RefreshQuote(symbol string) (*StockQuote, error) {
+	return s.loadQuote(context.Background(), symbol)
 }
 
-// 從Yahoo Finance API獲取數據
-func (s *MarketDataService) fetchFromYahooFinance(symbol string) (*StockQuote, error) {
-	// Yahoo Finance API URL
-	url := fmt.Sprintf("https://query1.finance.yahoo.com/v8/finance/chart/%s", symbol)
-	
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
+// 同一股票的並發請求合併為一次上游查詢，各調用方得到獨立的副本。
+// 上游查詢由各調用方共享，不隨單個調用方取消；調用方放棄等待或查詢失敗時返回標記為過期的最後已知價格
+func (s *MarketDataService) loadQuote(ctx context.Context, symbol string) (*StockQuote, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
 	}
 
-	// 設置請求頭
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36")
-	req.Header.Set("Accept", "application/json")
+	results := s.inflight.DoChan(symbol, func() (interface{}, error) {
+		return s.fetchQuote(symbol, s.cachedQuote(symbol))
+	})
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	var err error
+	select {
+	case result := <-results:
+		if result.Err == nil {
+			quote := *result.Val.(*StockQuote)
+			return &quote, nil
+		}
+		err = result.Err
+	case <-ctx.Done():
+		err = ctx.Err()
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Yahoo Finance API 返回狀態碼: %d", resp.StatusCode)
+	if previous := s.cachedQuote(symbol); previous != nil {
+		s.logger.WithError(err).WithField("symbol", symbol).Debug("行情來源不可用，返回最後已知價格")
+		previous.Stale = true
+		return previous, nil
 	}
+	return nil, err
+}
 
-	body, err := io.ReadAll(resp.Body)
+// 讀取緩存的報價，不論是否過期
+func (s *MarketDataService) cachedQuote(symbol string) *StockQuote {
+	cached, err := s.redis.Get(context.Background(), quoteCacheKey(symbol)).Result()
 	if err != nil {
-		return nil, err
+		return nil
 	}
-
-	// 解析Yahoo Finance響應
-	return s.parseYahooResponse(body, symbol)
+	return decodeQuote(cached)
 }
 
-// 解析Yahoo Finance響應
-func (s *MarketDataService) parseYahooResponse(data []byte, symbol string) (*StockQuote, error) {
-	var response struct {
-		Chart struct {
-			Result []struct {
-				Meta struct {
-					Currency              string  `json:"currency"`
-					Symbol                string  `json:"symbol"`
-					ExchangeName          string  `json:"exchangeName"`
-					RegularMarketPrice    float64 `json:"regularMarketPrice"`
-					PreviousClose         float64 `json:"previousClose"`
-					ChartPreviousClose    float64 `json:"chartPreviousClose"`
-					RegularMarketTime     int64   `json:"regularMarketTime"`
-					CurrentTradingPeriod  struct {
-						Regular struct {
-							Start int64 `json:"start"`
-							End   int64 `json:"end"`
-						} `json:"regular"`
-					} `json:"currentTradingPeriod"`
-				} `json:"meta"`
-				Indicators struct {
-					Quote []struct {
-						High   []float64 `json:"high"`
-						Low    []float64 `json:"low"`
-						Open   []float64 `json:"open"`
-						Close  []float64 `json:"close"`
-						Volume []int64   `json:"volume"`
-					} `json:"quote"`
-				} `json:"indicators"`
-			} `json:"result"`
-		} `json:"chart"`
+// 一次讀取多個股票的緩存報價
+func (s *MarketDataService) cachedQuotes(symbols []string) map[string]*StockQuote {
+	quotes := make(map[string]*StockQuote, len(symbols))
+	keys := make([]string, len(symbols))
+	for i, symbol := range symbols {
+		keys[i] = quoteCacheKey(symbol)
 	}
 
-	if err := json.Unmarshal(data, &response); err != nil {
-		return nil, fmt.Errorf("解析Yahoo Finance響應失敗: %v", err)
+	values, err := s.redis.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		s.logger.WithError(err).Warn("批量讀取股價緩存失敗")
+		return quotes
 	}
-
-	if len(response.Chart.Result) == 0 {
-		return nil, fmt.Errorf("未找到股票數據: %s", symbol)
+	for i, value := range values {
+		if cached, ok := value.(string); ok {
+			if quote := decodeQuote(cached); quote != nil {
+				quotes[symbols[i]] = quote
+			}
+		}
 	}
+	return quotes
+}
 
-	result := response.Chart.Result[0]
-	meta := result.Meta
+func quoteCacheKey(symbol string) string {
+	return fmt.Sprintf("quote:%s", symbol)
+}
 
-	// 計算當前交易時間
-	marketTime := time.Unix(meta.RegularMarketTime, 0)
-	isMarketOpen := s.isMarketOpen(marketTime)
+func decodeQuote(cached string) *StockQuote {
+	var quote StockQuote
+	if json.Unmarshal([]byte(cached), &quote) != nil {
+		return nil
+	}
+	return &quote
+}
 
-	// 獲取最新價格數據
-	var high, low, open, volume float64 = 0, 0, 0, 0
-	if len(result.Indicators.Quote) > 0 {
-		quote := result.Indicators.Quote[0]
-		if len(quote.High) > 0 {
-			high = quote.High[len(quote.High)-1]
-		}
-		if len(quote.Low) > 0 {
-			low = quote.Low[len(quote.Low)-1]
-		}
-		if len(quote.Open) > 0 {
-			open = quote.Open[len(quote.Open)-1]
-		}
-		if len(quote.Volume) > 0 {
-			volume = float64(quote.Volume[len(quote.Volume)-1])
+// 從行情來源獲取實時數據並更新緩存，價格相對 previous 變動時通知訂閱者
+func (s *MarketDataService) fetchQuote(symbol string, previous *StockQuote) (*StockQuote, error) {
+	// 從行情來源獲取實時數據
+	quote, err := s.provider.FetchQuote(context.Background(), symbol)
+	if err != nil {
+		entry := s.logger.WithError(err).WithFields(logrus.Fields{
+			"symbol":   symbol,
+			"provider": s.provider.Name(),
+		})
+		if errors.Is(err, ErrCircuitOpen) {
+			entry.Debug("行情來源熔斷中，跳過請求")
+		} else {
+			entry.Error("獲取行情數據失敗")
 		}
+		return nil, err
 	}
 
-	// 計算變化
-	change := meta.RegularMarketPrice - meta.PreviousClose
-	changePercent := (change / meta.PreviousClose) * 100
-
-	stockQuote := &StockQuote{
-		Symbol:           strings.ToUpper(symbol),
-		Price:            meta.RegularMarketPrice,
-		PreviousClose:    meta.PreviousClose,
-		Open:             open,
-		High:             high,
-		Low:              low,
-		Volume:           int64(volume),
-		LastUpdated:      marketTime,
-		IsMarketOpen:     isMarketOpen,
-		Currency:         meta.Currency,
-		Exchange:         meta.ExchangeName,
-		CompanyName:      symbol, // Yahoo Finance API不提供公司名稱，使用symbol代替
-		Change:           change,
-		ChangePercent:    changePercent,
+	// 緩存結果
+	quoteJSON, _ := json.Marshal(quote)
+	s.redis.Set(context.Background(), quoteCacheKey(symbol), quoteJSON, quoteCacheTTL)
+
+	// 價格變動時通知訂閱者
+	if previous == nil || previous.Price != quote.Price {
+		s.notifyPriceChange(quote)
 	}
 
-	s.logger.WithFields(logrus.Fields{
-		"symbol": symbol,
-		"price":  stockQuote.Price,
-		"change": change,
-		"changePercent": changePercent,
-	}).Info("獲取實時股價成功")
+	return quote, nil
+}
 
-	return stockQuote, nil
+// 訂閱價格變動通知，回調不應阻塞
+func (s *MarketDataService) OnPriceChange(fn func(*StockQuote)) {
+	s.listenersMux.Lock()
+	defer s.listenersMux.Unlock()
+	s.listeners = append(s.listeners, fn)
 }
 
-// 判斷市場是否開放
-func (s *MarketDataService) isMarketOpen(marketTime time.Time) bool {
-	now := time.Now()
-	
-	// 簡化判斷：週一到週五，美東時間9:30-16:00
-	weekday := now.Weekday()
-	if weekday == time.Saturday || weekday == time.Sunday {
-		return false
+func (s *MarketDataService) notifyPriceChange(quote *StockQuote) {
+	s.listenersMux.RLock()
+	defer s.listenersMux.RUnlock()
+	for _, fn := range s.listeners {
+		fn(quote)
 	}
-
-	// 檢查時間差，如果市場時間在30分鐘內，認為市場開放
-	timeDiff := now.Sub(marketTime)
-	return timeDiff >= 0 && timeDiff < 30*time.Minute
 }
 
-// 批量獲取股價
-func (s *MarketDataService) GetMultipleQuotes(symbols []string) (map[string]*StockQuote, error) {
-	quotes := make(map[string]*StockQuote)
-	
+// 批量獲取股價：一次讀取全部緩存，缺失的股票以有限並發從行情來源獲取；
+// 過期不超過 quoteStaleTTL 的緩存報價先行返回，並在後台刷新。返回取得的報價及各失敗股票的錯誤
+func (s *MarketDataService) GetMultipleQuotes(ctx context.Context, symbols []string) (map[string]*StockQuote, map[string]error) {
+	quotes := make(map[string]*StockQuote, len(symbols))
+	failures := make(map[string]error)
+	if len(symbols) == 0 {
+		return quotes, failures
+	}
+
+	cached := s.cachedQuotes(symbols)
+	var missing, stale []string
+	seen := make(map[string]bool, len(symbols))
 	for _, symbol := range symbols {
-		quote, err := s.GetStockQuote(symbol)
-		if err != nil {
-			s.logger.WithError(err).WithField("symbol", symbol).Warn("獲取股價失敗")
+		if seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+		quote, exists := cached[symbol]
+		if !exists || time.Since(quote.LastUpdated) >= quoteStaleTTL {
+			missing = append(missing, symbol)
 			continue
 		}
+		if time.Since(quote.LastUpdated) >= quoteFreshTTL {
+			stale = append(stale, symbol)
+		}
 		quotes[symbol] = quote
 	}
-	
-	return quotes, nil
+
+	var mu sync.Mutex
+	s.loadQuotes(ctx, missing, func(symbol string, quote *StockQuote, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failures[symbol] = err
+			return
+		}
+		quotes[symbol] = quote
+	})
+
+	if len(stale) > 0 {
+		go s.loadQuotes(context.Background(), stale, func(string, *StockQuote, error) {})
+	}
+
+	return quotes, failures
+}
+
+// 以最多 batchConcurrency 個並發獲取報價，全部完成後返回
+func (s *MarketDataService) loadQuotes(ctx context.Context, symbols []string, done func(symbol string, quote *StockQuote, err error)) {
+	sem := make(chan struct{}, s.batchConcurrency)
+	var wg sync.WaitGroup
+	for _, symbol := range symbols {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(symbol string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			quote, err := s.loadQuote(ctx, symbol)
+			done(symbol, quote, err)
+		}(symbol)
+	}
+	wg.Wait()
 }
 
 // 檢查價格是否符合成交條件
-func (s *MarketDataService) CheckOrderExecution(symbol string, orderType string, orderPrice float64, side string) (bool, float64, error) {
-	quote, err := s.GetStockQuote(symbol)
+func (s *MarketDataService) CheckOrderExecution(ctx context.Context, symbol string, orderType string, orderPrice models.Decimal, side string) (bool, models.Decimal, error) {
+	quote, err := s.GetStockQuote(ctx, symbol)
 	if err != nil {
 		return false, 0, err
 	}
 
-	currentPrice := quote.Price
-	executed := false
-	executionPrice := currentPrice
+	executed := orderTriggered(orderType, side, orderPrice, quote.Price)
+
+	s.logger.WithFields(logrus.Fields{
+		"symbol":      symbol,
+		"orderType":   orderType,
+		"side":        side,
+		"orderPrice":  orderPrice,
+		"marketPrice": quote.Price,
+		"executed":    executed,
+	}).Debug("訂單成交條件檢查")
+
+	return executed, quote.Price, nil
+}
 
-	// 首先檢查基本價格條件
+// 判斷訂單在給定市價下是否滿足成交或觸發條件
+func orderTriggered(orderType, side string, orderPrice, marketPrice models.Decimal) bool {
 	switch orderType {
 	case "market":
 		// 市價單始終符合條件
-		executed = true
-		executionPrice = currentPrice
-		
-	case "limit":
+		return true
+	case "limit", "market_if_touched":
 		if side == "buy" {
-			// 買入限價單：當前價格 <= 限價時符合條件
-			executed = currentPrice <= orderPrice
-			executionPrice = currentPrice
-		} else if side == "sell" {
-			// 賣出限價單：當前價格 >= 限價時符合條件
-			executed = currentPrice >= orderPrice
-			executionPrice = currentPrice
+			// 買入限價單（及觸價單）：當前價格 <= 限價時符合條件
+			return marketPrice <= orderPrice
 		}
-		
-	case "stop":
+		// 賣出限價單：當前價格 >= 限價時符合條件
+		return marketPrice >= orderPrice
+	case "stop", "stop_limit", "trailing_stop":
 		if side == "buy" {
 			// 買入止損單：當前價格 >= 止損價時觸發
-			executed = currentPrice >= orderPrice
-			executionPrice = currentPrice
-		} else if side == "sell" {
-			// 賣出止損單：當前價格 <= 止損價時觸發
-			executed = currentPrice <= orderPrice
-			executionPrice = currentPrice
+			return marketPrice >= orderPrice
 		}
+		// 賣出止損單：當前價格 <= 止損價時觸發
+		return marketPrice <= orderPrice
 	}
-
-	// 如果基本條件不符合，直接返回
-	if !executed {
-		return false, currentPrice, nil
-	}
-
-	// 基本條件符合後，應用隨機成交率邏輯
-	rand.Seed(time.Now().UnixNano())
-	
-	var fillRatio float64
-	
-	// GOOGL 特殊處理 - 70%-100%成交率
-	if strings.ToUpper(symbol) == "GOOGL" {
-		fillRatio = 0.7 + rand.Float64()*0.3 // 0.7-1.0
-		s.logger.WithFields(logrus.Fields{
-			"symbol": symbol,
-			"fillRatio": fillRatio,
-			"orderType": orderType,
-			"side": side,
-		}).Info("GOOGL訂單成交檢查 - 高成交率")
-	} else {
-		// 其他股票 - 30%-100%成交率
-		fillRatio = 0.3 + rand.Float64()*0.7 // 0.3-1.0
-		s.logger.WithFields(logrus.Fields{
-			"symbol": symbol,
-			"fillRatio": fillRatio,
-			"orderType": orderType,
-			"side": side,
-		}).Info("其他股票成交檢查")
-	}
-	
-	// >95%視為完全成交
-	if fillRatio > 0.95 {
-		s.logger.WithFields(logrus.Fields{
-			"symbol": symbol,
-			"fillRatio": fillRatio,
-			"marketPrice": currentPrice,
-			"orderPrice": orderPrice,
-		}).Info("訂單完全成交")
-		return true, executionPrice, nil
-	}
-	
-	// 30%-95%範圍內的隨機成交
-	if fillRatio > 0.3 {
-		// 可以實現部分成交邏輯，目前簡化為完全成交
-		s.logger.WithFields(logrus.Fields{
-			"symbol": symbol,
-			"fillRatio": fillRatio,
-			"marketPrice": currentPrice,
-			"orderPrice": orderPrice,
-		}).Info("訂單成交")
-		return true, executionPrice, nil
-	}
-	
-	// 低於30%不成交
-	s.logger.WithFields(logrus.Fields{
-		"symbol": symbol,
-		"fillRatio": fillRatio,
-		"marketPrice": currentPrice,
-		"orderPrice": orderPrice,
-	}).Info("訂單未成交")
-	return false, currentPrice, nil
+	return false
 }
-
-// 獲取支持的股票列表
-func (s *MarketDataService) GetSupportedStocks() []string {
-	return []string{
-		"AAPL",  // Apple
-		"GOOGL", // Alphabet (Google)
-		"MSFT",  // Microsoft
-		"AMZN",  // Amazon
-		"TSLA",  // Tesla
-		"META",  // Meta (Facebook)
-		"NFLX",  // Netflix
-		"NVDA",  // NVIDIA
-		"JPM",   // JPMorgan Chase
-		"JNJ",   // Johnson & Johnson
-		"V",     // Visa
-		"PG",    // Procter & Gamble
-		"MA",    // Mastercard
-		"UNH",   // UnitedHealth
-		"HD",    // Home Depot
-		"DIS",   // Disney
-		"PYPL",  // PayPal
-		"BAC",   // Bank of America
-		"VZ",    // Verizon
-		"ADBE",  // Adobe
-	}
-} 
\ No newline at end of file
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // 確保精簡容器中也能載入美東時區
+)
+
+// 美股交易日曆（紐約證券交易所），行情模擬、K線補齊等按此判斷交易時段
+var usMarketCalendar = newUSMarketCalendar("XNYS", "New York Stock Exchange")
+
+// 美股交易時區
+var marketLocation = usMarketCalendar.Location
+
+// 美股交易所：美東9:30-16:00，按NYSE規則休市及提前至13:00收盤
+func newUSMarketCalendar(code, name string) *TradingCalendar {
+	calendar, err := NewTradingCalendar(code, name, "America/New_York", "09:30", "16:00", nil)
+	if err != nil {
+		panic(err)
+	}
+	calendar.rules = usMarketDays
+	return calendar
+}
+
+// 臨時休市，如國葬日
+var usMarketClosures = []CalendarDay{
+	{Date: "2018-12-05", Name: "老布殊總統國葬日"},
+	{Date: "2025-01-09", Name: "卡特總統國葬日"},
+}
+
+// 按NYSE規則生成某年的休市日及提前收盤日
+// 假期逢週六提前至週五、逢週日順延至週一；元旦逢週六不補假
+func usMarketDays(year int) []CalendarDay {
+	days := make([]CalendarDay, 0, 16)
+	holiday := func(date time.Time, name string) {
+		days = append(days, CalendarDay{Date: date.Format(calendarDateLayout), Name: name})
+	}
+	earlyClose := func(date time.Time, name string) {
+		if date.Weekday() >= time.Monday && date.Weekday() <= time.Thursday {
+			days = append(days, CalendarDay{Date: date.Format(calendarDateLayout), Name: name, Close: "13:00"})
+		}
+	}
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	if newYear := date(time.January, 1); newYear.Weekday() != time.Saturday {
+		holiday(observedHoliday(newYear), "元旦")
+	}
+	holiday(nthWeekday(year, time.January, time.Monday, 3), "馬丁·路德·金紀念日")
+	holiday(nthWeekday(year, time.February, time.Monday, 3), "總統日")
+	holiday(easterSunday(year).AddDate(0, 0, -2), "耶穌受難日")
+	holiday(nthWeekday(year, time.June, time.Monday, 1).AddDate(0, 0, -7), "陣亡將士紀念日")
+	if year >= 2022 {
+		holiday(observedHoliday(date(time.June, 19)), "六月節")
+	}
+	holiday(observedHoliday(date(time.July, 4)), "獨立日")
+	holiday(nthWeekday(year, time.September, time.Monday, 1), "勞動節")
+	thanksgiving := nthWeekday(year, time.November, time.Thursday, 4)
+	holiday(thanksgiving, "感恩節")
+	holiday(observedHoliday(date(time.December, 25)), "聖誕節")
+
+	// 獨立日前夕、感恩節翌日及平安夜提前收盤，當天為補假日時除外
+	earlyClose(date(time.July, 3), "獨立日前夕")
+	days = append(days, CalendarDay{Date: thanksgiving.AddDate(0, 0, 1).Format(calendarDateLayout), Name: "感恩節翌日", Close: "13:00"})
+	earlyClose(date(time.December, 24), "平安夜")
+
+	for _, day := range usMarketClosures {
+		if strings.HasPrefix(day.Date, strconv.Itoa(year)) {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// 假期逢週六提前至週五，逢週日順延至週一
+func observedHoliday(date time.Time) time.Time {
+	switch date.Weekday() {
+	case time.Saturday:
+		return date.AddDate(0, 0, -1)
+	case time.Sunday:
+		return date.AddDate(0, 0, 1)
+	}
+	return date
+}
+
+// 某月第 n 個星期幾
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	offset := (int(weekday) - int(first.Weekday()) + 7) % 7
+	return first.AddDate(0, 0, offset+(n-1)*7)
+}
+
+// 復活節（公曆，Meeus/Jones/Butcher算法）
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// 是否處於常規交易時段（美東9:30-16:00，提前收盤日至13:00）
+func isRegularSession(t time.Time) bool {
+	return usMarketCalendar.IsOpen(t)
+}
+
+// 是否為交易日（非週末及假期）
+func isTradingDay(date time.Time) bool {
+	return usMarketCalendar.IsTradingDay(date)
+}
+
+// 交易日的開盤時間（美東9:30）
+func sessionOpen(date time.Time) time.Time {
+	return usMarketCalendar.at(date, usMarketCalendar.open)
+}
+
+// 交易日的交易分鐘數，提前收盤日為210
+func sessionLength(date time.Time) int {
+	return usMarketCalendar.sessionMinutes(date)
+}
+
+// 美東日期
+func marketDay(t time.Time) time.Time {
+	local := t.In(marketLocation)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, marketLocation)
+}
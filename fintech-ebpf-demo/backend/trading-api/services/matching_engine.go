@@ -0,0 +1,550 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+)
+
+// 成交參與方
+type FillParty struct {
+	OrderID   string       `json:"orderId"`
+	UserID    string       `json:"userId"`
+	Side      string       `json:"side"`
+	OrderType string       `json:"orderType"`
+	Lots      LotSelection `json:"lots,omitempty"` // 賣單的稅批扣減方式
+}
+
+// 單筆撮合成交
+type Fill struct {
+	ID         string         `json:"id"`
+	Symbol     string         `json:"symbol"`
+	Price      models.Decimal `json:"price"`
+	Quantity   models.Decimal `json:"quantity"`
+	Taker      FillParty      `json:"taker"`
+	Maker      *FillParty     `json:"maker,omitempty"` // nil 表示與市場報價成交
+	ExecutedAt time.Time      `json:"executedAt"`
+}
+
+// 訂單因有效期規則被終止（取消、拒絕或過期）的記錄
+type OrderTermination struct {
+	OrderID  string         `json:"orderId"`
+	UserID   string         `json:"userId"`
+	Symbol   string         `json:"symbol"`
+	Status   string         `json:"status"`
+	Price    models.Decimal `json:"price"`
+	Quantity models.Decimal `json:"quantity"` // 被終止的未成交數量
+	Reason   string         `json:"reason"`
+}
+
+// 撮合結果：成交明細、終止記錄及狀態有變化的訂單快照
+type ExecutionReport struct {
+	Fills        []Fill
+	Terminations []OrderTermination
+	Orders       []*models.Order
+
+	touched map[string]*models.Order
+}
+
+func newExecutionReport() *ExecutionReport {
+	return &ExecutionReport{touched: make(map[string]*models.Order)}
+}
+
+func (r *ExecutionReport) touch(order *models.Order) {
+	r.touched[order.ID] = order
+}
+
+// 鎖定訂單最終狀態，生成快照
+func (r *ExecutionReport) finalize() *ExecutionReport {
+	for _, order := range r.touched {
+		r.Orders = append(r.Orders, order.Clone())
+	}
+	r.touched = nil
+	return r
+}
+
+// 撮合引擎：每個股票一個訂單簿，價格優先、時間優先。
+// 未能在訂單簿內成交的市價流量以當前市場報價成交。
+type MatchingEngine struct {
+	logger *logrus.Logger
+	mu     sync.Mutex
+	books  map[string]*lockedBook
+}
+
+type lockedBook struct {
+	mu sync.Mutex
+	*OrderBook
+}
+
+func NewMatchingEngine(logger *logrus.Logger) *MatchingEngine {
+	return &MatchingEngine{
+		logger: logger,
+		books:  make(map[string]*lockedBook),
+	}
+}
+
+func (e *MatchingEngine) book(symbol string) *lockedBook {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	symbol = strings.ToUpper(symbol)
+	book, exists := e.books[symbol]
+	if !exists {
+		book = &lockedBook{OrderBook: newOrderBook(symbol)}
+		e.books[symbol] = book
+	}
+	return book
+}
+
+// 提交新訂單。order 會被就地更新成交數量與均價；
+// 未成交的限價單或未觸發的條件單會以副本形式掛入訂單簿。
+func (e *MatchingEngine) Submit(order *models.Order, quote *StockQuote) *ExecutionReport {
+	book := e.book(order.Symbol)
+	book.mu.Lock()
+	defer book.mu.Unlock()
+
+	report := newExecutionReport()
+	report.touch(order)
+
+	// FOK：無法全部成交則整單拒絕
+	if order.TimeInForce == models.TimeInForceFOK && !e.fullyFillable(book.OrderBook, order, quote) {
+		e.terminate(report, order, models.OrderStatusRejected, "fok_unfillable")
+		return report.finalize()
+	}
+
+	if order.IsConditional() && order.TriggeredAt == nil {
+		order.UpdateTrail(quote.Price)
+		if !orderTriggered(order.OrderType, order.Side, order.TriggerPrice(), quote.Price) {
+			book.addStop(order.Clone())
+			return report.finalize()
+		}
+		e.trigger(order)
+	}
+
+	e.activate(book.OrderBook, order, quote, report)
+	book.prune()
+	return report.finalize()
+}
+
+// 根據最新報價重新評估掛單：觸發止損單，並以報價成交已可成交的限價單
+func (e *MatchingEngine) OnQuote(quote *StockQuote) *ExecutionReport {
+	book := e.book(quote.Symbol)
+	book.mu.Lock()
+	defer book.mu.Unlock()
+
+	report := newExecutionReport()
+	price := quote.Price
+
+	pendingStops := book.stops[:0]
+	var triggered []*models.Order
+	for _, stop := range book.stops {
+		if stop.UpdateTrail(price) {
+			report.touch(stop)
+		}
+		if orderTriggered(stop.OrderType, stop.Side, stop.TriggerPrice(), price) {
+			triggered = append(triggered, stop)
+			delete(book.orders, stop.ID)
+		} else {
+			pendingStops = append(pendingStops, stop)
+		}
+	}
+	book.stops = pendingStops
+
+	for _, stop := range triggered {
+		if !stop.IsActive() {
+			continue
+		}
+		e.trigger(stop)
+		report.touch(stop)
+		e.activate(book.OrderBook, stop, quote, report)
+	}
+
+	for _, level := range book.bids {
+		if level.Price < price {
+			break
+		}
+		e.fillLevelAtQuote(book.OrderBook, level, quote, report)
+	}
+	for _, level := range book.asks {
+		if level.Price > price {
+			break
+		}
+		e.fillLevelAtQuote(book.OrderBook, level, quote, report)
+	}
+	book.prune()
+
+	return report.finalize()
+}
+
+// 使到期的掛單過期：DAY訂單於收盤時、GTD訂單於指定時間
+func (e *MatchingEngine) ExpireDue(now time.Time) *ExecutionReport {
+	books := e.allBooks()
+
+	report := newExecutionReport()
+	for _, book := range books {
+		book.mu.Lock()
+		for orderID, order := range book.orders {
+			if order.ExpireAt == nil || order.ExpireAt.After(now) {
+				continue
+			}
+
+			reason := "gtd_expired"
+			if order.TimeInForce == models.TimeInForceDay {
+				reason = "day_close"
+			}
+			book.remove(orderID)
+			e.terminate(report, order, models.OrderStatusExpired, reason)
+		}
+		book.mu.Unlock()
+	}
+
+	return report.finalize()
+}
+
+// 所有股票訂單簿的快照列表
+func (e *MatchingEngine) allBooks() []*lockedBook {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	books := make([]*lockedBook, 0, len(e.books))
+	for _, book := range e.books {
+		books = append(books, book)
+	}
+	return books
+}
+
+// 當前有掛單（含未觸發止損單）的股票代碼
+func (e *MatchingEngine) Symbols() []string {
+	books := e.allBooks()
+
+	symbols := make([]string, 0, len(books))
+	for _, book := range books {
+		book.mu.Lock()
+		if len(book.orders) > 0 {
+			symbols = append(symbols, book.Symbol)
+		}
+		book.mu.Unlock()
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// 從訂單簿撤單，返回撤單時的訂單快照；訂單不在簿內時返回nil
+func (e *MatchingEngine) Cancel(symbol, orderID string) *models.Order {
+	book := e.book(symbol)
+	book.mu.Lock()
+	defer book.mu.Unlock()
+
+	order := book.remove(orderID)
+	if order == nil {
+		return nil
+	}
+	return order.Clone()
+}
+
+// 將訂單恢復到訂單簿而不撮合：未觸發的條件單放回止損隊列，其餘掛在其價位隊尾。
+// 已在訂單簿內或無法掛單（無限價且已觸發）的訂單返回 false
+func (e *MatchingEngine) Restore(order *models.Order) bool {
+	book := e.book(order.Symbol)
+	book.mu.Lock()
+	defer book.mu.Unlock()
+
+	if _, exists := book.orders[order.ID]; exists || !order.IsActive() {
+		return false
+	}
+	if order.IsConditional() && order.TriggeredAt == nil {
+		book.addStop(order.Clone())
+		return true
+	}
+	if !order.HasLimitPrice() {
+		return false
+	}
+	book.add(order.Clone())
+	return true
+}
+
+// 訂單簿深度快照
+func (e *MatchingEngine) Snapshot(symbol string, depth int) *BookSnapshot {
+	book := e.book(symbol)
+	book.mu.Lock()
+	defer book.mu.Unlock()
+
+	return book.snapshot(depth)
+}
+
+// 訂單在價位隊列中的位置
+func (e *MatchingEngine) QueuePosition(symbol, orderID string) int {
+	book := e.book(symbol)
+	book.mu.Lock()
+	defer book.mu.Unlock()
+
+	return book.queuePosition(orderID)
+}
+
+// 標記條件單已觸發
+func (e *MatchingEngine) trigger(order *models.Order) {
+	now := time.Now()
+	order.TriggeredAt = &now
+	order.Touch(now)
+
+	e.logger.WithFields(logrus.Fields{
+		"order_id":      order.ID,
+		"symbol":        order.Symbol,
+		"order_type":    order.OrderType,
+		"trigger_price": order.TriggerPrice(),
+	}).Info("條件單已觸發")
+}
+
+// 執行已可成交的訂單：帶限價的進入限價流程，其餘按市價成交
+func (e *MatchingEngine) activate(book *OrderBook, order *models.Order, quote *StockQuote, report *ExecutionReport) {
+	if order.HasLimitPrice() {
+		e.executeLimit(book, order, quote, report)
+		return
+	}
+	e.executeAtMarket(book, order, quote, report)
+}
+
+// 限價單先與訂單簿撮合，剩餘部分可按報價成交則成交，否則掛單
+func (e *MatchingEngine) executeLimit(book *OrderBook, order *models.Order, quote *StockQuote, report *ExecutionReport) {
+	e.matchBook(book, order, quote, report)
+	if order.RemainingQty <= 0 {
+		return
+	}
+
+	if orderTriggered(models.OrderTypeLimit, order.Side, order.Price, quote.Price) {
+		e.fillAtQuote(book, order, quote, report)
+	} else if order.TimeInForce == models.TimeInForceIOC {
+		// IOC：未能立即成交的剩餘數量直接取消
+		e.terminate(report, order, models.OrderStatusCancelled, "ioc_remainder")
+	} else {
+		book.add(order.Clone())
+	}
+}
+
+// 先與訂單簿撮合，剩餘部分按市場報價成交
+func (e *MatchingEngine) executeAtMarket(book *OrderBook, order *models.Order, quote *StockQuote, report *ExecutionReport) {
+	e.matchBook(book, order, quote, report)
+	if order.RemainingQty > 0 {
+		e.fillAtQuote(book, order, quote, report)
+	}
+}
+
+// 與訂單簿對手盤撮合，成交價為被動方掛單價
+func (e *MatchingEngine) matchBook(book *OrderBook, taker *models.Order, quote *StockQuote, report *ExecutionReport) {
+	quotePrice := quote.Price
+	for _, level := range book.opposite(taker.Side) {
+		if taker.RemainingQty <= 0 || !levelAcceptable(taker, level.Price, quotePrice) {
+			break
+		}
+
+		kept := level.Orders[:0]
+		for _, maker := range level.Orders {
+			// 已被OCO撤銷的訂單等待清理
+			if !maker.IsActive() {
+				continue
+			}
+			if taker.RemainingQty <= 0 {
+				kept = append(kept, maker)
+				continue
+			}
+			// 自成交防範：撤銷同一用戶的掛單，主動方繼續撮合，訂單簿不會留下交叉的價位
+			if maker.UserID == taker.UserID {
+				delete(book.orders, maker.ID)
+				e.terminate(report, maker, models.OrderStatusCancelled, "self_trade_prevention")
+				continue
+			}
+
+			fill := Fill{
+				ID:         uuid.New().String(),
+				Symbol:     book.Symbol,
+				Price:      level.Price,
+				Quantity:   min(taker.RemainingQty, maker.RemainingQty),
+				Taker:      partyOf(taker),
+				ExecutedAt: time.Now(),
+			}
+			makerParty := partyOf(maker)
+			fill.Maker = &makerParty
+
+			e.applyFill(book, taker, fill, "taker", report)
+			e.applyFill(book, maker, fill, "maker", report)
+			report.touch(maker)
+			e.recordFill(report, fill)
+
+			if maker.RemainingQty > 0 {
+				kept = append(kept, maker)
+			} else {
+				delete(book.orders, maker.ID)
+			}
+		}
+		level.Orders = kept
+	}
+	book.prune()
+}
+
+// 以報價成交整個價位的掛單
+func (e *MatchingEngine) fillLevelAtQuote(book *OrderBook, level *priceLevel, quote *StockQuote, report *ExecutionReport) {
+	for _, order := range level.Orders {
+		if !order.IsActive() {
+			continue
+		}
+		report.touch(order)
+		e.fillAtQuote(book, order, quote, report)
+		delete(book.orders, order.ID)
+	}
+	level.Orders = nil
+}
+
+// 剩餘數量按市場報價成交
+func (e *MatchingEngine) fillAtQuote(book *OrderBook, order *models.Order, quote *StockQuote, report *ExecutionReport) {
+	fill := Fill{
+		ID:         uuid.New().String(),
+		Symbol:     order.Symbol,
+		Price:      quote.Price,
+		Quantity:   order.RemainingQty,
+		Taker:      partyOf(order),
+		ExecutedAt: time.Now(),
+	}
+
+	e.applyFill(book, order, fill, "market", report)
+	e.recordFill(report, fill)
+}
+
+// 將成交計入訂單，狀態轉換由訂單狀態機校驗
+func (e *MatchingEngine) applyFill(book *OrderBook, order *models.Order, fill Fill, liquidity string, report *ExecutionReport) {
+	if err := order.ApplyFill(fill.ID, fill.Quantity, fill.Price, liquidity, fill.ExecutedAt); err != nil {
+		e.logger.WithError(err).WithField("order_id", order.ID).Error("訂單成交狀態更新失敗")
+		return
+	}
+	e.cancelOCO(book, order, report)
+}
+
+// 同步與成交訂單互斥的關聯訂單：全部成交時撤銷關聯訂單，部分成交時將關聯訂單縮減到本訂單的剩餘數量。
+// 關聯訂單屬同一股票，在持有訂單簿鎖時完成，不會出現兩筆同時成交；被撤訂單由 prune 清出訂單簿。
+func (e *MatchingEngine) cancelOCO(book *OrderBook, order *models.Order, report *ExecutionReport) {
+	for _, linkedID := range order.OCOOrderIDs {
+		linked, exists := book.orders[linkedID]
+		if !exists || !linked.IsActive() {
+			continue
+		}
+		if order.Status == models.OrderStatusFilled {
+			e.terminate(report, linked, models.OrderStatusCancelled, "oco_sibling_filled")
+			continue
+		}
+		if linked.RemainingQty <= order.RemainingQty {
+			continue
+		}
+
+		linked.RemainingQty = order.RemainingQty
+		linked.Quantity = linked.FilledQty + linked.RemainingQty
+		linked.Touch(time.Now())
+		report.touch(linked)
+
+		e.logger.WithFields(logrus.Fields{
+			"order_id":      linked.ID,
+			"sibling_id":    order.ID,
+			"remaining_qty": linked.RemainingQty,
+		}).Info("OCO關聯訂單隨部分成交縮減數量")
+	}
+}
+
+func (e *MatchingEngine) recordFill(report *ExecutionReport, fill Fill) {
+	report.Fills = append(report.Fills, fill)
+
+	fields := logrus.Fields{
+		"fill_id":        fill.ID,
+		"symbol":         fill.Symbol,
+		"price":          fill.Price,
+		"quantity":       fill.Quantity,
+		"taker_order_id": fill.Taker.OrderID,
+		"taker_side":     fill.Taker.Side,
+	}
+	if fill.Maker != nil {
+		fields["maker_order_id"] = fill.Maker.OrderID
+		e.logger.WithFields(fields).Info("訂單簿撮合成交")
+	} else {
+		e.logger.WithFields(fields).Info("按市場報價成交")
+	}
+}
+
+// FOK預檢：訂單能否在當前訂單簿與報價下全部成交
+func (e *MatchingEngine) fullyFillable(book *OrderBook, order *models.Order, quote *StockQuote) bool {
+	// 市價流量或已可按報價成交的限價單，剩餘數量總能以報價成交
+	quotePrice := quote.Price
+	if !order.HasLimitPrice() || orderTriggered(models.OrderTypeLimit, order.Side, order.Price, quotePrice) {
+		return true
+	}
+
+	var available models.Decimal
+	for _, level := range book.opposite(order.Side) {
+		if !levelAcceptable(order, level.Price, quotePrice) {
+			break
+		}
+		// 同一用戶的掛單會被自成交防範撤銷，不計入可成交數量
+		for _, maker := range level.Orders {
+			if maker.IsActive() && maker.UserID != order.UserID {
+				available += maker.RemainingQty
+			}
+		}
+	}
+	return available >= order.RemainingQty
+}
+
+// 終止訂單的剩餘數量並記錄原因
+func (e *MatchingEngine) terminate(report *ExecutionReport, order *models.Order, status, reason string) {
+	remaining := order.RemainingQty
+	if err := order.TransitionTo(status); err != nil {
+		e.logger.WithError(err).WithField("order_id", order.ID).Error("訂單狀態轉換失敗")
+		return
+	}
+
+	report.touch(order)
+	report.Terminations = append(report.Terminations, OrderTermination{
+		OrderID:  order.ID,
+		UserID:   order.UserID,
+		Symbol:   order.Symbol,
+		Status:   status,
+		Price:    order.Price,
+		Quantity: remaining,
+		Reason:   reason,
+	})
+
+	e.logger.WithFields(logrus.Fields{
+		"order_id": order.ID,
+		"symbol":   order.Symbol,
+		"status":   status,
+		"quantity": remaining,
+		"reason":   reason,
+	}).Info("訂單已終止")
+}
+
+// 對手盤價位對主動方是否可接受：限價單只受限價約束，交叉的限價單直接互相成交；
+// 市價流量的剩餘部分總能按報價成交，只吃不劣於報價的價位
+func levelAcceptable(taker *models.Order, levelPrice, quotePrice models.Decimal) bool {
+	if taker.HasLimitPrice() {
+		if taker.Side == "buy" {
+			return levelPrice <= taker.Price
+		}
+		return levelPrice >= taker.Price
+	}
+
+	if taker.Side == "buy" {
+		return levelPrice <= quotePrice
+	}
+	return levelPrice >= quotePrice
+}
+
+func partyOf(order *models.Order) FillParty {
+	return FillParty{
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+		Side:      order.Side,
+		OrderType: order.OrderType,
+		Lots:      LotSelection{Method: order.LotMethod, LotIDs: order.LotIDs},
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"trading-api/models"
+)
+
+var engineClock = time.Now()
+
+// 創建時間依次遞增的限價單
+func limitOrder(id, userID, side string, quantity, price int64) *models.Order {
+	engineClock = engineClock.Add(time.Millisecond)
+	return &models.Order{
+		ID:           id,
+		UserID:       userID,
+		Symbol:       "AAPL",
+		Side:         side,
+		OrderType:    models.OrderTypeLimit,
+		Quantity:     models.DecimalFromInt(quantity),
+		RemainingQty: models.DecimalFromInt(quantity),
+		Price:        models.DecimalFromInt(price),
+		Status:       models.OrderStatusNew,
+		TimeInForce:  models.TimeInForceGTC,
+		CreatedAt:    engineClock,
+		UpdatedAt:    engineClock,
+	}
+}
+
+func reportOrder(report *ExecutionReport, orderID string) *models.Order {
+	for _, order := range report.Orders {
+		if order.ID == orderID {
+			return order
+		}
+	}
+	return nil
+}
+
+// 價格優先、同價位時間優先，成交價為掛單價；未吃完的掛單保留部分成交狀態及隊列位置
+func TestMatchingEnginePriceTimePriority(t *testing.T) {
+	engine := NewMatchingEngine(newTestLogger())
+	quote := testQuote("AAPL", 90)
+
+	for _, order := range []*models.Order{
+		limitOrder("s1", "u1", "sell", 5, 101),
+		limitOrder("s2", "u2", "sell", 5, 100),
+		limitOrder("s3", "u3", "sell", 5, 100),
+	} {
+		if report := engine.Submit(order, quote); len(report.Fills) != 0 {
+			t.Fatalf("%s 不應成交: %+v", order.ID, report.Fills)
+		}
+	}
+
+	taker := limitOrder("b1", "u4", "buy", 12, 101)
+	report := engine.Submit(taker, quote)
+
+	want := []struct {
+		maker string
+		qty   int64
+		price int64
+	}{{"s2", 5, 100}, {"s3", 5, 100}, {"s1", 2, 101}}
+	if len(report.Fills) != len(want) {
+		t.Fatalf("成交 %d 筆, 期望 %d 筆: %+v", len(report.Fills), len(want), report.Fills)
+	}
+	for i, w := range want {
+		fill := report.Fills[i]
+		if fill.Maker == nil || fill.Maker.OrderID != w.maker || fill.Quantity != models.DecimalFromInt(w.qty) || fill.Price != models.DecimalFromInt(w.price) {
+			t.Errorf("第 %d 筆成交 = %+v, 期望與 %s 成交 %d 股 @ %d", i+1, fill, w.maker, w.qty, w.price)
+		}
+	}
+
+	if taker.Status != models.OrderStatusFilled || taker.RemainingQty != 0 {
+		t.Errorf("主動方狀態 %s、剩餘 %v, 期望全部成交", taker.Status, taker.RemainingQty)
+	}
+	partial := reportOrder(report, "s1")
+	if partial == nil || partial.Status != models.OrderStatusPartiallyFilled || partial.RemainingQty != models.DecimalFromInt(3) {
+		t.Errorf("s1 = %+v, 期望部分成交剩餘 3 股", partial)
+	}
+	if position := engine.QueuePosition("AAPL", "s1"); position != 1 {
+		t.Errorf("s1 隊列位置 = %d, 期望 1", position)
+	}
+	snapshot := engine.Snapshot("AAPL", 0)
+	if len(snapshot.Bids) != 0 || len(snapshot.Asks) != 1 || snapshot.Asks[0].Quantity != models.DecimalFromInt(3) {
+		t.Errorf("訂單簿 = %+v, 期望只剩 101 的 3 股賣單", snapshot)
+	}
+}
+
+// 止損單在報價觸及觸發價前留在止損隊列，觸發後按報價成交
+func TestMatchingEngineStopTrigger(t *testing.T) {
+	engine := NewMatchingEngine(newTestLogger())
+
+	stop := limitOrder("stop1", "u1", "buy", 10, 110)
+	stop.OrderType = models.OrderTypeStop
+	if report := engine.Submit(stop, testQuote("AAPL", 100)); len(report.Fills) != 0 || stop.TriggeredAt != nil {
+		t.Fatalf("未觸及觸發價不應成交: %+v", report.Fills)
+	}
+	if report := engine.OnQuote(testQuote("AAPL", 105)); len(report.Fills) != 0 {
+		t.Fatalf("報價 105 不應觸發 110 的買入止損單: %+v", report.Fills)
+	}
+
+	report := engine.OnQuote(testQuote("AAPL", 111))
+	if len(report.Fills) != 1 || report.Fills[0].Maker != nil || report.Fills[0].Price != models.DecimalFromInt(111) {
+		t.Fatalf("成交 = %+v, 期望按報價 111 成交一筆", report.Fills)
+	}
+	triggered := reportOrder(report, "stop1")
+	if triggered == nil || triggered.TriggeredAt == nil || triggered.Status != models.OrderStatusFilled {
+		t.Errorf("止損單 = %+v, 期望已觸發並全部成交", triggered)
+	}
+	if symbols := engine.Symbols(); len(symbols) != 0 {
+		t.Errorf("成交後仍有掛單: %v", symbols)
+	}
+}
+
+// 主動方遇到同一用戶的掛單時撤銷該掛單，繼續與其他用戶成交，訂單簿不交叉
+func TestMatchingEngineSelfTradePrevention(t *testing.T) {
+	engine := NewMatchingEngine(newTestLogger())
+	quote := testQuote("AAPL", 90)
+
+	engine.Submit(limitOrder("own", "u1", "sell", 5, 100), quote)
+	engine.Submit(limitOrder("other", "u2", "sell", 3, 100), quote)
+
+	// 報價高於買入限價，剩餘部分掛單而不按報價成交
+	taker := limitOrder("b1", "u1", "buy", 5, 100)
+	report := engine.Submit(taker, testQuote("AAPL", 110))
+
+	if len(report.Fills) != 1 || report.Fills[0].Maker.OrderID != "other" || report.Fills[0].Quantity != models.DecimalFromInt(3) {
+		t.Fatalf("成交 = %+v, 期望只與 other 成交 3 股", report.Fills)
+	}
+	if len(report.Terminations) != 1 || report.Terminations[0].OrderID != "own" || report.Terminations[0].Reason != "self_trade_prevention" {
+		t.Errorf("終止記錄 = %+v, 期望撤銷 own", report.Terminations)
+	}
+	if own := reportOrder(report, "own"); own == nil || own.Status != models.OrderStatusCancelled {
+		t.Errorf("own = %+v, 期望已撤銷", own)
+	}
+
+	snapshot := engine.Snapshot("AAPL", 0)
+	if len(snapshot.Asks) != 0 || len(snapshot.Bids) != 1 || snapshot.Bids[0].Quantity != models.DecimalFromInt(2) {
+		t.Errorf("訂單簿 = %+v, 期望只剩 100 的 2 股買單", snapshot)
+	}
+	if engine.Cancel("AAPL", "own") != nil {
+		t.Error("被撤銷的掛單仍在訂單簿內")
+	}
+}
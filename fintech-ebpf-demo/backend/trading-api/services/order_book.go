@@ -0,0 +1,212 @@
+package services
+
+import (
+	"sort"
+
+	"trading-api/models"
+)
+
+// 價格檔位：同一價格的訂單按到達先後排隊
+type priceLevel struct {
+	Price  models.Decimal
+	Orders []*models.Order
+}
+
+// 訂單簿檔位快照
+type BookLevel struct {
+	Price    models.Decimal `json:"price"`
+	Quantity models.Decimal `json:"quantity"`
+	Orders   int            `json:"orders"`
+}
+
+// 訂單簿快照
+type BookSnapshot struct {
+	Symbol string      `json:"symbol"`
+	Bids   []BookLevel `json:"bids"`
+	Asks   []BookLevel `json:"asks"`
+}
+
+// 單一股票的限價訂單簿（價格優先、時間優先）
+type OrderBook struct {
+	Symbol string
+	bids   []*priceLevel // 買盤，價格由高到低
+	asks   []*priceLevel // 賣盤，價格由低到高
+	stops  []*models.Order
+	orders map[string]*models.Order
+}
+
+func newOrderBook(symbol string) *OrderBook {
+	return &OrderBook{
+		Symbol: symbol,
+		orders: make(map[string]*models.Order),
+	}
+}
+
+// 將訂單掛入訂單簿，排在同價位隊尾
+func (b *OrderBook) add(order *models.Order) {
+	b.orders[order.ID] = order
+
+	if order.Side == "buy" {
+		b.bids = insertLevel(b.bids, order, func(a, c models.Decimal) bool { return a > c })
+	} else {
+		b.asks = insertLevel(b.asks, order, func(a, c models.Decimal) bool { return a < c })
+	}
+}
+
+// 掛入未觸發的止損單
+func (b *OrderBook) addStop(order *models.Order) {
+	b.orders[order.ID] = order
+	b.stops = append(b.stops, order)
+}
+
+func insertLevel(levels []*priceLevel, order *models.Order, better func(a, c models.Decimal) bool) []*priceLevel {
+	idx := sort.Search(len(levels), func(i int) bool {
+		return !better(levels[i].Price, order.Price)
+	})
+
+	if idx < len(levels) && levels[idx].Price == order.Price {
+		levels[idx].Orders = append(levels[idx].Orders, order)
+		return levels
+	}
+
+	level := &priceLevel{Price: order.Price, Orders: []*models.Order{order}}
+	levels = append(levels, nil)
+	copy(levels[idx+1:], levels[idx:])
+	levels[idx] = level
+	return levels
+}
+
+// 從訂單簿移除訂單
+func (b *OrderBook) remove(orderID string) *models.Order {
+	order, exists := b.orders[orderID]
+	if !exists {
+		return nil
+	}
+	delete(b.orders, orderID)
+
+	for i, stop := range b.stops {
+		if stop.ID == orderID {
+			b.stops = append(b.stops[:i], b.stops[i+1:]...)
+			return order
+		}
+	}
+
+	if order.Side == "buy" {
+		b.bids = removeFromLevels(b.bids, orderID)
+	} else {
+		b.asks = removeFromLevels(b.asks, orderID)
+	}
+	return order
+}
+
+func removeFromLevels(levels []*priceLevel, orderID string) []*priceLevel {
+	for i, level := range levels {
+		for j, order := range level.Orders {
+			if order.ID != orderID {
+				continue
+			}
+			level.Orders = append(level.Orders[:j], level.Orders[j+1:]...)
+			if len(level.Orders) == 0 {
+				levels = append(levels[:i], levels[i+1:]...)
+			}
+			return levels
+		}
+	}
+	return levels
+}
+
+// 對手盤檔位
+func (b *OrderBook) opposite(side string) []*priceLevel {
+	if side == "buy" {
+		return b.asks
+	}
+	return b.bids
+}
+
+// 清除已失效的訂單及已空的檔位
+func (b *OrderBook) prune() {
+	b.bids = b.pruneLevels(b.bids)
+	b.asks = b.pruneLevels(b.asks)
+
+	stops := b.stops[:0]
+	for _, stop := range b.stops {
+		if stop.IsActive() {
+			stops = append(stops, stop)
+		} else {
+			delete(b.orders, stop.ID)
+		}
+	}
+	b.stops = stops
+}
+
+func (b *OrderBook) pruneLevels(levels []*priceLevel) []*priceLevel {
+	kept := levels[:0]
+	for _, level := range levels {
+		orders := level.Orders[:0]
+		for _, order := range level.Orders {
+			if order.IsActive() {
+				orders = append(orders, order)
+			} else {
+				delete(b.orders, order.ID)
+			}
+		}
+		level.Orders = orders
+
+		if len(level.Orders) > 0 {
+			kept = append(kept, level)
+		}
+	}
+	return kept
+}
+
+// 訂單在其價位隊列中的位置（從1開始），未找到返回0
+func (b *OrderBook) queuePosition(orderID string) int {
+	order, exists := b.orders[orderID]
+	if !exists {
+		return 0
+	}
+
+	levels := b.bids
+	if order.Side == "sell" {
+		levels = b.asks
+	}
+	for _, level := range levels {
+		if level.Price != order.Price {
+			continue
+		}
+		for i, queued := range level.Orders {
+			if queued.ID == orderID {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// 生成訂單簿深度快照
+func (b *OrderBook) snapshot(depth int) *BookSnapshot {
+	return &BookSnapshot{
+		Symbol: b.Symbol,
+		Bids:   aggregateLevels(b.bids, depth),
+		Asks:   aggregateLevels(b.asks, depth),
+	}
+}
+
+func aggregateLevels(levels []*priceLevel, depth int) []BookLevel {
+	result := make([]BookLevel, 0, len(levels))
+	for _, level := range levels {
+		if depth > 0 && len(result) >= depth {
+			break
+		}
+		var total models.Decimal
+		for _, order := range level.Orders {
+			total += order.RemainingQty
+		}
+		result = append(result, BookLevel{
+			Price:    level.Price,
+			Quantity: total,
+			Orders:   len(level.Orders),
+		})
+	}
+	return result
+}
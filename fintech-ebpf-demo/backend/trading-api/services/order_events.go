@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+)
+
+// 訂單事件類型
+const (
+	OrderEventCancelled = "order_cancelled"
+	OrderEventRejected  = "order_rejected"
+	OrderEventExpired   = "order_expired"
+)
+
+// 成交通知頻道前綴，按用戶區分：order_fills:<userId>
+const FillNotificationChannel = "order_fills"
+
+// 成交通知
+type FillNotification struct {
+	FillID       string         `json:"fillId"`
+	OrderID      string         `json:"orderId"`
+	UserID       string         `json:"userId"`
+	Symbol       string         `json:"symbol"`
+	Side         string         `json:"side"`
+	Quantity     models.Decimal `json:"quantity"`
+	Price        models.Decimal `json:"price"`
+	Liquidity    string         `json:"liquidity"`
+	OrderStatus  string         `json:"orderStatus"`
+	FilledQty    models.Decimal `json:"filledQty"`
+	RemainingQty models.Decimal `json:"remainingQty"`
+	ExecutedAt   time.Time      `json:"executedAt"`
+}
+
+// 訂單事件服務：記錄訂單生命週期中的關鍵事件
+type OrderEventService struct {
+	logger *logrus.Logger
+	redis  *redis.Client
+}
+
+func NewOrderEventService(logger *logrus.Logger, redisClient *redis.Client) *OrderEventService {
+	return &OrderEventService{
+		logger: logger,
+		redis:  redisClient,
+	}
+}
+
+// 記錄訂單事件
+func (s *OrderEventService) RecordEvent(orderID, userID, eventType, symbol string,
+	quantity, price models.Decimal, metadata models.JSONField) (*models.TradeEvent, error) {
+
+	event := &models.TradeEvent{
+		ID:        uuid.New().String(),
+		OrderID:   orderID,
+		UserID:    userID,
+		EventType: eventType,
+		Symbol:    symbol,
+		Quantity:  quantity,
+		Price:     price,
+		Metadata:  metadata,
+		CreatedAt: time.Now(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	eventsKey := fmt.Sprintf("order_events:%s", orderID)
+	if err := s.redis.RPush(ctx, eventsKey, eventJSON).Err(); err != nil {
+		return nil, err
+	}
+	s.redis.Expire(ctx, eventsKey, time.Hour*24*30)
+
+	s.logger.WithFields(logrus.Fields{
+		"eventId":   event.ID,
+		"orderId":   orderID,
+		"eventType": eventType,
+		"quantity":  quantity,
+	}).Info("訂單事件已記錄")
+
+	return event, nil
+}
+
+// 獲取訂單事件列表（按時間先後）
+func (s *OrderEventService) GetOrderEvents(orderID string) ([]*models.TradeEvent, error) {
+	eventsKey := fmt.Sprintf("order_events:%s", orderID)
+	items, err := s.redis.LRange(context.Background(), eventsKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*models.TradeEvent, 0, len(items))
+	for _, item := range items {
+		var event models.TradeEvent
+		if err := json.Unmarshal([]byte(item), &event); err != nil {
+			continue
+		}
+		events = append(events, &event)
+	}
+	return events, nil
+}
+
+// 發布成交通知到用戶頻道
+func (s *OrderEventService) PublishFill(notification *FillNotification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	channel := fmt.Sprintf("%s:%s", FillNotificationChannel, notification.UserID)
+	return s.redis.Publish(context.Background(), channel, payload).Err()
+}
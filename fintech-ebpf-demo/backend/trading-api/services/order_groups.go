@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+)
+
+// 訂單組狀態已被其他請求或後台任務修改
+var ErrOrderGroupStatusChanged = errors.New("訂單組狀態已變更")
+
+// 訂單組服務：保存括號訂單及OCO訂單組
+type OrderGroupService struct {
+	logger *logrus.Logger
+	redis  *redis.Client
+}
+
+func NewOrderGroupService(logger *logrus.Logger, redisClient *redis.Client) *OrderGroupService {
+	return &OrderGroupService{
+		logger: logger,
+		redis:  redisClient,
+	}
+}
+
+// 保存訂單組，已結束的訂單組保留30天
+func (s *OrderGroupService) SaveGroup(group *models.OrderGroup) error {
+	groupJSON, ttl, err := encodeGroup(group)
+	if err != nil {
+		return err
+	}
+	return s.redis.Set(context.Background(), orderGroupKey(group.ID), groupJSON, ttl).Err()
+}
+
+func orderGroupKey(groupID string) string {
+	return fmt.Sprintf("order_group:%s", groupID)
+}
+
+func encodeGroup(group *models.OrderGroup) ([]byte, time.Duration, error) {
+	groupJSON, err := json.Marshal(group)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ttl time.Duration
+	if !group.IsOpen() {
+		ttl = 30 * 24 * time.Hour
+	}
+	return groupJSON, ttl, nil
+}
+
+// 獲取訂單組
+func (s *OrderGroupService) GetGroup(groupID string) (*models.OrderGroup, error) {
+	groupJSON, err := s.redis.Get(context.Background(), orderGroupKey(groupID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var group models.OrderGroup
+	if err := json.Unmarshal([]byte(groupJSON), &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// 更新訂單組狀態。只有存儲中的狀態仍為 group.Status 時才寫入，否則返回 ErrOrderGroupStatusChanged，
+// 請求處理與後台任務並發推進同一訂單組時只有一方生效
+func (s *OrderGroupService) SetStatus(group *models.OrderGroup, status string) error {
+	if group.Status == status {
+		return nil
+	}
+
+	ctx := context.Background()
+	key := orderGroupKey(group.ID)
+	updated := *group
+	updated.Status = status
+	updated.UpdatedAt = time.Now()
+
+	err := watchKeys(ctx, s.redis, func(tx *redis.Tx) error {
+		storedJSON, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		var stored models.OrderGroup
+		if err := json.Unmarshal([]byte(storedJSON), &stored); err != nil {
+			return err
+		}
+		if stored.Status != group.Status {
+			return ErrOrderGroupStatusChanged
+		}
+
+		groupJSON, ttl, err := encodeGroup(&updated)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, groupJSON, ttl)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return err
+	}
+
+	group.Status = updated.Status
+	group.UpdatedAt = updated.UpdatedAt
+
+	s.logger.WithFields(logrus.Fields{
+		"group_id": group.ID,
+		"type":     group.Type,
+		"status":   status,
+	}).Info("訂單組狀態更新")
+	return nil
+}
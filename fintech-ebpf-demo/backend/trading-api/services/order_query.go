@@ -0,0 +1,129 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"trading-api/models"
+)
+
+// 游標格式錯誤
+var ErrInvalidCursor = errors.New("無效的分頁游標")
+
+// 訂單列表查詢：按創建時間排序，相同時間按訂單ID排序，保證翻頁穩定
+type OrderQuery struct {
+	UserID   string
+	Statuses []string   // 為空時不過濾
+	Symbol   string
+	Side     string
+	From     *time.Time // 創建時間下限（含）
+	To       *time.Time // 創建時間上限（不含）
+	Desc     bool       // 由新到舊
+	Limit    int
+	Cursor   string // 上一頁返回的 NextCursor
+}
+
+// 訂單列表分頁結果
+type OrderPage struct {
+	Orders     []*models.Order `json:"orders"`
+	NextCursor string          `json:"next_cursor,omitempty"` // 為空表示沒有下一頁
+}
+
+// 分頁游標：上一頁最後一筆訂單的排序鍵
+type OrderCursor struct {
+	CreatedMs int64
+	OrderID   string
+}
+
+// 訂單的排序鍵使用毫秒時間戳，與Redis有序集合分數一致
+func OrderSortKey(order *models.Order) int64 {
+	return order.CreatedAt.UnixMilli()
+}
+
+// 按創建時間升序排列，相同時間按訂單ID排序；恢復訂單簿時以此近似原有的時間優先順序
+func SortOrdersByCreation(orders []*models.Order) {
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+		}
+		return orders[i].ID < orders[j].ID
+	})
+}
+
+func encodeOrderCursor(order *models.Order) string {
+	raw := fmt.Sprintf("%d|%s", OrderSortKey(order), order.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeOrderCursor(cursor string) (*OrderCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, ErrInvalidCursor
+	}
+	createdMs, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &OrderCursor{CreatedMs: createdMs, OrderID: parts[1]}, nil
+}
+
+// 排序鍵是否按查詢方向位於游標之後；沒有游標時總是成立
+func (c *OrderCursor) Follows(createdMs int64, orderID string, desc bool) bool {
+	if c == nil {
+		return true
+	}
+	if desc {
+		return createdMs < c.CreatedMs || (createdMs == c.CreatedMs && orderID < c.OrderID)
+	}
+	return createdMs > c.CreatedMs || (createdMs == c.CreatedMs && orderID > c.OrderID)
+}
+
+// 訂單是否符合查詢條件（不含游標）
+func (q *OrderQuery) Matches(order *models.Order) bool {
+	if order.UserID != q.UserID {
+		return false
+	}
+	if q.Symbol != "" && order.Symbol != q.Symbol {
+		return false
+	}
+	if q.Side != "" && order.Side != q.Side {
+		return false
+	}
+	if q.From != nil && order.CreatedAt.Before(*q.From) {
+		return false
+	}
+	if q.To != nil && !order.CreatedAt.Before(*q.To) {
+		return false
+	}
+	if len(q.Statuses) == 0 {
+		return true
+	}
+	for _, status := range q.Statuses {
+		if order.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// 截取一頁結果：多取的一筆用於判斷是否還有下一頁
+func NewOrderPage(orders []*models.Order, limit int) *OrderPage {
+	page := &OrderPage{Orders: orders}
+	if limit > 0 && len(orders) > limit {
+		page.Orders = orders[:limit]
+		page.NextCursor = encodeOrderCursor(page.Orders[limit-1])
+	}
+	return page
+}
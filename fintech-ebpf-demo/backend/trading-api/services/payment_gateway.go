@@ -0,0 +1,121 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"trading-api/models"
+)
+
+// 支付網關的處理結果
+const (
+	PaymentSuccess  = "success"
+	PaymentFailed   = "failed"
+	RefundProcessed = "processed"
+)
+
+// 支付請求，OrderID 為出入金記錄ID
+type PaymentRequest struct {
+	OrderID  string         `json:"order_id"`
+	UserID   string         `json:"user_id"`
+	Amount   models.Decimal `json:"amount"`
+	Currency string         `json:"currency"`
+	Method   string         `json:"method"`
+}
+
+type PaymentResult struct {
+	PaymentID     string         `json:"payment_id"`
+	OrderID       string         `json:"order_id"`
+	Status        string         `json:"status"`
+	Amount        models.Decimal `json:"amount"`
+	Currency      string         `json:"currency"`
+	TransactionID string         `json:"transaction_id"`
+	ProcessedAt   time.Time      `json:"processed_at"`
+	Message       string         `json:"message"`
+}
+
+type RefundRequest struct {
+	PaymentID string         `json:"payment_id"`
+	Amount    models.Decimal `json:"amount"`
+	Reason    string         `json:"reason"`
+}
+
+type RefundResult struct {
+	RefundID    string         `json:"refund_id"`
+	PaymentID   string         `json:"payment_id"`
+	Amount      models.Decimal `json:"amount"`
+	Status      string         `json:"status"`
+	ProcessedAt time.Time      `json:"processed_at"`
+}
+
+// 支付網關：返回錯誤表示請求未得到處理結果，處理失敗以結果的 Status 表示
+type PaymentGateway interface {
+	Process(ctx context.Context, req PaymentRequest) (*PaymentResult, error)
+	Refund(ctx context.Context, req RefundRequest) (*RefundResult, error)
+}
+
+// payment-gateway 服務的HTTP客戶端
+type HTTPPaymentGateway struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewHTTPPaymentGateway(baseURL string, timeout time.Duration) *HTTPPaymentGateway {
+	return &HTTPPaymentGateway{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (g *HTTPPaymentGateway) Process(ctx context.Context, req PaymentRequest) (*PaymentResult, error) {
+	var result PaymentResult
+	if err := g.post(ctx, "/payment/process", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (g *HTTPPaymentGateway) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	var result RefundResult
+	if err := g.post(ctx, "/payment/refund", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (g *HTTPPaymentGateway) post(ctx context.Context, path string, body, dest interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", g.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPStatusError{Source: "payment-gateway", StatusCode: resp.StatusCode}
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("解析支付網關響應失敗: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,434 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+)
+
+// 績效曲線的數據粒度
+const (
+	PerformanceDaily    = "daily"    // 每個交易日一點，取當日最後一次快照
+	PerformanceIntraday = "intraday" // 交易時段內每次快照一點
+)
+
+// 每年交易日數，用於年化波動率及夏普比率
+const tradingDaysPerYear = 252
+
+// 有投資組合變動、需要定時估值的用戶
+const performanceUsersKey = "performance_users"
+
+func dailySnapshotsKey(userID string) string {
+	return fmt.Sprintf("performance_daily:%s", userID)
+}
+
+func intradaySnapshotsKey(userID string) string {
+	return fmt.Sprintf("performance_intraday:%s", userID)
+}
+
+// 投資組合估值快照
+type PerformanceSnapshot struct {
+	Time        time.Time      `json:"time"`
+	TotalValue  models.Decimal `json:"totalValue"`
+	CashBalance models.Decimal `json:"cashBalance"`
+	MarketValue models.Decimal `json:"marketValue"` // 持倉市值
+}
+
+// 績效曲線上的一點，收益率及回撤均為百分比
+type PerformancePoint struct {
+	Time             time.Time      `json:"time"`
+	Value            models.Decimal `json:"value"`
+	NetFlow          models.Decimal `json:"netFlow"`          // 與上一點之間的淨出入金
+	Return           float64        `json:"return"`           // 與上一點之間扣除出入金的收益率
+	CumulativeReturn float64        `json:"cumulativeReturn"` // 由起點累計的時間加權收益率
+	Drawdown         float64        `json:"drawdown"`         // 距前高的回撤
+}
+
+// 區間績效，收益率、回撤、波動率及無風險利率均為百分比
+type PerformanceReport struct {
+	UserID              string             `json:"userId"`
+	Interval            string             `json:"interval"`
+	From                time.Time          `json:"from"`
+	To                  time.Time          `json:"to"`
+	ResetAt             *time.Time         `json:"resetAt,omitempty"` // 區間內有帳戶重置時只計算重置之後
+	StartValue          models.Decimal     `json:"startValue"`
+	EndValue            models.Decimal     `json:"endValue"`
+	NetFlows            models.Decimal     `json:"netFlows"` // 淨入金，出金為負
+	Profit              models.Decimal     `json:"profit"`   // 扣除出入金後的損益
+	TimeWeightedReturn  float64            `json:"timeWeightedReturn"`
+	MoneyWeightedReturn *float64           `json:"moneyWeightedReturn"` // 區間內部收益率，無解時為null
+	MaxDrawdown         float64            `json:"maxDrawdown"`
+	Volatility          float64            `json:"volatility"`  // 按日收益率年化
+	SharpeRatio         *float64           `json:"sharpeRatio"` // 按日收益率年化，數據不足或波動率為0時為null
+	RiskFreeRate        float64            `json:"riskFreeRate"`
+	Points              []PerformancePoint `json:"points"`
+}
+
+type PerformanceOptions struct {
+	Intraday          bool          // 交易時段內同時保存日內快照
+	IntradayRetention time.Duration // 日內快照保留時間
+	RiskFreeRate      float64       // 年化無風險利率（百分比）
+}
+
+// 投資組合績效：定時估值並保存快照，按快照及賬本中的出入金計算收益率與風險指標
+type PerformanceService struct {
+	logger     *logrus.Logger
+	redis      *redis.Client
+	history    *TradingHistoryService
+	ledger     *LedgerService
+	marketData *MarketDataService
+	calendar   *TradingCalendar
+	opts       PerformanceOptions
+	tracked    sync.Map // 本進程已登記的用戶
+}
+
+func NewPerformanceService(logger *logrus.Logger, redisClient *redis.Client, history *TradingHistoryService,
+	ledger *LedgerService, marketData *MarketDataService, calendar *TradingCalendar, opts PerformanceOptions) *PerformanceService {
+	return &PerformanceService{
+		logger:     logger,
+		redis:      redisClient,
+		history:    history,
+		ledger:     ledger,
+		marketData: marketData,
+		calendar:   calendar,
+		opts:       opts,
+	}
+}
+
+// 登記需要定時估值的用戶，投資組合變動時調用
+func (s *PerformanceService) Track(userID string) {
+	if _, tracked := s.tracked.Load(userID); tracked {
+		return
+	}
+	if err := s.redis.SAdd(context.Background(), performanceUsersKey, userID).Err(); err != nil {
+		s.logger.WithError(err).WithField("user_id", userID).Warn("登記績效快照用戶失敗")
+		return
+	}
+	s.tracked.Store(userID, true)
+}
+
+// 為所有已登記用戶保存快照：交易日更新當日快照，交易時段內按配置另存日內快照
+func (s *PerformanceService) SnapshotAll(ctx context.Context, now time.Time) {
+	if !s.calendar.IsTradingDay(now) {
+		return
+	}
+	userIDs, err := s.redis.SMembers(ctx, performanceUsersKey).Result()
+	if err != nil {
+		s.logger.WithError(err).Error("讀取績效快照用戶失敗")
+		return
+	}
+
+	intraday := s.opts.Intraday && s.calendar.IsOpen(now)
+	for _, userID := range userIDs {
+		snapshot, err := s.Valuate(ctx, userID, now)
+		if err == nil {
+			err = s.save(ctx, userID, snapshot, intraday)
+		}
+		if err != nil {
+			s.logger.WithError(err).WithField("user_id", userID).Warn("保存績效快照失敗")
+		}
+	}
+}
+
+// 以最新報價估值；取不到報價的持倉沿用上次市價
+func (s *PerformanceService) Valuate(ctx context.Context, userID string, now time.Time) (*PerformanceSnapshot, error) {
+	portfolio, err := s.history.GetPortfolio(userID)
+	if err == ErrNotFound {
+		portfolio = NewPortfolio(userID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(portfolio.Positions) > 0 {
+		symbols := make([]string, 0, len(portfolio.Positions))
+		for symbol := range portfolio.Positions {
+			symbols = append(symbols, symbol)
+		}
+		quotes, _ := s.marketData.GetMultipleQuotes(ctx, symbols)
+		for symbol, position := range portfolio.Positions {
+			if quote, exists := quotes[symbol]; exists {
+				position.MarkToMarket(quote)
+			}
+		}
+	}
+
+	snapshot := &PerformanceSnapshot{Time: now, CashBalance: portfolio.CashBalance}
+	for _, position := range portfolio.Positions {
+		snapshot.MarketValue += position.MarketValue
+	}
+	snapshot.TotalValue = snapshot.CashBalance + snapshot.MarketValue
+	return snapshot, nil
+}
+
+func (s *PerformanceService) save(ctx context.Context, userID string, snapshot *PerformanceSnapshot, intraday bool) error {
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, dailySnapshotsKey(userID), s.tradingDate(snapshot.Time), snapshotJSON)
+		if intraday {
+			key := intradaySnapshotsKey(userID)
+			pipe.ZAdd(ctx, key, &redis.Z{Score: float64(snapshot.Time.UnixMilli()), Member: snapshotJSON})
+			if s.opts.IntradayRetention > 0 {
+				cutoff := snapshot.Time.Add(-s.opts.IntradayRetention).UnixMilli()
+				pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(cutoff, 10))
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *PerformanceService) tradingDate(t time.Time) string {
+	return t.In(s.calendar.Location).Format(calendarDateLayout)
+}
+
+// 計算 [from, to] 區間的績效；to 為零值或不早於當前時間時以實時估值作為最後一點
+func (s *PerformanceService) Performance(ctx context.Context, userID string, from, to time.Time, interval string) (*PerformanceReport, error) {
+	now := time.Now()
+	if to.IsZero() {
+		to = now
+	}
+	daily, err := s.dailySnapshots(ctx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	points := daily
+	if interval == PerformanceIntraday {
+		if points, err = s.intradaySnapshots(ctx, userID, from, to); err != nil {
+			return nil, err
+		}
+	}
+
+	if !to.Before(now) {
+		live, err := s.Valuate(ctx, userID, now)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(daily); n > 0 && s.tradingDate(daily[n-1].Time) == s.tradingDate(now) {
+			daily = daily[:n-1]
+		}
+		daily = append(daily, *live)
+		if interval == PerformanceIntraday {
+			points = append(points, *live)
+		} else {
+			points = daily
+		}
+	}
+
+	flows, err := s.ledger.ExternalFlows(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PerformanceReport{
+		UserID:       userID,
+		Interval:     interval,
+		From:         from,
+		To:           to,
+		RiskFreeRate: s.opts.RiskFreeRate,
+		Points:       make([]PerformancePoint, 0, len(points)),
+	}
+	if len(points) == 0 {
+		return report, nil
+	}
+
+	// 帳戶重置不是投資收益，重置之前的快照不參與計算
+	for _, flow := range flows {
+		if flow.Type == EntryReset && flow.PostedAt.After(points[0].Time) && !flow.PostedAt.After(points[len(points)-1].Time) {
+			resetAt := flow.PostedAt
+			report.ResetAt = &resetAt
+		}
+	}
+	if report.ResetAt != nil {
+		points = snapshotsAfter(points, *report.ResetAt)
+		daily = snapshotsAfter(daily, *report.ResetAt)
+		if len(points) == 0 {
+			return report, nil
+		}
+	}
+
+	first, last := points[0], points[len(points)-1]
+	report.Points = performancePoints(points, flows)
+	report.StartValue = first.TotalValue
+	report.EndValue = last.TotalValue
+	for _, flow := range flows {
+		if flow.PostedAt.After(first.Time) && !flow.PostedAt.After(last.Time) {
+			report.NetFlows += flow.Amount
+		}
+	}
+	report.Profit = report.EndValue - report.StartValue - report.NetFlows
+
+	for _, point := range report.Points {
+		report.MaxDrawdown = math.Max(report.MaxDrawdown, point.Drawdown)
+	}
+	report.TimeWeightedReturn = report.Points[len(report.Points)-1].CumulativeReturn
+	if mwr, ok := moneyWeightedReturn(first, last, flows); ok {
+		report.MoneyWeightedReturn = &mwr
+	}
+
+	dailyPoints := performancePoints(daily, flows)
+	returns := make([]float64, 0, len(dailyPoints))
+	for i := 1; i < len(dailyPoints); i++ {
+		returns = append(returns, dailyPoints[i].Return/100)
+	}
+	report.Volatility, report.SharpeRatio = riskMetrics(returns, s.opts.RiskFreeRate/100)
+	return report, nil
+}
+
+func (s *PerformanceService) dailySnapshots(ctx context.Context, userID string, from, to time.Time) ([]PerformanceSnapshot, error) {
+	values, err := s.redis.HGetAll(ctx, dailySnapshotsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]PerformanceSnapshot, 0, len(values))
+	for _, value := range values {
+		var snapshot PerformanceSnapshot
+		if err := json.Unmarshal([]byte(value), &snapshot); err != nil {
+			continue
+		}
+		if snapshot.Time.Before(from) || snapshot.Time.After(to) {
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.Before(snapshots[j].Time) })
+	return snapshots, nil
+}
+
+func (s *PerformanceService) intradaySnapshots(ctx context.Context, userID string, from, to time.Time) ([]PerformanceSnapshot, error) {
+	values, err := s.redis.ZRangeByScore(ctx, intradaySnapshotsKey(userID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.UnixMilli(), 10),
+		Max: strconv.FormatInt(to.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]PerformanceSnapshot, 0, len(values))
+	for _, value := range values {
+		var snapshot PerformanceSnapshot
+		if err := json.Unmarshal([]byte(value), &snapshot); err == nil {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+func snapshotsAfter(snapshots []PerformanceSnapshot, t time.Time) []PerformanceSnapshot {
+	idx := sort.Search(len(snapshots), func(i int) bool { return snapshots[i].Time.After(t) })
+	return snapshots[idx:]
+}
+
+// 逐段計算收益率：出入金視作在段末發生，段收益率 = (期末值 - 出入金) / 期初值 - 1，
+// 各段連乘得到時間加權收益率，回撤按累計收益率指數計算
+func performancePoints(snapshots []PerformanceSnapshot, flows []ExternalFlow) []PerformancePoint {
+	points := make([]PerformancePoint, 0, len(snapshots))
+	if len(snapshots) == 0 {
+		return points
+	}
+
+	j := 0
+	for j < len(flows) && !flows[j].PostedAt.After(snapshots[0].Time) {
+		j++
+	}
+	index, peak := 1.0, 1.0
+	points = append(points, PerformancePoint{Time: snapshots[0].Time, Value: snapshots[0].TotalValue})
+	for i := 1; i < len(snapshots); i++ {
+		var flow models.Decimal
+		for j < len(flows) && !flows[j].PostedAt.After(snapshots[i].Time) {
+			flow += flows[j].Amount
+			j++
+		}
+
+		r := 0.0
+		if previous := snapshots[i-1].TotalValue; previous > 0 {
+			r = (snapshots[i].TotalValue-flow).Float64()/previous.Float64() - 1
+		}
+		index *= 1 + r
+		peak = math.Max(peak, index)
+		points = append(points, PerformancePoint{
+			Time:             snapshots[i].Time,
+			Value:            snapshots[i].TotalValue,
+			NetFlow:          flow,
+			Return:           r * 100,
+			CumulativeReturn: (index - 1) * 100,
+			Drawdown:         (peak - index) / peak * 100,
+		})
+	}
+	return points
+}
+
+// 區間內部收益率（百分比）：求 R 使 期初值×(1+R) + Σ 出入金×(1+R)^w = 期末值，
+// w 為出入金之後剩餘時間佔整個區間的比例。以二分法求解，無解時返回 false
+func moneyWeightedReturn(first, last PerformanceSnapshot, flows []ExternalFlow) (float64, bool) {
+	span := last.Time.Sub(first.Time).Seconds()
+	if span <= 0 || first.TotalValue <= 0 {
+		return 0, false
+	}
+
+	npv := func(r float64) float64 {
+		value := first.TotalValue.Float64() * (1 + r)
+		for _, flow := range flows {
+			if flow.PostedAt.After(first.Time) && !flow.PostedAt.After(last.Time) {
+				weight := last.Time.Sub(flow.PostedAt).Seconds() / span
+				value += flow.Amount.Float64() * math.Pow(1+r, weight)
+			}
+		}
+		return value - last.TotalValue.Float64()
+	}
+
+	lo, hi := -0.999999, 1.0
+	for npv(hi) < 0 && hi < 1e6 {
+		hi *= 2
+	}
+	if npv(lo) > 0 || npv(hi) < 0 {
+		return 0, false
+	}
+	for i := 0; i < 200 && hi-lo > 1e-12; i++ {
+		mid := (lo + hi) / 2
+		if npv(mid) < 0 {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2 * 100, true
+}
+
+// 以日收益率計算年化波動率（百分比）及夏普比率，riskFreeRate 為年化無風險利率（小數）
+func riskMetrics(returns []float64, riskFreeRate float64) (float64, *float64) {
+	if len(returns) < 2 {
+		return 0, nil
+	}
+
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(returns)-1))
+	annualization := math.Sqrt(tradingDaysPerYear)
+
+	if stddev == 0 {
+		return 0, nil
+	}
+	sharpe := (mean - riskFreeRate/tradingDaysPerYear) / stddev * annualization
+	return stddev * annualization * 100, &sharpe
+}
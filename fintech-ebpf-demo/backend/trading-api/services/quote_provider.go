@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 行情來源
+type QuoteProvider interface {
+	// 來源名稱，寫入 StockQuote.Source
+	Name() string
+	FetchQuote(ctx context.Context, symbol string) (*StockQuote, error)
+	// 獲取 [from, to) 內的K線，不支持該週期時返回 ErrUnsupportedInterval
+	FetchCandles(ctx context.Context, symbol string, interval time.Duration, from, to time.Time) ([]Candle, error)
+}
+
+// 主來源失敗時改用備用來源；網絡不可達時在 retryAfter 內直接使用備用來源
+type FallbackQuoteProvider struct {
+	logger     *logrus.Logger
+	primary    QuoteProvider
+	fallback   QuoteProvider
+	retryAfter time.Duration
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+func NewFallbackQuoteProvider(logger *logrus.Logger, primary, fallback QuoteProvider, retryAfter time.Duration) *FallbackQuoteProvider {
+	return &FallbackQuoteProvider{
+		logger:     logger,
+		primary:    primary,
+		fallback:   fallback,
+		retryAfter: retryAfter,
+	}
+}
+
+func (p *FallbackQuoteProvider) Name() string {
+	return p.primary.Name() + "+" + p.fallback.Name()
+}
+
+func (p *FallbackQuoteProvider) FetchQuote(ctx context.Context, symbol string) (*StockQuote, error) {
+	if p.primaryAvailable() {
+		quote, err := p.primary.FetchQuote(ctx, symbol)
+		if err == nil {
+			return quote, nil
+		}
+		p.primaryFailed(err, symbol)
+	}
+	return p.fallback.FetchQuote(ctx, symbol)
+}
+
+func (p *FallbackQuoteProvider) FetchCandles(ctx context.Context, symbol string, interval time.Duration, from, to time.Time) ([]Candle, error) {
+	if p.primaryAvailable() {
+		candles, err := p.primary.FetchCandles(ctx, symbol, interval, from, to)
+		if err == nil || errors.Is(err, ErrUnsupportedInterval) {
+			return candles, err
+		}
+		p.primaryFailed(err, symbol)
+	}
+	return p.fallback.FetchCandles(ctx, symbol, interval, from, to)
+}
+
+func (p *FallbackQuoteProvider) primaryAvailable() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !time.Now().Before(p.downUntil)
+}
+
+func (p *FallbackQuoteProvider) primaryFailed(err error, symbol string) {
+	fields := logrus.Fields{"symbol": symbol, "provider": p.primary.Name(), "fallback": p.fallback.Name()}
+	if isUnreachable(err) {
+		p.mu.Lock()
+		p.downUntil = time.Now().Add(p.retryAfter)
+		p.mu.Unlock()
+		p.logger.WithError(err).WithFields(fields).Warnf("行情來源不可達，%s內改用備用來源", p.retryAfter)
+		return
+	}
+	p.logger.WithError(err).WithFields(fields).Warn("行情來源返回錯誤，改用備用來源")
+}
+
+// 連接失敗、DNS解析失敗、超時或已熔斷
+func isUnreachable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrCircuitOpen)
+}
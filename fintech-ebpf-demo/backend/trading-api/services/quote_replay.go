@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 按歷史數據文件回放行情，到達末尾後從頭循環
+// 回放時間 = 文件中最早的時間 + 啟動後經過的時間 × speed
+type ReplayQuoteProvider struct {
+	series map[string][]replayBar
+	origin time.Time     // 文件中最早的時間
+	span   time.Duration // 文件覆蓋的時間長度
+	step   time.Duration // 相鄰兩行的最小間隔，即數據粒度
+	speed  float64
+	start  time.Time
+	now    func() time.Time
+}
+
+// 文件中的一行
+type replayBar struct {
+	Candle
+	PreviousClose float64 // 上一交易日最後收盤價，載入時計算
+}
+
+// 支持的時間格式，亦可使用Unix秒
+var replayTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// 讀取CSV文件，首行為表頭：timestamp、symbol、close（或 price）必需，open、high、low、volume 可選
+func NewReplayQuoteProvider(path string, speed float64) (*ReplayQuoteProvider, error) {
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".csv" {
+		return nil, fmt.Errorf("不支持的回放文件格式 %s，請轉換為CSV", ext)
+	}
+	if speed <= 0 {
+		speed = 1
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	series, err := readReplayCSV(file)
+	if err != nil {
+		return nil, fmt.Errorf("讀取回放文件 %s 失敗: %w", path, err)
+	}
+	if len(series) == 0 {
+		return nil, fmt.Errorf("回放文件 %s 沒有數據", path)
+	}
+
+	provider := &ReplayQuoteProvider{
+		series: series,
+		speed:  speed,
+		start:  time.Now(),
+		now:    time.Now,
+	}
+	var last time.Time
+	for _, bars := range series {
+		if provider.origin.IsZero() || bars[0].Time.Before(provider.origin) {
+			provider.origin = bars[0].Time
+		}
+		if end := bars[len(bars)-1].Time; end.After(last) {
+			last = end
+		}
+		for i := 1; i < len(bars); i++ {
+			if gap := bars[i].Time.Sub(bars[i-1].Time); gap > 0 && (provider.step == 0 || gap < provider.step) {
+				provider.step = gap
+			}
+		}
+	}
+	provider.span = last.Sub(provider.origin)
+	return provider, nil
+}
+
+func readReplayCSV(r io.Reader) (map[string][]replayBar, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["close"]; !ok {
+		if i, ok := columns["price"]; ok {
+			columns["close"] = i
+		}
+	}
+	for _, required := range []string{"timestamp", "symbol", "close"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("缺少 %s 欄位", required)
+		}
+	}
+
+	series := make(map[string][]replayBar)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		symbol, bar, err := parseReplayRecord(record, columns)
+		if err != nil {
+			return nil, fmt.Errorf("第%d行: %w", line, err)
+		}
+		series[symbol] = append(series[symbol], bar)
+	}
+
+	for _, bars := range series {
+		sort.Slice(bars, func(i, j int) bool { return bars[i].Time.Before(bars[j].Time) })
+		previousClose, lastClose := bars[0].Open, bars[0].Open
+		for i := range bars {
+			if i > 0 && !marketDay(bars[i].Time).Equal(marketDay(bars[i-1].Time)) {
+				previousClose = lastClose
+			}
+			bars[i].PreviousClose = previousClose
+			lastClose = bars[i].Close
+		}
+	}
+	return series, nil
+}
+
+func parseReplayRecord(record []string, columns map[string]int) (string, replayBar, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	number := func(name string) (float64, error) {
+		value := field(name)
+		if value == "" {
+			return 0, nil
+		}
+		return strconv.ParseFloat(value, 64)
+	}
+
+	var bar replayBar
+	var err error
+	symbol := strings.ToUpper(field("symbol"))
+	if symbol == "" {
+		return "", bar, fmt.Errorf("缺少股票代碼")
+	}
+	if bar.Time, err = parseReplayTime(field("timestamp")); err != nil {
+		return "", bar, err
+	}
+	if bar.Close, err = number("close"); err != nil || bar.Close <= 0 {
+		return "", bar, fmt.Errorf("無效的收盤價 %q", field("close"))
+	}
+	for name, dest := range map[string]*float64{"open": &bar.Open, "high": &bar.High, "low": &bar.Low} {
+		if *dest, err = number(name); err != nil {
+			return "", bar, fmt.Errorf("無效的%s %q", name, field(name))
+		}
+		if *dest <= 0 {
+			*dest = bar.Close
+		}
+	}
+	if volume := field("volume"); volume != "" {
+		parsed, err := strconv.ParseFloat(volume, 64)
+		if err != nil {
+			return "", bar, fmt.Errorf("無效的成交量 %q", volume)
+		}
+		bar.Volume = int64(parsed)
+	}
+	return symbol, bar, nil
+}
+
+func parseReplayTime(value string) (time.Time, error) {
+	for _, layout := range replayTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, marketLocation); err == nil {
+			return t, nil
+		}
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("無效的時間 %q", value)
+}
+
+func (p *ReplayQuoteProvider) Name() string {
+	return "replay"
+}
+
+func (p *ReplayQuoteProvider) FetchQuote(ctx context.Context, symbol string) (*StockQuote, error) {
+	symbol = strings.ToUpper(symbol)
+	bars, exists := p.series[symbol]
+	if !exists {
+		return nil, fmt.Errorf("回放數據中沒有股票: %s", symbol)
+	}
+
+	now := p.now()
+	var offset time.Duration
+	if p.span > 0 {
+		offset = time.Duration(float64(now.Sub(p.start))*p.speed) % (p.span + time.Nanosecond)
+	}
+	at := p.origin.Add(offset)
+
+	// 回放時間之前最後一行；尚未開始時使用第一行
+	i := sort.Search(len(bars), func(i int) bool { return bars[i].Time.After(at) }) - 1
+	if i < 0 {
+		i = 0
+	}
+	bar := bars[i]
+
+	quote := &StockQuote{
+		Symbol:       symbol,
+		Volume:       bar.Volume,
+		LastUpdated:  now,
+		IsMarketOpen: isRegularSession(bar.Time),
+		Currency:     "USD",
+		Exchange:     "REPLAY",
+		CompanyName:  symbol,
+		Source:       p.Name(),
+	}
+	if err := quote.setPrices(bar.Close, bar.PreviousClose, bar.Open, bar.High, bar.Low); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// 按文件中的原始時間返回K線；週期大於數據粒度時返回 ErrUnsupportedInterval，由小週期聚合
+func (p *ReplayQuoteProvider) FetchCandles(ctx context.Context, symbol string, interval time.Duration, from, to time.Time) ([]Candle, error) {
+	if p.step > 0 && interval > p.step {
+		return nil, ErrUnsupportedInterval
+	}
+
+	symbol = strings.ToUpper(symbol)
+	bars, exists := p.series[symbol]
+	if !exists {
+		return nil, fmt.Errorf("回放數據中沒有股票: %s", symbol)
+	}
+
+	first := sort.Search(len(bars), func(i int) bool { return !bars[i].Time.Before(from) })
+	rows := make([]Candle, 0)
+	for _, bar := range bars[first:] {
+		if !bar.Time.Before(to) {
+			break
+		}
+		rows = append(rows, bar.Candle)
+	}
+	return rows, nil
+}
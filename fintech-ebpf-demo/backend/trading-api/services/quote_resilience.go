@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"trading-api/metrics"
+)
+
+// 熔斷器狀態
+const (
+	BreakerClosed   = "closed"
+	BreakerHalfOpen = "half_open"
+	BreakerOpen     = "open"
+)
+
+// 熔斷期間直接拒絕上游請求
+var ErrCircuitOpen = errors.New("行情來源暫時熔斷")
+
+// 上游返回的非200狀態碼
+type HTTPStatusError struct {
+	Source     string
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s 返回狀態碼: %d", e.Source, e.StatusCode)
+}
+
+// 上游不可用：網絡錯誤、超時、限流或服務端錯誤；其餘錯誤（如代碼不存在）說明上游仍可用
+func isUpstreamFailure(err error) bool {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == 429 || statusErr.StatusCode >= 500
+	}
+	return isUnreachable(err)
+}
+
+// 熔斷器：連續失敗達到閾值後熔斷，冷卻期滿後放行一個試探請求，成功則恢復
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	onChange  func(state string)
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration, onChange func(state string)) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		onChange:  onChange,
+		state:     BreakerClosed,
+	}
+}
+
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// 是否放行請求；放行後必須調用 Success、Failure 或 Release 之一
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	if b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+	b.setState(BreakerClosed)
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// 請求被調用方取消，結果不計入熔斷
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *CircuitBreaker) setState(state string) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(state)
+	}
+}
+
+// 令牌桶限流，每秒補充 rate 個令牌，最多積累 burst 個
+type TokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// 取得一個令牌，不足時等待；ctx 結束時返回其錯誤
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// 外部行情來源的保護參數
+type ResilienceOptions struct {
+	Timeout          time.Duration // 單次請求超時，0為只受調用方 ctx 限制
+	MaxRetries       int           // 上游失敗後的重試次數
+	RetryBackoff     time.Duration // 首次重試的基準等待，之後每次加倍並加入隨機抖動
+	RateLimit        float64       // 每秒最多請求數，0為不限制
+	RateBurst        int
+	BreakerThreshold int           // 連續失敗多少次後熔斷
+	BreakerCooldown  time.Duration // 熔斷後多久放行試探請求
+}
+
+// 為外部行情來源加上超時、重試、限流及熔斷；超時以調用方 ctx 為上限
+type ResilientQuoteProvider struct {
+	logger   *logrus.Logger
+	provider QuoteProvider
+	opts     ResilienceOptions
+	breaker  *CircuitBreaker
+	limiter  *TokenBucket // RateLimit 為0時為nil
+}
+
+func NewResilientQuoteProvider(logger *logrus.Logger, provider QuoteProvider, opts ResilienceOptions) *ResilientQuoteProvider {
+	p := &ResilientQuoteProvider{
+		logger:   logger,
+		provider: provider,
+		opts:     opts,
+	}
+	p.breaker = NewCircuitBreaker(opts.BreakerThreshold, opts.BreakerCooldown, p.breakerChanged)
+	if opts.RateLimit > 0 {
+		p.limiter = NewTokenBucket(opts.RateLimit, opts.RateBurst)
+	}
+	metrics.MarketDataBreakerState.WithLabelValues(provider.Name()).Set(0)
+	return p
+}
+
+func (p *ResilientQuoteProvider) Name() string {
+	return p.provider.Name()
+}
+
+func (p *ResilientQuoteProvider) BreakerState() string {
+	return p.breaker.State()
+}
+
+func (p *ResilientQuoteProvider) FetchQuote(ctx context.Context, symbol string) (*StockQuote, error) {
+	var quote *StockQuote
+	err := p.call(ctx, symbol, func(ctx context.Context) error {
+		var err error
+		quote, err = p.provider.FetchQuote(ctx, symbol)
+		return err
+	})
+	return quote, err
+}
+
+func (p *ResilientQuoteProvider) FetchCandles(ctx context.Context, symbol string, interval time.Duration, from, to time.Time) ([]Candle, error) {
+	var candles []Candle
+	err := p.call(ctx, symbol, func(ctx context.Context) error {
+		var err error
+		candles, err = p.provider.FetchCandles(ctx, symbol, interval, from, to)
+		return err
+	})
+	return candles, err
+}
+
+// 執行上游請求，僅對上游不可用的錯誤重試
+func (p *ResilientQuoteProvider) call(ctx context.Context, symbol string, fn func(ctx context.Context) error) error {
+	name := p.provider.Name()
+	var err error
+	for attempt := 0; attempt <= p.opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			metrics.MarketDataRetries.WithLabelValues(name).Inc()
+			if sleepErr := sleepContext(ctx, p.backoff(attempt)); sleepErr != nil {
+				return err
+			}
+		}
+
+		if !p.breaker.Allow() {
+			metrics.MarketDataRequests.WithLabelValues(name, "rejected").Inc()
+			return ErrCircuitOpen
+		}
+		if p.limiter != nil {
+			if waitErr := p.limiter.Wait(ctx); waitErr != nil {
+				p.breaker.Release()
+				return waitErr
+			}
+		}
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if p.opts.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, p.opts.Timeout)
+		}
+		start := time.Now()
+		err = fn(attemptCtx)
+		cancel()
+		metrics.MarketDataLatency.WithLabelValues(name).Observe(time.Since(start).Seconds())
+
+		switch {
+		case err == nil:
+			p.breaker.Success()
+			metrics.MarketDataRequests.WithLabelValues(name, "success").Inc()
+			return nil
+		case ctx.Err() != nil:
+			// 調用方已取消或超時，不計入熔斷
+			p.breaker.Release()
+			metrics.MarketDataRequests.WithLabelValues(name, "canceled").Inc()
+			return err
+		case !isUpstreamFailure(err):
+			p.breaker.Success()
+			metrics.MarketDataRequests.WithLabelValues(name, "error").Inc()
+			return err
+		}
+
+		p.breaker.Failure()
+		metrics.MarketDataRequests.WithLabelValues(name, "failure").Inc()
+		p.logger.WithError(err).WithFields(logrus.Fields{
+			"provider": name,
+			"symbol":   symbol,
+			"attempt":  attempt + 1,
+		}).Debug("行情來源請求失敗")
+	}
+	return err
+}
+
+// 指數退避加隨機抖動：基準等待的一半固定，另一半隨機
+func (p *ResilientQuoteProvider) backoff(attempt int) time.Duration {
+	base := p.opts.RetryBackoff << (attempt - 1)
+	if base <= 0 {
+		return 0
+	}
+	return base/2 + time.Duration(rand.Int63n(int64(base/2)+1))
+}
+
+func (p *ResilientQuoteProvider) breakerChanged(state string) {
+	name := p.provider.Name()
+	value := map[string]float64{BreakerClosed: 0, BreakerHalfOpen: 1, BreakerOpen: 2}[state]
+	metrics.MarketDataBreakerState.WithLabelValues(name).Set(value)
+
+	entry := p.logger.WithFields(logrus.Fields{"provider": name, "state": state})
+	if state == BreakerOpen {
+		entry.Warnf("行情來源連續失敗，熔斷%s", p.opts.BreakerCooldown)
+		return
+	}
+	entry.Info("行情來源熔斷狀態變更")
+}
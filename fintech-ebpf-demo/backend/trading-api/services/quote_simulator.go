@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 模擬股票的價格過程參數，漂移率和波動率均為年化值
+type SimulatedSymbol struct {
+	Price      float64 // 初始價格
+	Drift      float64
+	Volatility float64
+}
+
+const (
+	sessionMinutes = 390 // 常規交易時段分鐘數，提前收盤日較短
+	tradingDays    = 252 // 每年交易日
+)
+
+// 支持股票的默認參數，未列出的股票按代碼生成
+var defaultSimulatedSymbols = map[string]SimulatedSymbol{
+	"AAPL":  {Price: 190, Drift: 0.08, Volatility: 0.25},
+	"GOOGL": {Price: 140, Drift: 0.08, Volatility: 0.28},
+	"MSFT":  {Price: 380, Drift: 0.08, Volatility: 0.24},
+	"AMZN":  {Price: 150, Drift: 0.10, Volatility: 0.32},
+	"TSLA":  {Price: 240, Drift: 0.12, Volatility: 0.55},
+	"META":  {Price: 350, Drift: 0.10, Volatility: 0.38},
+	"NFLX":  {Price: 480, Drift: 0.09, Volatility: 0.40},
+	"NVDA":  {Price: 480, Drift: 0.15, Volatility: 0.50},
+	"JPM":   {Price: 170, Drift: 0.06, Volatility: 0.22},
+	"JNJ":   {Price: 155, Drift: 0.04, Volatility: 0.15},
+	"V":     {Price: 260, Drift: 0.07, Volatility: 0.20},
+	"PG":    {Price: 150, Drift: 0.04, Volatility: 0.15},
+	"MA":    {Price: 420, Drift: 0.07, Volatility: 0.22},
+	"UNH":   {Price: 520, Drift: 0.06, Volatility: 0.22},
+	"HD":    {Price: 340, Drift: 0.06, Volatility: 0.24},
+	"DIS":   {Price: 90, Drift: 0.05, Volatility: 0.30},
+	"PYPL":  {Price: 60, Drift: 0.05, Volatility: 0.40},
+	"BAC":   {Price: 33, Drift: 0.05, Volatility: 0.28},
+	"VZ":    {Price: 38, Drift: 0.03, Volatility: 0.18},
+	"ADBE":  {Price: 560, Drift: 0.08, Volatility: 0.32},
+}
+
+// 以幾何布朗運動生成行情，不依賴網絡
+// 每日收盤價按日收益率遞推，日內以布朗橋連接開盤與收盤，分鐘之間線性插值
+// 價格只由種子、股票代碼和時間決定，因此實時報價與歷史K線一致；休市期間價格不變
+// 啟動當天的昨收即為配置的初始價格
+type SimulatedQuoteProvider struct {
+	seed    int64
+	step    time.Duration
+	anchor  time.Time // 啟動當天（美東日期）
+	symbols map[string]SimulatedSymbol
+	now     func() time.Time
+
+	mu     sync.Mutex
+	series map[string]*simulatedSeries
+}
+
+// 單個股票的價格序列，按相對 anchor 的天數緩存
+type simulatedSeries struct {
+	params  SimulatedSymbol
+	key     uint64
+	anchor  time.Time
+	closes  map[int]float64   // 每日收盤價
+	minutes map[int][]float64 // 日內每分鐘末的價格，下標0為開盤價
+}
+
+// symbols 覆蓋默認參數；報價按 step 取整，不超過一分鐘
+func NewSimulatedQuoteProvider(seed int64, step time.Duration, symbols map[string]SimulatedSymbol) *SimulatedQuoteProvider {
+	if step <= 0 || step > time.Minute {
+		step = time.Second
+	}
+	params := make(map[string]SimulatedSymbol, len(defaultSimulatedSymbols)+len(symbols))
+	for symbol, p := range defaultSimulatedSymbols {
+		params[symbol] = p
+	}
+	for symbol, p := range symbols {
+		params[strings.ToUpper(symbol)] = p
+	}
+
+	return &SimulatedQuoteProvider{
+		seed:    seed,
+		step:    step,
+		anchor:  marketDay(time.Now()),
+		symbols: params,
+		now:     time.Now,
+		series:  make(map[string]*simulatedSeries),
+	}
+}
+
+func (p *SimulatedQuoteProvider) Name() string {
+	return "simulator"
+}
+
+func (p *SimulatedQuoteProvider) FetchQuote(ctx context.Context, symbol string) (*StockQuote, error) {
+	symbol = strings.ToUpper(symbol)
+	now := p.now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.seriesFor(symbol)
+	day, elapsed := p.lastSession(now)
+	length := sessionLength(p.anchor.AddDate(0, 0, day))
+	bar, _ := p.sessionCandle(s, day, 0, length, elapsed.Truncate(p.step))
+
+	quote := &StockQuote{
+		Symbol:       symbol,
+		Volume:       bar.Volume,
+		LastUpdated:  now,
+		IsMarketOpen: isRegularSession(now),
+		Currency:     "USD",
+		Exchange:     "SIM",
+		CompanyName:  symbol,
+		Source:       p.Name(),
+	}
+	if err := quote.setPrices(roundPrice(bar.Close), roundPrice(s.close(day-1)), roundPrice(bar.Open), roundPrice(bar.High), roundPrice(bar.Low)); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// 日內K線按開盤時間對齊，日K線的時間為美東零點；包含尚未完成的當前K線
+func (p *SimulatedQuoteProvider) FetchCandles(ctx context.Context, symbol string, interval time.Duration, from, to time.Time) ([]Candle, error) {
+	symbol = strings.ToUpper(symbol)
+	now := p.now()
+	if to.After(now) {
+		to = now
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.seriesFor(symbol)
+	candles := make([]Candle, 0)
+	width := int(interval / time.Minute)
+	for day := p.dayOffset(from); day <= p.dayOffset(to); day++ {
+		date := p.anchor.AddDate(0, 0, day)
+		if !isTradingDay(date) {
+			continue
+		}
+		open, length := sessionOpen(date), sessionLength(date)
+		cutoff := min(now.Sub(open), time.Duration(length)*time.Minute)
+
+		if interval >= 24*time.Hour {
+			if bar, ok := p.sessionCandle(s, day, 0, length, cutoff); ok && !date.Before(from) && date.Before(to) {
+				bar.Time = date
+				candles = append(candles, bar)
+			}
+			continue
+		}
+		for first := 0; first < length; first += width {
+			start := open.Add(time.Duration(first) * time.Minute)
+			if start.Before(from) {
+				continue
+			}
+			if !start.Before(to) {
+				break
+			}
+			bar, ok := p.sessionCandle(s, day, first, min(first+width, length), cutoff)
+			if !ok {
+				break
+			}
+			bar.Time = start
+			candles = append(candles, bar)
+		}
+	}
+	return candles, nil
+}
+
+func (p *SimulatedQuoteProvider) seriesFor(symbol string) *simulatedSeries {
+	if s, exists := p.series[symbol]; exists {
+		return s
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(symbol))
+	key := h.Sum64() ^ uint64(p.seed)
+
+	params, exists := p.symbols[symbol]
+	if !exists {
+		// 未配置的股票：由代碼決定初始價格，使用中等波動率
+		params = SimulatedSymbol{Price: 20 + float64(h.Sum64()%48000)/100, Drift: 0.06, Volatility: 0.30}
+	}
+
+	s := &simulatedSeries{
+		params:  params,
+		key:     key,
+		anchor:  p.anchor,
+		closes:  map[int]float64{-1: params.Price},
+		minutes: make(map[int][]float64),
+	}
+	p.series[symbol] = s
+	return s
+}
+
+func (p *SimulatedQuoteProvider) dayOffset(t time.Time) int {
+	return int(math.Round(marketDay(t).Sub(p.anchor).Hours() / 24))
+}
+
+// 最近一個已開盤的交易日及其開盤後經過的時間（收盤後為整個交易時段）
+func (p *SimulatedQuoteProvider) lastSession(now time.Time) (int, time.Duration) {
+	day := p.dayOffset(now)
+	for {
+		date := p.anchor.AddDate(0, 0, day)
+		if open := sessionOpen(date); isTradingDay(date) && !now.Before(open) {
+			return day, min(now.Sub(open), time.Duration(sessionLength(date))*time.Minute)
+		}
+		day--
+	}
+}
+
+// 匯總日內第 first 至 last 分鐘的價格，只計入開盤後 cutoff 以內的部分
+func (p *SimulatedQuoteProvider) sessionCandle(s *simulatedSeries, day, first, last int, cutoff time.Duration) (Candle, bool) {
+	end := min(float64(last), cutoff.Minutes())
+	if end <= float64(first) {
+		return Candle{}, false
+	}
+	prices := s.minutePrices(day)
+
+	bar := Candle{Open: prices[first], High: prices[first], Low: prices[first]}
+	whole := int(end)
+	for i := first + 1; i <= whole; i++ {
+		bar.High = math.Max(bar.High, prices[i])
+		bar.Low = math.Min(bar.Low, prices[i])
+		bar.Volume += s.minuteVolume(day, i)
+	}
+	bar.Close = prices[whole]
+	if frac := end - float64(whole); frac > 0 {
+		bar.Close += (prices[whole+1] - prices[whole]) * frac
+		bar.High = math.Max(bar.High, bar.Close)
+		bar.Low = math.Min(bar.Low, bar.Close)
+		bar.Volume += int64(float64(s.minuteVolume(day, whole+1)) * frac)
+	}
+	return bar, true
+}
+
+// 第 day 天的收盤價；非交易日沿用前一天
+func (s *simulatedSeries) close(day int) float64 {
+	if c, exists := s.closes[day]; exists {
+		return c
+	}
+	// 從已知的相鄰日期向外遞推
+	if day >= 0 {
+		known := day
+		for _, exists := s.closes[known-1]; !exists; _, exists = s.closes[known-1] {
+			known--
+		}
+		for i := known; i <= day; i++ {
+			s.closes[i] = s.closes[i-1] * s.dailyGrowth(i)
+		}
+	} else {
+		known := day
+		for _, exists := s.closes[known+1]; !exists; _, exists = s.closes[known+1] {
+			known++
+		}
+		for i := known; i >= day; i-- {
+			s.closes[i] = s.closes[i+1] / s.dailyGrowth(i+1)
+		}
+	}
+	return s.closes[day]
+}
+
+// 第 day 天收盤價相對前一天的倍數
+func (s *simulatedSeries) dailyGrowth(day int) float64 {
+	if !isTradingDay(s.anchor.AddDate(0, 0, day)) {
+		return 1
+	}
+	mu, sigma := s.params.Drift, s.params.Volatility
+	dt := 1.0 / tradingDays
+	return math.Exp((mu-sigma*sigma/2)*dt + sigma*math.Sqrt(dt)*s.normal(day, -1))
+}
+
+// 第 day 天每分鐘末的價格：以布朗橋連接昨收與當日收盤
+func (s *simulatedSeries) minutePrices(day int) []float64 {
+	if prices, exists := s.minutes[day]; exists {
+		return prices
+	}
+
+	logOpen, logClose := math.Log(s.close(day-1)), math.Log(s.close(day))
+	length := sessionLength(s.anchor.AddDate(0, 0, day))
+	walk := make([]float64, length+1)
+	for i := 1; i <= length; i++ {
+		walk[i] = walk[i-1] + s.normal(day, i)
+	}
+	sd := s.params.Volatility * math.Sqrt(1.0/(tradingDays*sessionMinutes))
+
+	prices := make([]float64, length+1)
+	for i := range prices {
+		f := float64(i) / float64(length)
+		prices[i] = math.Exp(logOpen + f*(logClose-logOpen) + sd*(walk[i]-f*walk[length]))
+	}
+
+	// 只保留最近使用的若干天
+	if len(s.minutes) >= 64 {
+		s.minutes = make(map[int][]float64)
+	}
+	s.minutes[day] = prices
+	return prices
+}
+
+func (s *simulatedSeries) minuteVolume(day, minute int) int64 {
+	return int64(100 * (1 + mix(s.key, day, minute, 1)%50))
+}
+
+// 由股票、日期和分鐘決定的標準正態隨機數（Box-Muller）
+func (s *simulatedSeries) normal(day, minute int) float64 {
+	u1 := (float64(mix(s.key, day, minute, 2)>>11) + 0.5) / (1 << 53)
+	u2 := float64(mix(s.key, day, minute, 3)>>11) / (1 << 53)
+	return math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2)
+}
+
+// splitmix64 混合，作為可隨機訪問的偽隨機數
+func mix(key uint64, day, minute, salt int) uint64 {
+	x := key ^ uint64(int64(day))*0x9E3779B97F4A7C15 ^ uint64(int64(minute))*0xBF58476D1CE4E5B9 ^ uint64(salt)*0x94D049BB133111EB
+	x ^= x >> 30
+	x *= 0xBF58476D1CE4E5B9
+	x ^= x >> 27
+	x *= 0x94D049BB133111EB
+	x ^= x >> 31
+	return x
+}
+
+func roundPrice(price float64) float64 {
+	return math.Round(price*100) / 100
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 實時報價分發：每個被訂閱的股票只有一個上游輪詢，報價扇出給所有訂閱者
+// 訂閱者來不及消費時只保留每個股票最新的報價，舊報價直接丟棄
+type QuoteHub struct {
+	logger   *logrus.Logger
+	fetch    func(symbol string) (*StockQuote, error)
+	interval time.Duration
+
+	mu          sync.Mutex
+	subscribers map[string]map[*QuoteSubscription]struct{}
+	pollers     map[string]context.CancelFunc
+	latest      map[string]*StockQuote
+}
+
+func NewQuoteHub(logger *logrus.Logger, fetch func(symbol string) (*StockQuote, error), interval time.Duration) *QuoteHub {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &QuoteHub{
+		logger:      logger,
+		fetch:       fetch,
+		interval:    interval,
+		subscribers: make(map[string]map[*QuoteSubscription]struct{}),
+		pollers:     make(map[string]context.CancelFunc),
+		latest:      make(map[string]*StockQuote),
+	}
+}
+
+// 單個連接的訂閱
+type QuoteSubscription struct {
+	hub *QuoteHub
+
+	mu      sync.Mutex
+	symbols map[string]struct{}
+	pending map[string]*StockQuote // 尚未發送的最新報價
+	dropped int64                  // 被更新報價覆蓋而未發送的數量
+	ready   chan struct{}
+	closed  bool
+}
+
+func (h *QuoteHub) Subscribe() *QuoteSubscription {
+	return &QuoteSubscription{
+		hub:     h,
+		symbols: make(map[string]struct{}),
+		pending: make(map[string]*StockQuote),
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+// 訂閱股票，已有報價時立即推送一次
+func (s *QuoteSubscription) Add(symbols ...string) {
+	for _, symbol := range symbols {
+		s.mu.Lock()
+		_, exists := s.symbols[symbol]
+		added := !exists && !s.closed
+		if added {
+			s.symbols[symbol] = struct{}{}
+		}
+		s.mu.Unlock()
+
+		if added {
+			s.hub.attach(symbol, s)
+		}
+	}
+}
+
+func (s *QuoteSubscription) Remove(symbols ...string) {
+	for _, symbol := range symbols {
+		s.mu.Lock()
+		_, exists := s.symbols[symbol]
+		delete(s.symbols, symbol)
+		delete(s.pending, symbol)
+		s.mu.Unlock()
+
+		if exists {
+			s.hub.detach(symbol, s)
+		}
+	}
+}
+
+// 取消全部訂閱，連接斷開時調用
+func (s *QuoteSubscription) Close() {
+	s.mu.Lock()
+	s.closed = true
+	symbols := make([]string, 0, len(s.symbols))
+	for symbol := range s.symbols {
+		symbols = append(symbols, symbol)
+	}
+	s.mu.Unlock()
+
+	s.Remove(symbols...)
+}
+
+// 當前訂閱的股票，按代碼排序
+func (s *QuoteSubscription) Symbols() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	symbols := make([]string, 0, len(s.symbols))
+	for symbol := range s.symbols {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// 有待發送的報價時可讀
+func (s *QuoteSubscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// 取出待發送的報價及自上次取出以來丟棄的數量
+func (s *QuoteSubscription) Drain() ([]*StockQuote, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	quotes := make([]*StockQuote, 0, len(s.pending))
+	for _, quote := range s.pending {
+		quotes = append(quotes, quote)
+	}
+	sort.Slice(quotes, func(i, j int) bool { return quotes[i].Symbol < quotes[j].Symbol })
+
+	dropped := s.dropped
+	s.pending = make(map[string]*StockQuote)
+	s.dropped = 0
+	return quotes, dropped
+}
+
+func (s *QuoteSubscription) deliver(quote *StockQuote) {
+	s.mu.Lock()
+	if _, subscribed := s.symbols[quote.Symbol]; !subscribed {
+		s.mu.Unlock()
+		return
+	}
+	if _, exists := s.pending[quote.Symbol]; exists {
+		s.dropped++
+	}
+	s.pending[quote.Symbol] = quote
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// 發布報價；沒有訂閱者或與上一筆價格和成交量相同時不推送
+func (h *QuoteHub) Publish(quote *StockQuote) {
+	h.mu.Lock()
+	if len(h.subscribers[quote.Symbol]) == 0 {
+		h.mu.Unlock()
+		return
+	}
+	if last, exists := h.latest[quote.Symbol]; exists && last.Price == quote.Price && last.Volume == quote.Volume {
+		h.mu.Unlock()
+		return
+	}
+	h.latest[quote.Symbol] = quote
+
+	subscribers := make([]*QuoteSubscription, 0, len(h.subscribers[quote.Symbol]))
+	for sub := range h.subscribers[quote.Symbol] {
+		subscribers = append(subscribers, sub)
+	}
+	h.mu.Unlock()
+
+	for _, sub := range subscribers {
+		sub.deliver(quote)
+	}
+}
+
+// 註冊訂閱者，第一個訂閱者啟動該股票的輪詢
+func (h *QuoteHub) attach(symbol string, sub *QuoteSubscription) {
+	h.mu.Lock()
+	if h.subscribers[symbol] == nil {
+		h.subscribers[symbol] = make(map[*QuoteSubscription]struct{})
+	}
+	h.subscribers[symbol][sub] = struct{}{}
+
+	if _, polling := h.pollers[symbol]; !polling {
+		ctx, cancel := context.WithCancel(context.Background())
+		h.pollers[symbol] = cancel
+		go h.poll(ctx, symbol)
+	}
+	latest := h.latest[symbol]
+	h.mu.Unlock()
+
+	if latest != nil {
+		sub.deliver(latest)
+	}
+}
+
+// 移除訂閱者，最後一個訂閱者離開時停止輪詢
+func (h *QuoteHub) detach(symbol string, sub *QuoteSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subscribers[symbol], sub)
+	if len(h.subscribers[symbol]) > 0 {
+		return
+	}
+	delete(h.subscribers, symbol)
+	delete(h.latest, symbol)
+	if cancel, polling := h.pollers[symbol]; polling {
+		cancel()
+		delete(h.pollers, symbol)
+	}
+}
+
+func (h *QuoteHub) poll(ctx context.Context, symbol string) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	h.logger.WithField("symbol", symbol).Debug("開始輪詢實時報價")
+	for {
+		quote, err := h.fetch(symbol)
+		if err != nil {
+			h.logger.WithError(err).WithField("symbol", symbol).Debug("輪詢實時報價失敗")
+		} else if ctx.Err() == nil {
+			h.Publish(quote)
+		}
+
+		select {
+		case <-ctx.Done():
+			h.logger.WithField("symbol", symbol).Debug("停止輪詢實時報價")
+			return
+		case <-ticker.C:
+		}
+	}
+}
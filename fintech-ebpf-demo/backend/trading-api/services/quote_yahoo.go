@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Yahoo Finance 行情，需要外網連接
+type YahooQuoteProvider struct {
+	logger *logrus.Logger
+	client *http.Client
+}
+
+func NewYahooQuoteProvider(logger *logrus.Logger) *YahooQuoteProvider {
+	return &YahooQuoteProvider{
+		logger: logger,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *YahooQuoteProvider) Name() string {
+	return "yahoo"
+}
+
+// 從Yahoo Finance API獲取數據
+func (p *YahooQuoteProvider) FetchQuote(ctx context.Context, symbol string) (*StockQuote, error) {
+	// Yahoo Finance API URL
+	url := fmt.Sprintf("https://query1.finance.yahoo.com/v8/finance/chart/%s", symbol)
+
+	body, err := p.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	// 解析Yahoo Finance響應
+	return p.parseYahooResponse(body, symbol)
+}
+
+// Yahoo Finance 的K線週期參數
+var yahooIntervals = map[time.Duration]string{
+	time.Minute:     "1m",
+	5 * time.Minute: "5m",
+	time.Hour:       "60m",
+	24 * time.Hour:  "1d",
+}
+
+// 從Yahoo Finance API獲取K線
+func (p *YahooQuoteProvider) FetchCandles(ctx context.Context, symbol string, interval time.Duration, from, to time.Time) ([]Candle, error) {
+	name, supported := yahooIntervals[interval]
+	if !supported {
+		return nil, ErrUnsupportedInterval
+	}
+
+	url := fmt.Sprintf("https://query1.finance.yahoo.com/v8/finance/chart/%s?interval=%s&period1=%d&period2=%d",
+		symbol, name, from.Unix(), to.Unix())
+	body, err := p.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return parseYahooCandles(body, symbol, interval)
+}
+
+// 發送請求並讀取響應內容
+func (p *YahooQuoteProvider) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 設置請求頭
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, &HTTPStatusError{Source: "Yahoo Finance API", StatusCode: resp.StatusCode}
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// 解析Yahoo Finance圖表響應中的全部K線，跳過沒有成交的時間點
+func parseYahooCandles(data []byte, symbol string, interval time.Duration) ([]Candle, error) {
+	var response struct {
+		Chart struct {
+			Result []struct {
+				Timestamp  []int64 `json:"timestamp"`
+				Indicators struct {
+					Quote []struct {
+						Open   []*float64 `json:"open"`
+						High   []*float64 `json:"high"`
+						Low    []*float64 `json:"low"`
+						Close  []*float64 `json:"close"`
+						Volume []*int64   `json:"volume"`
+					} `json:"quote"`
+				} `json:"indicators"`
+			} `json:"result"`
+		} `json:"chart"`
+	}
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("解析Yahoo Finance響應失敗: %v", err)
+	}
+	if len(response.Chart.Result) == 0 {
+		return nil, fmt.Errorf("未找到股票數據: %s", symbol)
+	}
+
+	result := response.Chart.Result[0]
+	candles := make([]Candle, 0, len(result.Timestamp))
+	if len(result.Indicators.Quote) == 0 {
+		return candles, nil
+	}
+	quote := result.Indicators.Quote[0]
+
+	value := func(values []*float64, i int) (float64, bool) {
+		if i >= len(values) || values[i] == nil {
+			return 0, false
+		}
+		return *values[i], true
+	}
+	for i, ts := range result.Timestamp {
+		closePrice, ok := value(quote.Close, i)
+		if !ok {
+			continue
+		}
+		candle := Candle{Time: time.Unix(ts, 0), Close: closePrice}
+		candle.Open, _ = value(quote.Open, i)
+		candle.High, _ = value(quote.High, i)
+		candle.Low, _ = value(quote.Low, i)
+		if i < len(quote.Volume) && quote.Volume[i] != nil {
+			candle.Volume = *quote.Volume[i]
+		}
+		// 日線統一使用美東零點
+		if interval >= 24*time.Hour {
+			candle.Time = marketDay(candle.Time)
+		}
+		candles = append(candles, candle)
+	}
+	return candles, nil
+}
+
+// 解析Yahoo Finance響應
+func (p *YahooQuoteProvider) parseYahooResponse(data []byte, symbol string) (*StockQuote, error) {
+	var response struct {
+		Chart struct {
+			Result []struct {
+				Meta struct {
+					Currency             string  `json:"currency"`
+					Symbol               string  `json:"symbol"`
+					ExchangeName         string  `json:"exchangeName"`
+					RegularMarketPrice   float64 `json:"regularMarketPrice"`
+					PreviousClose        float64 `json:"previousClose"`
+					ChartPreviousClose   float64 `json:"chartPreviousClose"`
+					RegularMarketTime    int64   `json:"regularMarketTime"`
+					CurrentTradingPeriod struct {
+						Regular struct {
+							Start int64 `json:"start"`
+							End   int64 `json:"end"`
+						} `json:"regular"`
+					} `json:"currentTradingPeriod"`
+				} `json:"meta"`
+				Indicators struct {
+					Quote []struct {
+						High   []float64 `json:"high"`
+						Low    []float64 `json:"low"`
+						Open   []float64 `json:"open"`
+						Close  []float64 `json:"close"`
+						Volume []int64   `json:"volume"`
+					} `json:"quote"`
+				} `json:"indicators"`
+			} `json:"result"`
+		} `json:"chart"`
+	}
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("解析Yahoo Finance響應失敗: %v", err)
+	}
+
+	if len(response.Chart.Result) == 0 {
+		return nil, fmt.Errorf("未找到股票數據: %s", symbol)
+	}
+
+	result := response.Chart.Result[0]
+	meta := result.Meta
+
+	// 按交易日曆判斷當前是否處於交易時段
+	marketTime := time.Unix(meta.RegularMarketTime, 0)
+	isMarketOpen := isRegularSession(time.Now())
+
+	// 獲取最新價格數據
+	var high, low, open, volume float64 = 0, 0, 0, 0
+	if len(result.Indicators.Quote) > 0 {
+		quote := result.Indicators.Quote[0]
+		if len(quote.High) > 0 {
+			high = quote.High[len(quote.High)-1]
+		}
+		if len(quote.Low) > 0 {
+			low = quote.Low[len(quote.Low)-1]
+		}
+		if len(quote.Open) > 0 {
+			open = quote.Open[len(quote.Open)-1]
+		}
+		if len(quote.Volume) > 0 {
+			volume = float64(quote.Volume[len(quote.Volume)-1])
+		}
+	}
+
+	stockQuote := &StockQuote{
+		Symbol:       strings.ToUpper(symbol),
+		Volume:       int64(volume),
+		LastUpdated:  marketTime,
+		IsMarketOpen: isMarketOpen,
+		Currency:     meta.Currency,
+		Exchange:     meta.ExchangeName,
+		CompanyName:  symbol, // Yahoo Finance API不提供公司名稱，使用symbol代替
+		Source:       p.Name(),
+	}
+	// 設置價格並計算變化
+	if err := stockQuote.setPrices(meta.RegularMarketPrice, meta.PreviousClose, open, high, low); err != nil {
+		return nil, err
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"symbol":        symbol,
+		"price":         stockQuote.Price,
+		"change":        stockQuote.Change,
+		"changePercent": stockQuote.ChangePercent,
+	}).Info("獲取實時股價成功")
+
+	return stockQuote, nil
+}
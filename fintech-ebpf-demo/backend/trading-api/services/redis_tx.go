@@ -0,0 +1,31 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 樂觀鎖衝突時的最大重試次數及最長退避時間
+const (
+	maxTxRetries    = 100
+	maxTxRetryDelay = 20 * time.Millisecond
+)
+
+// 以 WATCH/MULTI 樂觀鎖執行讀-改-寫事務，被監視的鍵在提交前被修改時隨機退避後重試
+func watchKeys(ctx context.Context, client *redis.Client, fn func(*redis.Tx) error, keys ...string) error {
+	for i := 0; i < maxTxRetries; i++ {
+		err := client.Watch(ctx, fn, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+
+		delay := min(time.Duration(1<<min(i, 10))*time.Millisecond/4, maxTxRetryDelay)
+		time.Sleep(time.Duration(rand.Int63n(int64(delay) + 1)))
+	}
+	return fmt.Errorf("鍵 %v 更新衝突，重試 %d 次後失敗", keys, maxTxRetries)
+}
@@ -0,0 +1,444 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+)
+
+// 預留資金的價格緩衝，覆蓋手續費及市價單滑點
+const ReserveBuffer = models.DecimalOne / 100
+
+// 掛單預留：買單預留資金，賣單預留股份
+type Hold struct {
+	OrderID   string         `json:"orderId"`
+	UserID    string         `json:"userId"`
+	GroupID   string         `json:"groupId,omitempty"` // 同一OCO組的預留只計最大一筆
+	Symbol    string         `json:"symbol"`
+	Side      string         `json:"side"`
+	Quantity  models.Decimal `json:"quantity"`           // 尚未成交的預留股數
+	Price     models.Decimal `json:"price"`              // 買單每股預留資金（含緩衝）
+	Borrowed  models.Decimal `json:"borrowed,omitempty"` // 賣空部分已預定的借券股數，最後成交
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+}
+
+// 預留的資金金額
+func (h *Hold) Cash() models.Decimal {
+	if h.Side != "buy" {
+		return 0
+	}
+	return h.Quantity.Mul(h.Price)
+}
+
+// 用戶預留匯總
+type HoldSummary struct {
+	Cash   models.Decimal            `json:"cash"`
+	Shares map[string]models.Decimal `json:"shares"`
+	Buys   map[string]models.Decimal `json:"buys"` // 各股票買單的預留資金
+}
+
+// 可用餘額不足錯誤；Margin 為真時表示保證金賬戶的初始保證金不足
+type InsufficientBalanceError struct {
+	Side      string
+	Symbol    string
+	Margin    bool
+	Available models.Decimal
+	Required  models.Decimal
+}
+
+func (e *InsufficientBalanceError) Error() string {
+	if e.Margin {
+		return fmt.Sprintf("可用保證金不足: 可用 $%.2f, 需要 $%.2f", e.Available, e.Required)
+	}
+	if e.Side == "buy" {
+		return fmt.Sprintf("可用資金不足: 可用 $%.2f, 需要 $%.2f", e.Available, e.Required)
+	}
+	return fmt.Sprintf("可用持股不足: %s 可用 %v 股, 需要 %v 股", e.Symbol, e.Available, e.Required)
+}
+
+// 預留服務：掛單接受時預留資金或股份，成交時轉換，撤單或過期時釋放。
+// 保證金賬戶按保證金要求校驗，賣空部分同時預定借券
+type ReservationService struct {
+	logger     *logrus.Logger
+	redis      *redis.Client
+	portfolios PortfolioStore
+	margin     *MarginService
+}
+
+func NewReservationService(logger *logrus.Logger, redisClient *redis.Client, portfolios PortfolioStore, margin *MarginService) *ReservationService {
+	return &ReservationService{
+		logger:     logger,
+		redis:      redisClient,
+		portfolios: portfolios,
+		margin:     margin,
+	}
+}
+
+func holdsKey(userID string) string {
+	return fmt.Sprintf("holds:%s", userID)
+}
+
+// 按訂單剩餘數量創建預留
+func NewHold(order *models.Order, price models.Decimal) *Hold {
+	hold := &Hold{
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+		Symbol:    order.Symbol,
+		Side:      order.Side,
+		Quantity:  order.RemainingQty,
+		Price:     price.Mul(models.DecimalOne + ReserveBuffer),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if len(order.OCOOrderIDs) > 0 {
+		hold.GroupID = order.GroupID
+	}
+	return hold
+}
+
+// 預留資金或股份。同一訂單已有預留時替換原預留；可用餘額不足時返回 *InsufficientBalanceError，
+// 借券不足時返回 *BorrowUnavailableError
+// 只監視預留鍵及借券數量：成交先扣減投資組合再轉換預留，其間讀到的可用額只會偏小
+func (s *ReservationService) Reserve(hold *Hold) error {
+	ctx := context.Background()
+	key := holdsKey(hold.UserID)
+
+	reserve := func(tx *redis.Tx) error {
+		holds, err := loadHolds(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		portfolio, err := s.portfolios.GetPortfolio(ctx, hold.UserID)
+		if err == ErrNotFound {
+			portfolio = NewPortfolio(hold.UserID)
+		} else if err != nil {
+			return err
+		}
+
+		var previouslyBorrowed models.Decimal
+		if previous := holds[hold.OrderID]; previous != nil {
+			previouslyBorrowed = previous.Borrowed
+		}
+		delete(holds, hold.OrderID)
+		before := summarizeHolds(holds)
+		holds[hold.OrderID] = hold
+		after := summarizeHolds(holds)
+
+		hold.Borrowed = 0
+		if portfolio.IsMargin() {
+			if hold.Side == "sell" {
+				hold.Borrowed = shortQuantity(portfolio, after, hold.Symbol) - shortQuantity(portfolio, before, hold.Symbol)
+			}
+			if err := s.margin.checkHold(ctx, portfolio, before, after, hold); err != nil {
+				return err
+			}
+			if borrow := hold.Borrowed - previouslyBorrowed; borrow > 0 {
+				if err := s.margin.checkBorrow(ctx, tx, hold.Symbol, borrow); err != nil {
+					return err
+				}
+			}
+		} else if hold.Side == "buy" {
+			if after.Cash > portfolio.CashBalance {
+				return &InsufficientBalanceError{
+					Side:      hold.Side,
+					Symbol:    hold.Symbol,
+					Available: portfolio.CashBalance - before.Cash,
+					Required:  after.Cash - before.Cash,
+				}
+			}
+		} else {
+			var owned models.Decimal
+			if position := portfolio.Positions[hold.Symbol]; position != nil {
+				owned = position.Quantity
+			}
+			if after.Shares[hold.Symbol] > owned {
+				return &InsufficientBalanceError{
+					Side:      hold.Side,
+					Symbol:    hold.Symbol,
+					Available: owned - before.Shares[hold.Symbol],
+					Required:  after.Shares[hold.Symbol] - before.Shares[hold.Symbol],
+				}
+			}
+		}
+
+		holdJSON, err := json.Marshal(hold)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, hold.OrderID, holdJSON)
+			if borrow := hold.Borrowed - previouslyBorrowed; borrow != 0 {
+				pipe.HIncrBy(ctx, borrowedSharesKey, hold.Symbol, int64(borrow))
+			}
+			return nil
+		})
+		return err
+	}
+
+	if err := watchKeys(ctx, s.redis, reserve, key, borrowedSharesKey); err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"orderId":  hold.OrderID,
+		"userId":   hold.UserID,
+		"symbol":   hold.Symbol,
+		"side":     hold.Side,
+		"quantity": hold.Quantity,
+		"cash":     hold.Cash(),
+		"borrowed": hold.Borrowed,
+	}).Info("已預留可用餘額")
+	return nil
+}
+
+// 成交後按成交數量轉換預留，全部成交時刪除；成交先沖減持股部分，超出部分的預定借券轉為已借出
+func (s *ReservationService) ConsumeFill(userID, orderID string, quantity models.Decimal) error {
+	ctx := context.Background()
+	key := holdsKey(userID)
+
+	consume := func(tx *redis.Tx) error {
+		holdJSON, err := tx.HGet(ctx, key, orderID).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var hold Hold
+		if err := json.Unmarshal([]byte(holdJSON), &hold); err != nil {
+			return err
+		}
+		hold.Borrowed -= models.MaxDecimal(0, quantity-(hold.Quantity-hold.Borrowed))
+		hold.Borrowed = models.MaxDecimal(0, hold.Borrowed)
+		hold.Quantity -= quantity
+		hold.UpdatedAt = time.Now()
+
+		updated, err := json.Marshal(&hold)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if hold.Quantity <= 0 {
+				pipe.HDel(ctx, key, orderID)
+			} else {
+				pipe.HSet(ctx, key, orderID, updated)
+			}
+			return nil
+		})
+		return err
+	}
+
+	return watchKeys(ctx, s.redis, consume, key)
+}
+
+// 將預留縮減到指定數量（如OCO關聯訂單部分成交後），超出部分預定的借券一併歸還；預留不大於該數量時不變
+func (s *ReservationService) Shrink(userID, orderID string, quantity models.Decimal) error {
+	ctx := context.Background()
+	key := holdsKey(userID)
+
+	shrink := func(tx *redis.Tx) error {
+		holdJSON, err := tx.HGet(ctx, key, orderID).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var hold Hold
+		if err := json.Unmarshal([]byte(holdJSON), &hold); err != nil {
+			return err
+		}
+		if hold.Quantity <= quantity {
+			return nil
+		}
+		// 借券部分最後成交，縮減時先歸還
+		returned := min(hold.Borrowed, hold.Quantity-quantity)
+		hold.Borrowed -= returned
+		hold.Quantity = quantity
+		hold.UpdatedAt = time.Now()
+
+		updated, err := json.Marshal(&hold)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if hold.Quantity <= 0 {
+				pipe.HDel(ctx, key, orderID)
+			} else {
+				pipe.HSet(ctx, key, orderID, updated)
+			}
+			if returned > 0 {
+				pipe.HIncrBy(ctx, borrowedSharesKey, hold.Symbol, -int64(returned))
+			}
+			return nil
+		})
+		return err
+	}
+
+	return watchKeys(ctx, s.redis, shrink, key)
+}
+
+// 為出金預留現金：與掛單預留在同一預留鍵上監視，校驗扣除其他預留後的可用現金，
+// 保證金賬戶同時不得超過初始保證金盈餘；不足時返回 *InsufficientBalanceError。
+// 調用方扣減投資組合現金後以 Release 釋放，其間讀到的可用額只會偏小
+func (s *ReservationService) ReserveCash(userID, holdID string, amount models.Decimal) error {
+	ctx := context.Background()
+	key := holdsKey(userID)
+
+	reserve := func(tx *redis.Tx) error {
+		holds, err := loadHolds(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		portfolio, err := s.portfolios.GetPortfolio(ctx, userID)
+		if err == ErrNotFound {
+			portfolio = NewPortfolio(userID)
+		} else if err != nil {
+			return err
+		}
+
+		delete(holds, holdID)
+		summary := summarizeHolds(holds)
+		available := portfolio.CashBalance - summary.Cash
+		if portfolio.IsMargin() {
+			excess, err := s.margin.Withdrawable(ctx, portfolio, summary)
+			if err != nil {
+				return err
+			}
+			available = models.MinDecimal(available, excess)
+		}
+		if amount > available {
+			return &InsufficientBalanceError{Side: "buy", Available: available, Required: amount}
+		}
+
+		// 以一股、每股價格為金額的買入預留表示，計入其他預留的可用現金
+		holdJSON, err := json.Marshal(&Hold{
+			OrderID:   holdID,
+			UserID:    userID,
+			Side:      "buy",
+			Quantity:  models.DecimalOne,
+			Price:     amount,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, holdID, holdJSON)
+			return nil
+		})
+		return err
+	}
+
+	return watchKeys(ctx, s.redis, reserve, key)
+}
+
+// 釋放訂單的預留，並歸還尚未成交部分預定的借券
+func (s *ReservationService) Release(userID, orderID string) error {
+	ctx := context.Background()
+	key := holdsKey(userID)
+
+	release := func(tx *redis.Tx) error {
+		var hold Hold
+		holdJSON, err := tx.HGet(ctx, key, orderID).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(holdJSON), &hold); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, key, orderID)
+			if hold.Borrowed > 0 {
+				pipe.HIncrBy(ctx, borrowedSharesKey, hold.Symbol, -int64(hold.Borrowed))
+			}
+			return nil
+		})
+		return err
+	}
+
+	return watchKeys(ctx, s.redis, release, key)
+}
+
+// 用戶當前預留匯總
+func (s *ReservationService) Summary(userID string) (*HoldSummary, error) {
+	holds, err := loadHolds(context.Background(), s.redis, holdsKey(userID))
+	if err != nil {
+		return nil, err
+	}
+	return summarizeHolds(holds), nil
+}
+
+func loadHolds(ctx context.Context, client redis.Cmdable, key string) (map[string]*Hold, error) {
+	items, err := client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	holds := make(map[string]*Hold, len(items))
+	for orderID, item := range items {
+		var hold Hold
+		if err := json.Unmarshal([]byte(item), &hold); err != nil {
+			continue
+		}
+		holds[orderID] = &hold
+	}
+	return holds, nil
+}
+
+// 匯總預留：同一OCO組內只會有一筆成交，按組內最大值計算
+func summarizeHolds(holds map[string]*Hold) *HoldSummary {
+	summary := &HoldSummary{Shares: make(map[string]models.Decimal), Buys: make(map[string]models.Decimal)}
+	groupBuys := make(map[string]*Hold)
+	groupShares := make(map[string]map[string]models.Decimal)
+
+	for _, hold := range holds {
+		if hold.GroupID == "" {
+			summary.Cash += hold.Cash()
+			if hold.Side == "buy" {
+				summary.Buys[hold.Symbol] += hold.Cash()
+			}
+			if hold.Side == "sell" {
+				summary.Shares[hold.Symbol] += hold.Quantity
+			}
+			continue
+		}
+
+		if largest := groupBuys[hold.GroupID]; largest == nil || hold.Cash() > largest.Cash() {
+			groupBuys[hold.GroupID] = hold
+		}
+		if hold.Side == "sell" {
+			if groupShares[hold.GroupID] == nil {
+				groupShares[hold.GroupID] = make(map[string]models.Decimal)
+			}
+			shares := groupShares[hold.GroupID]
+			shares[hold.Symbol] = max(shares[hold.Symbol], hold.Quantity)
+		}
+	}
+
+	for _, hold := range groupBuys {
+		summary.Cash += hold.Cash()
+		if hold.Side == "buy" {
+			summary.Buys[hold.Symbol] += hold.Cash()
+		}
+	}
+	for _, shares := range groupShares {
+		for symbol, quantity := range shares {
+			summary.Shares[symbol] += quantity
+		}
+	}
+	return summary
+}
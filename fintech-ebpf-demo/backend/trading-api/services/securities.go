@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+)
+
+// 參考數據在進程內的緩存時間，其他實例的修改最遲在此時間後生效
+const securityCacheTTL = time.Minute
+
+// 默認證券的可借券總股數
+const defaultBorrowLimit = models.DecimalOne * 100000
+
+// 首次啟動時寫入的默認證券，均可賣空
+var defaultSecurities = []models.Security{
+	{Symbol: "AAPL", Name: "Apple Inc.", Exchange: "XNAS", Sector: "資訊科技"},
+	{Symbol: "GOOGL", Name: "Alphabet Inc.", Exchange: "XNAS", Sector: "通訊服務"},
+	{Symbol: "MSFT", Name: "Microsoft Corp.", Exchange: "XNAS", Sector: "資訊科技"},
+	{Symbol: "AMZN", Name: "Amazon.com Inc.", Exchange: "XNAS", Sector: "非必需消費品"},
+	{Symbol: "TSLA", Name: "Tesla Inc.", Exchange: "XNAS", Sector: "非必需消費品"},
+	{Symbol: "META", Name: "Meta Platforms Inc.", Exchange: "XNAS", Sector: "通訊服務"},
+	{Symbol: "NFLX", Name: "Netflix Inc.", Exchange: "XNAS", Sector: "通訊服務"},
+	{Symbol: "NVDA", Name: "NVIDIA Corp.", Exchange: "XNAS", Sector: "資訊科技"},
+	{Symbol: "JPM", Name: "JPMorgan Chase & Co.", Exchange: "XNYS", Sector: "金融"},
+	{Symbol: "JNJ", Name: "Johnson & Johnson", Exchange: "XNYS", Sector: "醫療保健"},
+	{Symbol: "V", Name: "Visa Inc.", Exchange: "XNYS", Sector: "金融"},
+	{Symbol: "PG", Name: "Procter & Gamble Co.", Exchange: "XNYS", Sector: "必需消費品"},
+	{Symbol: "MA", Name: "Mastercard Inc.", Exchange: "XNYS", Sector: "金融"},
+	{Symbol: "UNH", Name: "UnitedHealth Group Inc.", Exchange: "XNYS", Sector: "醫療保健"},
+	{Symbol: "HD", Name: "Home Depot Inc.", Exchange: "XNYS", Sector: "非必需消費品"},
+	{Symbol: "DIS", Name: "Walt Disney Co.", Exchange: "XNYS", Sector: "通訊服務"},
+	{Symbol: "PYPL", Name: "PayPal Holdings Inc.", Exchange: "XNAS", Sector: "金融"},
+	{Symbol: "BAC", Name: "Bank of America Corp.", Exchange: "XNYS", Sector: "金融"},
+	{Symbol: "VZ", Name: "Verizon Communications Inc.", Exchange: "XNYS", Sector: "通訊服務"},
+	{Symbol: "ADBE", Name: "Adobe Inc.", Exchange: "XNAS", Sector: "資訊科技"},
+}
+
+// 證券參考數據服務：維護可交易證券及其交易規則，讀取走進程內緩存
+type SecurityService struct {
+	logger *logrus.Logger
+	store  SecurityStore
+
+	mu       sync.Mutex
+	cache    map[string]models.Security
+	loadedAt time.Time
+}
+
+func NewSecurityService(logger *logrus.Logger, store SecurityStore) *SecurityService {
+	return &SecurityService{
+		logger: logger,
+		store:  store,
+	}
+}
+
+// CSV導入結果；存在錯誤時不保存任何記錄
+type SecurityImport struct {
+	Created int      `json:"created"`
+	Updated int      `json:"updated"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// 寫入存儲中缺少的默認證券，已有記錄保持不變
+func (s *SecurityService) EnsureDefaults(ctx context.Context) error {
+	existing, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, security := range defaultSecurities {
+		if _, exists := existing[security.Symbol]; exists {
+			continue
+		}
+		security := security
+		security.BorrowLimit = defaultBorrowLimit
+		if _, err := s.Save(ctx, &security); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 讀取證券，不存在時返回 ErrNotFound
+func (s *SecurityService) Get(ctx context.Context, symbol string) (*models.Security, error) {
+	securities, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	security, exists := securities[strings.ToUpper(symbol)]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return &security, nil
+}
+
+// 所有證券，按代碼排序
+func (s *SecurityService) List(ctx context.Context) ([]*models.Security, error) {
+	securities, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*models.Security, 0, len(securities))
+	for _, security := range securities {
+		security := security
+		list = append(list, &security)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Symbol < list[j].Symbol })
+	return list, nil
+}
+
+// 可交易的股票代碼
+func (s *SecurityService) TradableSymbols(ctx context.Context) ([]string, error) {
+	securities, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := make([]string, 0, len(securities))
+	for _, security := range securities {
+		if security.IsTradable() {
+			symbols = append(symbols, security.Symbol)
+		}
+	}
+	return symbols, nil
+}
+
+// 新增或更新證券，返回是否為新增
+func (s *SecurityService) Save(ctx context.Context, security *models.Security) (bool, error) {
+	if err := security.Normalize(); err != nil {
+		return false, err
+	}
+	security.UpdatedAt = time.Now()
+
+	_, err := s.store.GetSecurity(ctx, security.Symbol)
+	created := err == ErrNotFound
+	if err != nil && !created {
+		return false, err
+	}
+	if err := s.store.SaveSecurity(ctx, security); err != nil {
+		return false, err
+	}
+
+	s.remember(*security)
+	s.logger.WithFields(logrus.Fields{
+		"symbol":  security.Symbol,
+		"status":  security.Status,
+		"created": created,
+	}).Info("證券參考數據已保存")
+	return created, nil
+}
+
+// 修改交易狀態，如停牌或復牌
+func (s *SecurityService) SetStatus(ctx context.Context, symbol, status, reason string) (*models.Security, error) {
+	if !models.IsValidSecurityStatus(status) {
+		return nil, fmt.Errorf("無效的交易狀態: %s", status)
+	}
+
+	security, err := s.store.GetSecurity(ctx, strings.ToUpper(symbol))
+	if err != nil {
+		return nil, err
+	}
+	security.Status = status
+	security.HaltReason = reason
+	if _, err := s.Save(ctx, security); err != nil {
+		return nil, err
+	}
+	return security, nil
+}
+
+// 從CSV批量導入，首行為表頭：symbol 必需，其餘欄位
+// name、exchange、sector、currency、lot_size、tick_size、status、halt_reason、
+// initial_margin、maintenance_margin、borrow_limit 可選，
+// 已有證券只更新文件中出現且非空的欄位。先校驗全部記錄，存在錯誤時不保存
+func (s *SecurityService) Import(ctx context.Context, r io.Reader) (*SecurityImport, error) {
+	existing, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("讀取表頭失敗: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["symbol"]; !ok {
+		return nil, fmt.Errorf("缺少 symbol 欄位")
+	}
+
+	result := &SecurityImport{}
+	securities := make([]models.Security, 0)
+	seen := make(map[string]int)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		security, err := parseSecurityRecord(record, columns, existing)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("第%d行: %v", line, err))
+			continue
+		}
+		if previous, duplicated := seen[security.Symbol]; duplicated {
+			result.Errors = append(result.Errors, fmt.Sprintf("第%d行: %s 與第%d行重複", line, security.Symbol, previous))
+			continue
+		}
+		seen[security.Symbol] = line
+		securities = append(securities, security)
+	}
+	if len(result.Errors) > 0 {
+		return result, nil
+	}
+
+	for i := range securities {
+		created, err := s.Save(ctx, &securities[i])
+		if err != nil {
+			return result, err
+		}
+		if created {
+			result.Created++
+		} else {
+			result.Updated++
+		}
+	}
+	return result, nil
+}
+
+func parseSecurityRecord(record []string, columns map[string]int, existing map[string]models.Security) (models.Security, error) {
+	field := func(name string) (string, bool) {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i]), true
+		}
+		return "", false
+	}
+
+	symbol, _ := field("symbol")
+	security, exists := existing[strings.ToUpper(symbol)]
+	if !exists {
+		security = models.Security{Symbol: symbol}
+	}
+
+	for name, dest := range map[string]*string{
+		"name":        &security.Name,
+		"exchange":    &security.Exchange,
+		"sector":      &security.Sector,
+		"currency":    &security.Currency,
+		"status":      &security.Status,
+		"halt_reason": &security.HaltReason,
+	} {
+		if value, ok := field(name); ok && value != "" {
+			*dest = value
+		}
+	}
+	for name, dest := range map[string]*models.Decimal{
+		"lot_size":           &security.LotSize,
+		"tick_size":          &security.TickSize,
+		"initial_margin":     &security.InitialMargin,
+		"maintenance_margin": &security.MaintenanceMargin,
+		"borrow_limit":       &security.BorrowLimit,
+	} {
+		value, ok := field(name)
+		if !ok || value == "" {
+			continue
+		}
+		parsed, err := models.ParseDecimal(value)
+		if err != nil {
+			return security, fmt.Errorf("無效的%s %q", name, value)
+		}
+		*dest = parsed
+	}
+
+	return security, security.Normalize()
+}
+
+// 讀取全部證券，緩存過期時從存儲重新載入
+func (s *SecurityService) load(ctx context.Context) (map[string]models.Security, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cache != nil && time.Since(s.loadedAt) < securityCacheTTL {
+		return s.cache, nil
+	}
+
+	securities, err := s.store.ListSecurities(ctx)
+	if err != nil {
+		if s.cache != nil {
+			s.logger.WithError(err).Warn("重新載入證券參考數據失敗，繼續使用緩存")
+			return s.cache, nil
+		}
+		return nil, err
+	}
+
+	cache := make(map[string]models.Security, len(securities))
+	for _, security := range securities {
+		cache[security.Symbol] = *security
+	}
+	s.cache, s.loadedAt = cache, time.Now()
+	return cache, nil
+}
+
+// 更新緩存中的單個證券；緩存在讀取時整體替換，這裡複製後再修改
+func (s *SecurityService) remember(security models.Security) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cache == nil {
+		return
+	}
+	cache := make(map[string]models.Security, len(s.cache)+1)
+	for symbol, existing := range s.cache {
+		cache[symbol] = existing
+	}
+	cache[security.Symbol] = security
+	s.cache = cache
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"trading-api/models"
+)
+
+// 存儲中不存在請求的記錄
+var ErrNotFound = errors.New("記錄不存在")
+
+// 存儲中的訂單版本比要保存的更新，說明該副本已過期
+var ErrStaleOrder = errors.New("訂單已被更新的版本覆蓋")
+
+// 訂單存儲
+type OrderStore interface {
+	// 讀取訂單，不存在時返回 ErrNotFound
+	GetOrder(ctx context.Context, orderID string) (*models.Order, error)
+	// 保存訂單；存儲中的版本號大於 order.Version 時不覆蓋，返回 ErrStaleOrder
+	SaveOrder(ctx context.Context, order *models.Order) error
+	// 按查詢條件分頁列出用戶訂單，游標無效時返回 ErrInvalidCursor
+	ListUserOrders(ctx context.Context, query OrderQuery) (*OrderPage, error)
+	// 按創建時間升序列出所有用戶未完成（new、partially_filled）的訂單，用於重啟後恢復訂單簿
+	ListActiveOrders(ctx context.Context) ([]*models.Order, error)
+}
+
+// 交易記錄存儲
+type TradeStore interface {
+	SaveTrade(ctx context.Context, trade *TradeRecord) error
+	// 按成交時間倒序列出交易
+	ListUserTrades(ctx context.Context, userID string, limit int) ([]*TradeRecord, error)
+	ListSymbolTrades(ctx context.Context, symbol string, limit int) ([]*TradeRecord, error)
+	DeleteUserTrades(ctx context.Context, userID string) error
+}
+
+// 投資組合與交易統計存儲
+// Update 方法以原子的讀-改-寫調用 fn，記錄不存在時傳入初始值；fn 返回錯誤時不保存
+type PortfolioStore interface {
+	// 讀取投資組合，不存在時返回 ErrNotFound
+	GetPortfolio(ctx context.Context, userID string) (*Portfolio, error)
+	UpdatePortfolio(ctx context.Context, userID string, fn func(*Portfolio) error) error
+	// 同 UpdatePortfolio，並在同一事務中把 fn 返回的分錄追加到同一後端的賬本（ID已存在的忽略）；
+	// 任一寫入失敗時投資組合與分錄均不保存
+	JournalPortfolio(ctx context.Context, userID string, fn func(*Portfolio) ([]*JournalEntry, error)) error
+	SavePortfolio(ctx context.Context, portfolio *Portfolio) error
+
+	// 讀取交易統計，不存在時返回 ErrNotFound
+	GetStats(ctx context.Context, userID string) (*TradingStats, error)
+	UpdateStats(ctx context.Context, userID string, fn func(*TradingStats) error) error
+	DeleteStats(ctx context.Context, userID string) error
+}
+
+// 配置存儲：按鍵保存JSON序列化的值
+type ConfigStore interface {
+	// 讀取配置並解析到 dest，不存在時返回 ErrNotFound
+	GetConfig(ctx context.Context, key string, dest interface{}) error
+	SetConfig(ctx context.Context, key string, value interface{}) error
+}
+
+// 證券參考數據存儲，以股票代碼為鍵
+type SecurityStore interface {
+	// 讀取證券，不存在時返回 ErrNotFound
+	GetSecurity(ctx context.Context, symbol string) (*models.Security, error)
+	ListSecurities(ctx context.Context) ([]*models.Security, error)
+	SaveSecurity(ctx context.Context, security *models.Security) error
+}
+
+// 複式記賬分錄存儲，只追加不修改
+type LedgerStore interface {
+	// 追加分錄，ID已存在時忽略，重複過賬不會重複記賬
+	AppendEntry(ctx context.Context, entry *JournalEntry) error
+	// 按過賬先後倒序列出用戶分錄，limit 為0時返回全部
+	ListEntries(ctx context.Context, userID string, limit int) ([]*JournalEntry, error)
+}
+
+// 新用戶的初始交易統計
+func newTradingStats(userID string) *TradingStats {
+	return &TradingStats{UserID: userID}
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+)
+
+// 帶讀穿緩存的訂單存儲：以 primary 為準，cache 只加速單筆讀取
+type CachedOrderStore struct {
+	logger  *logrus.Logger
+	primary OrderStore
+	cache   OrderStore
+}
+
+func NewCachedOrderStore(logger *logrus.Logger, primary, cache OrderStore) *CachedOrderStore {
+	return &CachedOrderStore{
+		logger:  logger,
+		primary: primary,
+		cache:   cache,
+	}
+}
+
+// 緩存未命中或不可用時從主存儲讀取並回填
+func (s *CachedOrderStore) GetOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	order, err := s.cache.GetOrder(ctx, orderID)
+	if err == nil {
+		return order, nil
+	}
+	if err != ErrNotFound {
+		s.logger.WithError(err).WithField("order_id", orderID).Warn("讀取訂單緩存失敗")
+	}
+
+	order, err = s.primary.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cache.SaveOrder(ctx, order); err != nil {
+		s.logger.WithError(err).WithField("order_id", orderID).Warn("回填訂單緩存失敗")
+	}
+	return order, nil
+}
+
+// 先寫主存儲再更新緩存；緩存寫入失敗不影響結果
+func (s *CachedOrderStore) SaveOrder(ctx context.Context, order *models.Order) error {
+	if err := s.primary.SaveOrder(ctx, order); err != nil {
+		return err
+	}
+	if err := s.cache.SaveOrder(ctx, order); err != nil {
+		s.logger.WithError(err).WithField("order_id", order.ID).Warn("更新訂單緩存失敗")
+	}
+	return nil
+}
+
+func (s *CachedOrderStore) ListUserOrders(ctx context.Context, query OrderQuery) (*OrderPage, error) {
+	return s.primary.ListUserOrders(ctx, query)
+}
+
+func (s *CachedOrderStore) ListActiveOrders(ctx context.Context) ([]*models.Order, error) {
+	return s.primary.ListActiveOrders(ctx)
+}
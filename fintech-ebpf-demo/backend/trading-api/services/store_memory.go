@@ -0,0 +1,366 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"trading-api/models"
+)
+
+// 進程內存儲，實現 OrderStore、TradeStore、PortfolioStore、ConfigStore、SecurityStore 和 LedgerStore
+// 用於單元測試和無外部依賴的離線演示，重啟後數據丟失
+type MemoryStore struct {
+	mu         sync.Mutex
+	orders     map[string]*models.Order
+	trades     []*TradeRecord // 按保存先後排列
+	portfolios map[string]*Portfolio
+	stats      map[string]*TradingStats
+	configs    map[string][]byte
+	securities map[string]models.Security
+	ledger     []*JournalEntry // 按過賬先後排列
+	ledgerIDs  map[string]bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		orders:     make(map[string]*models.Order),
+		portfolios: make(map[string]*Portfolio),
+		stats:      make(map[string]*TradingStats),
+		configs:    make(map[string][]byte),
+		securities: make(map[string]models.Security),
+		ledgerIDs:  make(map[string]bool),
+	}
+}
+
+var (
+	_ OrderStore     = (*MemoryStore)(nil)
+	_ TradeStore     = (*MemoryStore)(nil)
+	_ PortfolioStore = (*MemoryStore)(nil)
+	_ ConfigStore    = (*MemoryStore)(nil)
+	_ SecurityStore  = (*MemoryStore)(nil)
+	_ LedgerStore    = (*MemoryStore)(nil)
+)
+
+// 通過JSON往返深拷貝，調用方修改返回值不會影響存儲內容
+func deepCopy(src, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+func (s *MemoryStore) GetOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, exists := s.orders[orderID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return order.Clone(), nil
+}
+
+func (s *MemoryStore) SaveOrder(ctx context.Context, order *models.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, exists := s.orders[order.ID]; exists && existing.Version > order.Version {
+		return ErrStaleOrder
+	}
+	s.orders[order.ID] = order.Clone()
+	return nil
+}
+
+func (s *MemoryStore) ListUserOrders(ctx context.Context, query OrderQuery) (*OrderPage, error) {
+	cursor, err := DecodeOrderCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	orders := make([]*models.Order, 0)
+	for _, order := range s.orders {
+		if query.Matches(order) && cursor.Follows(OrderSortKey(order), order.ID, query.Desc) {
+			orders = append(orders, order.Clone())
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(orders, func(i, j int) bool {
+		ki, kj := OrderSortKey(orders[i]), OrderSortKey(orders[j])
+		if ki == kj {
+			return (orders[i].ID < orders[j].ID) != query.Desc
+		}
+		return (ki < kj) != query.Desc
+	})
+	if query.Limit > 0 && len(orders) > query.Limit+1 {
+		orders = orders[:query.Limit+1]
+	}
+	return NewOrderPage(orders, query.Limit), nil
+}
+
+func (s *MemoryStore) ListActiveOrders(ctx context.Context) ([]*models.Order, error) {
+	s.mu.Lock()
+	orders := make([]*models.Order, 0)
+	for _, order := range s.orders {
+		if order.IsActive() {
+			orders = append(orders, order.Clone())
+		}
+	}
+	s.mu.Unlock()
+
+	SortOrdersByCreation(orders)
+	return orders, nil
+}
+
+func (s *MemoryStore) SaveTrade(ctx context.Context, trade *TradeRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *trade
+	s.trades = append(s.trades, &saved)
+	return nil
+}
+
+func (s *MemoryStore) ListUserTrades(ctx context.Context, userID string, limit int) ([]*TradeRecord, error) {
+	return s.listTrades(limit, func(trade *TradeRecord) bool { return trade.UserID == userID }), nil
+}
+
+func (s *MemoryStore) ListSymbolTrades(ctx context.Context, symbol string, limit int) ([]*TradeRecord, error) {
+	return s.listTrades(limit, func(trade *TradeRecord) bool { return trade.Symbol == symbol }), nil
+}
+
+// 從最新的交易開始返回符合條件的記錄
+func (s *MemoryStore) listTrades(limit int, match func(*TradeRecord) bool) []*TradeRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trades := make([]*TradeRecord, 0)
+	for i := len(s.trades) - 1; i >= 0 && (limit <= 0 || len(trades) < limit); i-- {
+		if match(s.trades[i]) {
+			trade := *s.trades[i]
+			trades = append(trades, &trade)
+		}
+	}
+	return trades
+}
+
+func (s *MemoryStore) DeleteUserTrades(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.trades[:0]
+	for _, trade := range s.trades {
+		if trade.UserID != userID {
+			kept = append(kept, trade)
+		}
+	}
+	s.trades = kept
+	return nil
+}
+
+func (s *MemoryStore) GetPortfolio(ctx context.Context, userID string) (*Portfolio, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	portfolio, exists := s.portfolios[userID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	var copied Portfolio
+	if err := deepCopy(portfolio, &copied); err != nil {
+		return nil, err
+	}
+	return &copied, nil
+}
+
+// 在鎖內對副本調用 fn，成功後替換原值
+func (s *MemoryStore) UpdatePortfolio(ctx context.Context, userID string, fn func(*Portfolio) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	portfolio := NewPortfolio(userID)
+	if existing, exists := s.portfolios[userID]; exists {
+		if err := deepCopy(existing, portfolio); err != nil {
+			return err
+		}
+	}
+	if err := fn(portfolio); err != nil {
+		return err
+	}
+	s.portfolios[userID] = portfolio
+	return nil
+}
+
+func (s *MemoryStore) JournalPortfolio(ctx context.Context, userID string, fn func(*Portfolio) ([]*JournalEntry, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	portfolio := NewPortfolio(userID)
+	if existing, exists := s.portfolios[userID]; exists {
+		if err := deepCopy(existing, portfolio); err != nil {
+			return err
+		}
+	}
+	entries, err := fn(portfolio)
+	if err != nil {
+		return err
+	}
+
+	// 先複製全部分錄，複製失敗時不寫入任何數據
+	copies := make([]*JournalEntry, len(entries))
+	for i, entry := range entries {
+		copies[i] = &JournalEntry{}
+		if err := deepCopy(entry, copies[i]); err != nil {
+			return err
+		}
+	}
+	for _, entry := range copies {
+		s.appendEntryLocked(entry)
+	}
+	s.portfolios[userID] = portfolio
+	return nil
+}
+
+func (s *MemoryStore) SavePortfolio(ctx context.Context, portfolio *Portfolio) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var copied Portfolio
+	if err := deepCopy(portfolio, &copied); err != nil {
+		return err
+	}
+	s.portfolios[portfolio.UserID] = &copied
+	return nil
+}
+
+func (s *MemoryStore) GetStats(ctx context.Context, userID string) (*TradingStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats, exists := s.stats[userID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	copied := *stats
+	return &copied, nil
+}
+
+func (s *MemoryStore) UpdateStats(ctx context.Context, userID string, fn func(*TradingStats) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := newTradingStats(userID)
+	if existing, exists := s.stats[userID]; exists {
+		*stats = *existing
+	}
+	if err := fn(stats); err != nil {
+		return err
+	}
+	s.stats[userID] = stats
+	return nil
+}
+
+func (s *MemoryStore) DeleteStats(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.stats, userID)
+	return nil
+}
+
+func (s *MemoryStore) GetConfig(ctx context.Context, key string, dest interface{}) error {
+	s.mu.Lock()
+	data, exists := s.configs[key]
+	s.mu.Unlock()
+
+	if !exists {
+		return ErrNotFound
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func (s *MemoryStore) SetConfig(ctx context.Context, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.configs[key] = data
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) GetSecurity(ctx context.Context, symbol string) (*models.Security, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	security, exists := s.securities[symbol]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return &security, nil
+}
+
+func (s *MemoryStore) ListSecurities(ctx context.Context) ([]*models.Security, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	securities := make([]*models.Security, 0, len(s.securities))
+	for _, security := range s.securities {
+		security := security
+		securities = append(securities, &security)
+	}
+	sort.Slice(securities, func(i, j int) bool { return securities[i].Symbol < securities[j].Symbol })
+	return securities, nil
+}
+
+func (s *MemoryStore) SaveSecurity(ctx context.Context, security *models.Security) error {
+	s.mu.Lock()
+	s.securities[security.Symbol] = *security
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) AppendEntry(ctx context.Context, entry *JournalEntry) error {
+	var copied JournalEntry
+	if err := deepCopy(entry, &copied); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.appendEntryLocked(&copied)
+	return nil
+}
+
+// 調用方須持有 s.mu
+func (s *MemoryStore) appendEntryLocked(entry *JournalEntry) {
+	if s.ledgerIDs[entry.ID] {
+		return
+	}
+	s.ledgerIDs[entry.ID] = true
+	s.ledger = append(s.ledger, entry)
+}
+
+func (s *MemoryStore) ListEntries(ctx context.Context, userID string, limit int) ([]*JournalEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]*JournalEntry, 0)
+	for i := len(s.ledger) - 1; i >= 0 && (limit <= 0 || len(entries) < limit); i-- {
+		if s.ledger[i].UserID == userID {
+			var copied JournalEntry
+			if err := deepCopy(s.ledger[i], &copied); err != nil {
+				return nil, err
+			}
+			entries = append(entries, &copied)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"trading-api/models"
+)
+
+func testOrder(id, userID, status string, createdAt time.Time) *models.Order {
+	return &models.Order{
+		ID:           id,
+		UserID:       userID,
+		Symbol:       "AAPL",
+		Side:         "buy",
+		OrderType:    models.OrderTypeLimit,
+		Quantity:     models.DecimalFromInt(10),
+		RemainingQty: models.DecimalFromInt(10),
+		Price:        models.DecimalFromInt(100),
+		Status:       status,
+		TimeInForce:  models.TimeInForceGTC,
+		CreatedAt:    createdAt,
+		UpdatedAt:    createdAt,
+	}
+}
+
+func TestMemoryOrderStore(t *testing.T) {
+	var store OrderStore = NewMemoryStore()
+	ctx := context.Background()
+	base := time.Now().Truncate(time.Millisecond)
+
+	orders := []*models.Order{
+		testOrder("o1", "u1", models.OrderStatusNew, base),
+		testOrder("o2", "u1", models.OrderStatusFilled, base.Add(time.Second)),
+		testOrder("o3", "u1", models.OrderStatusPartiallyFilled, base.Add(2*time.Second)),
+		testOrder("o4", "u2", models.OrderStatusNew, base.Add(-time.Second)),
+		testOrder("o5", "u2", models.OrderStatusHeld, base.Add(3*time.Second)),
+	}
+	for _, order := range orders {
+		if err := store.SaveOrder(ctx, order); err != nil {
+			t.Fatalf("保存訂單 %s 失敗: %v", order.ID, err)
+		}
+	}
+
+	// 讀取返回副本，修改不影響存儲
+	got, err := store.GetOrder(ctx, "o1")
+	if err != nil {
+		t.Fatalf("讀取訂單失敗: %v", err)
+	}
+	got.Status = models.OrderStatusCancelled
+	if again, _ := store.GetOrder(ctx, "o1"); again.Status != models.OrderStatusNew {
+		t.Errorf("修改讀取結果影響了存儲: 狀態 = %s", again.Status)
+	}
+	if _, err := store.GetOrder(ctx, "missing"); err != ErrNotFound {
+		t.Errorf("不存在的訂單 err = %v, 期望 ErrNotFound", err)
+	}
+
+	// 版本較舊的副本不覆蓋已保存的修改
+	stale, _ := store.GetOrder(ctx, "o1")
+	amended := stale.Clone()
+	amended.Price = models.DecimalFromInt(101)
+	amended.Touch(time.Now())
+	if err := store.SaveOrder(ctx, amended); err != nil {
+		t.Fatalf("保存新版本失敗: %v", err)
+	}
+	stale.Status = models.OrderStatusFilled
+	if err := store.SaveOrder(ctx, stale); err != ErrStaleOrder {
+		t.Errorf("保存舊版本 err = %v, 期望 ErrStaleOrder", err)
+	}
+	if again, _ := store.GetOrder(ctx, "o1"); again.Status != models.OrderStatusNew || again.Price != amended.Price {
+		t.Errorf("訂單 = %+v, 期望保留新版本的修改", again)
+	}
+
+	// 游標分頁：由新到舊，每頁一筆
+	var ids []string
+	query := OrderQuery{UserID: "u1", Desc: true, Limit: 1}
+	for {
+		page, err := store.ListUserOrders(ctx, query)
+		if err != nil {
+			t.Fatalf("列出訂單失敗: %v", err)
+		}
+		for _, order := range page.Orders {
+			ids = append(ids, order.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if want := []string{"o3", "o2", "o1"}; !slices.Equal(ids, want) {
+		t.Errorf("分頁結果 = %v, 期望 %v", ids, want)
+	}
+
+	page, err := store.ListUserOrders(ctx, OrderQuery{UserID: "u1", Statuses: []string{models.OrderStatusFilled}})
+	if err != nil || len(page.Orders) != 1 || page.Orders[0].ID != "o2" {
+		t.Errorf("按狀態過濾 = %+v, err = %v, 期望只有 o2", page, err)
+	}
+	if _, err := store.ListUserOrders(ctx, OrderQuery{UserID: "u1", Cursor: "!"}); err != ErrInvalidCursor {
+		t.Errorf("無效游標 err = %v, 期望 ErrInvalidCursor", err)
+	}
+
+	// 所有用戶的未完成訂單按創建時間升序返回
+	active, err := store.ListActiveOrders(ctx)
+	if err != nil {
+		t.Fatalf("列出未完成訂單失敗: %v", err)
+	}
+	ids = ids[:0]
+	for _, order := range active {
+		ids = append(ids, order.ID)
+	}
+	if want := []string{"o4", "o1", "o3"}; !slices.Equal(ids, want) {
+		t.Errorf("未完成訂單 = %v, 期望 %v", ids, want)
+	}
+}
+
+func TestMemoryPortfolioStore(t *testing.T) {
+	var store PortfolioStore = NewMemoryStore()
+	ctx := context.Background()
+
+	if _, err := store.GetPortfolio(ctx, "u1"); err != ErrNotFound {
+		t.Fatalf("新用戶 err = %v, 期望 ErrNotFound", err)
+	}
+
+	// 不存在時以初始投資組合調用 fn
+	err := store.UpdatePortfolio(ctx, "u1", func(portfolio *Portfolio) error {
+		if portfolio.CashBalance != InitialCashBalance {
+			t.Errorf("初始現金 = %v, 期望 %v", portfolio.CashBalance, InitialCashBalance)
+		}
+		portfolio.CashBalance -= models.DecimalFromInt(500)
+		portfolio.Positions["AAPL"] = &Position{Symbol: "AAPL", Quantity: models.DecimalFromInt(5)}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("更新投資組合失敗: %v", err)
+	}
+
+	// fn 返回錯誤時不保存
+	rejected := errors.New("拒絕")
+	err = store.UpdatePortfolio(ctx, "u1", func(portfolio *Portfolio) error {
+		portfolio.CashBalance = 0
+		return rejected
+	})
+	if err != rejected {
+		t.Errorf("err = %v, 期望返回 fn 的錯誤", err)
+	}
+
+	portfolio, err := store.GetPortfolio(ctx, "u1")
+	if err != nil {
+		t.Fatalf("讀取投資組合失敗: %v", err)
+	}
+	if want := InitialCashBalance - models.DecimalFromInt(500); portfolio.CashBalance != want {
+		t.Errorf("現金 = %v, 期望 %v", portfolio.CashBalance, want)
+	}
+	if position := portfolio.Positions["AAPL"]; position == nil || position.Quantity != models.DecimalFromInt(5) {
+		t.Errorf("持倉 = %+v, 期望 5 股 AAPL", position)
+	}
+
+	// 讀取返回深拷貝
+	portfolio.Positions["AAPL"].Quantity = 0
+	if again, _ := store.GetPortfolio(ctx, "u1"); again.Positions["AAPL"].Quantity != models.DecimalFromInt(5) {
+		t.Error("修改讀取結果影響了存儲")
+	}
+
+	// 投資組合與分錄同時寫入；fn 返回錯誤時兩者均不保存，已存在的分錄ID不重複記賬
+	ledger := store.(LedgerStore)
+	entry := &JournalEntry{ID: "e1", UserID: "u1", Type: EntryDeposit}
+	journal := func(err error) error {
+		return store.JournalPortfolio(ctx, "u1", func(portfolio *Portfolio) ([]*JournalEntry, error) {
+			portfolio.CashBalance += models.DecimalFromInt(100)
+			return []*JournalEntry{entry}, err
+		})
+	}
+	if err := journal(rejected); err != rejected {
+		t.Errorf("err = %v, 期望返回 fn 的錯誤", err)
+	}
+	if entries, _ := ledger.ListEntries(ctx, "u1", 0); len(entries) != 0 {
+		t.Errorf("fn 失敗時不應過賬: %+v", entries)
+	}
+	for i := 0; i < 2; i++ {
+		if err := journal(nil); err != nil {
+			t.Fatalf("記賬更新投資組合失敗: %v", err)
+		}
+	}
+	if entries, _ := ledger.ListEntries(ctx, "u1", 0); len(entries) != 1 {
+		t.Errorf("分錄 %d 筆, 期望 1 筆", len(entries))
+	}
+	if portfolio, err = store.GetPortfolio(ctx, "u1"); err != nil {
+		t.Fatalf("讀取投資組合失敗: %v", err)
+	}
+	if want := InitialCashBalance - models.DecimalFromInt(300); portfolio.CashBalance != want {
+		t.Errorf("現金 = %v, 期望 %v", portfolio.CashBalance, want)
+	}
+
+	err = store.UpdateStats(ctx, "u1", func(stats *TradingStats) error {
+		stats.TotalTrades++
+		return nil
+	})
+	if stats, _ := store.GetStats(ctx, "u1"); err != nil || stats == nil || stats.TotalTrades != 1 {
+		t.Errorf("交易統計 = %+v, err = %v, 期望 1 筆交易", stats, err)
+	}
+	if err := store.DeleteStats(ctx, "u1"); err != nil {
+		t.Fatalf("刪除交易統計失敗: %v", err)
+	}
+	if _, err := store.GetStats(ctx, "u1"); err != ErrNotFound {
+		t.Errorf("刪除後 err = %v, 期望 ErrNotFound", err)
+	}
+}
@@ -0,0 +1,656 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"trading-api/models"
+)
+
+// 終態訂單在Redis中的保留時間，活躍訂單不過期
+const terminalOrderTTL = 30 * 24 * time.Hour
+
+// 基於Redis的存儲，實現 OrderStore、TradeStore、PortfolioStore、ConfigStore、SecurityStore 和 LedgerStore
+type RedisStore struct {
+	redis *redis.Client
+}
+
+func NewRedisStore(redisClient *redis.Client) *RedisStore {
+	return &RedisStore{redis: redisClient}
+}
+
+var (
+	_ OrderStore     = (*RedisStore)(nil)
+	_ TradeStore     = (*RedisStore)(nil)
+	_ PortfolioStore = (*RedisStore)(nil)
+	_ ConfigStore    = (*RedisStore)(nil)
+	_ SecurityStore  = (*RedisStore)(nil)
+	_ LedgerStore    = (*RedisStore)(nil)
+)
+
+func orderKey(orderID string) string {
+	return fmt.Sprintf("order:%s", orderID)
+}
+
+// 用戶訂單索引：有序集合，分數為創建時間（毫秒）
+func userOrdersKey(userID string) string {
+	return fmt.Sprintf("user_orders:%s", userID)
+}
+
+// 用戶按狀態劃分的訂單索引
+func userStatusOrdersKey(userID, status string) string {
+	return fmt.Sprintf("user_orders:%s:%s", userID, status)
+}
+
+func portfolioKey(userID string) string {
+	return fmt.Sprintf("portfolio:%s", userID)
+}
+
+func statsKey(userID string) string {
+	return fmt.Sprintf("trading_stats:%s", userID)
+}
+
+// 用戶分錄：列表，按過賬先後追加；不設過期時間
+func ledgerKey(userID string) string {
+	return fmt.Sprintf("ledger:%s", userID)
+}
+
+// 用戶已過賬的分錄ID集合，用於去重
+func ledgerIDsKey(userID string) string {
+	return fmt.Sprintf("ledger_ids:%s", userID)
+}
+
+// 證券參考數據：哈希表，欄位為股票代碼
+const securitiesKey = "securities"
+
+// 讀取JSON值到 dest，鍵不存在時返回 ErrNotFound
+func getJSON(ctx context.Context, client redis.Cmdable, key string, dest interface{}) error {
+	data, err := client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), dest)
+}
+
+func (s *RedisStore) GetOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	var order models.Order
+	if err := getJSON(ctx, s.redis, orderKey(orderID), &order); err != nil {
+		return nil, err
+	}
+	order.NormalizeStatus()
+	return &order, nil
+}
+
+// 活躍訂單不設過期時間，由有效期規則負責終止；終態訂單保留30天
+// 訂單與用戶索引、狀態索引在同一事務中更新
+func (s *RedisStore) SaveOrder(ctx context.Context, order *models.Order) error {
+	orderJSON, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	var ttl time.Duration
+	if order.IsTerminal() {
+		ttl = terminalOrderTTL
+	}
+	key := orderKey(order.ID)
+	return watchKeys(ctx, s.redis, func(tx *redis.Tx) error {
+		storedJSON, err := tx.Get(ctx, key).Bytes()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil {
+			var stored struct {
+				Version int64 `json:"version"`
+			}
+			if err := json.Unmarshal(storedJSON, &stored); err != nil {
+				return err
+			}
+			if stored.Version > order.Version {
+				return ErrStaleOrder
+			}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, orderJSON, ttl)
+			indexOrder(ctx, pipe, order)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+// 將訂單加入用戶索引及當前狀態的索引，並從其他狀態的索引移除
+func indexOrder(ctx context.Context, pipe redis.Pipeliner, order *models.Order) {
+	member := &redis.Z{Score: float64(OrderSortKey(order)), Member: order.ID}
+	pipe.ZAdd(ctx, userOrdersKey(order.UserID), member)
+	for _, status := range models.OrderStatuses {
+		if status != order.Status {
+			pipe.ZRem(ctx, userStatusOrdersKey(order.UserID, status), order.ID)
+		}
+	}
+	pipe.ZAdd(ctx, userStatusOrdersKey(order.UserID, order.Status), member)
+}
+
+// 從用戶的全部索引中移除已過期的訂單
+func (s *RedisStore) unindexOrders(ctx context.Context, userID string, orderIDs []string) error {
+	if len(orderIDs) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(orderIDs))
+	for i, id := range orderIDs {
+		members[i] = id
+	}
+	_, err := s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, userOrdersKey(userID), members...)
+		for _, status := range models.OrderStatuses {
+			pipe.ZRem(ctx, userStatusOrdersKey(userID, status), members...)
+		}
+		return nil
+	})
+	return err
+}
+
+// 為建立索引之前保存的訂單補建索引，完成後寫入標記，之後啟動不再重複
+func (s *RedisStore) EnsureOrderIndexes(ctx context.Context) error {
+	const markerKey = "order_indexes:v1"
+
+	exists, err := s.redis.Exists(ctx, markerKey).Result()
+	if err != nil || exists > 0 {
+		return err
+	}
+
+	var cursor uint64
+	for {
+		keys, next, err := s.redis.Scan(ctx, cursor, "order:*", 500).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			values, err := s.redis.MGet(ctx, keys...).Result()
+			if err != nil {
+				return err
+			}
+			_, err = s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, value := range values {
+					data, ok := value.(string)
+					if !ok {
+						continue
+					}
+					var order models.Order
+					if json.Unmarshal([]byte(data), &order) != nil || order.ID == "" {
+						continue
+					}
+					order.NormalizeStatus()
+					indexOrder(ctx, pipe, &order)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	return s.redis.Set(ctx, markerKey, time.Now().Format(time.RFC3339), 0).Err()
+}
+
+// 從各用戶未完成狀態的索引收集訂單，索引中已過期的訂單跳過
+func (s *RedisStore) ListActiveOrders(ctx context.Context) ([]*models.Order, error) {
+	seen := make(map[string]bool)
+	orders := make([]*models.Order, 0)
+	for _, status := range []string{models.OrderStatusNew, models.OrderStatusPartiallyFilled} {
+		var cursor uint64
+		for {
+			keys, next, err := s.redis.Scan(ctx, cursor, userStatusOrdersKey("*", status), 500).Result()
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range keys {
+				ids, err := s.redis.ZRange(ctx, key, 0, -1).Result()
+				if err != nil {
+					return nil, err
+				}
+				for _, id := range ids {
+					if seen[id] {
+						continue
+					}
+					seen[id] = true
+					order, err := s.GetOrder(ctx, id)
+					if err == ErrNotFound {
+						continue
+					}
+					if err != nil {
+						return nil, err
+					}
+					if order.IsActive() {
+						orders = append(orders, order)
+					}
+				}
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+	}
+
+	SortOrdersByCreation(orders)
+	return orders, nil
+}
+
+// 只有一個狀態條件時使用狀態索引，其餘條件在讀取訂單後過濾
+// 索引中已過期的訂單在讀取時順便清除
+func (s *RedisStore) ListUserOrders(ctx context.Context, query OrderQuery) (*OrderPage, error) {
+	cursor, err := DecodeOrderCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	key := userOrdersKey(query.UserID)
+	if len(query.Statuses) == 1 {
+		key = userStatusOrdersKey(query.UserID, query.Statuses[0])
+	}
+	rangeBy := orderScoreRange(query, cursor)
+
+	want := query.Limit + 1
+	if query.Limit <= 0 {
+		want = math.MaxInt
+	}
+	rangeBy.Count = int64(max(min(want, 1000)*2, 100))
+
+	orders := make([]*models.Order, 0)
+	var expired []string
+	for len(orders) < want {
+		var ids []string
+		if query.Desc {
+			ids, err = s.redis.ZRevRangeByScore(ctx, key, rangeBy).Result()
+		} else {
+			ids, err = s.redis.ZRangeByScore(ctx, key, rangeBy).Result()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		keys := make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = orderKey(id)
+		}
+		values, err := s.redis.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for i, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				expired = append(expired, ids[i])
+				continue
+			}
+			var order models.Order
+			if err := json.Unmarshal([]byte(data), &order); err != nil {
+				continue
+			}
+			order.NormalizeStatus()
+
+			if !cursor.Follows(OrderSortKey(&order), order.ID, query.Desc) || !query.Matches(&order) {
+				continue
+			}
+			orders = append(orders, &order)
+			if len(orders) == want {
+				break
+			}
+		}
+
+		if int64(len(ids)) < rangeBy.Count {
+			break
+		}
+		rangeBy.Offset += rangeBy.Count
+	}
+
+	if err := s.unindexOrders(ctx, query.UserID, expired); err != nil {
+		return nil, err
+	}
+	return NewOrderPage(orders, query.Limit), nil
+}
+
+// 按時間範圍及游標計算有序集合的分數區間
+func orderScoreRange(query OrderQuery, cursor *OrderCursor) *redis.ZRangeBy {
+	rangeBy := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+
+	lower, upper := int64(math.MinInt64), int64(math.MaxInt64)
+	if query.From != nil {
+		lower = query.From.UnixMilli()
+	}
+	if query.To != nil {
+		upper = query.To.UnixMilli()
+	}
+	// 游標所在的毫秒仍需掃描，同一毫秒內的訂單按ID過濾
+	if cursor != nil {
+		if query.Desc {
+			upper = min(upper, cursor.CreatedMs)
+		} else {
+			lower = max(lower, cursor.CreatedMs)
+		}
+	}
+
+	if lower != math.MinInt64 {
+		rangeBy.Min = strconv.FormatInt(lower, 10)
+	}
+	if upper != math.MaxInt64 {
+		rangeBy.Max = strconv.FormatInt(upper, 10)
+	}
+	return rangeBy
+}
+
+func (s *RedisStore) SaveTrade(ctx context.Context, trade *TradeRecord) error {
+	tradeJSON, err := json.Marshal(trade)
+	if err != nil {
+		return err
+	}
+
+	// 保存個別交易記錄
+	tradeKey := fmt.Sprintf("trade:%s", trade.ID)
+	if err := s.redis.Set(ctx, tradeKey, tradeJSON, time.Hour*24*365).Err(); err != nil {
+		return err
+	}
+
+	// 添加到用戶交易列表
+	userTradesKey := fmt.Sprintf("user_trades:%s", trade.UserID)
+	s.redis.LPush(ctx, userTradesKey, trade.ID)
+	s.redis.Expire(ctx, userTradesKey, time.Hour*24*365)
+
+	// 添加到股票交易列表
+	symbolTradesKey := fmt.Sprintf("symbol_trades:%s", trade.Symbol)
+	s.redis.LPush(ctx, symbolTradesKey, trade.ID)
+	s.redis.Expire(ctx, symbolTradesKey, time.Hour*24*30)
+
+	// 添加到日期索引
+	dateKey := fmt.Sprintf("trades_date:%s", trade.ExecutedAt.Format("2006-01-02"))
+	s.redis.LPush(ctx, dateKey, trade.ID)
+	s.redis.Expire(ctx, dateKey, time.Hour*24*90)
+
+	return nil
+}
+
+func (s *RedisStore) ListUserTrades(ctx context.Context, userID string, limit int) ([]*TradeRecord, error) {
+	return s.listTrades(ctx, fmt.Sprintf("user_trades:%s", userID), limit)
+}
+
+func (s *RedisStore) ListSymbolTrades(ctx context.Context, symbol string, limit int) ([]*TradeRecord, error) {
+	return s.listTrades(ctx, fmt.Sprintf("symbol_trades:%s", symbol), limit)
+}
+
+// 按交易ID列表讀取交易記錄，已過期的記錄跳過
+func (s *RedisStore) listTrades(ctx context.Context, listKey string, limit int) ([]*TradeRecord, error) {
+	tradeIDs, err := s.redis.LRange(ctx, listKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	trades := make([]*TradeRecord, 0, len(tradeIDs))
+	for _, tradeID := range tradeIDs {
+		var trade TradeRecord
+		if err := getJSON(ctx, s.redis, fmt.Sprintf("trade:%s", tradeID), &trade); err != nil {
+			continue
+		}
+		trades = append(trades, &trade)
+	}
+	return trades, nil
+}
+
+func (s *RedisStore) DeleteUserTrades(ctx context.Context, userID string) error {
+	return s.redis.Del(ctx, fmt.Sprintf("user_trades:%s", userID)).Err()
+}
+
+func (s *RedisStore) GetPortfolio(ctx context.Context, userID string) (*Portfolio, error) {
+	var portfolio Portfolio
+	if err := getJSON(ctx, s.redis, portfolioKey(userID), &portfolio); err != nil {
+		return nil, err
+	}
+	if portfolio.Positions == nil {
+		portfolio.Positions = make(map[string]*Position)
+	}
+	return &portfolio, nil
+}
+
+// 以 WATCH/MULTI 事務完成讀-改-寫，並發成交不會互相覆蓋
+func (s *RedisStore) UpdatePortfolio(ctx context.Context, userID string, fn func(*Portfolio) error) error {
+	key := portfolioKey(userID)
+
+	return watchKeys(ctx, s.redis, func(tx *redis.Tx) error {
+		portfolio := NewPortfolio(userID)
+		if err := getJSON(ctx, tx, key, portfolio); err != nil && err != ErrNotFound {
+			return err
+		}
+		if portfolio.Positions == nil {
+			portfolio.Positions = make(map[string]*Position)
+		}
+
+		if err := fn(portfolio); err != nil {
+			return err
+		}
+
+		portfolioJSON, err := json.Marshal(portfolio)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, portfolioJSON, time.Hour*24*365)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+// 同時監視投資組合及賬本分錄ID集合，投資組合與新分錄在同一 MULTI 中提交；衝突重試時 fn 重新執行
+func (s *RedisStore) JournalPortfolio(ctx context.Context, userID string, fn func(*Portfolio) ([]*JournalEntry, error)) error {
+	key := portfolioKey(userID)
+	idsKey := ledgerIDsKey(userID)
+
+	return watchKeys(ctx, s.redis, func(tx *redis.Tx) error {
+		portfolio := NewPortfolio(userID)
+		if err := getJSON(ctx, tx, key, portfolio); err != nil && err != ErrNotFound {
+			return err
+		}
+		if portfolio.Positions == nil {
+			portfolio.Positions = make(map[string]*Position)
+		}
+
+		entries, err := fn(portfolio)
+		if err != nil {
+			return err
+		}
+
+		portfolioJSON, err := json.Marshal(portfolio)
+		if err != nil {
+			return err
+		}
+		// 只寫入賬本中尚不存在的分錄，同一批內重複的ID只取第一筆
+		var pending []*JournalEntry
+		var entriesJSON [][]byte
+		for _, entry := range entries {
+			exists, err := tx.SIsMember(ctx, idsKey, entry.ID).Result()
+			if err != nil {
+				return err
+			}
+			if exists || slices.ContainsFunc(pending, func(e *JournalEntry) bool { return e.ID == entry.ID }) {
+				continue
+			}
+			entryJSON, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, entry)
+			entriesJSON = append(entriesJSON, entryJSON)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, portfolioJSON, time.Hour*24*365)
+			for i, entry := range pending {
+				pipe.SAdd(ctx, idsKey, entry.ID)
+				pipe.RPush(ctx, ledgerKey(userID), entriesJSON[i])
+			}
+			return nil
+		})
+		return err
+	}, key, idsKey)
+}
+
+func (s *RedisStore) SavePortfolio(ctx context.Context, portfolio *Portfolio) error {
+	portfolioJSON, err := json.Marshal(portfolio)
+	if err != nil {
+		return err
+	}
+	return s.redis.Set(ctx, portfolioKey(portfolio.UserID), portfolioJSON, time.Hour*24*365).Err()
+}
+
+func (s *RedisStore) GetStats(ctx context.Context, userID string) (*TradingStats, error) {
+	var stats TradingStats
+	if err := getJSON(ctx, s.redis, statsKey(userID), &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// 與投資組合相同，以事務避免並發更新丟失
+func (s *RedisStore) UpdateStats(ctx context.Context, userID string, fn func(*TradingStats) error) error {
+	key := statsKey(userID)
+
+	return watchKeys(ctx, s.redis, func(tx *redis.Tx) error {
+		stats := newTradingStats(userID)
+		if err := getJSON(ctx, tx, key, stats); err != nil && err != ErrNotFound {
+			return err
+		}
+
+		if err := fn(stats); err != nil {
+			return err
+		}
+
+		statsJSON, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, statsJSON, time.Hour*24*365)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+func (s *RedisStore) DeleteStats(ctx context.Context, userID string) error {
+	return s.redis.Del(ctx, statsKey(userID)).Err()
+}
+
+func (s *RedisStore) GetConfig(ctx context.Context, key string, dest interface{}) error {
+	return getJSON(ctx, s.redis, key, dest)
+}
+
+func (s *RedisStore) SetConfig(ctx context.Context, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.redis.Set(ctx, key, data, time.Hour*24*365).Err()
+}
+
+func (s *RedisStore) GetSecurity(ctx context.Context, symbol string) (*models.Security, error) {
+	data, err := s.redis.HGet(ctx, securitiesKey, symbol).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var security models.Security
+	if err := json.Unmarshal([]byte(data), &security); err != nil {
+		return nil, err
+	}
+	return &security, nil
+}
+
+func (s *RedisStore) ListSecurities(ctx context.Context) ([]*models.Security, error) {
+	values, err := s.redis.HGetAll(ctx, securitiesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	securities := make([]*models.Security, 0, len(values))
+	for _, data := range values {
+		var security models.Security
+		if err := json.Unmarshal([]byte(data), &security); err != nil {
+			return nil, err
+		}
+		securities = append(securities, &security)
+	}
+	sort.Slice(securities, func(i, j int) bool { return securities[i].Symbol < securities[j].Symbol })
+	return securities, nil
+}
+
+func (s *RedisStore) SaveSecurity(ctx context.Context, security *models.Security) error {
+	data, err := json.Marshal(security)
+	if err != nil {
+		return err
+	}
+	return s.redis.HSet(ctx, securitiesKey, security.Symbol, data).Err()
+}
+
+// 分錄與ID集合在同一事務中寫入，並發重複過賬時只保留一筆
+func (s *RedisStore) AppendEntry(ctx context.Context, entry *JournalEntry) error {
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	idsKey := ledgerIDsKey(entry.UserID)
+
+	return watchKeys(ctx, s.redis, func(tx *redis.Tx) error {
+		exists, err := tx.SIsMember(ctx, idsKey, entry.ID).Result()
+		if err != nil || exists {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SAdd(ctx, idsKey, entry.ID)
+			pipe.RPush(ctx, ledgerKey(entry.UserID), entryJSON)
+			return nil
+		})
+		return err
+	}, idsKey)
+}
+
+func (s *RedisStore) ListEntries(ctx context.Context, userID string, limit int) ([]*JournalEntry, error) {
+	start := int64(0)
+	if limit > 0 {
+		start = int64(-limit)
+	}
+	values, err := s.redis.LRange(ctx, ledgerKey(userID), start, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*JournalEntry, 0, len(values))
+	for i := len(values) - 1; i >= 0; i-- {
+		var entry JournalEntry
+		if err := json.Unmarshal([]byte(values[i]), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"trading-api/models"
+)
+
+// 賣出時扣減稅批的方法
+const (
+	LotMethodFIFO     = "fifo"     // 先進先出
+	LotMethodLIFO     = "lifo"     // 後進先出
+	LotMethodHIFO     = "hifo"     // 單位成本最高者優先
+	LotMethodSpecific = "specific" // 按指定稅批扣減，不足部分使用默認方法
+)
+
+func IsValidLotMethod(method string) bool {
+	switch method {
+	case LotMethodFIFO, LotMethodLIFO, LotMethodHIFO, LotMethodSpecific:
+		return true
+	}
+	return false
+}
+
+// 稅批：一次買入或賣空形成的持倉，數量恆為正；買入成本含手續費，賣空成本為扣除手續費後的所得
+type TaxLot struct {
+	ID         string         `json:"id"`
+	TradeID    string         `json:"tradeId,omitempty"`
+	Quantity   models.Decimal `json:"quantity"` // 剩餘數量
+	UnitCost   models.Decimal `json:"unitCost"`
+	Cost       models.Decimal `json:"cost"`  // 剩餘數量的總成本，按比例扣減，賣完時恰好歸零
+	Price      models.Decimal `json:"price"` // 成交價，不含手續費；賬本按此計量持倉
+	AcquiredAt time.Time      `json:"acquiredAt"`
+}
+
+// 賣單指定的稅批扣減方式，Method 為空時使用默認方法
+type LotSelection struct {
+	Method string   `json:"method,omitempty"`
+	LotIDs []string `json:"lotIds,omitempty"`
+}
+
+// 一筆平倉交易的已實現損益，賣出所得已扣除手續費；空頭平倉時所得為賣空所得，成本為買回淨額
+type RealizedGain struct {
+	Method     string         `json:"method"`
+	Short      bool           `json:"short,omitempty"` // 買入平空
+	Quantity   models.Decimal `json:"quantity"`
+	CostBasis  models.Decimal `json:"costBasis"`
+	Proceeds   models.Decimal `json:"proceeds"`
+	RealizedPL models.Decimal `json:"realizedPL"`
+	Lots       []LotRelief    `json:"lots"`
+
+	allocated models.Decimal // 分攤到平倉部分的交易淨額
+}
+
+// 賣出交易中從單個稅批扣減的部分
+type LotRelief struct {
+	LotID      string         `json:"lotId"`
+	Quantity   models.Decimal `json:"quantity"`
+	UnitCost   models.Decimal `json:"unitCost"`
+	Price      models.Decimal `json:"price"`
+	AcquiredAt time.Time      `json:"acquiredAt"`
+	CostBasis  models.Decimal `json:"costBasis"`
+	Proceeds   models.Decimal `json:"proceeds"`
+	RealizedPL models.Decimal `json:"realizedPL"`
+	LongTerm   bool           `json:"longTerm"` // 持有超過一年
+}
+
+// 按成交更新持倉：先沖減反向持倉的稅批，剩餘數量開立新稅批（買入為多頭，賣出為空頭）。
+// 返回平倉部分的已實現損益，沒有平倉時返回nil
+func (p *Position) applyTrade(trade *TradeRecord, selection LotSelection, defaultMethod string) *RealizedGain {
+	p.ensureLots()
+	closing := p.Quantity != 0 && p.Short == (trade.Side == "buy")
+
+	var realized *RealizedGain
+	openQty, openCost := trade.Quantity, trade.NetAmount
+	if closing {
+		realized = p.relieveLots(trade, selection, defaultMethod)
+		openQty -= realized.Quantity
+		openCost -= realized.allocated
+		if p.Short {
+			realized.reverse()
+		}
+	}
+	if openQty > 0 {
+		p.Short = trade.Side == "sell"
+		p.addLot(trade, openQty, openCost)
+	}
+	return realized
+}
+
+// 以成交的剩餘部分形成新稅批，cost 為分攤的交易淨額（買入含手續費，賣空為扣除手續費後的所得）
+func (p *Position) addLot(trade *TradeRecord, quantity, cost models.Decimal) {
+	p.Lots = append(p.Lots, &TaxLot{
+		ID:         uuid.New().String(),
+		TradeID:    trade.ID,
+		Quantity:   quantity,
+		UnitCost:   cost.Div(quantity),
+		Cost:       cost,
+		Price:      trade.Price,
+		AcquiredAt: trade.ExecutedAt,
+	})
+	p.syncLots()
+}
+
+// 按 selection 扣減稅批並計算已實現損益，defaultMethod 用於未指定或指定稅批不足的部分
+func (p *Position) relieveLots(trade *TradeRecord, selection LotSelection, defaultMethod string) *RealizedGain {
+	p.ensureLots()
+
+	method := selection.Method
+	if method == "" {
+		method = defaultMethod
+	}
+	if len(selection.LotIDs) > 0 {
+		method = LotMethodSpecific
+	}
+
+	gain := &RealizedGain{Method: method, Lots: make([]LotRelief, 0)}
+	remaining := trade.Quantity
+	unallocated := trade.NetAmount
+	for _, lot := range p.reliefOrder(selection.LotIDs, defaultMethod, method) {
+		if remaining <= 0 {
+			break
+		}
+		quantity := models.MinDecimal(lot.Quantity, remaining)
+
+		// 成本及所得按數量比例分攤，最後一份取餘額，合計與稅批成本及交易淨額完全一致
+		cost := lot.remainingCost()
+		if quantity < lot.Quantity {
+			cost = cost.Mul(quantity).Div(lot.Quantity)
+		}
+		proceeds := unallocated
+		if quantity < remaining {
+			proceeds = trade.NetAmount.Mul(quantity).Div(trade.Quantity)
+		}
+		lot.Cost = lot.remainingCost() - cost
+		lot.Quantity -= quantity
+		remaining -= quantity
+		unallocated -= proceeds
+
+		relief := LotRelief{
+			LotID:      lot.ID,
+			Quantity:   quantity,
+			UnitCost:   lot.UnitCost,
+			Price:      lot.Price,
+			AcquiredAt: lot.AcquiredAt,
+			CostBasis:  cost,
+			Proceeds:   proceeds,
+			LongTerm:   trade.ExecutedAt.After(lot.AcquiredAt.AddDate(1, 0, 0)),
+		}
+		relief.RealizedPL = relief.Proceeds - relief.CostBasis
+		gain.Lots = append(gain.Lots, relief)
+		gain.Quantity += quantity
+		gain.CostBasis += relief.CostBasis
+		gain.Proceeds += relief.Proceeds
+	}
+	gain.RealizedPL = gain.Proceeds - gain.CostBasis
+	gain.allocated = gain.Proceeds
+
+	p.syncLots()
+	return gain
+}
+
+// 空頭平倉：稅批成本是賣空所得，買回的淨額才是成本；空頭持有期不計入長期
+func (g *RealizedGain) reverse() {
+	g.Short = true
+	g.CostBasis, g.Proceeds = g.Proceeds, g.CostBasis
+	g.RealizedPL = g.Proceeds - g.CostBasis
+	for i := range g.Lots {
+		lot := &g.Lots[i]
+		lot.CostBasis, lot.Proceeds = lot.Proceeds, lot.CostBasis
+		lot.RealizedPL = lot.Proceeds - lot.CostBasis
+		lot.LongTerm = false
+	}
+}
+
+// 扣減順序：指定的稅批在前，其餘按方法排序
+func (p *Position) reliefOrder(lotIDs []string, defaultMethod, method string) []*TaxLot {
+	order := make([]*TaxLot, 0, len(p.Lots))
+	picked := make(map[string]bool, len(lotIDs))
+	for _, id := range lotIDs {
+		for _, lot := range p.Lots {
+			if lot.ID == id && !picked[id] {
+				order = append(order, lot)
+				picked[id] = true
+			}
+		}
+	}
+
+	rest := make([]*TaxLot, 0, len(p.Lots))
+	for _, lot := range p.Lots {
+		if !picked[lot.ID] {
+			rest = append(rest, lot)
+		}
+	}
+	if method == LotMethodSpecific {
+		method = defaultMethod
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		switch method {
+		case LotMethodLIFO:
+			return rest[i].AcquiredAt.After(rest[j].AcquiredAt)
+		case LotMethodHIFO:
+			return rest[i].UnitCost > rest[j].UnitCost
+		default:
+			return rest[i].AcquiredAt.Before(rest[j].AcquiredAt)
+		}
+	})
+	return append(order, rest...)
+}
+
+// 舊數據只有平均成本時，以現有持倉建立一個稅批；ID固定，重複載入時保持不變
+func (p *Position) ensureLots() {
+	if len(p.Lots) > 0 || p.Quantity <= 0 {
+		return
+	}
+	p.Lots = []*TaxLot{{
+		ID:         "legacy-" + p.Symbol,
+		Quantity:   p.Quantity,
+		UnitCost:   p.AvgCost,
+		Cost:       p.Quantity.Mul(p.AvgCost),
+		Price:      p.AvgCost,
+		AcquiredAt: p.LastUpdated,
+	}}
+}
+
+// 移除已平倉的稅批，並以剩餘稅批重新計算數量與平均成本；空頭持倉的數量為負
+func (p *Position) syncLots() {
+	kept := p.Lots[:0]
+	var quantity, cost models.Decimal
+	for _, lot := range p.Lots {
+		if lot.Quantity <= 0 {
+			continue
+		}
+		kept = append(kept, lot)
+		quantity += lot.Quantity
+		cost += lot.remainingCost()
+	}
+	p.Lots = kept
+	p.Quantity = quantity
+	p.AvgCost = 0
+	if quantity > 0 {
+		p.AvgCost = cost.Div(quantity)
+	}
+	if p.Short {
+		p.Quantity = -quantity
+	}
+}
+
+// 剩餘數量的總成本；未記錄總成本的舊稅批按單位成本計算
+func (l *TaxLot) remainingCost() models.Decimal {
+	if l.Cost == 0 {
+		return l.Quantity.Mul(l.UnitCost)
+	}
+	return l.Cost
+}
+
+// 查找稅批
+func (p *Position) Lot(id string) *TaxLot {
+	p.ensureLots()
+	for _, lot := range p.Lots {
+		if lot.ID == id {
+			return lot
+		}
+	}
+	return nil
+}
+
+// 按成交價計算的持倉成本，不含手續費，與賬本中的證券賬戶對應；空頭為負數
+func (p *Position) PriceCost() models.Decimal {
+	p.ensureLots()
+	var cost models.Decimal
+	for _, lot := range p.Lots {
+		cost += lot.Quantity.Mul(lot.Price)
+	}
+	if p.Short {
+		return -cost
+	}
+	return cost
+}
@@ -2,94 +2,225 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
 )
 
 type TradingHistoryService struct {
-	logger *logrus.Logger
-	redis  *redis.Client
+	logger     *logrus.Logger
+	trades     TradeStore
+	portfolios PortfolioStore
+	ledger     *LedgerService
+	lotMethod  string // 賣單未指定時的稅批扣減方法
+
+	listenersMux  sync.RWMutex
+	listeners     []func(userID string)
+	borrowReturns []func(symbol string, quantity models.Decimal)
 }
 
 type TradeRecord struct {
-	ID            string    `json:"id"`
-	OrderID       string    `json:"orderId"`
-	UserID        string    `json:"userId"`
-	Symbol        string    `json:"symbol"`
-	Side          string    `json:"side"`          // "buy" 或 "sell"
-	Quantity      float64   `json:"quantity"`
-	Price         float64   `json:"price"`
-	Amount        float64   `json:"amount"`        // 總金額
-	Commission    float64   `json:"commission"`    // 手續費
-	NetAmount     float64   `json:"netAmount"`     // 淨額
-	OrderType     string    `json:"orderType"`
-	ExecutedAt    time.Time `json:"executedAt"`
-	MarketPrice   float64   `json:"marketPrice"`   // 當時市價
-	PriceChange   float64   `json:"priceChange"`   // 相對市價的差異
-	IsMarketOpen  bool      `json:"isMarketOpen"`
-	Currency      string    `json:"currency"`
-	Exchange      string    `json:"exchange"`
-	Notes         string    `json:"notes"`
+	ID             string         `json:"id"`
+	OrderID        string         `json:"orderId"`
+	UserID         string         `json:"userId"`
+	Symbol         string         `json:"symbol"`
+	Side           string         `json:"side"` // "buy" 或 "sell"
+	Quantity       models.Decimal `json:"quantity"`
+	Price          models.Decimal `json:"price"`
+	Amount         models.Decimal `json:"amount"`     // 總金額
+	Commission     models.Decimal `json:"commission"` // 手續費，按幣種最小單位四捨五入
+	NetAmount      models.Decimal `json:"netAmount"`  // 淨額
+	OrderType      string         `json:"orderType"`
+	ExecutedAt     time.Time      `json:"executedAt"`
+	MarketPrice    models.Decimal `json:"marketPrice"` // 當時市價
+	PriceChange    models.Decimal `json:"priceChange"` // 相對市價的差異
+	IsMarketOpen   bool           `json:"isMarketOpen"`
+	Currency       string         `json:"currency"`
+	Exchange       string         `json:"exchange"`
+	Notes          string         `json:"notes"`
+	FillID         string         `json:"fillId,omitempty"`
+	Liquidity      string         `json:"liquidity,omitempty"`      // "maker"、"taker" 或 "market"
+	CounterOrderID string         `json:"counterOrderId,omitempty"` // 對手方訂單ID
+	Realized       *RealizedGain  `json:"realized,omitempty"`       // 平倉交易的已實現損益
 }
 
+// 新用戶的初始資金
+const InitialCashBalance = models.DecimalOne * 100000
+
+// 手續費率（0.25%）
+const CommissionRate = models.DecimalOne / 400
+
+// 賬戶類型
+const (
+	AccountTypeCash   = "cash"   // 現金賬戶：只能以現金買入、賣出已有持股
+	AccountTypeMargin = "margin" // 保證金賬戶：可融資買入及賣空
+)
+
 type Portfolio struct {
-	UserID        string             `json:"userId"`
+	UserID        string               `json:"userId"`
+	AccountType   string               `json:"accountType"` // 為空視作現金賬戶
 	Positions     map[string]*Position `json:"positions"`
-	CashBalance   float64            `json:"cashBalance"`
-	TotalValue    float64            `json:"totalValue"`
-	TotalPL       float64            `json:"totalPL"`     // 總損益
-	DayPL         float64            `json:"dayPL"`       // 當日損益
-	LastUpdated   time.Time          `json:"lastUpdated"`
+	CashBalance   models.Decimal       `json:"cashBalance"`
+	ReservedCash  models.Decimal       `json:"reservedCash"`  // 掛單預留資金
+	AvailableCash models.Decimal       `json:"availableCash"` // 可用資金（購買力）
+	TotalValue    models.Decimal       `json:"totalValue"`
+	TotalPL       models.Decimal       `json:"totalPL"` // 總損益
+	DayPL         models.Decimal       `json:"dayPL"`   // 當日損益
+	LastUpdated   time.Time            `json:"lastUpdated"`
 }
 
 type Position struct {
-	Symbol        string    `json:"symbol"`
-	Quantity      float64   `json:"quantity"`
-	AvgCost       float64   `json:"avgCost"`       // 平均成本
-	MarketValue   float64   `json:"marketValue"`   // 市值
-	UnrealizedPL  float64   `json:"unrealizedPL"`  // 未實現損益
-	DayPL         float64   `json:"dayPL"`         // 當日損益
-	LastPrice     float64   `json:"lastPrice"`     // 最新價格
-	PreviousClose float64   `json:"previousClose"` // 前收盤價
-	LastUpdated   time.Time `json:"lastUpdated"`
+	Symbol        string         `json:"symbol"`
+	Quantity      models.Decimal `json:"quantity"`
+	ReservedQty   models.Decimal `json:"reservedQuantity"`  // 賣單預留股數
+	AvailableQty  models.Decimal `json:"availableQuantity"` // 可賣股數
+	AvgCost       models.Decimal `json:"avgCost"`           // 平均成本
+	MarketValue   models.Decimal `json:"marketValue"`       // 市值
+	UnrealizedPL  models.Decimal `json:"unrealizedPL"`      // 未實現損益
+	DayPL         models.Decimal `json:"dayPL"`             // 當日損益
+	LastPrice     models.Decimal `json:"lastPrice"`         // 最新價格
+	PreviousClose models.Decimal `json:"previousClose"`     // 前收盤價
+	LastUpdated   time.Time      `json:"lastUpdated"`
+	Lots          []*TaxLot      `json:"lots"`            // 稅批，數量及平均成本由此計算
+	Short         bool           `json:"short,omitempty"` // 空頭持倉，數量為負
 }
 
 type TradingStats struct {
-	UserID          string    `json:"userId"`
-	TotalTrades     int       `json:"totalTrades"`
-	WinningTrades   int       `json:"winningTrades"`
-	LosingTrades    int       `json:"losingTrades"`
-	WinRate         float64   `json:"winRate"`
-	TotalProfit     float64   `json:"totalProfit"`
-	TotalLoss       float64   `json:"totalLoss"`
-	NetProfit       float64   `json:"netProfit"`
-	LargestWin      float64   `json:"largestWin"`
-	LargestLoss     float64   `json:"largestLoss"`
-	AvgTradeSize    float64   `json:"avgTradeSize"`
-	TotalVolume     float64   `json:"totalVolume"`
-	TotalCommission float64   `json:"totalCommission"`
-	LastUpdated     time.Time `json:"lastUpdated"`
-}
-
-func NewTradingHistoryService(logger *logrus.Logger, redisClient *redis.Client) *TradingHistoryService {
+	UserID          string         `json:"userId"`
+	TotalTrades     int            `json:"totalTrades"`
+	RealizedTrades  int            `json:"realizedTrades"` // 產生已實現損益的賣出交易數
+	WinningTrades   int            `json:"winningTrades"`
+	LosingTrades    int            `json:"losingTrades"`
+	WinRate         float64        `json:"winRate"` // 盈利交易佔已實現交易的百分比
+	TotalProfit     models.Decimal `json:"totalProfit"`
+	TotalLoss       models.Decimal `json:"totalLoss"`
+	NetProfit       models.Decimal `json:"netProfit"`
+	LargestWin      models.Decimal `json:"largestWin"`
+	LargestLoss     models.Decimal `json:"largestLoss"`
+	AvgTradeSize    models.Decimal `json:"avgTradeSize"`
+	TotalVolume     models.Decimal `json:"totalVolume"`
+	TotalCommission models.Decimal `json:"totalCommission"`
+	LastUpdated     time.Time      `json:"lastUpdated"`
+}
+
+func NewTradingHistoryService(logger *logrus.Logger, trades TradeStore, portfolios PortfolioStore, ledger *LedgerService, lotMethod string) *TradingHistoryService {
+	if !IsValidLotMethod(lotMethod) || lotMethod == LotMethodSpecific {
+		lotMethod = LotMethodFIFO
+	}
 	return &TradingHistoryService{
-		logger: logger,
-		redis:  redisClient,
+		logger:     logger,
+		trades:     trades,
+		portfolios: portfolios,
+		ledger:     ledger,
+		lotMethod:  lotMethod,
 	}
 }
 
 // 記錄交易
 func (s *TradingHistoryService) RecordTrade(orderID, userID, symbol, side string, 
-	quantity, price float64, orderType string, marketQuote *StockQuote) (*TradeRecord, error) {
+	quantity, price models.Decimal, orderType string, marketQuote *StockQuote) (*TradeRecord, error) {
 	
-	// 計算手續費（0.25%）
-	amount := quantity * price
-	commission := amount * 0.0025
+	trade := newTradeRecord(orderID, userID, symbol, side, quantity, price, orderType, marketQuote)
+	if err := s.recordTrade(trade, marketQuote, LotSelection{}); err != nil {
+		return nil, err
+	}
+	return trade, nil
+}
+
+// 記錄撮合成交：主動方與被動方各生成一筆交易記錄
+func (s *TradingHistoryService) RecordFill(fill Fill, marketQuote *StockQuote) ([]*TradeRecord, error) {
+	settlement := NewFillSettlement(fill, marketQuote)
+	if err := s.Settle(settlement); err != nil {
+		return nil, err
+	}
+	return settlement.Trades(), nil
+}
+
+// 成交的結算進度。記錄失敗時由調用方保留並重試，重試從失敗的交易繼續，已記賬的交易不重複記賬
+type FillSettlement struct {
+	Fill       Fill
+	Quote      *StockQuote
+	Attempts   int // 已嘗試結算的次數
+	trades     []*TradeRecord
+	selections []LotSelection
+	next       int  // 下一筆待記錄的交易
+	journaled  bool // 下一筆交易已記賬，只差保存交易記錄
+}
+
+// 按成交生成主動方及被動方的交易記錄，尚未記賬
+func NewFillSettlement(fill Fill, marketQuote *StockQuote) *FillSettlement {
+	taker := newTradeRecord(fill.Taker.OrderID, fill.Taker.UserID, fill.Symbol, fill.Taker.Side,
+		fill.Quantity, fill.Price, fill.Taker.OrderType, marketQuote)
+	taker.FillID = fill.ID
+	taker.ExecutedAt = fill.ExecutedAt
+	taker.Liquidity = "market"
+
+	settlement := &FillSettlement{
+		Fill:       fill,
+		Quote:      marketQuote,
+		trades:     []*TradeRecord{taker},
+		selections: []LotSelection{fill.Taker.Lots},
+	}
+
+	if fill.Maker != nil {
+		taker.Liquidity = "taker"
+		taker.CounterOrderID = fill.Maker.OrderID
+
+		maker := newTradeRecord(fill.Maker.OrderID, fill.Maker.UserID, fill.Symbol, fill.Maker.Side,
+			fill.Quantity, fill.Price, fill.Maker.OrderType, marketQuote)
+		maker.FillID = fill.ID
+		maker.ExecutedAt = fill.ExecutedAt
+		maker.Liquidity = "maker"
+		maker.CounterOrderID = fill.Taker.OrderID
+		settlement.trades = append(settlement.trades, maker)
+		settlement.selections = append(settlement.selections, fill.Maker.Lots)
+	}
+	return settlement
+}
+
+// 成交生成的交易記錄
+func (f *FillSettlement) Trades() []*TradeRecord {
+	return f.trades
+}
+
+// 記錄成交的各筆交易，失敗時保留進度，以同一 settlement 再次調用即可重試
+func (s *TradingHistoryService) Settle(settlement *FillSettlement) error {
+	settlement.Attempts++
+	for ; settlement.next < len(settlement.trades); settlement.next++ {
+		trade := settlement.trades[settlement.next]
+		if !settlement.journaled {
+			if err := s.updatePortfolio(trade, settlement.Quote, settlement.selections[settlement.next]); err != nil {
+				return fmt.Errorf("記賬及更新投資組合失敗: %w", err)
+			}
+			settlement.journaled = true
+		}
+		if err := s.saveTrade(trade); err != nil {
+			return err
+		}
+		settlement.journaled = false
+	}
+	return nil
+}
+
+// 創建交易記錄並計算手續費
+func newTradeRecord(orderID, userID, symbol, side string,
+	quantity, price models.Decimal, orderType string, marketQuote *StockQuote) *TradeRecord {
+
+	// 沒有報價時（如到期巡檢）以成交價作為市價，幣種按默認處理
+	marketPrice, currency, exchange, isMarketOpen := price, "", "", false
+	if marketQuote != nil {
+		marketPrice = marketQuote.Price
+		currency, exchange, isMarketOpen = marketQuote.Currency, marketQuote.Exchange, marketQuote.IsMarketOpen
+	}
+
+	// 計算手續費，按報價幣種的最小單位四捨五入
+	amount := quantity.Mul(price)
+	commission := amount.Mul(CommissionRate).RoundCurrency(currency)
 	netAmount := amount
 	
 	if side == "buy" {
@@ -98,8 +229,7 @@ func (s *TradingHistoryService) RecordTrade(orderID, userID, symbol, side string
 		netAmount = amount - commission // 賣出時減手續費
 	}
 
-	// 創建交易記錄
-	trade := &TradeRecord{
+	return &TradeRecord{
 		ID:           uuid.New().String(),
 		OrderID:      orderID,
 		UserID:       userID,
@@ -112,22 +242,28 @@ func (s *TradingHistoryService) RecordTrade(orderID, userID, symbol, side string
 		NetAmount:    netAmount,
 		OrderType:    orderType,
 		ExecutedAt:   time.Now(),
-		MarketPrice:  marketQuote.Price,
-		PriceChange:  price - marketQuote.Price,
-		IsMarketOpen: marketQuote.IsMarketOpen,
-		Currency:     marketQuote.Currency,
-		Exchange:     marketQuote.Exchange,
-		Notes:        fmt.Sprintf("%s %s %g shares at $%.2f", side, symbol, quantity, price),
+		MarketPrice:  marketPrice,
+		PriceChange:  price - marketPrice,
+		IsMarketOpen: isMarketOpen,
+		Currency:     currency,
+		Exchange:     exchange,
+		Notes:        fmt.Sprintf("%s %s %v shares at $%v", side, symbol, quantity, price),
 	}
+}
 
-	// 保存到Redis
-	if err := s.saveTrade(trade); err != nil {
-		return nil, err
+// 更新投資組合並保存交易與統計；賣出交易的已實現損益在扣減稅批時得出，隨交易記錄保存
+func (s *TradingHistoryService) recordTrade(trade *TradeRecord, marketQuote *StockQuote, selection LotSelection) error {
+	// 記賬並更新投資組合，失敗時不保存交易記錄及統計，避免交易歷史與賬本、現金、持倉不一致
+	if err := s.updatePortfolio(trade, marketQuote, selection); err != nil {
+		return fmt.Errorf("記賬及更新投資組合失敗: %w", err)
 	}
+	return s.saveTrade(trade)
+}
 
-	// 更新投資組合
-	if err := s.updatePortfolio(trade, marketQuote); err != nil {
-		s.logger.WithError(err).Error("更新投資組合失敗")
+// 保存已記賬的交易記錄並更新交易統計
+func (s *TradingHistoryService) saveTrade(trade *TradeRecord) error {
+	if err := s.trades.SaveTrade(context.Background(), trade); err != nil {
+		return err
 	}
 
 	// 更新交易統計
@@ -137,71 +273,128 @@ func (s *TradingHistoryService) RecordTrade(orderID, userID, symbol, side string
 
 	s.logger.WithFields(logrus.Fields{
 		"tradeId":   trade.ID,
-		"orderId":   orderID,
-		"symbol":    symbol,
-		"side":      side,
-		"quantity":  quantity,
-		"price":     price,
-		"amount":    amount,
-		"commission": commission,
+		"orderId":   trade.OrderID,
+		"symbol":    trade.Symbol,
+		"side":      trade.Side,
+		"quantity":  trade.Quantity,
+		"price":     trade.Price,
+		"amount":    trade.Amount,
+		"commission": trade.Commission,
+		"liquidity": trade.Liquidity,
 	}).Info("交易記錄已保存")
 
-	return trade, nil
+	return nil
 }
 
-// 保存交易記錄
-func (s *TradingHistoryService) saveTrade(trade *TradeRecord) error {
-	tradeJSON, err := json.Marshal(trade)
+// 更新投資組合並過賬成交分錄：兩者在存儲的同一事務中寫入，並發成交不會互相覆蓋，記賬失敗時投資組合不變。
+// 存儲可能重試 fn，已實現損益及分錄以最後一次成功執行的結果為準
+func (s *TradingHistoryService) updatePortfolio(trade *TradeRecord, marketQuote *StockQuote, selection LotSelection) error {
+	err := s.ledger.Journal(context.Background(), s.portfolios, trade.UserID, func(portfolio *Portfolio) ([]*JournalEntry, error) {
+		trade.Realized = applyTradeToPortfolio(portfolio, trade, marketQuote, selection, s.lotMethod)
+		return tradeEntries(trade), nil
+	})
 	if err != nil {
 		return err
 	}
+	if trade.Realized != nil && trade.Realized.Short {
+		s.notifyBorrowReturn(trade.Symbol, trade.Realized.Quantity)
+	}
+	s.notifyPortfolioChange(trade.UserID)
+	return nil
+}
 
-	ctx := context.Background()
-	
-	// 保存個別交易記錄
-	tradeKey := fmt.Sprintf("trade:%s", trade.ID)
-	if err := s.redis.Set(ctx, tradeKey, tradeJSON, time.Hour*24*365).Err(); err != nil {
+// 讀-改-寫投資組合，fn 返回錯誤時不保存；賬本尚未有該用戶的分錄時保留修改前的狀態，提交後據此建立期初餘額
+func (s *TradingHistoryService) modifyPortfolio(ctx context.Context, userID string, fn func(*Portfolio) error) error {
+	var opening *Portfolio
+	err := s.portfolios.UpdatePortfolio(ctx, userID, func(portfolio *Portfolio) error {
+		opening = nil
+		if !s.ledger.Opened(userID) {
+			opening = &Portfolio{}
+			if err := deepCopy(portfolio, opening); err != nil {
+				return err
+			}
+		}
+		return fn(portfolio)
+	})
+	if err == nil && opening != nil {
+		s.ledger.Open(ctx, opening)
+	}
+	if err == nil {
+		s.notifyPortfolioChange(userID)
+	}
+	return err
+}
+
+// 修改投資組合並在同一事務中過賬 fn 返回的分錄，fn 返回錯誤時兩者均不保存
+func (s *TradingHistoryService) journalPortfolio(ctx context.Context, userID string, fn func(*Portfolio) ([]*JournalEntry, error)) error {
+	if err := s.ledger.Journal(ctx, s.portfolios, userID, fn); err != nil {
 		return err
 	}
+	s.notifyPortfolioChange(userID)
+	return nil
+}
 
-	// 添加到用戶交易列表
-	userTradesKey := fmt.Sprintf("user_trades:%s", trade.UserID)
-	s.redis.LPush(ctx, userTradesKey, trade.ID)
-	s.redis.Expire(ctx, userTradesKey, time.Hour*24*365)
+// 註冊投資組合變動的回調，在修改保存後同步調用
+func (s *TradingHistoryService) OnPortfolioChange(fn func(userID string)) {
+	s.listenersMux.Lock()
+	defer s.listenersMux.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
 
-	// 添加到股票交易列表
-	symbolTradesKey := fmt.Sprintf("symbol_trades:%s", trade.Symbol)
-	s.redis.LPush(ctx, symbolTradesKey, trade.ID)
-	s.redis.Expire(ctx, symbolTradesKey, time.Hour*24*30)
+func (s *TradingHistoryService) notifyPortfolioChange(userID string) {
+	s.listenersMux.RLock()
+	defer s.listenersMux.RUnlock()
+	for _, fn := range s.listeners {
+		fn(userID)
+	}
+}
 
-	// 添加到日期索引
-	dateKey := fmt.Sprintf("trades_date:%s", trade.ExecutedAt.Format("2006-01-02"))
-	s.redis.LPush(ctx, dateKey, trade.ID)
-	s.redis.Expire(ctx, dateKey, time.Hour*24*90)
+// 註冊空頭平倉或重置時歸還借券的回調
+func (s *TradingHistoryService) OnBorrowReturn(fn func(symbol string, quantity models.Decimal)) {
+	s.listenersMux.Lock()
+	defer s.listenersMux.Unlock()
+	s.borrowReturns = append(s.borrowReturns, fn)
+}
 
-	return nil
+func (s *TradingHistoryService) notifyBorrowReturn(symbol string, quantity models.Decimal) {
+	s.listenersMux.RLock()
+	defer s.listenersMux.RUnlock()
+	for _, fn := range s.borrowReturns {
+		fn(symbol, quantity)
+	}
 }
 
-// 更新投資組合
-func (s *TradingHistoryService) updatePortfolio(trade *TradeRecord, marketQuote *StockQuote) error {
+// 重置投資組合為只有 balance 的現金，並記錄重置分錄；賬戶類型保持不變，清除的空頭持倉歸還借券
+func (s *TradingHistoryService) ResetPortfolio(userID string, balance models.Decimal) error {
 	ctx := context.Background()
-	portfolioKey := fmt.Sprintf("portfolio:%s", trade.UserID)
-	
-	// 獲取現有投資組合
-	portfolio, err := s.getPortfolio(trade.UserID)
-	if err != nil {
-		// 創建新投資組合
-		portfolio = &Portfolio{
-			UserID:      trade.UserID,
-			Positions:   make(map[string]*Position),
-			CashBalance: 100000.0, // 初始資金10萬美元
-			TotalValue:  100000.0,
-			TotalPL:     0,
-			DayPL:       0,
-			LastUpdated: time.Now(),
+	var shorts map[string]models.Decimal
+	// 重置分錄按重置前的投資組合生成，與重置後的投資組合在同一事務中寫入
+	err := s.journalPortfolio(ctx, userID, func(portfolio *Portfolio) ([]*JournalEntry, error) {
+		entry := resetEntry(portfolio, balance)
+		shorts = make(map[string]models.Decimal)
+		for symbol, position := range portfolio.Positions {
+			if position.Short {
+				shorts[symbol] = -position.Quantity
+			}
 		}
+		accountType := portfolio.AccountType
+		*portfolio = *NewPortfolio(userID)
+		portfolio.AccountType = accountType
+		portfolio.CashBalance = balance
+		portfolio.TotalValue = balance
+		return []*JournalEntry{entry}, nil
+	})
+	if err != nil {
+		return err
+	}
+	for symbol, quantity := range shorts {
+		s.notifyBorrowReturn(symbol, quantity)
 	}
+	return nil
+}
 
+// 將一筆交易計入投資組合，平倉時返回已實現損益
+func applyTradeToPortfolio(portfolio *Portfolio, trade *TradeRecord, marketQuote *StockQuote, selection LotSelection, lotMethod string) *RealizedGain {
 	// 更新現金餘額
 	if trade.Side == "buy" {
 		portfolio.CashBalance -= trade.NetAmount
@@ -219,35 +412,25 @@ func (s *TradingHistoryService) updatePortfolio(trade *TradeRecord, marketQuote
 			MarketValue:   0,
 			UnrealizedPL:  0,
 			DayPL:         0,
-			LastPrice:     marketQuote.Price,
-			PreviousClose: marketQuote.PreviousClose,
+			LastPrice:     trade.Price,
 			LastUpdated:   time.Now(),
 		}
+		if marketQuote != nil {
+			position.LastPrice = marketQuote.Price
+			position.PreviousClose = marketQuote.PreviousClose
+		}
 		portfolio.Positions[trade.Symbol] = position
 	}
 
-	if trade.Side == "buy" {
-		// 買入：更新平均成本
-		totalCost := position.Quantity*position.AvgCost + trade.Quantity*trade.Price
-		position.Quantity += trade.Quantity
-		if position.Quantity > 0 {
-			position.AvgCost = totalCost / position.Quantity
-		}
-	} else {
-		// 賣出：減少持倉
-		position.Quantity -= trade.Quantity
-		if position.Quantity <= 0 {
-			delete(portfolio.Positions, trade.Symbol)
-		}
+	// 先平反向持倉，剩餘數量按成交方向開倉
+	realized := position.applyTrade(trade, selection, lotMethod)
+	if position.Quantity == 0 {
+		delete(portfolio.Positions, trade.Symbol)
 	}
 
 	// 更新市值和損益
-	if position.Quantity > 0 {
-		position.MarketValue = position.Quantity * marketQuote.Price
-		position.UnrealizedPL = position.MarketValue - (position.Quantity * position.AvgCost)
-		position.DayPL = position.Quantity * (marketQuote.Price - marketQuote.PreviousClose)
-		position.LastPrice = marketQuote.Price
-		position.LastUpdated = time.Now()
+	if position.Quantity != 0 && marketQuote != nil {
+		position.MarkToMarket(marketQuote)
 	}
 
 	// 計算總市值和損益
@@ -262,173 +445,97 @@ func (s *TradingHistoryService) updatePortfolio(trade *TradeRecord, marketQuote
 	}
 
 	portfolio.LastUpdated = time.Now()
+	return realized
+}
 
-	// 保存投資組合
-	portfolioJSON, err := json.Marshal(portfolio)
-	if err != nil {
-		return err
-	}
+// 是否為保證金賬戶
+func (p *Portfolio) IsMargin() bool {
+	return p.AccountType == AccountTypeMargin
+}
 
-	return s.redis.Set(ctx, portfolioKey, portfolioJSON, time.Hour*24*365).Err()
+// 以報價更新持倉的最新價、市值及損益；空頭持倉的數量為負，市值亦為負
+func (p *Position) MarkToMarket(quote *StockQuote) {
+	price := quote.Price
+	previousClose := quote.PreviousClose
+	p.MarketValue = p.Quantity.Mul(price)
+	p.UnrealizedPL = p.MarketValue - p.Quantity.Mul(p.AvgCost)
+	p.DayPL = p.Quantity.Mul(price - previousClose)
+	p.LastPrice = price
+	p.PreviousClose = previousClose
+	p.LastUpdated = time.Now()
 }
 
-// 更新交易統計
+// 更新交易統計：與投資組合相同，避免並發更新丟失
 func (s *TradingHistoryService) updateTradingStats(trade *TradeRecord) error {
-	ctx := context.Background()
-	statsKey := fmt.Sprintf("trading_stats:%s", trade.UserID)
-	
-	// 獲取現有統計
-	stats, err := s.getTradingStats(trade.UserID)
-	if err != nil {
-		stats = &TradingStats{
-			UserID:      trade.UserID,
-			LastUpdated: time.Now(),
-		}
-	}
+	return s.portfolios.UpdateStats(context.Background(), trade.UserID, func(stats *TradingStats) error {
+		applyTradeToStats(stats, trade)
+		return nil
+	})
+}
 
+// 將一筆交易計入交易統計
+func applyTradeToStats(stats *TradingStats, trade *TradeRecord) {
 	stats.TotalTrades++
 	stats.TotalVolume += trade.Amount
 	stats.TotalCommission += trade.Commission
-	stats.AvgTradeSize = stats.TotalVolume / float64(stats.TotalTrades)
+	stats.AvgTradeSize = stats.TotalVolume.Div(models.DecimalFromInt(int64(stats.TotalTrades)))
 
-	// 計算損益（僅對賣出交易）
-	if trade.Side == "sell" {
-		// 簡化計算：假設賣出價高於平均成本則為盈利
-		if trade.Price > trade.MarketPrice*0.95 { // 假設平均成本為市價的95%
-			profit := trade.NetAmount - (trade.Quantity * trade.MarketPrice * 0.95)
+	// 按賣出交易的已實現損益統計盈虧
+	if trade.Realized != nil {
+		stats.RealizedTrades++
+		switch pl := trade.Realized.RealizedPL; {
+		case pl > 0:
 			stats.WinningTrades++
-			stats.TotalProfit += profit
-			if profit > stats.LargestWin {
-				stats.LargestWin = profit
+			stats.TotalProfit += pl
+			if pl > stats.LargestWin {
+				stats.LargestWin = pl
 			}
-		} else {
-			loss := (trade.Quantity * trade.MarketPrice * 0.95) - trade.NetAmount
+		case pl < 0:
 			stats.LosingTrades++
-			stats.TotalLoss += loss
-			if loss > stats.LargestLoss {
-				stats.LargestLoss = loss
+			stats.TotalLoss -= pl
+			if -pl > stats.LargestLoss {
+				stats.LargestLoss = -pl
 			}
 		}
 	}
 
 	stats.NetProfit = stats.TotalProfit - stats.TotalLoss
-	if stats.TotalTrades > 0 {
-		stats.WinRate = float64(stats.WinningTrades) / float64(stats.TotalTrades) * 100
+	if stats.RealizedTrades > 0 {
+		stats.WinRate = float64(stats.WinningTrades) / float64(stats.RealizedTrades) * 100
 	}
 	stats.LastUpdated = time.Now()
-
-	// 保存統計
-	statsJSON, err := json.Marshal(stats)
-	if err != nil {
-		return err
-	}
-
-	return s.redis.Set(ctx, statsKey, statsJSON, time.Hour*24*365).Err()
 }
 
 // 獲取用戶交易歷史
 func (s *TradingHistoryService) GetUserTrades(userID string, limit int) ([]*TradeRecord, error) {
-	ctx := context.Background()
-	userTradesKey := fmt.Sprintf("user_trades:%s", userID)
-	
-	// 獲取交易ID列表
-	tradeIDs, err := s.redis.LRange(ctx, userTradesKey, 0, int64(limit-1)).Result()
-	if err != nil {
-		return nil, err
-	}
-
-	trades := make([]*TradeRecord, 0, len(tradeIDs))
-	
-	for _, tradeID := range tradeIDs {
-		tradeKey := fmt.Sprintf("trade:%s", tradeID)
-		tradeJSON, err := s.redis.Get(ctx, tradeKey).Result()
-		if err != nil {
-			continue
-		}
-
-		var trade TradeRecord
-		if err := json.Unmarshal([]byte(tradeJSON), &trade); err != nil {
-			continue
-		}
-
-		trades = append(trades, &trade)
-	}
-
-	return trades, nil
+	return s.trades.ListUserTrades(context.Background(), userID, limit)
 }
 
-// 獲取投資組合
-func (s *TradingHistoryService) getPortfolio(userID string) (*Portfolio, error) {
-	ctx := context.Background()
-	portfolioKey := fmt.Sprintf("portfolio:%s", userID)
-	
-	portfolioJSON, err := s.redis.Get(ctx, portfolioKey).Result()
-	if err != nil {
-		return nil, err
+// 創建初始投資組合
+func NewPortfolio(userID string) *Portfolio {
+	return &Portfolio{
+		UserID:      userID,
+		AccountType: AccountTypeCash,
+		Positions:   make(map[string]*Position),
+		CashBalance: InitialCashBalance, // 初始資金10萬美元
+		TotalValue:  InitialCashBalance,
+		TotalPL:     0,
+		DayPL:       0,
+		LastUpdated: time.Now(),
 	}
-
-	var portfolio Portfolio
-	if err := json.Unmarshal([]byte(portfolioJSON), &portfolio); err != nil {
-		return nil, err
-	}
-
-	return &portfolio, nil
 }
 
-// 獲取投資組合（公開方法）
+// 獲取投資組合，不存在時返回 ErrNotFound
 func (s *TradingHistoryService) GetPortfolio(userID string) (*Portfolio, error) {
-	return s.getPortfolio(userID)
-}
-
-// 獲取交易統計
-func (s *TradingHistoryService) getTradingStats(userID string) (*TradingStats, error) {
-	ctx := context.Background()
-	statsKey := fmt.Sprintf("trading_stats:%s", userID)
-	
-	statsJSON, err := s.redis.Get(ctx, statsKey).Result()
-	if err != nil {
-		return nil, err
-	}
-
-	var stats TradingStats
-	if err := json.Unmarshal([]byte(statsJSON), &stats); err != nil {
-		return nil, err
-	}
-
-	return &stats, nil
+	return s.portfolios.GetPortfolio(context.Background(), userID)
 }
 
-// 獲取交易統計（公開方法）
+// 獲取交易統計，不存在時返回 ErrNotFound
 func (s *TradingHistoryService) GetTradingStats(userID string) (*TradingStats, error) {
-	return s.getTradingStats(userID)
+	return s.portfolios.GetStats(context.Background(), userID)
 }
 
 // 獲取股票交易歷史
 func (s *TradingHistoryService) GetSymbolTrades(symbol string, limit int) ([]*TradeRecord, error) {
-	ctx := context.Background()
-	symbolTradesKey := fmt.Sprintf("symbol_trades:%s", symbol)
-	
-	tradeIDs, err := s.redis.LRange(ctx, symbolTradesKey, 0, int64(limit-1)).Result()
-	if err != nil {
-		return nil, err
-	}
-
-	trades := make([]*TradeRecord, 0, len(tradeIDs))
-	
-	for _, tradeID := range tradeIDs {
-		tradeKey := fmt.Sprintf("trade:%s", tradeID)
-		tradeJSON, err := s.redis.Get(ctx, tradeKey).Result()
-		if err != nil {
-			continue
-		}
-
-		var trade TradeRecord
-		if err := json.Unmarshal([]byte(tradeJSON), &trade); err != nil {
-			continue
-		}
-
-		trades = append(trades, &trade)
-	}
-
-	return trades, nil
-} 
\ No newline at end of file
+	return s.trades.ListSymbolTrades(context.Background(), symbol, limit)
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"trading-api/models"
+)
+
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func newTestHistoryService(store *MemoryStore) *TradingHistoryService {
+	logger := newTestLogger()
+	return NewTradingHistoryService(logger, store, store, NewLedgerService(logger, store), LotMethodFIFO)
+}
+
+func testQuote(symbol string, price int64) *StockQuote {
+	return &StockQuote{
+		Symbol:        symbol,
+		Price:         models.DecimalFromInt(price),
+		PreviousClose: models.DecimalFromInt(price),
+		Currency:      "USD",
+		IsMarketOpen:  true,
+		LastUpdated:   time.Now(),
+	}
+}
+
+// 同一賬戶的並發成交：最終現金、持倉、交易記錄、統計及賬本均須與逐筆成交金額一致
+func TestRecordTradeConcurrentSameAccount(t *testing.T) {
+	store := NewMemoryStore()
+	service := newTestHistoryService(store)
+	const userID = "concurrent_user"
+
+	opening, err := service.RecordTrade("open", userID, "AAPL", "buy", models.DecimalFromInt(100), models.DecimalFromInt(100), models.OrderTypeMarket, testQuote("AAPL", 100))
+	if err != nil {
+		t.Fatalf("建倉失敗: %v", err)
+	}
+
+	const workers = 50
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		trades []*TradeRecord
+		errs   []error
+	)
+	for i := 0; i < workers; i++ {
+		for _, side := range []string{"buy", "sell"} {
+			wg.Add(1)
+			go func(side string) {
+				defer wg.Done()
+				price := models.DecimalFromInt(100)
+				if side == "sell" {
+					price = models.DecimalFromInt(110)
+				}
+				trade, err := service.RecordTrade("order_"+side, userID, "AAPL", side, models.DecimalFromInt(1), price, models.OrderTypeMarket, testQuote("AAPL", 105))
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs = append(errs, err)
+					return
+				}
+				trades = append(trades, trade)
+			}(side)
+		}
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		t.Fatalf("並發記錄交易失敗: %v", errs)
+	}
+
+	expectedCash := InitialCashBalance - opening.NetAmount
+	for _, trade := range trades {
+		if trade.Side == "buy" {
+			expectedCash -= trade.NetAmount
+		} else {
+			expectedCash += trade.NetAmount
+		}
+	}
+
+	portfolio, err := service.GetPortfolio(userID)
+	if err != nil {
+		t.Fatalf("讀取投資組合失敗: %v", err)
+	}
+	if portfolio.CashBalance != expectedCash {
+		t.Errorf("現金 = %v, 期望 %v", portfolio.CashBalance, expectedCash)
+	}
+	position := portfolio.Positions["AAPL"]
+	if position == nil || position.Quantity != models.DecimalFromInt(100) {
+		t.Fatalf("持倉 = %+v, 期望 100 股", position)
+	}
+	var lotQuantity models.Decimal
+	for _, lot := range position.Lots {
+		lotQuantity += lot.Quantity
+	}
+	if lotQuantity != position.Quantity {
+		t.Errorf("稅批合計 %v 與持倉 %v 不一致", lotQuantity, position.Quantity)
+	}
+
+	saved, err := service.GetUserTrades(userID, 0)
+	if err != nil {
+		t.Fatalf("讀取交易記錄失敗: %v", err)
+	}
+	if len(saved) != 2*workers+1 {
+		t.Errorf("交易記錄 %d 筆, 期望 %d 筆", len(saved), 2*workers+1)
+	}
+	stats, err := service.GetTradingStats(userID)
+	if err != nil {
+		t.Fatalf("讀取交易統計失敗: %v", err)
+	}
+	if stats.TotalTrades != 2*workers+1 || stats.RealizedTrades != workers {
+		t.Errorf("統計 = %d 筆交易、%d 筆已實現, 期望 %d、%d", stats.TotalTrades, stats.RealizedTrades, 2*workers+1, workers)
+	}
+
+	reconciliation, err := service.ledger.Reconcile(context.Background(), portfolio)
+	if err != nil {
+		t.Fatalf("對賬失敗: %v", err)
+	}
+	if !reconciliation.Reconciled {
+		t.Errorf("賬本與投資組合不一致: %+v", reconciliation.Differences)
+	}
+}
+
+// 記賬及投資組合更新失敗時不保存交易記錄、統計及分錄
+func TestRecordTradeSkipsHistoryWhenPortfolioUpdateFails(t *testing.T) {
+	store := NewMemoryStore()
+	failing := &failingPortfolioStore{MemoryStore: store}
+	logger := newTestLogger()
+	service := NewTradingHistoryService(logger, store, failing, NewLedgerService(logger, store), LotMethodFIFO)
+
+	if _, err := service.RecordTrade("o1", "u1", "AAPL", "buy", models.DecimalFromInt(1), models.DecimalFromInt(100), models.OrderTypeMarket, nil); err == nil {
+		t.Fatal("投資組合更新失敗時應返回錯誤")
+	}
+	if trades, _ := service.GetUserTrades("u1", 0); len(trades) != 0 {
+		t.Errorf("不應保存交易記錄: %+v", trades)
+	}
+	if _, err := service.GetTradingStats("u1"); err != ErrNotFound {
+		t.Errorf("不應保存交易統計, err = %v", err)
+	}
+	if entries, _ := store.ListEntries(context.Background(), "u1", 0); len(entries) != 0 {
+		t.Errorf("不應過賬分錄: %+v", entries)
+	}
+}
+
+type failingPortfolioStore struct {
+	*MemoryStore
+}
+
+func (s *failingPortfolioStore) JournalPortfolio(ctx context.Context, userID string, fn func(*Portfolio) ([]*JournalEntry, error)) error {
+	return context.DeadlineExceeded
+}
+
+// 被動方記賬失敗後重試：只補記被動方，已記錄的主動方交易不重複記賬
+func TestSettleFillResumesAfterFailure(t *testing.T) {
+	store := NewMemoryStore()
+	flaky := &flakyPortfolioStore{MemoryStore: store, failing: "u2"}
+	logger := newTestLogger()
+	service := NewTradingHistoryService(logger, store, flaky, NewLedgerService(logger, store), LotMethodFIFO)
+
+	fill := Fill{
+		ID:         "f1",
+		Symbol:     "AAPL",
+		Price:      models.DecimalFromInt(100),
+		Quantity:   models.DecimalFromInt(2),
+		Taker:      FillParty{OrderID: "o1", UserID: "u1", Side: "buy", OrderType: models.OrderTypeLimit},
+		Maker:      &FillParty{OrderID: "o2", UserID: "u2", Side: "sell", OrderType: models.OrderTypeLimit},
+		ExecutedAt: time.Now(),
+	}
+	settlement := NewFillSettlement(fill, testQuote("AAPL", 100))
+	if err := service.Settle(settlement); err == nil {
+		t.Fatal("被動方記賬失敗時應返回錯誤")
+	}
+
+	flaky.failing = ""
+	if err := service.Settle(settlement); err != nil {
+		t.Fatalf("重試結算失敗: %v", err)
+	}
+	if settlement.Attempts != 2 {
+		t.Errorf("嘗試次數 = %d, 期望 2", settlement.Attempts)
+	}
+
+	for _, userID := range []string{"u1", "u2"} {
+		if trades, _ := service.GetUserTrades(userID, 0); len(trades) != 1 {
+			t.Errorf("%s 交易記錄 %d 筆, 期望 1 筆", userID, len(trades))
+		}
+	}
+	portfolio, err := store.GetPortfolio(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("讀取投資組合失敗: %v", err)
+	}
+	if position := portfolio.Positions["AAPL"]; position == nil || position.Quantity != models.DecimalFromInt(2) {
+		t.Errorf("u1 持倉 = %+v, 期望 2 股", position)
+	}
+}
+
+// 指定用戶的記賬總是失敗
+type flakyPortfolioStore struct {
+	*MemoryStore
+	failing string
+}
+
+func (s *flakyPortfolioStore) JournalPortfolio(ctx context.Context, userID string, fn func(*Portfolio) ([]*JournalEntry, error)) error {
+	if userID == s.failing {
+		return context.DeadlineExceeded
+	}
+	return s.MemoryStore.JournalPortfolio(ctx, userID, fn)
+}
@@ -253,9 +253,13 @@ const Dashboard: React.FC = () => {
   const getOrderStatusTag = (status: string) => {
     const statusConfig = {
       filled: { color: 'success', text: '已成交' },
+      new: { color: 'processing', text: '待執行' },
       pending: { color: 'processing', text: '待執行' },
+      partially_filled: { color: 'warning', text: '部分成交' },
+      held: { color: 'default', text: '等待觸發' },
       cancelled: { color: 'default', text: '已取消' },
       rejected: { color: 'error', text: '已拒絕' },
+      expired: { color: 'default', text: '已過期' },
     };
     const config = statusConfig[status.toLowerCase() as keyof typeof statusConfig] || { color: 'default', text: status };
     return <Tag color={config.color}>{config.text}</Tag>;
@@ -200,7 +200,7 @@ const Trading: React.FC = () => {
           price: 175.00,
           filled_qty: 0,
           remaining_qty: 100,
-          status: 'pending',
+          status: 'new',
           created_at: '2023-12-01T09:30:15Z',
         },
         {
@@ -213,7 +213,7 @@ const Trading: React.FC = () => {
           price: 2500.00,
           filled_qty: 0,
           remaining_qty: 50,
-          status: 'pending',
+          status: 'new',
           created_at: '2023-12-01T10:15:30Z',
         }
       ]);
@@ -380,6 +380,9 @@ const Trading: React.FC = () => {
           limit: '限價',
           market: '市價',
           stop: '止損',
+          stop_limit: '止損限價',
+          trailing_stop: '追蹤止損',
+          market_if_touched: '觸價',
         };
         return <Tag>{typeMap[type as keyof typeof typeMap] || type}</Tag>;
       },
@@ -416,10 +419,13 @@ const Trading: React.FC = () => {
       render: (status: string) => {
         const statusConfig = {
           filled: { color: 'success', text: '已成交' },
+          new: { color: 'processing', text: '待執行' },
           pending: { color: 'processing', text: '待執行' },
-          partial: { color: 'warning', text: '部分成交' },
+          partially_filled: { color: 'warning', text: '部分成交' },
+          held: { color: 'default', text: '等待觸發' },
           cancelled: { color: 'default', text: '已取消' },
           rejected: { color: 'error', text: '已拒絕' },
+          expired: { color: 'default', text: '已過期' },
         };
         const config = statusConfig[status as keyof typeof statusConfig] || { color: 'default', text: status };
         return <Badge status={config.color as any} text={config.text} />;
@@ -440,7 +446,7 @@ const Trading: React.FC = () => {
       key: 'action',
       render: (record: any) => (
         <Space>
-          {record.status === 'pending' && (
+          {['new', 'partially_filled'].includes(record.status) && (
             <>
               <Button 
                 size="small" 
@@ -650,7 +656,7 @@ const Trading: React.FC = () => {
           <Card>
             <Statistic
               title="活躍訂單"
-              value={orders.filter(o => o.status === 'pending').length}
+              value={orders.filter(o => ['new', 'partially_filled'].includes(o.status)).length}
               prefix={<ClockCircleOutlined />}
               valueStyle={{ color: '#fa8c16' }}
             />
@@ -853,7 +859,7 @@ const Trading: React.FC = () => {
               <Option value="GTC">GTC</Option>
               <Option value="IOC">IOC</Option>
               <Option value="FOK">FOK</Option>
-              <Option value="GTT">GTT</Option>
+              <Option value="DAY">DAY</Option>
             </Select>
           </Form.Item>
 